@@ -26,6 +26,7 @@ type serverConfig struct {
 	Update        *AppUpdate      `json:"update"`
 	NeedsRestart  bool            `json:"needs_restart"`
 	HasLegacyUser bool            `json:"has_legacy_user"`
+	Approval      bool            `json:"campaign_approval"`
 	Version       string          `json:"version"`
 }
 
@@ -37,6 +38,7 @@ func (a *App) GetServerConfig(c echo.Context) error {
 		Lang:          a.cfg.Lang,
 		Permissions:   a.cfg.PermissionsRaw,
 		HasLegacyUser: a.cfg.HasLegacyUser,
+		Approval:      a.cfg.CampaignApproval,
 	}
 	out.PublicSubscription.Enabled = a.cfg.EnablePublicSubPage
 	if a.cfg.Security.EnableCaptcha {
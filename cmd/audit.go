@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	// Context keys of the before and after summaries of a change that handlers
+	// attach to a request's audit log entry.
+	auditBeforeCtxKey = "audit_before"
+	auditAfterCtxKey  = "audit_after"
+)
+
+// Non-GET API endpoints that don't change anything and aren't recorded in the audit log.
+var auditSkipRoutes = map[string]bool{
+	"/api/campaigns/:id/preview":         true,
+	"/api/campaigns/:id/preview/archive": true,
+	"/api/campaigns/:id/content":         true,
+	"/api/campaigns/:id/text":            true,
+	"/api/templates/preview":             true,
+	"/api/segments/preview":              true,
+	"/api/settings/smtp/test":            true,
+
+	// Transactional messages are high volume and aren't changes.
+	"/api/tx": true,
+}
+
+// GetAuditLog handles the retrieval of audit log entries.
+func (a *App) GetAuditLog(c echo.Context) error {
+	var (
+		userID, _ = strconv.Atoi(c.QueryParam("user_id"))
+		entType   = strings.TrimSpace(c.QueryParam("entity_type"))
+		entID     = strings.TrimSpace(c.QueryParam("entity_id"))
+		action    = strings.TrimSpace(c.QueryParam("action"))
+
+		pg = a.pg.NewFromURL(c.Request().URL.Query())
+	)
+
+	// Optional time range.
+	var from, to null.Time
+	if s := c.QueryParam("from"); s != "" {
+		t, err := parseAuditTime(s)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "from"))
+		}
+		from = null.TimeFrom(t)
+	}
+	if s := c.QueryParam("to"); s != "" {
+		t, err := parseAuditTime(s)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "to"))
+		}
+		to = null.TimeFrom(t)
+	}
+
+	res, total, err := a.core.QueryAuditLog(userID, entType, entID, action, from, to, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}})
+}
+
+// auditLog is a middleware that records successful mutating (non-GET) API calls in the
+// audit log along with the user who made them and the before and after summaries of the
+// change that the handlers attach with setAudit().
+func (a *App) auditLog(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+
+		if err := next(c); err != nil {
+			return err
+		}
+
+		route := c.Path()
+		if !strings.HasPrefix(route, "/api/") || auditSkipRoutes[route] {
+			return nil
+		}
+
+		l := models.AuditLog{
+			IP:         c.RealIP(),
+			Method:     c.Request().Method,
+			Path:       route,
+			Action:     auditAction(c.Request().Method, route),
+			EntityType: strings.Split(strings.TrimPrefix(route, "/api/"), "/")[0],
+			EntityID:   c.Param("id"),
+			Status:     c.Response().Status,
+			Before:     auditJSON(c.Get(auditBeforeCtxKey)),
+			After:      auditJSON(c.Get(auditAfterCtxKey)),
+		}
+		if u, ok := c.Get(auth.UserHTTPCtxKey).(auth.User); ok {
+			l.UserID = null.IntFrom(u.ID)
+			l.Username = u.Username
+		}
+
+		// Routes with other params, eg: /api/maintenance/subscribers/:type.
+		if l.EntityID == "" && len(c.ParamNames()) > 0 {
+			l.EntityID = c.Param(c.ParamNames()[0])
+		}
+
+		// Bulk calls without summaries have their targets in the query string, eg: ?id=1&id=2.
+		if l.After == nil && len(c.QueryParams()) > 0 {
+			l.After = auditJSON(c.QueryParams())
+		}
+
+		a.core.AddAuditLog(l)
+		return nil
+	}
+}
+
+// setAudit attaches the before and after summaries of the change made by a request
+// to its audit log entry. Either can be nil.
+func setAudit(c echo.Context, before, after any) {
+	if before != nil {
+		c.Set(auditBeforeCtxKey, before)
+	}
+	if after != nil {
+		c.Set(auditAfterCtxKey, after)
+	}
+}
+
+// auditAction returns the name of the action of an API route, which is its static
+// path segments joined by dots, eg: PUT /api/subscribers/:id/blocklist = subscribers.blocklist.
+// Routes that are just an entity get the verb of the method, eg: DELETE /api/subscribers/:id
+// = subscribers.delete.
+func auditAction(method, route string) string {
+	parts := []string{}
+	for _, p := range strings.Split(strings.TrimPrefix(route, "/api/"), "/") {
+		if p != "" && !strings.HasPrefix(p, ":") {
+			parts = append(parts, p)
+		}
+	}
+
+	if len(parts) == 1 {
+		switch method {
+		case http.MethodPost:
+			parts = append(parts, "create")
+		case http.MethodPut:
+			parts = append(parts, "update")
+		case http.MethodDelete:
+			parts = append(parts, "delete")
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// auditUser returns the audit summary of a user, without the password or the API token.
+func auditUser(u auth.User) map[string]any {
+	return map[string]any{
+		"username":       u.Username,
+		"email":          u.Email,
+		"name":           u.Name,
+		"type":           u.Type,
+		"status":         u.Status,
+		"password_login": u.PasswordLogin,
+		"user_role_id":   u.UserRoleID,
+		"list_role_id":   u.ListRoleID,
+	}
+}
+
+// auditAPIToken returns the audit summary of a scoped API token, without the token.
+func auditAPIToken(u auth.User, t auth.APIToken) map[string]any {
+	return map[string]any{
+		"username":     u.Username,
+		"name":         t.Name,
+		"token_prefix": t.Prefix,
+		"permissions":  t.Permissions,
+		"list_ids":     t.ListIDs,
+		"expires_at":   t.ExpiresAt,
+	}
+}
+
+// auditJSON marshals an audit summary. It returns nil if there's no summary.
+func auditJSON(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	return b
+}
+
+// changedSettings returns the sorted keys of the settings that differ between a and b.
+func changedSettings(a, b models.Settings) []string {
+	var ma, mb map[string]json.RawMessage
+	if ba, err := json.Marshal(a); err == nil {
+		_ = json.Unmarshal(ba, &ma)
+	}
+	if bb, err := json.Marshal(b); err == nil {
+		_ = json.Unmarshal(bb, &mb)
+	}
+
+	out := []string{}
+	for k, v := range mb {
+		if !bytes.Equal(ma[k], v) {
+			out = append(out, k)
+		}
+	}
+	slices.Sort(out)
+
+	return out
+}
+
+// parseAuditTime parses a timestamp (RFC3339) or a date (YYYY-MM-DD).
+func parseAuditTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse("2006-01-02", s)
+}
+
+// pruneAuditLog periodically deletes audit log entries older than the given days.
+func (a *App) pruneAuditLog(interval time.Duration, days int) {
+	if days < 1 {
+		return
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for range t.C {
+		n, err := a.core.DeleteAuditLog(time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			continue
+		}
+		if n > 0 {
+			a.log.Printf("deleted %d audit log entries older than %d days", n, days)
+		}
+	}
+}
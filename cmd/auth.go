@@ -3,9 +3,7 @@ package main
 import (
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"net/http"
-	"net/mail"
 	"net/url"
 	"strings"
 	"time"
@@ -26,6 +24,7 @@ type loginTpl struct {
 	PasswordEnabled  bool
 	OIDCProvider     string
 	OIDCProviderLogo string
+	SAMLProvider     string
 	Error            string
 }
 
@@ -55,8 +54,14 @@ func (a *App) LoginPage(c echo.Context) error {
 	// Process POST login request.
 	var loginErr error
 	if c.Request().Method == http.MethodPost {
-		loginErr = a.doLogin(c)
+		var needsTOTP bool
+		needsTOTP, loginErr = a.doLogin(c)
 		if loginErr == nil {
+			// Continue to two-factor authentication.
+			if needsTOTP {
+				return c.Redirect(http.StatusFound, totpLoginURI(utils.SanitizeURI(c.FormValue("next"))))
+			}
+
 			return c.Redirect(http.StatusFound, utils.SanitizeURI(c.FormValue("next")))
 		}
 	}
@@ -148,19 +153,22 @@ func (a *App) OIDCFinish(c echo.Context) error {
 		return a.renderLoginPage(c, echo.NewHTTPError(http.StatusUnauthorized, a.i18n.T("users.invalidRequest")))
 	}
 
-	// Validate e-mail from the claim.
-	email := strings.TrimSpace(claims.Email)
-	if email == "" {
-		return a.renderLoginPage(c, errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "email")))
-	}
-	em, err := mail.ParseAddress(email)
-	if err != nil {
-		return a.renderLoginPage(c, err)
+	// The e-mail is what the user is matched to an account by. Only trust it
+	// if the provider has verified it.
+	if !claims.EmailVerified {
+		a.log.Printf("OIDC login with unverified e-mail %s rejected", claims.Email)
+		return a.renderLoginPage(c, echo.NewHTTPError(http.StatusForbidden, a.i18n.T("users.ssoEmailNotVerified")))
 	}
-	email = strings.ToLower(em.Address)
 
-	// Get the user by e-mail received from OIDC.
-	user, err := a.core.GetUser(0, "", email)
+	// Get the user by e-mail received from OIDC, creating it and syncing its roles
+	// from the claims as configured.
+	cfg := a.cfg.Security.OIDC
+	user, err := a.getSSOUser(c, ssoUser{Email: claims.Email, Name: claims.Name, Claims: claims.Claims}, ssoOptions{
+		AutoCreate:        cfg.AutoCreateUsers,
+		DefaultUserRoleID: cfg.DefaultUserRoleID,
+		GroupsClaim:       oidcGroupsClaim,
+		RoleMappings:      cfg.RoleMappings,
+	})
 	if err != nil {
 		return a.renderLoginPage(c, err)
 	}
@@ -171,10 +179,16 @@ func (a *App) OIDCFinish(c echo.Context) error {
 	}
 
 	// Set the session in the DB and cookie.
-	if err := a.auth.SaveSession(user, oidcToken, c); err != nil {
+	needsTOTP, err := a.saveLoginSession(user, oidcToken, c)
+	if err != nil {
 		return a.renderLoginPage(c, err)
 	}
 
+	// Continue to two-factor authentication.
+	if needsTOTP {
+		return c.Redirect(http.StatusFound, totpLoginURI(utils.SanitizeURI(state.Next)))
+	}
+
 	// Redirect to the next page.
 	return c.Redirect(http.StatusFound, utils.SanitizeURI(state.Next))
 }
@@ -225,6 +239,12 @@ func (a *App) renderLoginPage(c echo.Context, loginErr error) error {
 		OIDCProviderLogo: oidcLogo,
 		NextURI:          next,
 	}
+	if a.auth.SAMLEnabled() {
+		out.SAMLProvider = a.cfg.Security.SAML.ProviderName
+		if out.SAMLProvider == "" {
+			out.SAMLProvider = "SAML"
+		}
+	}
 
 	// If there was an error in the previous state (POST reqest), set it to render in the template.
 	if loginErr != nil {
@@ -279,25 +299,34 @@ func (a *App) renderLoginSetupPage(c echo.Context, loginErr error) error {
 	return c.Render(http.StatusOK, "admin-login-setup", out)
 }
 
-// doLogin logs a user in with a username and password.
-func (a *App) doLogin(c echo.Context) error {
+// doLogin logs a user in with a username and password. It returns true if the user
+// has to complete two-factor authentication.
+func (a *App) doLogin(c echo.Context) (bool, error) {
 	var (
 		username = strings.TrimSpace(c.FormValue("username"))
 		password = strings.TrimSpace(c.FormValue("password"))
 	)
 
 	if !strHasLen(username, 3, stdInputMaxLen) {
-		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "username"))
+		return false, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "username"))
 	}
 	if !strHasLen(password, 8, stdInputMaxLen) {
-		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "password"))
+		return false, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "password"))
+	}
+
+	// Reject attempts for locked out usernames and IPs without checking the credentials.
+	ip := c.RealIP()
+	if a.auth.IsLockedOut(username, ip) {
+		return false, echo.NewHTTPError(http.StatusTooManyRequests, a.i18n.T("users.loginLocked"))
 	}
 
 	// Log the user in by fetching and verifying credentials from the DB.
 	user, err := a.core.LoginUser(username, password)
 	if err != nil {
-		return err
+		a.auth.LoginFailed(username, ip)
+		return false, err
 	}
+	a.auth.LoginSucceeded(username)
 
 	// Resist potential constant-time-comparison attacks with a min response time.
 	if ms := time.Since(time.Now()).Milliseconds(); ms < 100 {
@@ -305,11 +334,7 @@ func (a *App) doLogin(c echo.Context) error {
 	}
 
 	// Set the session in the DB and cookie.
-	if err := a.auth.SaveSession(user, "", c); err != nil {
-		return err
-	}
-
-	return nil
+	return a.saveLoginSession(user, "", c)
 }
 
 // doFirstTimeSetup sets a user up for the first time.
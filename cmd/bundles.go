@@ -0,0 +1,470 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	// campBundleVersion is the version of the campaign bundle format.
+	campBundleVersion = 1
+
+	// campBundleFile is the name of the JSON manifest in a campaign bundle (zip).
+	// Media files are stored under campBundleMediaDir.
+	campBundleFile     = "campaign.json"
+	campBundleMediaDir = "media/"
+
+	// Max size of a campaign bundle and of a single file in it.
+	campBundleMaxSize = 100 * 1024 * 1024
+)
+
+// campBundle is a portable export of a campaign that can be imported into
+// another instance. Lists and segments are referenced by name, templates are carried
+// whole and mapped by name on import, and media files are carried in the zip.
+type campBundle struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Campaign   models.Campaign `json:"campaign"`
+
+	Template        *models.Template `json:"template"`
+	ArchiveTemplate *models.Template `json:"archive_template"`
+
+	Lists    []string          `json:"lists"`
+	Segments []string          `json:"segments"`
+	Media    []campBundleMedia `json:"media"`
+}
+
+// campBundleMedia is a media file (attachment) in a campaign bundle.
+type campBundleMedia struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+
+	// URL of the file on the exporting instance. References to it in the
+	// campaign's content are replaced with the URL of the imported file.
+	URL string `json:"url"`
+
+	// Path of the file in the bundle.
+	File string `json:"file"`
+}
+
+// ExportCampaign exports a campaign along with its templates, media, and list
+// references as a zip bundle that can be imported into another instance.
+func (a *App) ExportCampaign(c echo.Context) error {
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeGet, id, c); err != nil {
+		return err
+	}
+
+	cm, err := a.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	out := campBundle{
+		Version:    campBundleVersion,
+		ExportedAt: time.Now(),
+		Campaign:   cm,
+		Lists:      []string{},
+		Segments:   []string{},
+		Media:      []campBundleMedia{},
+	}
+
+	// Lists are referenced by name as IDs differ across instances.
+	var lists []struct {
+		Name string `json:"name"`
+	}
+	if err := cm.Lists.Unmarshal(&lists); err != nil {
+		a.log.Printf("error reading campaign lists: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			a.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.lists}", "error", err.Error()))
+	}
+	for _, l := range lists {
+		out.Lists = append(out.Lists, l.Name)
+	}
+
+	// Segments are referenced by name too.
+	if len(cm.SegmentIDs) > 0 {
+		segs, err := a.core.GetSegments()
+		if err != nil {
+			return err
+		}
+		for _, s := range segs {
+			if slices.Contains(cm.SegmentIDs, int64(s.ID)) {
+				out.Segments = append(out.Segments, s.Name)
+			}
+		}
+	}
+
+	// Templates.
+	if cm.TemplateID.Valid {
+		tpl, err := a.core.GetTemplate(cm.TemplateID.Int, false)
+		if err != nil {
+			return err
+		}
+		out.Template = &tpl
+	}
+	if cm.ArchiveTemplateID.Valid {
+		tpl, err := a.core.GetTemplate(cm.ArchiveTemplateID.Int, false)
+		if err != nil {
+			return err
+		}
+		out.ArchiveTemplate = &tpl
+	}
+
+	var (
+		buf bytes.Buffer
+		zw  = zip.NewWriter(&buf)
+	)
+
+	// Media (attachments).
+	for _, mID := range getJSONIDs(cm.Media) {
+		m, err := a.core.GetMedia(mID, "", "", a.media)
+		if err != nil {
+			return err
+		}
+
+		b, err := a.media.GetBlob(m.URL)
+		if err != nil {
+			a.log.Printf("error reading media %s: %v", m.Filename, err)
+			return echo.NewHTTPError(http.StatusInternalServerError,
+				a.i18n.Ts("media.errorReadingFile", "error", err.Error()))
+		}
+
+		bm := campBundleMedia{
+			Filename:    m.Filename,
+			ContentType: m.ContentType,
+			URL:         m.URL,
+			File:        campBundleMediaDir + m.Filename,
+		}
+		if err := writeZipFile(zw, bm.File, b); err != nil {
+			return a.bundleError(err)
+		}
+		out.Media = append(out.Media, bm)
+	}
+
+	// Manifest.
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return a.bundleError(err)
+	}
+	if err := writeZipFile(zw, campBundleFile, b); err != nil {
+		return a.bundleError(err)
+	}
+	if err := zw.Close(); err != nil {
+		return a.bundleError(err)
+	}
+
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="campaign-%d.zip"`, cm.ID))
+	return c.Blob(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// ImportCampaign creates a draft campaign from an exported campaign bundle (zip).
+// Lists and templates are mapped by name. Templates that don't exist are created
+// and media files are uploaded to the configured media store.
+func (a *App) ImportCampaign(c echo.Context) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("media.invalidFile", "error", err.Error()))
+	}
+	if file.Size > campBundleMaxSize {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("campaigns.bundleInvalid", "error", "file is too big"))
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			a.i18n.Ts("media.errorReadingFile", "error", err.Error()))
+	}
+	defer src.Close()
+
+	zr, err := zip.NewReader(src, file.Size)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("campaigns.bundleInvalid", "error", err.Error()))
+	}
+
+	// Read the manifest.
+	var b campBundle
+	if raw, err := readZipFile(zr, campBundleFile); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("campaigns.bundleInvalid", "error", err.Error()))
+	} else if err := json.Unmarshal(raw, &b); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("campaigns.bundleInvalid", "error", err.Error()))
+	}
+	if b.Version != campBundleVersion {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("campaigns.bundleVersion", "version", fmt.Sprintf("%d", b.Version)))
+	}
+
+	user := auth.GetUser(c)
+
+	// Map lists by name to the lists the user has access to.
+	listIDs, err := a.getBundleListIDs(user, b.Lists)
+	if err != nil {
+		return err
+	}
+
+	// Map segments by name.
+	segIDs, err := a.getBundleSegmentIDs(b.Segments)
+	if err != nil {
+		return err
+	}
+
+	// Anything created on the way is removed if the import fails.
+	var (
+		tplIDs   []int
+		mediaIDs []int
+		ok       = false
+	)
+	defer func() {
+		if ok {
+			return
+		}
+		for _, id := range mediaIDs {
+			if fname, err := a.core.DeleteMedia(id); err == nil {
+				a.media.Delete(fname)
+				a.media.Delete(thumbPrefix + fname)
+			}
+		}
+		for _, id := range tplIDs {
+			a.core.DeleteTemplate(id)
+		}
+	}()
+
+	// Map the templates by name, creating the ones that don't exist.
+	o := campReq{Campaign: b.Campaign, ListIDs: listIDs, MediaIDs: []int{}}
+	o.SegmentIDs = segIDs
+	o.TemplateID, err = a.getBundleTemplateID(user, b.Template, &tplIDs)
+	if err != nil {
+		return err
+	}
+	o.ArchiveTemplateID, err = a.getBundleTemplateID(user, b.ArchiveTemplate, &tplIDs)
+	if err != nil {
+		return err
+	}
+
+	// Upload the media files and point the content to their new URLs.
+	if len(b.Media) > 0 && !user.HasPerm(auth.PermMediaManage) {
+		return echo.NewHTTPError(http.StatusForbidden,
+			a.i18n.Ts("globals.messages.permissionDenied", "name", auth.PermMediaManage))
+	}
+	urls := []string{}
+	for _, bm := range b.Media {
+		raw, err := readZipFile(zr, bm.File)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				a.i18n.Ts("campaigns.bundleInvalid", "error", err.Error()))
+		}
+
+		m, err := a.storeMedia(bm.Filename, bm.ContentType, bytes.NewReader(raw))
+		if err != nil {
+			return err
+		}
+		mediaIDs = append(mediaIDs, m.ID)
+		o.MediaIDs = append(o.MediaIDs, m.ID)
+
+		if bm.URL != "" {
+			urls = append(urls, bm.URL, m.URL)
+		}
+	}
+	if len(urls) > 0 {
+		r := strings.NewReplacer(urls...)
+		o.Body = r.Replace(o.Body)
+		if o.AltBody.Valid {
+			o.AltBody.String = r.Replace(o.AltBody.String)
+		}
+		if o.BodySource.Valid {
+			o.BodySource.String = r.Replace(o.BodySource.String)
+		}
+	}
+
+	// The imported campaign always starts off as an unscheduled draft.
+	o.SendAt = null.Time{}
+	o.Status = models.CampaignStatusDraft
+	if o.Type == "" {
+		o.Type = models.CampaignTypeRegular
+	}
+	if o.Messenger == "" {
+		o.Messenger = "email"
+	}
+
+	if v, err := a.validateCampaignFields(o); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else {
+		o = v
+	}
+
+	out, err := a.core.CreateCampaign(o.Campaign, o.ListIDs, o.MediaIDs)
+	if err != nil {
+		return err
+	}
+	ok = true
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// getBundleListIDs returns the IDs of the lists with the given names that the user
+// has access to. All the lists should exist.
+func (a *App) getBundleListIDs(user auth.User, names []string) ([]int, error) {
+	hasAllPerm, permittedIDs := user.GetPermittedLists(auth.PermTypeGet | auth.PermTypeManage)
+
+	lists, err := a.core.GetLists("", hasAllPerm, permittedIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int, len(lists))
+	for _, l := range lists {
+		ids[l.Name] = l.ID
+	}
+
+	var (
+		out     = make([]int, 0, len(names))
+		missing []string
+	)
+	for _, n := range names {
+		id, ok := ids[n]
+		if !ok {
+			missing = append(missing, n)
+			continue
+		}
+		out = append(out, id)
+	}
+	if len(missing) > 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("campaigns.bundleListsNotFound", "names", strings.Join(missing, ", ")))
+	}
+
+	return out, nil
+}
+
+// getBundleSegmentIDs returns the IDs of the segments with the given names.
+// All the segments should exist.
+func (a *App) getBundleSegmentIDs(names []string) (pq.Int64Array, error) {
+	out := pq.Int64Array{}
+	if len(names) == 0 {
+		return out, nil
+	}
+
+	segs, err := a.core.GetSegments()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int, len(segs))
+	for _, s := range segs {
+		ids[s.Name] = s.ID
+	}
+
+	var missing []string
+	for _, n := range names {
+		id, ok := ids[n]
+		if !ok {
+			missing = append(missing, n)
+			continue
+		}
+		out = append(out, int64(id))
+	}
+	if len(missing) > 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest,
+			a.i18n.Ts("campaigns.bundleSegmentsNotFound", "names", strings.Join(missing, ", ")))
+	}
+
+	return out, nil
+}
+
+// getBundleTemplateID returns the ID of the template with the same name and type
+// as the bundled template. If there's none, the template is created and its ID
+// appended to created.
+func (a *App) getBundleTemplateID(user auth.User, tpl *models.Template, created *[]int) (null.Int, error) {
+	if tpl == nil {
+		return null.Int{}, nil
+	}
+
+	tpls, err := a.core.GetTemplates(tpl.Type, true)
+	if err != nil {
+		return null.Int{}, err
+	}
+	for _, t := range tpls {
+		if t.Name == tpl.Name {
+			return null.IntFrom(t.ID), nil
+		}
+	}
+
+	// Create the template.
+	if !user.HasPerm(auth.PermTemplatesManage) {
+		return null.Int{}, echo.NewHTTPError(http.StatusForbidden,
+			a.i18n.Ts("globals.messages.permissionDenied", "name", auth.PermTemplatesManage))
+	}
+	if err := a.validateTemplate(*tpl); err != nil {
+		return null.Int{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	out, err := a.core.CreateTemplate(tpl.Name, tpl.Type, tpl.Subject, []byte(tpl.Body), tpl.BodySource)
+	if err != nil {
+		return null.Int{}, err
+	}
+	*created = append(*created, out.ID)
+
+	return null.IntFrom(out.ID), nil
+}
+
+// bundleError logs and returns an error in creating a campaign bundle.
+func (a *App) bundleError(err error) error {
+	a.log.Printf("error creating campaign bundle: %v", err)
+	return echo.NewHTTPError(http.StatusInternalServerError,
+		a.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.campaign}", "error", err.Error()))
+}
+
+// writeZipFile writes a file to a zip.
+func writeZipFile(zw *zip.Writer, name string, b []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// readZipFile reads a file from a zip.
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	name = path.Clean(name)
+	for _, f := range zr.File {
+		if path.Clean(f.Name) != name {
+			continue
+		}
+		if f.UncompressedSize64 > campBundleMaxSize {
+			return nil, fmt.Errorf("%s is too big", name)
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		return io.ReadAll(io.LimitReader(r, campBundleMaxSize))
+	}
+
+	return nil, fmt.Errorf("%s not found", name)
+}
@@ -9,11 +9,15 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gdgvda/cron"
+	"github.com/jmoiron/sqlx/types"
 	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/internal/manager"
 	"github.com/knadh/listmonk/internal/notifs"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
@@ -312,6 +316,9 @@ func (a *App) UpdateCampaign(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.cantUpdate"))
 	}
 
+	// Fingerprint the content subject to approval before it's overwritten.
+	content := campaignContent(cm, getJSONIDs(cm.Lists), getJSONIDs(cm.Media))
+
 	// Read the incoming params into the existing campaign fields from the DB.
 	// This allows updating of values that have been sent whereas fields
 	// that are not in the request retain the old values.
@@ -320,17 +327,37 @@ func (a *App) UpdateCampaign(c echo.Context) error {
 		return err
 	}
 
+	return a.updateCampaign(c, cm, content, o)
+}
+
+// updateCampaign validates and saves the changes (o) to a campaign (cm). content
+// is the fingerprint of the campaign's content before the changes.
+func (a *App) updateCampaign(c echo.Context, cm models.Campaign, content string, o campReq) error {
+	id := cm.ID
 	if c, err := a.validateCampaignFields(o); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	} else {
 		o = c
 	}
 
-	out, err := a.core.UpdateCampaign(id, o.Campaign, o.ListIDs, o.MediaIDs)
+	// Editing the content of a campaign that's pending approval or has been
+	// approved invalidates the approval and reverts it to a draft.
+	invalidate := isCampaignApproved(cm.Status, a.cfg.CampaignApproval) &&
+		campaignContent(o.Campaign, o.ListIDs, o.MediaIDs) != content
+
+	out, err := a.core.UpdateCampaign(id, o.Campaign, o.ListIDs, o.MediaIDs, auth.GetUser(c).ID)
 	if err != nil {
 		return err
 	}
 
+	if invalidate {
+		if err := a.resetCampaignApproval(c, cm); err != nil {
+			return err
+		}
+
+		out.Status = models.CampaignStatusDraft
+	}
+
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
@@ -340,23 +367,62 @@ func (a *App) UpdateCampaignStatus(c echo.Context) error {
 	id := getID(c)
 
 	// Check if the user has access to the campaign.
-	if err := a.checkCampaignPerm(auth.PermTypeManage, id, c); err != nil {
+	if err := a.checkCampaignPerm(auth.PermTypeGet, id, c); err != nil {
 		return err
 	}
 
 	req := struct {
 		Status string `json:"status"`
+		Note   string `json:"note"`
 	}{}
 	if err := c.Bind(&req); err != nil {
 		return err
 	}
 
+	cm, err := a.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	// Approving or rejecting a campaign requires the approve permission. Every
+	// other change, including the requester withdrawing the request, requires
+	// manage access to the campaign.
+	user := auth.GetUser(c)
+	action, err := a.getApprovalAction(cm, req.Status, user)
+	if err != nil {
+		return err
+	}
+	if action == models.ApprovalActionApproved || action == models.ApprovalActionRejected {
+		if !user.HasPerm(auth.PermCampaignsApprove) {
+			return echo.NewHTTPError(http.StatusForbidden,
+				a.i18n.Ts("globals.messages.permissionDenied", "name", auth.PermCampaignsApprove))
+		}
+	} else if err := a.checkCampaignPerm(auth.PermTypeManage, id, c); err != nil {
+		return err
+	}
+
+	// If approvals are required, drafts can't be started or scheduled directly.
+	if a.cfg.CampaignApproval && cm.Status == models.CampaignStatusDraft &&
+		(req.Status == models.CampaignStatusScheduled || req.Status == models.CampaignStatusRunning) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.needsApproval"))
+	}
+
 	// Update the campaign status in the DB.
 	out, err := a.core.UpdateCampaignStatus(id, req.Status)
 	if err != nil {
 		return err
 	}
 
+	setAudit(c, map[string]any{"name": cm.Name, "status": cm.Status}, map[string]any{"name": out.Name, "status": out.Status})
+
+	// Record the change in the campaign's approval history and notify the other party.
+	if action != "" {
+		if err := a.core.AddCampaignApproval(id, user.ID, action, req.Note); err != nil {
+			return err
+		}
+		a.notifyCampaignApproval(out, action, user, req.Note)
+	}
+
 	// If the campaign is being stopped, send the signal to the manager to stop it in flight.
 	if req.Status == models.CampaignStatusPaused || req.Status == models.CampaignStatusCancelled {
 		a.manager.StopCampaign(id)
@@ -365,6 +431,23 @@ func (a *App) UpdateCampaignStatus(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// GetCampaignApprovals returns the approval history of a campaign.
+func (a *App) GetCampaignApprovals(c echo.Context) error {
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeGet, id, c); err != nil {
+		return err
+	}
+
+	out, err := a.core.GetCampaignApprovals(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
 // UpdateCampaignArchive handles campaign status modification.
 func (a *App) UpdateCampaignArchive(c echo.Context) error {
 	id := getID(c)
@@ -548,6 +631,16 @@ func (a *App) GetCampaignViewAnalytics(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("analytics.invalidDates"))
 	}
 
+	// Per-variant stats of A/B tested campaigns.
+	if typ == "variants" {
+		out, err := a.core.GetCampaignAnalyticsVariants(ids, from, to)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, okResp{out})
+	}
+
 	// Campaign link stats.
 	if typ == "links" {
 		out, err := a.core.GetCampaignAnalyticsLinks(ids, typ, from, to)
@@ -567,6 +660,137 @@ func (a *App) GetCampaignViewAnalytics(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// GetCampaignVariants retrieves the A/B test variants of a campaign.
+func (a *App) GetCampaignVariants(c echo.Context) error {
+	// Get the campaign ID.
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeGet, id, c); err != nil {
+		return err
+	}
+
+	out, err := a.core.GetCampaignVariants(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateCampaignVariant handles the creation of an A/B test variant on a campaign.
+func (a *App) CreateCampaignVariant(c echo.Context) error {
+	// Get the campaign ID.
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeManage, id, c); err != nil {
+		return err
+	}
+
+	var o models.CampaignVariant
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	// Validate.
+	cm, err := a.validateCampaignVariant(id, 0, o)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.CreateCampaignVariant(id, o)
+	if err != nil {
+		return err
+	}
+
+	// Variants are a part of the content subject to approval.
+	if err := a.resetCampaignApproval(c, cm); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateCampaignVariant handles the modification of an A/B test variant of a campaign.
+func (a *App) UpdateCampaignVariant(c echo.Context) error {
+	// Get the campaign ID.
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeManage, id, c); err != nil {
+		return err
+	}
+
+	varID, _ := strconv.Atoi(c.Param("variantID"))
+	if varID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidID"))
+	}
+
+	// Read the incoming params into the existing variant fields from the DB.
+	v, err := a.core.GetCampaignVariant(id, varID)
+	if err != nil {
+		return err
+	}
+	if err := c.Bind(&v); err != nil {
+		return err
+	}
+
+	// Validate.
+	cm, err := a.validateCampaignVariant(id, varID, v)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.UpdateCampaignVariant(id, varID, v)
+	if err != nil {
+		return err
+	}
+
+	// Variants are a part of the content subject to approval.
+	if err := a.resetCampaignApproval(c, cm); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteCampaignVariant handles the deletion of an A/B test variant of a campaign.
+func (a *App) DeleteCampaignVariant(c echo.Context) error {
+	// Get the campaign ID.
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeManage, id, c); err != nil {
+		return err
+	}
+
+	varID, _ := strconv.Atoi(c.Param("variantID"))
+	if varID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidID"))
+	}
+
+	// Variants can't be changed once the test has started.
+	cm, err := a.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+	if !canEditCampaign(cm.Status) || cm.ABStatus.Valid {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.cantUpdateVariants"))
+	}
+
+	if err := a.core.DeleteCampaignVariant(id, varID); err != nil {
+		return err
+	}
+
+	// Variants are a part of the content subject to approval.
+	if err := a.resetCampaignApproval(c, cm); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
 // sendTestMessage takes a campaign and a subscriber and sends out a sample campaign message.
 func (a *App) sendTestMessage(sub models.Subscriber, camp *models.Campaign) error {
 	if err := camp.CompileTemplate(a.manager.TemplateFuncs(camp)); err != nil {
@@ -585,6 +809,51 @@ func (a *App) sendTestMessage(sub models.Subscriber, camp *models.Campaign) erro
 	return a.manager.PushCampaignMessage(msg)
 }
 
+// DryRunCampaign starts a dry run of a campaign where messages to all of its subscribers
+// are rendered, but not sent.
+func (a *App) DryRunCampaign(c echo.Context) error {
+	// Get the campaign ID.
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeManage, id, c); err != nil {
+		return err
+	}
+
+	camp, err := a.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	if err := a.manager.DryRun(&camp); err != nil {
+		if errors.Is(err, manager.ErrDryRunRunning) {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.dryRunRunning"))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	out, _ := a.manager.GetDryRun(id)
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetCampaignDryRun returns the report of the last dry run of a campaign.
+func (a *App) GetCampaignDryRun(c echo.Context) error {
+	// Get the campaign ID.
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeGet, id, c); err != nil {
+		return err
+	}
+
+	out, ok := a.manager.GetDryRun(id)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, a.i18n.T("campaigns.noDryRun"))
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
 // validateCampaignFields validates incoming campaign field values.
 func (a *App) validateCampaignFields(c campReq) (campReq, error) {
 	if c.FromEmail == "" {
@@ -628,6 +897,20 @@ func (a *App) validateCampaignFields(c campReq) (campReq, error) {
 		return c, errors.New(a.i18n.T("campaigns.fieldInvalidListIDs"))
 	}
 
+	// Segments that narrow down the audience of the lists should exist.
+	if len(c.SegmentIDs) > 0 {
+		segs, err := a.core.GetSegments()
+		if err != nil {
+			return c, errors.New(a.i18n.T("campaigns.fieldInvalidSegmentIDs"))
+		}
+
+		for _, id := range c.SegmentIDs {
+			if !slices.ContainsFunc(segs, func(s models.Segment) bool { return int64(s.ID) == id }) {
+				return c, errors.New(a.i18n.T("campaigns.fieldInvalidSegmentIDs"))
+			}
+		}
+	}
+
 	if !a.manager.HasMessenger(c.Messenger) {
 		return c, errors.New(a.i18n.Ts("campaigns.fieldInvalidMessenger", "name", c.Messenger))
 	}
@@ -637,6 +920,67 @@ func (a *App) validateCampaignFields(c campReq) (campReq, error) {
 		return c, errors.New(a.i18n.Ts("campaigns.fieldInvalidBody", "error", err.Error()))
 	}
 
+	// A/B test of variants, if there are any.
+	if c.ABMetric == "" {
+		c.ABMetric = models.CampaignABMetricViews
+	}
+	if c.ABMetric != models.CampaignABMetricViews && c.ABMetric != models.CampaignABMetricClicks {
+		return c, errors.New(a.i18n.T("campaigns.fieldInvalidABMetric"))
+	}
+	if c.ABWait == "" {
+		c.ABWait = "4h"
+	}
+	if d, err := time.ParseDuration(c.ABWait); err != nil || d < time.Minute {
+		return c, errors.New(a.i18n.T("campaigns.fieldInvalidABWait"))
+	}
+
+	// Per-subscriber delivery schedule.
+	if c.SendMode == "" {
+		c.SendMode = models.CampaignSendModeDefault
+	}
+	if c.SendMode != models.CampaignSendModeDefault && c.SendMode != models.CampaignSendModeOptimal &&
+		c.SendMode != models.CampaignSendModeLocal {
+		return c, errors.New(a.i18n.T("campaigns.fieldInvalidSendMode"))
+	}
+
+	// Local time delivery needs the wall-clock time to send at.
+	if c.SendMode == models.CampaignSendModeLocal && !c.SendAt.Valid {
+		return c, errors.New(a.i18n.T("campaigns.fieldLocalSendAt"))
+	}
+
+	// Send throttling.
+	if c.ThrottleRate < 0 || c.ThrottleCap < 0 {
+		return c, errors.New(a.i18n.T("campaigns.fieldInvalidThrottle"))
+	}
+	if c.ThrottleWindow == "" {
+		c.ThrottleWindow = models.ThrottleWindowDay
+	}
+	if c.ThrottleWindow != models.ThrottleWindowHour && c.ThrottleWindow != models.ThrottleWindowDay {
+		return c, errors.New(a.i18n.T("campaigns.fieldInvalidThrottleWindow"))
+	}
+
+	// Recurring campaigns. Clones and their feed items are only created by the runs.
+	c.ParentID = null.Int{}
+	c.FeedItems = models.FeedItems{}
+	c.RecurCron = strings.TrimSpace(c.RecurCron)
+	if c.RecurCron != "" {
+		if _, err := cron.ParseStandard(c.RecurCron); err != nil {
+			return c, errors.New(a.i18n.Ts("campaigns.fieldInvalidRecurCron", "error", err.Error()))
+		}
+	}
+
+	c.RecurFeedURL = strings.TrimSpace(c.RecurFeedURL)
+	if c.RecurFeedURL != "" {
+		if c.RecurCron == "" {
+			return c, errors.New(a.i18n.T("campaigns.fieldFeedNeedsRecur"))
+		}
+
+		u, err := url.ParseRequestURI(c.RecurFeedURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return c, errors.New(a.i18n.T("campaigns.fieldInvalidRecurFeedURL"))
+		}
+	}
+
 	if len(c.Headers) == 0 {
 		c.Headers = make([]map[string]string, 0)
 	}
@@ -660,6 +1004,50 @@ func (a *App) validateCampaignFields(c campReq) (campReq, error) {
 	return c, nil
 }
 
+// validateCampaignVariant validates an incoming campaign variant and returns its
+// campaign. varID is the ID of the variant being updated, or 0 if a new one is being created.
+func (a *App) validateCampaignVariant(campID, varID int, v models.CampaignVariant) (models.Campaign, error) {
+	// Variants can't be changed once the test has started.
+	cm, err := a.core.GetCampaign(campID, "", "")
+	if err != nil {
+		return cm, err
+	}
+	if !canEditCampaign(cm.Status) || cm.ABStatus.Valid {
+		return cm, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.cantUpdateVariants"))
+	}
+
+	if !strHasLen(v.Name, 1, stdInputMaxLen) {
+		return cm, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.fieldInvalidName"))
+	}
+	if !strHasLen(v.Subject, 1, 5000) {
+		return cm, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.fieldInvalidSubject"))
+	}
+
+	// The variant's content is rendered with the campaign's content type and template.
+	camp := models.Campaign{Subject: v.Subject, Body: v.Body, AltBody: v.AltBody, ContentType: cm.ContentType, TemplateBody: tplTag}
+	if err := camp.CompileTemplate(a.manager.TemplateFuncs(&camp)); err != nil {
+		return cm, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("campaigns.fieldInvalidBody", "error", err.Error()))
+	}
+
+	// The samples of all the variants together should leave a remainder of the audience
+	// to send the winning variant to.
+	vars, err := a.core.GetCampaignVariants(campID)
+	if err != nil {
+		return cm, err
+	}
+	total := v.Percent
+	for _, o := range vars {
+		if o.ID != varID {
+			total += o.Percent
+		}
+	}
+	if v.Percent < 1 || total >= 100 {
+		return cm, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.fieldInvalidVariantPercent"))
+	}
+
+	return cm, nil
+}
+
 // makeOptinCampaignMessage makes a default opt-in campaign message body.
 func (a *App) makeOptinCampaignMessage(o campReq) (campReq, error) {
 	if len(o.ListIDs) == 0 {
@@ -741,6 +1129,153 @@ func (a *App) checkCampaignPerm(types auth.PermType, id int, c echo.Context) err
 // its properties is allowed.
 func canEditCampaign(status string) bool {
 	return status == models.CampaignStatusDraft ||
+		status == models.CampaignStatusPendingApproval ||
+		status == models.CampaignStatusApproved ||
 		status == models.CampaignStatusPaused ||
 		status == models.CampaignStatusScheduled
 }
+
+// getApprovalAction returns the approval action, if any, that changing a
+// campaign's status to the given status amounts to.
+func (a *App) getApprovalAction(cm models.Campaign, status string, user auth.User) (string, error) {
+	switch {
+	case status == models.CampaignStatusPendingApproval:
+		return models.ApprovalActionRequested, nil
+
+	case status == models.CampaignStatusApproved:
+		// Approval has to come from someone other than the requester.
+		if cm.Status == models.CampaignStatusPendingApproval {
+			req, err := a.getApprovalRequester(cm.ID)
+			if err != nil {
+				return "", err
+			}
+			if req.UserID.Valid && req.UserID.Int == user.ID {
+				return "", echo.NewHTTPError(http.StatusForbidden, a.i18n.T("campaigns.cantApproveOwn"))
+			}
+		}
+		return models.ApprovalActionApproved, nil
+
+	case status == models.CampaignStatusDraft && cm.Status == models.CampaignStatusPendingApproval:
+		// The requester withdrawing the request doesn't count as a rejection.
+		req, err := a.getApprovalRequester(cm.ID)
+		if err != nil {
+			return "", err
+		}
+		if req.UserID.Valid && req.UserID.Int == user.ID {
+			return models.ApprovalActionInvalidated, nil
+		}
+		return models.ApprovalActionRejected, nil
+
+	case status == models.CampaignStatusDraft && cm.Status == models.CampaignStatusApproved:
+		return models.ApprovalActionInvalidated, nil
+	}
+
+	return "", nil
+}
+
+// getApprovalRequester returns the latest approval request of a campaign.
+func (a *App) getApprovalRequester(campID int) (models.CampaignApproval, error) {
+	hist, err := a.core.GetCampaignApprovals(campID)
+	if err != nil {
+		return models.CampaignApproval{}, err
+	}
+
+	for _, h := range hist {
+		if h.Action == models.ApprovalActionRequested {
+			return h, nil
+		}
+	}
+
+	return models.CampaignApproval{}, nil
+}
+
+// notifyCampaignApproval notifies the approvers of a campaign's approval request,
+// and the requester of the approval or the rejection of the request.
+func (a *App) notifyCampaignApproval(camp models.Campaign, action string, user auth.User, note string) {
+	var emails []string
+	switch action {
+	case models.ApprovalActionRequested:
+		e, err := a.core.GetCampaignApprovers(user.ID)
+		if err != nil {
+			return
+		}
+		emails = e
+
+	case models.ApprovalActionApproved, models.ApprovalActionRejected:
+		req, err := a.getApprovalRequester(camp.ID)
+		if err != nil || !req.Email.Valid {
+			return
+		}
+		emails = []string{req.Email.String}
+
+	default:
+		return
+	}
+
+	var (
+		name    = a.i18n.T("campaigns.approval." + action)
+		subject = fmt.Sprintf("%s: %s", name, camp.Name)
+		data    = map[string]any{
+			"ID":     camp.ID,
+			"Name":   camp.Name,
+			"Action": name,
+			"User":   user.Name,
+			"Note":   note,
+		}
+	)
+	if err := notifs.Notify(emails, subject, notifs.TplCampaignApproval, data, nil); err != nil {
+		a.log.Printf("error sending campaign approval notification: %v", err)
+	}
+}
+
+// resetCampaignApproval reverts a campaign that's pending approval or has been approved
+// back to a draft as its content has changed.
+func (a *App) resetCampaignApproval(c echo.Context, cm models.Campaign) error {
+	if !isCampaignApproved(cm.Status, a.cfg.CampaignApproval) {
+		return nil
+	}
+
+	return a.core.InvalidateCampaignApproval(cm.ID, auth.GetUser(c).ID, a.i18n.T("campaigns.approvalContentChanged"))
+}
+
+// isCampaignApproved returns true if a campaign in the given status is pending approval
+// or has been approved. If approvals are required, scheduled and paused campaigns
+// have necessarily been approved.
+func isCampaignApproved(status string, required bool) bool {
+	switch status {
+	case models.CampaignStatusPendingApproval, models.CampaignStatusApproved:
+		return true
+	case models.CampaignStatusScheduled, models.CampaignStatusPaused:
+		return required
+	}
+
+	return false
+}
+
+// campaignContent returns a fingerprint of the content of a campaign that's subject
+// to approval: the message, its lists and segments, and its attachments.
+func campaignContent(c models.Campaign, listIDs, mediaIDs []int) string {
+	listIDs, mediaIDs, segIDs := slices.Clone(listIDs), slices.Clone(mediaIDs), slices.Clone(c.SegmentIDs)
+	slices.Sort(listIDs)
+	slices.Sort(mediaIDs)
+	slices.Sort(segIDs)
+
+	b, _ := json.Marshal([]any{c.Subject, c.FromEmail, c.Body, c.AltBody, c.ContentType,
+		c.Headers, c.TemplateID, c.Messenger, listIDs, mediaIDs, segIDs})
+	return string(b)
+}
+
+// getJSONIDs returns the IDs in a JSON array of {id} objects.
+func getJSONIDs(j types.JSONText) []int {
+	var items []struct {
+		ID int `json:"id"`
+	}
+	_ = j.Unmarshal(&items)
+
+	out := make([]int, 0, len(items))
+	for _, i := range items {
+		out = append(out, i.ID)
+	}
+
+	return out
+}
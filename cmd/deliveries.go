@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Max number of deferred deliveries retried in one run of the retrier.
+	deferredBatchSize = 1000
+
+	// Max delay between retries of a deferred delivery.
+	maxRetryBackoff = time.Hour * 24
+)
+
+// GetCampaignDeliveries retrieves the paginated delivery log of a campaign,
+// optionally filtered by subscriber, status, or e-mail.
+func (a *App) GetCampaignDeliveries(c echo.Context) error {
+	var (
+		id       = getID(c)
+		subID, _ = strconv.Atoi(c.QueryParam("subscriber_id"))
+		status   = c.FormValue("status")
+		email    = strings.TrimSpace(c.FormValue("email"))
+		orderBy  = c.FormValue("order_by")
+		order    = c.FormValue("order")
+
+		pg = a.pg.NewFromURL(c.Request().URL.Query())
+	)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeGet, id, c); err != nil {
+		return err
+	}
+
+	switch status {
+	case "", models.DeliveryStatusSent, models.DeliveryStatusFailed, models.DeliveryStatusDeferred, models.DeliveryStatusBounced:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+	}
+
+	res, total, err := a.core.QueryCampaignDeliveries(id, subID, status, email, orderBy, order, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// No results.
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.Delivery{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetDeferredDeliveries retrieves the paginated campaign messages that failed to send.
+func (a *App) GetDeferredDeliveries(c echo.Context) error {
+	var (
+		campID, _ = strconv.Atoi(c.QueryParam("campaign_id"))
+		subID, _  = strconv.Atoi(c.QueryParam("subscriber_id"))
+		status    = c.FormValue("status")
+		orderBy   = c.FormValue("order_by")
+		order     = c.FormValue("order")
+
+		pg = a.pg.NewFromURL(c.Request().URL.Query())
+	)
+
+	if status != "" && status != models.DeferredStatusPending && status != models.DeferredStatusFailed {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+	}
+
+	res, total, err := a.core.QueryDeferredDeliveries(campID, subID, status, orderBy, order, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// No results.
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.DeferredDelivery{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// RetryDeferredDeliveries queues one or more (or all) deferred deliveries for
+// an immediate retry, including the ones that have run out of attempts.
+func (a *App) RetryDeferredDeliveries(c echo.Context) error {
+	ids, err := a.getDeferredIDs(c)
+	if err != nil {
+		return err
+	}
+
+	if err := a.core.RetryDeferredDeliveries(ids); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// DeleteDeferredDeliveries discards one or more (or all) deferred deliveries.
+func (a *App) DeleteDeferredDeliveries(c echo.Context) error {
+	ids, err := a.getDeferredIDs(c)
+	if err != nil {
+		return err
+	}
+
+	if err := a.core.DeleteDeferredDeliveries(ids); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// getDeferredIDs returns the deferred delivery IDs in the query string, or
+// an empty list if `all` is set.
+func (a *App) getDeferredIDs(c echo.Context) ([]int, error) {
+	if all, _ := strconv.ParseBool(c.QueryParam("all")); all {
+		return []int{}, nil
+	}
+
+	// There are multiple IDs in the query string.
+	ids, err := parseStringIDs(c.Request().URL.Query()["id"])
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidID", "error", err.Error()))
+	}
+	if len(ids) == 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidID"))
+	}
+
+	return ids, nil
+}
+
+// runDeferredRetrier periodically retries the deferred deliveries that are due.
+// A delivery that fails again is retried with an exponential backoff, and after
+// maxAttempts, it's marked as failed. If maxAttempts is 0, failed messages are
+// recorded, but never retried.
+func (a *App) runDeferredRetrier(interval time.Duration, maxAttempts int, backoff time.Duration) {
+	if maxAttempts < 1 {
+		return
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for range t.C {
+		items, err := a.core.GetDueDeferredDeliveries(deferredBatchSize)
+		if err != nil {
+			continue
+		}
+
+		// Campaigns (and their A/B test variants) compiled in this run.
+		camps := map[deferredCamp]*models.Campaign{}
+
+		for _, d := range items {
+			err := a.retryDeferredDelivery(d, camps)
+			if err == nil {
+				if err := a.core.DeleteDeferredDeliveries([]int{d.ID}); err != nil {
+					a.log.Printf("error deleting deferred delivery (%d): %v", d.ID, err)
+				}
+				continue
+			}
+
+			// Back off exponentially, or give up after the max attempts.
+			var (
+				attempts = d.Attempts + 1
+				status   = models.DeferredStatusPending
+				wait     = maxRetryBackoff
+			)
+			if attempts < 32 {
+				wait = min(maxRetryBackoff, backoff<<attempts)
+			}
+			if attempts >= maxAttempts {
+				status = models.DeferredStatusFailed
+				a.log.Printf("giving up on deferred message in campaign %d: subscriber %d after %d attempts: %v",
+					d.CampaignID, d.SubscriberID, attempts, err)
+
+				if a.cfg.DeliveryLog {
+					_ = a.core.LogDelivery(d.CampaignID, d.SubscriberID, d.Messenger, "", err.Error(), models.DeliveryStatusFailed)
+				}
+			}
+
+			if err := a.core.UpdateDeferredDelivery(d.ID, status, err.Error(), time.Now().Add(wait)); err != nil {
+				a.log.Printf("error updating deferred delivery (%d): %v", d.ID, err)
+			}
+		}
+	}
+}
+
+// deferredCamp identifies the compiled campaign, or the A/B test variant of it,
+// that a deferred message is rendered from.
+type deferredCamp struct {
+	campID    int
+	variantID int
+}
+
+// retryDeferredDelivery renders and sends a deferred campaign message to its subscriber
+// from the campaign, or the A/B test variant the subscriber was originally sent.
+func (a *App) retryDeferredDelivery(d models.DeferredDelivery, camps map[deferredCamp]*models.Campaign) error {
+	key := deferredCamp{campID: d.CampaignID, variantID: d.VariantID.Int}
+
+	camp, ok := camps[key]
+	if !ok {
+		c, err := a.core.GetCampaign(d.CampaignID, "", "")
+		if err != nil {
+			return err
+		}
+
+		if key.variantID > 0 {
+			v, err := a.core.GetCampaignVariant(d.CampaignID, key.variantID)
+			if err != nil {
+				return err
+			}
+			c.Subject = v.Subject
+			c.Body = v.Body
+			c.AltBody = v.AltBody
+		}
+
+		// Compile the templates and load the media once per campaign.
+		if err := a.manager.CompileCampaign(&c); err != nil {
+			return err
+		}
+
+		camp = &c
+		camps[key] = camp
+	}
+
+	sub, err := a.core.GetSubscriber(d.SubscriberID, "", "")
+	if err != nil {
+		return err
+	}
+
+	msg, err := a.manager.NewCampaignMessage(camp, sub)
+	if err != nil {
+		return fmt.Errorf("error rendering message: %v", err)
+	}
+
+	return a.manager.SendCampaignMessage(msg)
+}
+
+// pruneDeliveries periodically deletes the delivery log entries older than
+// the retention period (days).
+func (a *App) pruneDeliveries(interval time.Duration, days int) {
+	if days < 1 {
+		return
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for range t.C {
+		n, err := a.core.DeleteDeliveries(time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			continue
+		}
+		if n > 0 {
+			a.log.Printf("deleted %d delivery log entries older than %d days", n, days)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Interval at which engagement scores are recomputed and the sunset policy is applied.
+	engagementInterval = 6 * time.Hour
+
+	// Max number of subscribers returned in the preview of a sunset policy.
+	sunsetPreviewLimit = 50
+)
+
+// GetSunsetSubscribers previews the subscribers that a sunset policy would affect.
+func (a *App) GetSunsetSubscribers(c echo.Context) error {
+	var (
+		campaigns, _ = strconv.Atoi(c.QueryParam("campaigns"))
+		days, _      = strconv.Atoi(c.QueryParam("days"))
+		listID, _    = strconv.Atoi(c.QueryParam("list_id"))
+		p            = models.SunsetPolicy{Campaigns: campaigns, Days: days, Action: c.QueryParam("action"), ListID: listID}
+	)
+	if err := a.validateSunsetPolicy(p); err != nil {
+		return err
+	}
+
+	res, total, err := a.core.GetSunsetSubscribers(p, sunsetPreviewLimit)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    1,
+		PerPage: sunsetPreviewLimit,
+	}})
+}
+
+// SunsetSubscribers applies a sunset policy to inactive subscribers.
+func (a *App) SunsetSubscribers(c echo.Context) error {
+	var p models.SunsetPolicy
+	if err := c.Bind(&p); err != nil {
+		return err
+	}
+	if err := a.validateSunsetPolicy(p); err != nil {
+		return err
+	}
+
+	n, err := a.core.SunsetSubscribers(p)
+	if err != nil {
+		return err
+	}
+
+	setAudit(c, nil, map[string]any{"policy": p, "count": n})
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		Count int `json:"count"`
+	}{n}})
+}
+
+// validateSunsetPolicy validates the fields of a sunset policy.
+func (a *App) validateSunsetPolicy(p models.SunsetPolicy) error {
+	// Inactivity can't be told apart from anonymous views and clicks.
+	if !a.cfg.Privacy.IndividualTracking {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("maintenance.sunsetNeedsTracking"))
+	}
+
+	if p.Campaigns < 0 || p.Days < 0 || (p.Campaigns == 0 && p.Days == 0) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("maintenance.sunsetNoCriteria"))
+	}
+
+	switch p.Action {
+	case models.SunsetActionUnsubscribe:
+	case models.SunsetActionMove:
+		if p.ListID < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "list_id"))
+		}
+		if _, err := a.core.GetList(p.ListID, ""); err != nil {
+			return err
+		}
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "action"))
+	}
+
+	return nil
+}
+
+// runEngagement periodically recomputes the engagement scores of subscribers, and
+// if there's a sunset policy, applies it.
+func (a *App) runEngagement(interval time.Duration, halfLife int, sunset *models.SunsetPolicy) {
+	if halfLife < 1 {
+		halfLife = 30
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for range t.C {
+		if _, err := a.core.UpdateEngagementScores(halfLife); err != nil {
+			a.log.Printf("error updating engagement scores: %v", err)
+		}
+
+		if sunset == nil {
+			continue
+		}
+
+		n, err := a.core.SunsetSubscribers(*sunset)
+		if err != nil {
+			a.log.Printf("error sunsetting subscribers: %v", err)
+			continue
+		}
+		if n > 0 {
+			a.log.Printf("sunset %d inactive subscribers (%s)", n, sunset.Action)
+		}
+	}
+}
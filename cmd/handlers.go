@@ -87,7 +87,7 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 
 					return next(c)
 				}
-			})
+			}, a.auditLog)
 		)
 
 		// API endpoints.
@@ -100,14 +100,17 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.GET("/api/settings", pm(a.GetSettings, "settings:get"))
 		g.PUT("/api/settings", pm(a.UpdateSettings, "settings:manage"))
 		g.POST("/api/settings/smtp/test", pm(a.TestSMTPSettings, "settings:manage"))
+		g.GET("/api/settings/smtp/warmup", pm(a.GetSMTPWarmups, "settings:get"))
 		g.POST("/api/admin/reload", pm(a.ReloadApp, "settings:manage"))
 		g.GET("/api/logs", pm(a.GetLogs, "settings:get"))
+		g.GET("/api/audit", pm(a.GetAuditLog, "audit:get"))
 		g.GET("/api/events", pm(a.EventStream, "settings:get"))
 		g.GET("/api/about", a.GetAboutInfo)
 
 		g.GET("/api/subscribers", pm(a.QuerySubscribers, "subscribers:get_all", "subscribers:get"))
 		g.GET("/api/subscribers/:id", pm(hasID(a.GetSubscriber), "subscribers:get_all", "subscribers:get"))
 		g.GET("/api/subscribers/:id/export", pm(hasID(a.ExportSubscriberData), "subscribers:get_all", "subscribers:get"))
+		g.GET("/api/subscribers/:id/activity", pm(hasID(a.GetSubscriberActivity), "subscribers:get_all", "subscribers:get"))
 		g.GET("/api/subscribers/:id/bounces", pm(hasID(a.GetSubscriberBounces), "bounces:get"))
 		g.DELETE("/api/subscribers/:id/bounces", pm(hasID(a.DeleteSubscriberBounces), "bounces:manage"))
 		g.POST("/api/subscribers", pm(a.CreateSubscriber, "subscribers:manage"))
@@ -125,6 +128,10 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.DELETE("/api/bounces", pm(a.DeleteBounces, "bounces:manage"))
 		g.DELETE("/api/bounces/:id", pm(hasID(a.DeleteBounce), "bounces:manage"))
 
+		g.GET("/api/deliveries/deferred", pm(a.GetDeferredDeliveries, "campaigns:get_all"))
+		g.PUT("/api/deliveries/deferred/retry", pm(a.RetryDeferredDeliveries, "campaigns:manage_all"))
+		g.DELETE("/api/deliveries/deferred", pm(a.DeleteDeferredDeliveries, "campaigns:manage_all"))
+
 		// Subscriber operations based on arbitrary SQL queries.
 		// These aren't very REST-like.
 		g.POST("/api/subscribers/query/delete", pm(a.DeleteSubscribersByQuery, "subscribers:manage"))
@@ -155,11 +162,25 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.POST("/api/campaigns/:id/content", pm(hasID(a.CampaignContent), "campaigns:manage_all", "campaigns:manage"))
 		g.POST("/api/campaigns/:id/text", pm(hasID(a.PreviewCampaign), "campaigns:get"))
 		g.POST("/api/campaigns/:id/test", pm(hasID(a.TestCampaign), "campaigns:manage_all", "campaigns:manage"))
+		g.GET("/api/campaigns/:id/dry-run", pm(hasID(a.GetCampaignDryRun), "campaigns:get_all", "campaigns:get"))
+		g.POST("/api/campaigns/:id/dry-run", pm(hasID(a.DryRunCampaign), "campaigns:manage_all", "campaigns:manage"))
 		g.POST("/api/campaigns", pm(a.CreateCampaign, "campaigns:manage_all", "campaigns:manage"))
+		g.POST("/api/campaigns/import", pm(a.ImportCampaign, "campaigns:manage_all", "campaigns:manage"))
 		g.PUT("/api/campaigns/:id", pm(hasID(a.UpdateCampaign), "campaigns:manage_all", "campaigns:manage"))
-		g.PUT("/api/campaigns/:id/status", pm(hasID(a.UpdateCampaignStatus), "campaigns:manage_all", "campaigns:manage"))
+		g.PUT("/api/campaigns/:id/status", pm(hasID(a.UpdateCampaignStatus), "campaigns:manage_all", "campaigns:manage", "campaigns:approve"))
 		g.PUT("/api/campaigns/:id/archive", pm(hasID(a.UpdateCampaignArchive), "campaigns:manage_all", "campaigns:manage"))
 		g.DELETE("/api/campaigns/:id", pm(hasID(a.DeleteCampaign), "campaigns:manage_all", "campaigns:manage"))
+		g.GET("/api/campaigns/:id/variants", pm(hasID(a.GetCampaignVariants), "campaigns:get_all", "campaigns:get"))
+		g.GET("/api/campaigns/:id/deliveries", pm(hasID(a.GetCampaignDeliveries), "campaigns:get_all", "campaigns:get"))
+		g.GET("/api/campaigns/:id/export", pm(hasID(a.ExportCampaign), "campaigns:get_all", "campaigns:get"))
+		g.GET("/api/campaigns/:id/approvals", pm(hasID(a.GetCampaignApprovals), "campaigns:get_all", "campaigns:get"))
+		g.GET("/api/campaigns/:id/revisions", pm(hasID(a.GetCampaignRevisions), "campaigns:get_all", "campaigns:get"))
+		g.GET("/api/campaigns/:id/revisions/:revID", pm(hasID(a.GetCampaignRevision), "campaigns:get_all", "campaigns:get"))
+		g.GET("/api/campaigns/:id/revisions/:revID/diff", pm(hasID(a.GetCampaignRevisionDiff), "campaigns:get_all", "campaigns:get"))
+		g.POST("/api/campaigns/:id/revisions/:revID/restore", pm(hasID(a.RestoreCampaignRevision), "campaigns:manage_all", "campaigns:manage"))
+		g.POST("/api/campaigns/:id/variants", pm(hasID(a.CreateCampaignVariant), "campaigns:manage_all", "campaigns:manage"))
+		g.PUT("/api/campaigns/:id/variants/:variantID", pm(hasID(a.UpdateCampaignVariant), "campaigns:manage_all", "campaigns:manage"))
+		g.DELETE("/api/campaigns/:id/variants/:variantID", pm(hasID(a.DeleteCampaignVariant), "campaigns:manage_all", "campaigns:manage"))
 
 		g.GET("/api/media", pm(a.GetAllMedia, "media:get"))
 		g.GET("/api/media/:id", pm(hasID(a.GetMedia), "media:get"))
@@ -172,23 +193,64 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 		g.POST("/api/templates/preview", pm(a.PreviewTemplateBody, "templates:get"))
 		g.POST("/api/templates", pm(a.CreateTemplate, "templates:manage"))
 		g.PUT("/api/templates/:id", pm(hasID(a.UpdateTemplate), "templates:manage"))
+		g.GET("/api/templates/:id/revisions", pm(hasID(a.GetTemplateRevisions), "templates:get"))
+		g.GET("/api/templates/:id/revisions/:revID", pm(hasID(a.GetTemplateRevision), "templates:get"))
+		g.GET("/api/templates/:id/revisions/:revID/diff", pm(hasID(a.GetTemplateRevisionDiff), "templates:get"))
+		g.POST("/api/templates/:id/revisions/:revID/restore", pm(hasID(a.RestoreTemplateRevision), "templates:manage"))
 		g.PUT("/api/templates/:id/default", pm(hasID(a.TemplateSetDefault), "templates:manage"))
 		g.DELETE("/api/templates/:id", pm(hasID(a.DeleteTemplate), "templates:manage"))
 
+		g.GET("/api/sequences", pm(a.GetSequences, "sequences:get"))
+		g.GET("/api/sequences/:id", pm(hasID(a.GetSequence), "sequences:get"))
+		g.POST("/api/sequences", pm(a.CreateSequence, "sequences:manage"))
+		g.PUT("/api/sequences/:id", pm(hasID(a.UpdateSequence), "sequences:manage"))
+		g.PUT("/api/sequences/:id/status", pm(hasID(a.UpdateSequenceStatus), "sequences:manage"))
+		g.DELETE("/api/sequences/:id", pm(hasID(a.DeleteSequence), "sequences:manage"))
+		g.GET("/api/sequences/:id/steps", pm(hasID(a.GetSequenceSteps), "sequences:get"))
+		g.POST("/api/sequences/:id/steps", pm(hasID(a.CreateSequenceStep), "sequences:manage"))
+		g.PUT("/api/sequences/:id/steps/:stepID", pm(hasID(a.UpdateSequenceStep), "sequences:manage"))
+		g.DELETE("/api/sequences/:id/steps/:stepID", pm(hasID(a.DeleteSequenceStep), "sequences:manage"))
+
+		g.GET("/api/segments", pm(a.GetSegments, "segments:get"))
+		g.GET("/api/segments/:id", pm(hasID(a.GetSegment), "segments:get"))
+		g.POST("/api/segments", pm(a.CreateSegment, "segments:manage"))
+		g.POST("/api/segments/preview", pm(a.PreviewSegment, "segments:get"))
+		g.PUT("/api/segments/:id", pm(hasID(a.UpdateSegment), "segments:manage"))
+		g.POST("/api/segments/:id/refresh", pm(hasID(a.RefreshSegment), "segments:manage"))
+		g.DELETE("/api/segments/:id", pm(hasID(a.DeleteSegment), "segments:manage"))
+
 		g.DELETE("/api/maintenance/subscribers/:type", pm(a.GCSubscribers, "settings:maintain"))
 		g.DELETE("/api/maintenance/analytics/:type", pm(a.GCCampaignAnalytics, "settings:maintain"))
 		g.DELETE("/api/maintenance/subscriptions/unconfirmed", pm(a.GCSubscriptions, "settings:maintain"))
+		g.DELETE("/api/maintenance/deliveries", pm(a.GCDeliveries, "settings:maintain"))
+		g.GET("/api/maintenance/sunset", pm(a.GetSunsetSubscribers, "settings:maintain"))
+		g.POST("/api/maintenance/sunset", pm(a.SunsetSubscribers, "settings:maintain"))
 
 		g.POST("/api/tx", pm(a.SendTxMessage, "tx:send"))
 
 		g.GET("/api/profile", a.GetUserProfile)
 		g.PUT("/api/profile", a.UpdateUserProfile)
+		g.POST("/api/profile/2fa", a.SetupProfileTOTP)
+		g.PUT("/api/profile/2fa", a.EnableProfileTOTP)
+		g.DELETE("/api/profile/2fa", a.DisableProfileTOTP)
+		g.GET("/api/profile/sessions", a.GetProfileSessions)
+		g.DELETE("/api/profile/sessions", a.DeleteProfileSessions)
+		g.DELETE("/api/profile/sessions/:sessID", a.DeleteProfileSession)
 		g.GET("/api/users", pm(a.GetUsers, "users:get"))
+		g.GET("/api/users/lockouts", pm(a.GetLoginLockouts, "users:get"))
+		g.DELETE("/api/users/lockouts", pm(a.DeleteLoginLockout, "users:manage"))
 		g.GET("/api/users/:id", pm(hasID(a.GetUser), "users:get"))
 		g.POST("/api/users", pm(a.CreateUser, "users:manage"))
 		g.PUT("/api/users/:id", pm(hasID(a.UpdateUser), "users:manage"))
 		g.DELETE("/api/users", pm(a.DeleteUsers, "users:manage"))
 		g.DELETE("/api/users/:id", pm(hasID(a.DeleteUser), "users:manage"))
+		g.DELETE("/api/users/:id/2fa", pm(hasID(a.ResetUserTOTP), "users:manage"))
+		g.GET("/api/users/:id/tokens", pm(hasID(a.GetAPITokens), "users:get"))
+		g.POST("/api/users/:id/tokens", pm(hasID(a.CreateAPIToken), "users:manage"))
+		g.DELETE("/api/users/:id/tokens/:tokenID", pm(hasID(a.DeleteAPIToken), "users:manage"))
+		g.GET("/api/users/:id/sessions", pm(hasID(a.GetUserSessions), "users:get"))
+		g.DELETE("/api/users/:id/sessions", pm(hasID(a.DeleteUserSessions), "users:manage"))
+		g.DELETE("/api/users/:id/sessions/:sessID", pm(hasID(a.DeleteUserSession), "users:manage"))
 		g.POST("/api/logout", a.Logout)
 
 		g.GET("/api/roles/users", pm(a.GetUserRoles, "roles:get"))
@@ -221,14 +283,25 @@ func initHTTPHandlers(e *echo.Echo, a *App) {
 			return c.Render(http.StatusOK, "home", publicTpl{Title: "listmonk"})
 		})
 
-		// Public admin endpoints (login page, OIDC endpoints).
+		// Public admin endpoints (login page, OIDC and SAML endpoints).
 		g.GET(path.Join(uriAdmin, "/login"), a.LoginPage)
 		g.POST(path.Join(uriAdmin, "/login"), a.LoginPage)
+		g.GET(path.Join(uriAdmin, "/login/2fa"), a.LoginTOTPPage)
+		g.POST(path.Join(uriAdmin, "/login/2fa"), a.LoginTOTPPage)
+		g.GET(path.Join(uriAdmin, "/login/forgot"), a.ForgotPasswordPage)
+		g.POST(path.Join(uriAdmin, "/login/forgot"), a.ForgotPasswordPage)
+		g.GET(path.Join(uriAdmin, "/login/reset"), a.ResetPasswordPage)
+		g.POST(path.Join(uriAdmin, "/login/reset"), a.ResetPasswordPage)
 
 		if a.cfg.Security.OIDC.Enabled {
 			g.POST("/auth/oidc", a.OIDCLogin)
 			g.GET("/auth/oidc", a.OIDCFinish)
 		}
+		if a.cfg.Security.SAML.Enabled {
+			g.GET(auth.SAMLMetadataURI, a.SAMLMetadata)
+			g.POST("/auth/saml", a.SAMLLogin)
+			g.POST(auth.SAMLACSURI, a.SAMLFinish)
+		}
 
 		// Public APIs.
 		g.GET("/api/public/lists", a.GetPublicLists)
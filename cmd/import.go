@@ -87,6 +87,14 @@ func (a *App) ImportSubscribers(c echo.Context) error {
 	}
 	go sess.Start()
 
+	setAudit(c, nil, map[string]any{
+		"filename":            opt.Filename,
+		"mode":                opt.Mode,
+		"subscription_status": opt.SubStatus,
+		"overwrite":           opt.Overwrite,
+		"lists":               opt.ListIDs,
+	})
+
 	if strings.HasSuffix(strings.ToLower(file.Filename), ".csv") {
 		go sess.LoadCSV(out.Name(), rune(opt.Delim[0]))
 	} else {
@@ -15,6 +15,7 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
@@ -101,11 +102,27 @@ type Config struct {
 			ProviderName string `koanf:"provider_name"`
 			ClientID     string `koanf:"client_id"`
 			ClientSecret string `koanf:"client_secret"`
+
+			AutoCreateUsers   bool          `koanf:"auto_create_users"`
+			DefaultUserRoleID int           `koanf:"default_user_role_id"`
+			RoleMappings      []roleMapping `koanf:"role_mappings"`
 		} `koanf:"oidc"`
 
+		SAML struct {
+			Enabled           bool          `koanf:"enabled"`
+			ProviderName      string        `koanf:"provider_name"`
+			AttrGroups        string        `koanf:"attr_groups"`
+			AutoCreateUsers   bool          `koanf:"auto_create_users"`
+			DefaultUserRoleID int           `koanf:"default_user_role_id"`
+			RoleMappings      []roleMapping `koanf:"role_mappings"`
+		} `koanf:"saml"`
+
 		EnableCaptcha bool   `koanf:"enable_captcha"`
 		CaptchaKey    string `koanf:"captcha_key"`
 		CaptchaSecret string `koanf:"captcha_secret"`
+
+		TOTPRequired      string `koanf:"totp_required"`
+		TOTPRequiredRoles []int  `koanf:"totp_required_roles"`
 	} `koanf:"security"`
 
 	Appearance struct {
@@ -115,6 +132,9 @@ type Config struct {
 		PublicJS  []byte `koanf:"public.custom_js"`
 	}
 
+	DeliveryLog      bool `koanf:"delivery_log"`
+	CampaignApproval bool `koanf:"campaign_approval"`
+
 	HasLegacyUser bool
 	AssetVersion  string
 
@@ -542,12 +562,15 @@ func initCampaignManager(msgrs []manager.Messenger, q *models.Queries, u *UrlCon
 		ArchiveURL:            u.ArchiveURL,
 		RootURL:               u.RootURL,
 		UnsubHeader:           ko.Bool("privacy.unsubscribe_header"),
+		DefaultTimezone:       ko.String("app.default_timezone"),
+		DeliveryLog:           ko.Bool("app.delivery_log"),
 		SlidingWindow:         ko.Bool("app.message_sliding_window"),
 		SlidingWindowDuration: ko.Duration("app.message_sliding_window_duration"),
 		SlidingWindowRate:     ko.Int("app.message_sliding_window_rate"),
+		MessengerLimits:       initMessengerLimits(ko),
 		ScanInterval:          time.Second * 5,
 		ScanCampaigns:         !ko.Bool("passive"),
-	}, newManagerStore(q, co, md), i, lo)
+	}, newManagerStore(q, co, md, ko.Duration("app.retry_backoff")), i, lo)
 
 	// Attach all messengers to the campaign manager.
 	for _, m := range msgrs {
@@ -584,6 +607,9 @@ func initImporter(q *models.Queries, db *sqlx.DB, core *core.Core, i *i18n.I18n,
 			BlocklistStmt:      q.UpsertBlocklistSubscriber.Stmt,
 			UpdateListDateStmt: q.UpdateListsDate.Stmt,
 
+			// Start the sequences of the lists subscribers are imported into.
+			SubscribeCB: core.StartSequencesByLists,
+
 			// Hook for triggering admin notifications and refreshing stats materialized
 			// views after a successful import.
 			PostCB: func(subject string, data any) error {
@@ -597,8 +623,42 @@ func initImporter(q *models.Queries, db *sqlx.DB, core *core.Core, i *i18n.I18n,
 		}, db.DB, i)
 }
 
+// initSMTPWarmups loads the warm-up state of the enabled SMTP servers that have a
+// warm-up schedule, keyed by the servers' UUIDs.
+func initSMTPWarmups(co *core.Core) map[string]*email.Warmup {
+	var (
+		uuids     []string
+		schedules = map[string][]int{}
+	)
+	for _, item := range ko.Slices("smtp") {
+		sched := item.Ints("warmup_schedule")
+		if !item.Bool("enabled") || len(sched) == 0 {
+			continue
+		}
+
+		uuids = append(uuids, item.String("uuid"))
+		schedules[item.String("uuid")] = sched
+	}
+
+	out := make(map[string]*email.Warmup, len(uuids))
+	if len(uuids) == 0 {
+		return out
+	}
+
+	res, err := co.GetSMTPWarmups(uuids)
+	if err != nil {
+		lo.Fatalf("error loading SMTP warm-ups: %v", err)
+	}
+
+	for _, w := range res {
+		out[w.UUID] = email.NewWarmup(schedules[w.UUID], w.StartedOn, w.Day, w.Sent)
+	}
+
+	return out
+}
+
 // initSMTPMessenger initializes the combined and individual SMTP messengers.
-func initSMTPMessengers() []manager.Messenger {
+func initSMTPMessengers(warmups map[string]*email.Warmup) []manager.Messenger {
 	var (
 		servers = []email.Server{}
 		out     = []manager.Messenger{}
@@ -615,6 +675,7 @@ func initSMTPMessengers() []manager.Messenger {
 		if err := item.UnmarshalWithConf("", &s, koanf.UnmarshalConf{Tag: "json"}); err != nil {
 			lo.Fatalf("error reading SMTP config: %v", err)
 		}
+		s.Warmup = warmups[s.UUID]
 
 		servers = append(servers, s)
 		lo.Printf("initialized email (SMTP) messenger: %s@%s", item.String("username"), item.String("host"))
@@ -683,6 +744,20 @@ func initPostbackMessengers(ko *koanf.Koanf) []manager.Messenger {
 	return out
 }
 
+// initMessengerLimits loads the send limits of messengers.
+func initMessengerLimits(ko *koanf.Koanf) map[string]manager.Limit {
+	out := make(map[string]manager.Limit)
+	for _, item := range ko.Slices("app.messenger_limits") {
+		out[item.String("messenger")] = manager.Limit{
+			Rate:   item.Int("rate"),
+			Cap:    item.Int("cap"),
+			Window: manager.ThrottleWindow(item.String("window")),
+		}
+	}
+
+	return out
+}
+
 // initMediaStore initializes Upload manager with a custom backend.
 func initMediaStore(ko *koanf.Koanf) media.Store {
 	switch provider := ko.String("upload.provider"); provider {
@@ -998,7 +1073,7 @@ func initTplFuncs(i *i18n.I18n, u *UrlConfig) template.FuncMap {
 }
 
 // initAuth initializes the auth module with the given DB connection and
-func initAuth(co *core.Core, db *sql.DB, ko *koanf.Koanf) (bool, *auth.Auth) {
+func initAuth(co *core.Core, db *sql.DB, i *i18n.I18n, ko *koanf.Koanf) (bool, *auth.Auth) {
 	var oidcCfg auth.OIDCConfig
 
 	// If OIDC is enabled, set up the OIDC config.
@@ -1010,6 +1085,33 @@ func initAuth(co *core.Core, db *sql.DB, ko *koanf.Koanf) (bool, *auth.Auth) {
 			ClientSecret: ko.String("security.oidc.client_secret"),
 			RedirectURL:  fmt.Sprintf("%s/auth/oidc", strings.TrimRight(ko.String("app.root_url"), "/")),
 		}
+
+		// Claims that roles are mapped from.
+		var mappings []roleMapping
+		if err := ko.Unmarshal("security.oidc.role_mappings", &mappings); err != nil {
+			lo.Printf("error loading OIDC role mappings: %v", err)
+		}
+		for _, m := range mappings {
+			c := m.claim(oidcGroupsClaim)
+			if !slices.Contains(oidcCfg.Claims, c) {
+				oidcCfg.Claims = append(oidcCfg.Claims, c)
+			}
+		}
+	}
+
+	// If SAML is enabled, set up the SAML SP config.
+	var samlCfg auth.SAMLConfig
+	if ko.Bool("security.saml.enabled") {
+		samlCfg = auth.SAMLConfig{
+			Enabled:        true,
+			IDPMetadataURL: ko.String("security.saml.idp_metadata_url"),
+			IDPMetadata:    ko.String("security.saml.idp_metadata"),
+			Certificate:    ko.String("security.saml.sp_certificate"),
+			PrivateKey:     ko.String("security.saml.sp_private_key"),
+			RootURL:        ko.String("app.root_url"),
+			AttrEmail:      ko.String("security.saml.attr_email"),
+			AttrName:       ko.String("security.saml.attr_name"),
+		}
 	}
 
 	// Setup the sessio manager callbacks for getting and setting cookies.
@@ -1027,10 +1129,36 @@ func initAuth(co *core.Core, db *sql.DB, ko *koanf.Koanf) (bool, *auth.Auth) {
 		GetUser: func(id int) (auth.User, error) {
 			return co.GetUser(id, "", "")
 		},
+		APITokenUsed: func(id int, ip string) {
+			_ = co.UpdateAPITokenUsage(id, ip)
+		},
+
+		// Persist failed login attempts and lockouts.
+		GetLoginFailures: co.GetLoginFailures,
+		SaveLoginFailures: func(f auth.LoginFailures) {
+			_ = co.SaveLoginFailures(f)
+		},
+		DeleteLoginFailures: func(typ, key string) {
+			_ = co.DeleteLoginFailures(typ, key)
+		},
+
+		// Notify admins of lockouts due to repeated failed login attempts.
+		OnLockout: func(l auth.Lockout) {
+			if err := notifs.NotifySystem(i.T("email.lockout.subject"), notifs.TplLoginLockout, l, nil); err != nil {
+				lo.Printf("error sending login lockout notification: %v", err)
+			}
+		},
+	}
+
+	// Failed login attempt limits.
+	lockout := auth.LockoutConfig{
+		MaxAttempts:   ko.Int("security.login_max_attempts"),
+		MaxIPAttempts: ko.Int("security.login_max_ip_attempts"),
+		Duration:      ko.Duration("security.login_lockout_duration"),
 	}
 
 	// Initiaize the auth module.
-	a, err := auth.New(auth.Config{OIDC: oidcCfg}, db, cb, lo)
+	a, err := auth.New(auth.Config{OIDC: oidcCfg, SAML: samlCfg, Lockout: lockout}, db, cb, lo)
 	if err != nil {
 		lo.Fatalf("error initializing auth: %v", err)
 	}
@@ -53,6 +53,9 @@ type App struct {
 	log        *log.Logger
 	bufLog     *buflog.BufLog
 
+	// Warm-up state of SMTP servers by their UUIDs.
+	smtpWarmups map[string]*email.Warmup
+
 	about         about
 	fnOptinNotify func(models.Subscriber, []int) (int, error)
 
@@ -186,8 +189,11 @@ func main() {
 		// Crud core.
 		core = initCore(fbOptinNotify, queries, db, i18n, ko)
 
+		// Load the warm-up state of SMTP servers.
+		smtpWarmups = initSMTPWarmups(core)
+
 		// Initialize all messengers, SMTP and postback.
-		msgrs = append(initSMTPMessengers(), initPostbackMessengers(ko)...)
+		msgrs = append(initSMTPMessengers(smtpWarmups), initPostbackMessengers(ko)...)
 
 		// Campaign manager.
 		mgr = initCampaignManager(msgrs, queries, urlCfg, core, media, i18n, ko)
@@ -196,7 +202,7 @@ func main() {
 		importer = initImporter(queries, db, core, i18n, ko)
 
 		// Initialize the auth manager.
-		hasUsers, auth = initAuth(core, db.DB, ko)
+		hasUsers, auth = initAuth(core, db.DB, i18n, ko)
 
 		// Initialize the webhook/POP3 bounce processor.
 		bounce *bounce.Manager
@@ -262,6 +268,8 @@ func main() {
 		events:     evStream,
 		bufLog:     bufLog,
 
+		smtpWarmups: smtpWarmups,
+
 		pg: paginator.New(paginator.Opt{
 			DefaultPerPage: 20,
 			MaxPerPage:     50,
@@ -279,6 +287,56 @@ func main() {
 		needsUserSetup: !hasUsers,
 	}
 
+	// Start the sequence runner that sends the due steps of drip sequences.
+	if !ko.Bool("passive") {
+		go app.runSequences(ko.Int("app.batch_size"), time.Minute, ko.Int("app.retry_max_attempts"), ko.Duration("app.retry_backoff"))
+	}
+
+	// Start the runner that periodically refreshes the members of saved segments.
+	if !ko.Bool("passive") {
+		go app.runSegmentRefresher(ko.Duration("app.segment_refresh_interval"))
+	}
+
+	// Start the runner that recomputes engagement scores and sunsets inactive subscribers.
+	if !ko.Bool("passive") {
+		var sunset *models.SunsetPolicy
+		if ko.Bool("app.sunset_enabled") && ko.Bool("privacy.individual_tracking") {
+			sunset = &models.SunsetPolicy{
+				Campaigns: ko.Int("app.sunset_campaigns"),
+				Days:      ko.Int("app.sunset_days"),
+				Action:    ko.String("app.sunset_action"),
+				ListID:    ko.Int("app.sunset_list_id"),
+			}
+		}
+		go app.runEngagement(engagementInterval, ko.Int("app.engagement_half_life"), sunset)
+	}
+
+	// Start the runner that clones and sends recurring campaigns on their schedules.
+	if !ko.Bool("passive") {
+		go app.runRecurringCampaigns(time.Minute)
+	}
+
+	// Start the periodic saving of the warm-up state of SMTP servers. Passive instances
+	// don't send campaigns and don't own the state.
+	if !ko.Bool("passive") {
+		go app.syncSMTPWarmups(time.Minute)
+	}
+
+	// Start the retrier that retries the campaign messages that failed to send.
+	if !ko.Bool("passive") {
+		go app.runDeferredRetrier(time.Minute, ko.Int("app.retry_max_attempts"), ko.Duration("app.retry_backoff"))
+	}
+
+	// Start the pruning of delivery log entries past the retention period.
+	if !ko.Bool("passive") && ko.Bool("app.delivery_log") {
+		go app.pruneDeliveries(time.Hour, ko.Int("app.delivery_log_retention"))
+	}
+
+	// Start the pruning of audit log entries past the retention period.
+	if !ko.Bool("passive") {
+		go app.pruneAuditLog(time.Hour, ko.Int("security.audit_log_retention"))
+	}
+
 	// Star the update checker.
 	if ko.Bool("app.check_updates") {
 		go app.checkUpdates(versionString, time.Hour*24)
@@ -303,6 +361,11 @@ func main() {
 		// Close the campaign manager.
 		mgr.Close()
 
+		// Save the warm-up state of SMTP servers.
+		if !ko.Bool("passive") {
+			app.saveSMTPWarmups()
+		}
+
 		// Close the DB pool.
 		db.Close()
 
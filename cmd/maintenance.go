@@ -29,6 +29,8 @@ func (a *App) GCSubscribers(c echo.Context) error {
 		return err
 	}
 
+	setAudit(c, nil, map[string]any{"type": typ, "count": n})
+
 	return c.JSON(http.StatusOK, okResp{struct {
 		Count int `json:"count"`
 	}{n}})
@@ -48,6 +50,8 @@ func (a *App) GCSubscriptions(c echo.Context) error {
 		return err
 	}
 
+	setAudit(c, nil, map[string]any{"before_date": t, "count": n})
+
 	return c.JSON(http.StatusOK, okResp{struct {
 		Count int `json:"count"`
 	}{n}})
@@ -81,3 +85,22 @@ func (a *App) GCCampaignAnalytics(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, okResp{true})
 }
+
+// GCDeliveries garbage collects (deletes) delivery log entries older than the given date.
+func (a *App) GCDeliveries(c echo.Context) error {
+	t, err := time.Parse(time.RFC3339, c.FormValue("before_date"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidData"))
+	}
+
+	n, err := a.core.DeleteDeliveries(t)
+	if err != nil {
+		return err
+	}
+
+	setAudit(c, nil, map[string]any{"before_date": t, "count": n})
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		Count int `json:"count"`
+	}{n}})
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/gofrs/uuid/v5"
 	"github.com/knadh/listmonk/internal/core"
 	"github.com/knadh/listmonk/internal/manager"
@@ -15,6 +17,9 @@ type store struct {
 	queries *models.Queries
 	core    *core.Core
 	media   media.Store
+
+	// Delay before the first retry of a deferred message.
+	retryBackoff time.Duration
 }
 
 type runningCamp struct {
@@ -25,11 +30,12 @@ type runningCamp struct {
 	ListID           int    `db:"list_id"`
 }
 
-func newManagerStore(q *models.Queries, c *core.Core, m media.Store) *store {
+func newManagerStore(q *models.Queries, c *core.Core, m media.Store, retryBackoff time.Duration) *store {
 	return &store{
-		queries: q,
-		core:    c,
-		media:   m,
+		queries:      q,
+		core:         c,
+		media:        m,
+		retryBackoff: retryBackoff,
 	}
 }
 
@@ -85,6 +91,12 @@ func (s *store) UpdateCampaignCounts(campID int, toSend int, sent int, lastSubID
 	return err
 }
 
+// UpdateCampaignSent adds to a campaign's sent count without moving its checkpoint.
+func (s *store) UpdateCampaignSent(campID int, sent int) error {
+	_, err := s.queries.UpdateCampaignSent.Exec(campID, sent)
+	return err
+}
+
 // GetAttachment fetches a media attachment blob.
 func (s *store) GetAttachment(mediaID int) (models.Attachment, error) {
 	m, err := s.core.GetMedia(mediaID, "", "", s.media)
@@ -150,3 +162,98 @@ func (s *store) DeleteSubscriber(id int64) error {
 	_, err := s.queries.DeleteSubscribers.Exec(pq.Int64Array{id})
 	return err
 }
+
+// GetCampaignVariants fetches the A/B test variants of a campaign.
+func (s *store) GetCampaignVariants(campID int) ([]models.CampaignVariant, error) {
+	var out []models.CampaignVariant
+	err := s.queries.GetCampaignVariants.Select(&out, campID, 0)
+	return out, err
+}
+
+// AssignCampaignVariants samples subscribers from a campaign's audience for each of
+// its A/B test variants and marks the test as started.
+func (s *store) AssignCampaignVariants(campID int) error {
+	_, err := s.queries.AssignCampaignVariants.Exec(campID)
+	return err
+}
+
+// NextVariantSubscribers retrieves the next batch of subscribers sampled for an A/B test
+// variant. Like NextSubscribers, every batch is fetched above the last ID of the previous one.
+func (s *store) NextVariantSubscribers(variantID, limit int) ([]models.Subscriber, error) {
+	var out []models.Subscriber
+	err := s.queries.NextVariantSubscribers.Select(&out, variantID, limit)
+	return out, err
+}
+
+// UpdateCampaignABStatus updates the status of a campaign's A/B test.
+func (s *store) UpdateCampaignABStatus(campID int, status string, decideAt time.Time) error {
+	_, err := s.queries.UpdateCampaignABStatus.Exec(campID, status, decideAt)
+	return err
+}
+
+// PickCampaignVariantWinner picks the winning A/B test variant of a campaign and
+// copies its content on to the campaign.
+func (s *store) PickCampaignVariantWinner(campID int) (models.CampaignVariant, error) {
+	var out models.CampaignVariant
+	err := s.queries.PickCampaignVariantWinner.Get(&out, campID)
+	return out, err
+}
+
+// ScheduleCampaignSubscribers creates the per-subscriber delivery schedule of a campaign.
+// It's a no-op if the campaign has already been scheduled.
+func (s *store) ScheduleCampaignSubscribers(campID int, defaultTZ string) error {
+	_, err := s.queries.ScheduleCampaignSubscribers.Exec(campID, defaultTZ)
+	return err
+}
+
+// NextScheduledSubscribers retrieves the next batch of subscribers of a campaign whose
+// scheduled delivery time is due, marking them as sent.
+func (s *store) NextScheduledSubscribers(campID, limit int) ([]models.Subscriber, error) {
+	var out []models.Subscriber
+	err := s.queries.NextScheduledSubscribers.Select(&out, campID, limit)
+	return out, err
+}
+
+// GetCampaignSchedulePending returns the number of subscribers on a campaign's
+// delivery schedule who are yet to be sent to.
+func (s *store) GetCampaignSchedulePending(campID int) (int, error) {
+	var out int
+	err := s.queries.GetCampaignSchedulePending.Get(&out, campID)
+	return out, err
+}
+
+// DeferMessage records a campaign message that failed to send in the deferred
+// deliveries to be retried later.
+func (s *store) DeferMessage(campID, subID, variantID int, messenger, errMsg string) error {
+	_, err := s.queries.DeferDelivery.Exec(campID, subID, variantID, messenger, errMsg, time.Now().Add(s.retryBackoff))
+	return err
+}
+
+// LogDelivery records the delivery status of a campaign message in the delivery log.
+func (s *store) LogDelivery(campID, subID int, messenger, server, response, status string) error {
+	_, err := s.queries.LogDelivery.Exec(campID, subID, messenger, server, response, status)
+	return err
+}
+
+// GetSendLimitCount returns the number of messages sent in the given cap window
+// of a campaign or messenger send limit.
+func (s *store) GetSendLimitCount(key string, winStart time.Time) (int, error) {
+	var out int
+	err := s.queries.GetSendLimitCount.Get(&out, key, winStart)
+	return out, err
+}
+
+// AddSendLimitCount adds n messages to the count of the cap window of a campaign
+// or messenger send limit.
+func (s *store) AddSendLimitCount(key string, winStart time.Time, n int) error {
+	_, err := s.queries.AddSendLimitCount.Exec(key, winStart, n)
+	return err
+}
+
+// DryRunSubscribers retrieves the next batch of subscribers of a campaign after the given
+// subscriber ID for a dry run, without updating the campaign's checkpoint.
+func (s *store) DryRunSubscribers(campID, afterID, limit int) ([]models.Subscriber, error) {
+	var out []models.Subscriber
+	err := s.queries.GetDryRunSubscribers.Select(&out, campID, afterID, limit)
+	return out, err
+}
@@ -2,12 +2,13 @@ package main
 
 import (
 	"bytes"
-	"mime/multipart"
+	"io"
 	"net/http"
 	"path/filepath"
 	"strings"
 
 	"github.com/disintegration/imaging"
+	"github.com/knadh/listmonk/internal/media"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 )
@@ -38,39 +39,47 @@ func (a *App) UploadMedia(c echo.Context) error {
 	}
 	defer src.Close()
 
-	var (
-		// Naive check for content type and extension.
-		ext         = strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Filename)), ".")
-		contentType = file.Header.Get("Content-Type")
-	)
+	m, err := a.storeMedia(file.Filename, file.Header.Get("Content-Type"), src)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{m})
+}
+
+// storeMedia validates a file, uploads it and its thumbnail to the media store,
+// and records it in the DB.
+func (a *App) storeMedia(fileName, contentType string, src io.ReadSeeker) (media.Media, error) {
+	// Naive check for content type and extension.
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
 
 	// Validate file extension.
 	if !inArray("*", a.cfg.MediaUpload.Extensions) {
 		if ok := inArray(ext, a.cfg.MediaUpload.Extensions); !ok {
-			return echo.NewHTTPError(http.StatusBadRequest,
+			return media.Media{}, echo.NewHTTPError(http.StatusBadRequest,
 				a.i18n.Ts("media.unsupportedFileType", "type", ext))
 		}
 	}
 
 	// Sanitize the filename.
-	fName := makeFilename(file.Filename)
+	fName := makeFilename(fileName)
 
 	// If the filename already exists in the DB, make it unique by adding a random suffix.
 	if _, err := a.core.GetMedia(0, "", fName, a.media); err == nil {
 		suffix, err := generateRandomString(6)
 		if err != nil {
 			a.log.Printf("error generating random string: %v", err)
-			return echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
+			return media.Media{}, echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
 		}
 
 		fName = appendSuffixToFilename(fName, suffix)
 	}
 
 	// Upload the file to the media store.
-	fName, err = a.media.Put(fName, contentType, src)
+	fName, err := a.media.Put(fName, contentType, src)
 	if err != nil {
 		a.log.Printf("error uploading file: %v", err)
-		return echo.NewHTTPError(http.StatusInternalServerError,
+		return media.Media{}, echo.NewHTTPError(http.StatusInternalServerError,
 			a.i18n.Ts("media.errorUploading", "error", err.Error()))
 	}
 
@@ -96,11 +105,19 @@ func (a *App) UploadMedia(c echo.Context) error {
 	// Create thumbnail from file for non-vector formats.
 	isImage := inArray(ext, imageExts)
 	if isImage {
-		thumbFile, wi, he, err := processImage(file)
+		// Rewind the file that was read by the upload.
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			cleanUp = true
+			a.log.Printf("error reading image: %v", err)
+			return media.Media{}, echo.NewHTTPError(http.StatusInternalServerError,
+				a.i18n.Ts("media.errorReadingFile", "error", err.Error()))
+		}
+
+		thumbFile, wi, he, err := processImage(src)
 		if err != nil {
 			cleanUp = true
 			a.log.Printf("error resizing image: %v", err)
-			return echo.NewHTTPError(http.StatusInternalServerError,
+			return media.Media{}, echo.NewHTTPError(http.StatusInternalServerError,
 				a.i18n.Ts("media.errorResizing", "error", err.Error()))
 		}
 		width = wi
@@ -111,7 +128,7 @@ func (a *App) UploadMedia(c echo.Context) error {
 		if err != nil {
 			cleanUp = true
 			a.log.Printf("error saving thumbnail: %v", err)
-			return echo.NewHTTPError(http.StatusInternalServerError,
+			return media.Media{}, echo.NewHTTPError(http.StatusInternalServerError,
 				a.i18n.Ts("media.errorSavingThumbnail", "error", err.Error()))
 		}
 		thumbfName = tf
@@ -133,10 +150,10 @@ func (a *App) UploadMedia(c echo.Context) error {
 	m, err := a.core.InsertMedia(fName, thumbfName, contentType, meta, a.cfg.MediaUpload.Provider, a.media)
 	if err != nil {
 		cleanUp = true
-		return err
+		return media.Media{}, err
 	}
 
-	return c.JSON(http.StatusOK, okResp{m})
+	return m, nil
 }
 
 // GetAllMedia handles retrieval of uploaded media.
@@ -193,13 +210,7 @@ func (a *App) DeleteMedia(c echo.Context) error {
 
 // processImage reads the image file and returns thumbnail bytes and
 // the original image's width, and height.
-func processImage(file *multipart.FileHeader) (*bytes.Reader, int, int, error) {
-	src, err := file.Open()
-	if err != nil {
-		return nil, 0, 0, err
-	}
-	defer src.Close()
-
+func processImage(src io.Reader) (*bytes.Reader, int, int, error) {
 	img, err := imaging.Decode(src)
 	if err != nil {
 		return nil, 0, 0, err
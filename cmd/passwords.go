@@ -0,0 +1,215 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/internal/notifs"
+	"github.com/knadh/listmonk/internal/utils"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	// Duration for which a password reset link is valid.
+	passwordResetTTL = time.Hour
+
+	// Max password reset requests per IP and max reset links sent to a user
+	// within passwordResetWindow.
+	passwordResetMaxIP   = 5
+	passwordResetMaxUser = 3
+	passwordResetWindow  = time.Hour
+)
+
+type loginResetTpl struct {
+	Title string
+	Error string
+
+	// Token of a valid reset link for which the new password form is shown.
+	Token string
+
+	// Reset link sent / password reset.
+	Sent bool
+	Done bool
+}
+
+type passwordResetEmail struct {
+	Name     string
+	ResetURL string
+	TTL      string
+}
+
+// ForgotPasswordPage renders the page for requesting a password reset link and handles
+// its form. To not reveal whether an account exists, the same response is rendered
+// whether a link is sent or not.
+func (a *App) ForgotPasswordPage(c echo.Context) error {
+	out := loginResetTpl{Title: a.i18n.T("users.resetPassword")}
+
+	if c.Request().Method == http.MethodPost {
+		if err := a.doPasswordResetRequest(c); err != nil {
+			out.Error = httpErrMsg(err)
+		} else {
+			out.Sent = true
+		}
+	}
+
+	return c.Render(http.StatusOK, "admin-login-reset", out)
+}
+
+// ResetPasswordPage renders the page for setting a new password with a password reset
+// link and handles its form.
+func (a *App) ResetPasswordPage(c echo.Context) error {
+	token := strings.TrimSpace(c.FormValue("token"))
+	if token == "" {
+		return c.Redirect(http.StatusFound, path.Join(uriAdmin, "/login/forgot"))
+	}
+
+	out := loginResetTpl{Title: a.i18n.T("users.resetPassword")}
+
+	// Check the link before showing the form.
+	if _, err := a.core.GetPasswordResetUser(token); err != nil {
+		out.Error = httpErrMsg(err)
+		return c.Render(http.StatusOK, "admin-login-reset", out)
+	}
+
+	out.Token = token
+	if c.Request().Method == http.MethodPost {
+		if err := a.doPasswordReset(c, token); err != nil {
+			out.Error = httpErrMsg(err)
+		} else {
+			out.Token = ""
+			out.Done = true
+		}
+	}
+
+	return c.Render(http.StatusOK, "admin-login-reset", out)
+}
+
+// doPasswordResetRequest rate-limits a password reset request and e-mails a reset link
+// if the e-mail belongs to a user who can log in with a password. Requests for unknown
+// e-mails and ineligible users are logged, but don't return an error.
+func (a *App) doPasswordResetRequest(c echo.Context) error {
+	var (
+		email = strings.TrimSpace(c.FormValue("email"))
+		ip    = c.RealIP()
+	)
+	if !utils.ValidateEmail(email) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "email"))
+	}
+
+	// Errors are not returned as they'd reveal whether the account exists.
+	user, err := a.core.GetUser(0, "", email)
+	if err != nil {
+		user = auth.User{}
+	}
+
+	nIP, nUser, err := a.core.GetPasswordResetCounts(ip, user.ID, time.Now().Add(-passwordResetWindow))
+	if err != nil {
+		return err
+	}
+	if nIP >= passwordResetMaxIP {
+		a.log.Printf("password reset: too many requests from %s", ip)
+		return echo.NewHTTPError(http.StatusTooManyRequests, a.i18n.T("users.resetPasswordTooMany"))
+	}
+
+	// OIDC-only, API, and disabled users can't reset their passwords.
+	if user.ID == 0 || user.Type != auth.UserTypeUser || user.Status != auth.UserStatusEnabled ||
+		!user.PasswordLogin || !user.Email.Valid {
+		a.log.Printf("password reset: requested for unknown or ineligible account %s from %s", email, ip)
+		return a.core.CreatePasswordReset(0, email, "", ip, null.Time{})
+	}
+
+	// Don't flood the user's inbox. The request is still recorded against the IP.
+	if nUser >= passwordResetMaxUser {
+		a.log.Printf("password reset: too many links sent to user %d (%s), requested from %s", user.ID, user.Username, ip)
+		return a.core.CreatePasswordReset(0, email, "", ip, null.Time{})
+	}
+
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		a.log.Printf("error generating password reset token: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
+	}
+
+	if err := a.core.CreatePasswordReset(user.ID, email, token, ip, null.TimeFrom(time.Now().Add(passwordResetTTL))); err != nil {
+		return err
+	}
+	a.logPasswordReset(c, user, "users.password_reset_request")
+
+	// Send the link.
+	data := passwordResetEmail{
+		Name:     user.Name,
+		ResetURL: a.urlCfg.RootURL + path.Join(uriAdmin, "/login/reset") + "?token=" + url.QueryEscape(token),
+		TTL:      strconv.Itoa(int(passwordResetTTL.Minutes())),
+	}
+	if err := notifs.Notify([]string{user.Email.String}, a.i18n.T("email.passwordReset.subject"), notifs.TplPasswordReset, data, nil); err != nil {
+		a.log.Printf("error sending password reset e-mail to user %d (%s): %v", user.ID, user.Username, err)
+	}
+
+	return nil
+}
+
+// doPasswordReset validates the new password submitted with a reset link and sets it.
+func (a *App) doPasswordReset(c echo.Context, token string) error {
+	var (
+		password  = strings.TrimSpace(c.FormValue("password"))
+		password2 = strings.TrimSpace(c.FormValue("password2"))
+	)
+	if !strHasLen(password, 8, stdInputMaxLen) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "password"))
+	}
+	if password != password2 {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.passwordMismatch"))
+	}
+
+	id, err := a.core.ResetUserPassword(token, password)
+	if err != nil {
+		return err
+	}
+
+	user, err := a.core.GetUser(id, "", "")
+	if err != nil {
+		user = auth.User{}
+		user.ID = id
+	} else {
+		// The user has proven ownership of the account. Lift any lockout from guessing its password.
+		a.auth.ClearLoginFailures(user.Username)
+	}
+	a.log.Printf("password reset: user %d (%s) reset their password from %s", user.ID, user.Username, c.RealIP())
+	a.logPasswordReset(c, user, "users.password_reset")
+
+	return nil
+}
+
+// logPasswordReset records a password reset action of a user, who isn't logged in,
+// in the audit log.
+func (a *App) logPasswordReset(c echo.Context, user auth.User, action string) {
+	a.core.AddAuditLog(models.AuditLog{
+		UserID:     null.IntFrom(user.ID),
+		Username:   user.Username,
+		IP:         c.RealIP(),
+		Method:     c.Request().Method,
+		Path:       c.Path(),
+		Action:     action,
+		EntityType: "users",
+		EntityID:   strconv.Itoa(user.ID),
+		Status:     http.StatusOK,
+	})
+}
+
+// httpErrMsg returns the message of an error to render on a page.
+func httpErrMsg(err error) string {
+	if e, ok := err.(*echo.HTTPError); ok {
+		if s, ok := e.Message.(string); ok {
+			return s
+		}
+	}
+
+	return err.Error()
+}
@@ -269,6 +269,16 @@ func (a *App) SubscriptionPrefs(c echo.Context) error {
 				makeMsgTpl(a.i18n.T("public.errorTitle"), "", a.i18n.T("public.errorProcessingRequest")))
 		}
 
+		ev := models.SubscriberEvent{
+			Type:         models.SubscriberEventUnsubscribed,
+			Source:       models.SubscriberEventSourceSubscriber,
+			CampaignUUID: campUUID,
+		}
+		if blocklist {
+			ev.Type = models.SubscriberEventBlocklisted
+		}
+		a.core.AddSubscriberEvents(nil, []string{subUUID}, ev)
+
 		return c.Render(http.StatusOK, tplMessage,
 			makeMsgTpl(a.i18n.T("public.unsubbedTitle"), "", a.i18n.T("public.unsubbedInfo")))
 	}
@@ -293,6 +303,7 @@ func (a *App) SubscriptionPrefs(c echo.Context) error {
 			makeMsgTpl(a.i18n.T("public.errorTitle"), "", a.i18n.Ts("globals.messages.pFound",
 				"name", a.i18n.T("globals.terms.subscriber"))))
 	}
+	nameChanged := sub.Name != req.Name
 	sub.Name = req.Name
 
 	// Update the subscriber properties in the DB.
@@ -332,6 +343,21 @@ func (a *App) SubscriptionPrefs(c echo.Context) error {
 
 	}
 
+	// Record the changes in the subscriber's history. Lists that the subscriber
+	// has unsubscribed from are recorded in the event.
+	if nameChanged || len(unsubUUIDs) > 0 {
+		fields := []string{}
+		if nameChanged {
+			fields = append(fields, "name")
+		}
+		a.core.AddSubscriberEvents([]int{sub.ID}, nil, models.SubscriberEvent{
+			Type:      models.SubscriberEventPrefsUpdated,
+			Source:    models.SubscriberEventSourceSubscriber,
+			ListUUIDs: unsubUUIDs,
+			Meta:      models.JSON{"fields": fields},
+		})
+	}
+
 	return c.Render(http.StatusOK, tplMessage,
 		makeMsgTpl(a.i18n.T("globals.messages.done"), "", a.i18n.T("public.prefsSaved")))
 }
@@ -390,6 +416,18 @@ func (a *App) OptinPage(c echo.Context) error {
 				makeMsgTpl(a.i18n.T("public.errorTitle"), "", a.i18n.Ts("public.errorProcessingRequest")))
 		}
 
+		// Record the confirmed lists, which are all the unconfirmed lists if none were given.
+		listIDs := make([]int, 0, len(lists))
+		for _, l := range lists {
+			listIDs = append(listIDs, l.ID)
+		}
+		a.core.AddSubscriberEvents(nil, []string{subUUID}, models.SubscriberEvent{
+			Type:    models.SubscriberEventOptinConfirmed,
+			Source:  models.SubscriberEventSourceSubscriber,
+			ListIDs: listIDs,
+			Meta:    meta,
+		})
+
 		return c.Render(http.StatusOK, tplMessage,
 			makeMsgTpl(a.i18n.T("public.subConfirmedTitle"), "", a.i18n.Ts("public.subConfirmed")))
 	}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gdgvda/cron"
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/internal/feed"
+	"github.com/knadh/listmonk/models"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+const feedTimeout = 30 * time.Second
+
+// runRecurringCampaigns periodically checks active recurring campaigns and runs
+// the ones whose cron schedules are due.
+func (a *App) runRecurringCampaigns(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for range t.C {
+		ids, err := a.core.GetRecurringCampaigns()
+		if err != nil {
+			continue
+		}
+
+		for _, id := range ids {
+			if err := a.runRecurringCampaign(id, time.Now()); err != nil {
+				a.log.Printf("error running recurring campaign (%d): %v", id, err)
+			}
+		}
+	}
+}
+
+// runRecurringCampaign clones a recurring campaign into a new campaign and starts it
+// if its cron schedule is due. If the campaign has a feed, the clone is filled with
+// the feed items that weren't in the feed on the last run (and if they're dated, that
+// were published since), and if there are none, the run is skipped.
+// If approvals are required, the clone is submitted for approval instead of being started
+// as its content (feed items) is new.
+func (a *App) runRecurringCampaign(id int, now time.Time) error {
+	cm, err := a.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	sched, err := cron.ParseStandard(cm.RecurCron)
+	if err != nil {
+		return err
+	}
+
+	// The schedule runs from the last run, or from when the campaign was last modified
+	// (scheduled) if it's never run.
+	from := cm.UpdatedAt.Time
+	if cm.RecurLastRunAt.Valid {
+		from = cm.RecurLastRunAt.Time
+	}
+	if sched.Next(from).After(now) {
+		return nil
+	}
+
+	// Record the run upfront so that a failing feed isn't retried until the next run.
+	if err := a.core.UpdateCampaignRecurrence(cm.ID, now, nil, nil); err != nil {
+		return err
+	}
+
+	// Get the feed items that are new since the last run.
+	var (
+		items      = models.FeedItems{}
+		guids      []string
+		lastItemAt *time.Time
+	)
+	if cm.RecurFeedURL != "" {
+		all, err := feed.Fetch(cm.RecurFeedURL, feedTimeout)
+		if err != nil {
+			return fmt.Errorf("error fetching feed %s: %v", cm.RecurFeedURL, err)
+		}
+
+		seen := make(map[string]bool, len(cm.RecurLastItems))
+		for _, g := range cm.RecurLastItems {
+			seen[g] = true
+		}
+
+		guids = make([]string, 0, len(all))
+		for _, i := range all {
+			guids = append(guids, i.GUID)
+
+			if seen[i.GUID] {
+				continue
+			}
+			if cm.RecurLastItemAt.Valid && !i.PublishedAt.IsZero() && !i.PublishedAt.After(cm.RecurLastItemAt.Time) {
+				continue
+			}
+			items = append(items, i)
+		}
+
+		if len(items) == 0 {
+			a.log.Printf("skipping recurring campaign (%d) run as there are no new feed items", cm.ID)
+			return nil
+		}
+
+		// Items are sorted latest first (undated ones last).
+		if t := items[0].PublishedAt; !t.IsZero() {
+			lastItemAt = &t
+		}
+	}
+
+	// Clone the campaign along with its lists and attachments.
+	var lists []struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(cm.Lists, &lists); err != nil {
+		return err
+	}
+	listIDs := make([]int, 0, len(lists))
+	for _, l := range lists {
+		// Lists that have been deleted since.
+		if l.ID > 0 {
+			listIDs = append(listIDs, l.ID)
+		}
+	}
+
+	var media []struct {
+		ID null.Int `json:"id"`
+	}
+	if len(cm.Media) > 0 {
+		if err := json.Unmarshal(cm.Media, &media); err != nil {
+			return err
+		}
+	}
+	mediaIDs := make([]int, 0, len(media))
+	for _, m := range media {
+		if m.ID.Valid {
+			mediaIDs = append(mediaIDs, m.ID.Int)
+		}
+	}
+
+	c := cm
+	c.Name = fmt.Sprintf("%s (%s)", cm.Name, now.Format("2006-01-02 15:04"))
+	c.SendAt = null.TimeFrom(now)
+	c.RecurCron = ""
+	c.RecurFeedURL = ""
+	c.ParentID = null.IntFrom(cm.ID)
+	c.FeedItems = items
+	if cm.ArchiveSlug.Valid {
+		c.ArchiveSlug = null.StringFrom(cm.ArchiveSlug.String + "-" + now.Format("2006-01-02-1504"))
+	}
+
+	out, err := a.core.CreateCampaign(c, listIDs, mediaIDs)
+	if err != nil {
+		return err
+	}
+
+	if a.cfg.CampaignApproval {
+		if err := a.requestRecurringApproval(cm, out); err != nil {
+			return err
+		}
+	} else if _, err := a.core.UpdateCampaignStatus(out.ID, models.CampaignStatusRunning); err != nil {
+		return err
+	}
+
+	if guids != nil {
+		if err := a.core.UpdateCampaignRecurrence(cm.ID, now, lastItemAt, guids); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// requestRecurringApproval submits a run (clone) of a recurring campaign for approval
+// and notifies the approvers.
+func (a *App) requestRecurringApproval(parent models.Campaign, c models.Campaign) error {
+	out, err := a.core.UpdateCampaignStatus(c.ID, models.CampaignStatusPendingApproval)
+	if err != nil {
+		return err
+	}
+
+	note := a.i18n.Ts("campaigns.approvalRecurringRun", "name", parent.Name)
+	if err := a.core.AddCampaignApproval(c.ID, 0, models.ApprovalActionRequested, note); err != nil {
+		return err
+	}
+	a.notifyCampaignApproval(out, models.ApprovalActionRequested, auth.User{Name: parent.Name}, note)
+
+	return nil
+}
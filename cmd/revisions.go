@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetCampaignRevisions retrieves the paginated content revisions of a campaign.
+func (a *App) GetCampaignRevisions(c echo.Context) error {
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeGet, id, c); err != nil {
+		return err
+	}
+
+	return a.getRevisions(c, id, 0)
+}
+
+// GetCampaignRevision retrieves a content revision of a campaign.
+func (a *App) GetCampaignRevision(c echo.Context) error {
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeGet, id, c); err != nil {
+		return err
+	}
+
+	revID, err := a.getRevisionID(c)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.GetRevision(id, 0, revID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetCampaignRevisionDiff returns the changes between a revision of a campaign and
+// another revision (?to=id), or the campaign's current content.
+func (a *App) GetCampaignRevisionDiff(c echo.Context) error {
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeGet, id, c); err != nil {
+		return err
+	}
+
+	revID, err := a.getRevisionID(c)
+	if err != nil {
+		return err
+	}
+	toID, _ := strconv.Atoi(c.QueryParam("to"))
+
+	out, err := a.core.DiffCampaignRevision(id, revID, toID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// RestoreCampaignRevision restores the content of a campaign to a revision. The
+// restoration is saved like any other edit and is itself recorded as a revision.
+func (a *App) RestoreCampaignRevision(c echo.Context) error {
+	id := getID(c)
+
+	// Check if the user has access to the campaign.
+	if err := a.checkCampaignPerm(auth.PermTypeManage, id, c); err != nil {
+		return err
+	}
+
+	revID, err := a.getRevisionID(c)
+	if err != nil {
+		return err
+	}
+
+	rev, err := a.core.GetRevision(id, 0, revID)
+	if err != nil {
+		return err
+	}
+
+	cm, err := a.core.GetCampaign(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	if !canEditCampaign(cm.Status) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.cantUpdate"))
+	}
+
+	// Apply the revision's fields on the campaign's current state.
+	var (
+		content = campaignContent(cm, getJSONIDs(cm.Lists), getJSONIDs(cm.Media))
+		o       = campReq{Campaign: cm, ListIDs: getJSONIDs(cm.Lists), MediaIDs: getJSONIDs(cm.Media)}
+	)
+	o.Headers = nil
+	if err := json.Unmarshal(rev.Data, &o.Campaign); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			a.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.revision}", "error", err.Error()))
+	}
+
+	return a.updateCampaign(c, cm, content, o)
+}
+
+// GetTemplateRevisions retrieves the paginated revisions of a template.
+func (a *App) GetTemplateRevisions(c echo.Context) error {
+	return a.getRevisions(c, 0, getID(c))
+}
+
+// GetTemplateRevision retrieves a revision of a template.
+func (a *App) GetTemplateRevision(c echo.Context) error {
+	revID, err := a.getRevisionID(c)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.GetRevision(0, getID(c), revID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetTemplateRevisionDiff returns the changes between a revision of a template and
+// another revision (?to=id), or the template's current content.
+func (a *App) GetTemplateRevisionDiff(c echo.Context) error {
+	revID, err := a.getRevisionID(c)
+	if err != nil {
+		return err
+	}
+	toID, _ := strconv.Atoi(c.QueryParam("to"))
+
+	out, err := a.core.DiffTemplateRevision(getID(c), revID, toID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// RestoreTemplateRevision restores a template to a revision. The restoration
+// is itself recorded as a revision.
+func (a *App) RestoreTemplateRevision(c echo.Context) error {
+	id := getID(c)
+
+	revID, err := a.getRevisionID(c)
+	if err != nil {
+		return err
+	}
+
+	rev, err := a.core.GetRevision(0, id, revID)
+	if err != nil {
+		return err
+	}
+
+	o, err := a.core.GetTemplate(id, false)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(rev.Data, &o); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			a.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.revision}", "error", err.Error()))
+	}
+
+	return a.updateTemplate(c, id, o)
+}
+
+// getRevisions responds with the paginated revisions of a campaign or a template.
+func (a *App) getRevisions(c echo.Context, campID, tplID int) error {
+	pg := a.pg.NewFromURL(c.Request().URL.Query())
+
+	res, total, err := a.core.GetRevisions(campID, tplID, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	// No results.
+	if len(res) == 0 {
+		return c.JSON(http.StatusOK, okResp{models.PageResults{Results: []models.Revision{}}})
+	}
+
+	out := models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// getRevisionID returns the revision ID in the URL.
+func (a *App) getRevisionID(c echo.Context) (int, error) {
+	id, _ := strconv.Atoi(c.Param("revID"))
+	if id < 1 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidID"))
+	}
+
+	return id, nil
+}
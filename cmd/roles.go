@@ -46,6 +46,7 @@ func (a *App) CreateUserRole(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	setAudit(c, nil, map[string]any{"name": out.Name, "permissions": out.Permissions})
 
 	return c.JSON(http.StatusOK, okResp{out})
 }
@@ -65,6 +66,7 @@ func (a *App) CreateListRole(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	setAudit(c, nil, map[string]any{"name": out.Name, "lists": r.Lists})
 
 	return c.JSON(http.StatusOK, okResp{out})
 }
@@ -90,11 +92,19 @@ func (a *App) UpdateUserRole(c echo.Context) error {
 	// Validate.
 	r.Name.String = strings.TrimSpace(r.Name.String)
 
+	// Get the role as it was before the update for the audit log.
+	cur, err := a.core.GetRole(id)
+	if err != nil {
+		return err
+	}
+
 	// Update the role in the DB.
 	out, err := a.core.UpdateUserRole(id, r)
 	if err != nil {
 		return err
 	}
+	setAudit(c, map[string]any{"name": cur.Name, "permissions": cur.Permissions},
+		map[string]any{"name": out.Name, "permissions": out.Permissions})
 
 	// Cache API tokens for in-memory, off-DB /api/* request auth.
 	if _, err := cacheUsers(a.core, a.auth); err != nil {
@@ -132,6 +142,7 @@ func (a *App) UpdateListRole(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	setAudit(c, nil, map[string]any{"name": out.Name, "lists": r.Lists})
 
 	// Cache API tokens for in-memory, off-DB /api/* request auth.
 	if _, err := cacheUsers(a.core, a.auth); err != nil {
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Cookie that tracks a SAML authentication request until the IdP responds.
+	samlCookie    = "saml_request"
+	samlCookieTTL = time.Minute * 10
+)
+
+type samlState struct {
+	RequestID string `json:"request_id"`
+	Next      string `json:"next"`
+}
+
+// SAMLMetadata serves the SAML SP metadata XML to be registered with the IdP.
+func (a *App) SAMLMetadata(c echo.Context) error {
+	if !a.auth.SAMLEnabled() {
+		return echo.NewHTTPError(http.StatusNotFound, a.i18n.T("users.invalidRequest"))
+	}
+
+	b, err := a.auth.GetSAMLMetadata()
+	if err != nil {
+		a.log.Printf("error generating SAML metadata: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
+	}
+
+	return c.Blob(http.StatusOK, "application/samlmetadata+xml", b)
+}
+
+// SAMLLogin initializes a SAML authentication request and redirects to the IdP for login.
+func (a *App) SAMLLogin(c echo.Context) error {
+	// Verify that the request came from the login page (CSRF).
+	nonce, err := c.Cookie("nonce")
+	if err != nil || nonce.Value == "" || nonce.Value != c.FormValue("nonce") {
+		return echo.NewHTTPError(http.StatusUnauthorized, a.i18n.T("users.invalidRequest"))
+	}
+	if !a.auth.SAMLEnabled() {
+		return a.renderLoginPage(c, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.invalidRequest")))
+	}
+
+	// Sanitize the URL and make it relative.
+	next := utils.SanitizeURI(c.FormValue("next"))
+	if next == "/" {
+		next = uriAdmin
+	}
+
+	u, reqID, err := a.auth.GetSAMLAuthURL()
+	if err != nil {
+		a.log.Printf("error creating SAML request: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
+	}
+
+	// Remember the request to validate the IdP's response against.
+	b, err := json.Marshal(samlState{RequestID: reqID, Next: next})
+	if err != nil {
+		a.log.Printf("error marshalling SAML state: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
+	}
+	a.setSAMLCookie(c, base64.URLEncoding.EncodeToString(b), samlCookieTTL)
+
+	// Redirect to the IdP.
+	return c.Redirect(http.StatusFound, u)
+}
+
+// SAMLFinish receives the IdP's response on the assertion consumer service (ACS)
+// endpoint and logs the user in.
+func (a *App) SAMLFinish(c echo.Context) error {
+	if !a.auth.SAMLEnabled() {
+		return a.renderLoginPage(c, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.invalidRequest")))
+	}
+
+	// Get the request that the response is to.
+	cookie, err := c.Cookie(samlCookie)
+	if err != nil || cookie.Value == "" {
+		return a.renderLoginPage(c, echo.NewHTTPError(http.StatusUnauthorized, a.i18n.T("users.invalidRequest")))
+	}
+	a.setSAMLCookie(c, "", -1)
+
+	var state samlState
+	if b, err := base64.URLEncoding.DecodeString(cookie.Value); err != nil || json.Unmarshal(b, &state) != nil {
+		return a.renderLoginPage(c, echo.NewHTTPError(http.StatusUnauthorized, a.i18n.T("users.invalidRequest")))
+	}
+
+	// Validate the response.
+	claims, err := a.auth.ParseSAMLResponse(c.Request(), state.RequestID)
+	if err != nil {
+		return a.renderLoginPage(c, echo.NewHTTPError(http.StatusUnauthorized, a.i18n.T("users.invalidRequest")))
+	}
+
+	cfg := a.cfg.Security.SAML
+	user, err := a.getSSOUser(c, ssoUser{Email: claims.Email, Name: claims.Name, Claims: claims.Attributes}, ssoOptions{
+		AutoCreate:        cfg.AutoCreateUsers,
+		DefaultUserRoleID: cfg.DefaultUserRoleID,
+		GroupsClaim:       cfg.AttrGroups,
+		RoleMappings:      cfg.RoleMappings,
+	})
+	if err != nil {
+		return a.renderLoginPage(c, err)
+	}
+
+	// Update the user login state (logged in date) in the DB.
+	if err := a.core.UpdateUserLogin(user.ID, ""); err != nil {
+		return a.renderLoginPage(c, err)
+	}
+
+	// Set the session in the DB and cookie.
+	needsTOTP, err := a.saveLoginSession(user, "", c)
+	if err != nil {
+		return a.renderLoginPage(c, err)
+	}
+
+	// Continue to two-factor authentication.
+	if needsTOTP {
+		return c.Redirect(http.StatusFound, totpLoginURI(utils.SanitizeURI(state.Next)))
+	}
+
+	return c.Redirect(http.StatusFound, utils.SanitizeURI(state.Next))
+}
+
+// setSAMLCookie sets the cookie that tracks a SAML request. The IdP POSTs its response
+// cross-site, which only carries SameSite=None cookies, which in turn have to be Secure.
+func (a *App) setSAMLCookie(c echo.Context, val string, ttl time.Duration) {
+	ck := &http.Cookie{
+		Name:     samlCookie,
+		Value:    val,
+		Path:     "/auth/saml",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if strings.HasPrefix(a.urlCfg.RootURL, "https://") {
+		ck.SameSite = http.SameSiteNoneMode
+		ck.Secure = true
+	}
+
+	c.SetCookie(ck)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/internal/segment"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetSegments handles the retrieval of segments.
+func (a *App) GetSegments(c echo.Context) error {
+	out, err := a.core.GetSegments()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetSegment handles the retrieval of a segment.
+func (a *App) GetSegment(c echo.Context) error {
+	out, err := a.core.GetSegment(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateSegment handles the creation of a segment.
+func (a *App) CreateSegment(c echo.Context) error {
+	var o models.Segment
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	// Validate.
+	if err := a.validateSegment(o, auth.GetUser(c)); err != nil {
+		return err
+	}
+
+	out, err := a.core.CreateSegment(o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateSegment handles the modification of a segment.
+func (a *App) UpdateSegment(c echo.Context) error {
+	id := getID(c)
+
+	// Read the incoming params into the existing segment fields from the DB.
+	o, err := a.core.GetSegment(id)
+	if err != nil {
+		return err
+	}
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	// Validate.
+	if err := a.validateSegment(o, auth.GetUser(c)); err != nil {
+		return err
+	}
+
+	out, err := a.core.UpdateSegment(id, o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteSegment handles the deletion of a segment.
+func (a *App) DeleteSegment(c echo.Context) error {
+	if err := a.core.DeleteSegment(getID(c)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// RefreshSegment handles the on-demand refresh of the members of a segment.
+func (a *App) RefreshSegment(c echo.Context) error {
+	id := getID(c)
+	if err := a.core.RefreshSegment(id); err != nil {
+		return err
+	}
+
+	return a.GetSegment(c)
+}
+
+// PreviewSegment handles the counting of the subscribers who match a set of
+// rules without saving them as a segment.
+func (a *App) PreviewSegment(c echo.Context) error {
+	var o models.Segment
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	if err := segment.Validate(o.Rules); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("segments.invalidRules", "error", err.Error()))
+	}
+
+	if err := checkSegmentListPerms(o.Rules, auth.GetUser(c)); err != nil {
+		return err
+	}
+
+	total, err := a.core.CountSegmentSubscribers(o.Rules)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		Total int `json:"total"`
+	}{total}})
+}
+
+// validateSegment validates segment fields and checks that the user has access
+// to the lists in its rules.
+func (a *App) validateSegment(o models.Segment, user auth.User) error {
+	if !strHasLen(o.Name, 1, stdInputMaxLen) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	if len(o.Description) > stdInputMaxLen {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "description"))
+	}
+
+	if err := segment.Validate(o.Rules); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("segments.invalidRules", "error", err.Error()))
+	}
+
+	return checkSegmentListPerms(o.Rules, user)
+}
+
+// checkSegmentListPerms checks that the user has access to every list that
+// the list rules of a segment refer to.
+func checkSegmentListPerms(r models.SegmentRule, user auth.User) error {
+	for _, id := range segment.ListIDs(r) {
+		if err := user.HasListPerm(auth.PermTypeGet, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runSegmentRefresher periodically refreshes the members and counts of all segments.
+func (a *App) runSegmentRefresher(interval time.Duration) {
+	if interval < time.Minute {
+		interval = time.Hour
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for range t.C {
+		segs, err := a.core.GetSegments()
+		if err != nil {
+			continue
+		}
+
+		for _, s := range segs {
+			if err := a.core.RefreshSegment(s.ID); err != nil {
+				a.log.Printf("error refreshing segment (%d): %v", s.ID, err)
+			}
+		}
+	}
+}
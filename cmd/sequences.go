@@ -0,0 +1,339 @@
+package main
+
+import (
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Time for which a batch of sequence messages is claimed while it's being
+	// sent, after which unsent messages are picked up again.
+	sequenceClaimTimeout = time.Hour
+)
+
+// GetSequences handles the retrieval of sequences.
+func (a *App) GetSequences(c echo.Context) error {
+	out, err := a.core.GetSequences()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// GetSequence handles the retrieval of a sequence.
+func (a *App) GetSequence(c echo.Context) error {
+	out, err := a.core.GetSequence(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateSequence handles the creation of a sequence.
+func (a *App) CreateSequence(c echo.Context) error {
+	var o models.Sequence
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	// Validate.
+	o, err := a.validateSequence(o)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.CreateSequence(o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateSequence handles the modification of a sequence.
+func (a *App) UpdateSequence(c echo.Context) error {
+	id := getID(c)
+
+	// Read the incoming params into the existing sequence fields from the DB.
+	o, err := a.core.GetSequence(id)
+	if err != nil {
+		return err
+	}
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	// Validate.
+	o, err = a.validateSequence(o)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.UpdateSequence(id, o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateSequenceStatus handles the pausing and resuming of a sequence.
+func (a *App) UpdateSequenceStatus(c echo.Context) error {
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if req.Status != models.SequenceStatusActive && req.Status != models.SequenceStatusPaused {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+	}
+
+	out, err := a.core.UpdateSequenceStatus(getID(c), req.Status)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteSequence handles the deletion of a sequence.
+func (a *App) DeleteSequence(c echo.Context) error {
+	if err := a.core.DeleteSequence(getID(c)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// GetSequenceSteps handles the retrieval of the steps of a sequence along with their stats.
+func (a *App) GetSequenceSteps(c echo.Context) error {
+	out, err := a.core.GetSequenceSteps(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateSequenceStep handles the addition of a step to the end of a sequence.
+func (a *App) CreateSequenceStep(c echo.Context) error {
+	id := getID(c)
+
+	// Check if the sequence exists.
+	if _, err := a.core.GetSequence(id); err != nil {
+		return err
+	}
+
+	var o models.SequenceStep
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	// Validate.
+	o, err := a.validateSequenceStep(o)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.CreateSequenceStep(id, o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// UpdateSequenceStep handles the modification of a step of a sequence.
+func (a *App) UpdateSequenceStep(c echo.Context) error {
+	id := getID(c)
+
+	stepID, _ := strconv.Atoi(c.Param("stepID"))
+	if stepID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidID"))
+	}
+
+	// Read the incoming params into the existing step fields from the DB.
+	o, err := a.core.GetSequenceStep(id, stepID)
+	if err != nil {
+		return err
+	}
+	if err := c.Bind(&o); err != nil {
+		return err
+	}
+
+	// Validate.
+	o, err = a.validateSequenceStep(o)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.core.UpdateSequenceStep(id, stepID, o)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteSequenceStep handles the deletion of a step of a sequence.
+func (a *App) DeleteSequenceStep(c echo.Context) error {
+	id := getID(c)
+
+	stepID, _ := strconv.Atoi(c.Param("stepID"))
+	if stepID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := a.core.DeleteSequenceStep(id, stepID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// validateSequence validates sequence fields and sets defaults.
+func (a *App) validateSequence(o models.Sequence) (models.Sequence, error) {
+	if !strHasLen(o.Name, 1, stdInputMaxLen) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	if !o.ListID.Valid || o.ListID.Int < 1 {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "list_id"))
+	}
+
+	if o.Status == "" {
+		o.Status = models.SequenceStatusActive
+	}
+	if o.Status != models.SequenceStatusActive && o.Status != models.SequenceStatusPaused {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "status"))
+	}
+
+	if o.ExitListIDs == nil {
+		o.ExitListIDs = []int64{}
+	}
+
+	if o.FromEmail == "" {
+		o.FromEmail = a.cfg.FromEmail
+	} else if !reFromAddress.Match([]byte(o.FromEmail)) {
+		if _, err := a.importer.SanitizeEmail(o.FromEmail); err != nil {
+			return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("campaigns.fieldInvalidFromEmail"))
+		}
+	}
+
+	if o.Messenger == "" {
+		o.Messenger = emailMsgr
+	} else if !a.manager.HasMessenger(o.Messenger) {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("campaigns.fieldInvalidMessenger", "name", o.Messenger))
+	}
+
+	return o, nil
+}
+
+// validateSequenceStep validates sequence step fields and sets defaults.
+func (a *App) validateSequenceStep(o models.SequenceStep) (models.SequenceStep, error) {
+	// Steps are sent with transactional templates.
+	if _, err := a.manager.GetTpl(o.TemplateID); err != nil {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("sequences.invalidTemplate"))
+	}
+
+	if o.DelayMins < 0 {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "delay_mins"))
+	}
+
+	if o.ContentType == "" {
+		o.ContentType = models.CampaignContentTypeHTML
+	}
+	if o.ContentType != models.CampaignContentTypeHTML && o.ContentType != models.CampaignContentTypePlain {
+		return o, echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "content_type"))
+	}
+
+	return o, nil
+}
+
+// runSequences periodically exits subscribers from sequences whose exit conditions have
+// been met and sends the next steps of sequences to subscribers whose delays are over.
+// A subscriber's progress is advanced only once a step has been sent. Failed steps are
+// retried with an exponential backoff up to maxAttempts, after which the subscriber is
+// marked as failed in the sequence.
+func (a *App) runSequences(batchSize int, interval time.Duration, maxAttempts int, backoff time.Duration) {
+	// With retries disabled, a subscriber fails on the first failed attempt.
+	maxAttempts = max(maxAttempts, 1)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for range t.C {
+		if _, err := a.core.ExitSequenceSubscribers(); err != nil {
+			continue
+		}
+
+		for {
+			msgs, err := a.core.NextSequenceMessages(batchSize, time.Now().Add(sequenceClaimTimeout))
+			if err != nil || len(msgs) == 0 {
+				break
+			}
+
+			for _, m := range msgs {
+				if err := a.sendSequenceMessage(m); err != nil {
+					var (
+						attempts = m.Attempts + 1
+						wait     = maxRetryBackoff
+					)
+					if attempts < 32 {
+						wait = min(maxRetryBackoff, backoff<<attempts)
+					}
+					if attempts >= maxAttempts {
+						a.log.Printf("giving up on sequence (%d) step (%d) to %s after %d attempts: %v",
+							m.SequenceID, m.StepID, m.Email, attempts, err)
+					} else {
+						a.log.Printf("error sending sequence (%d) step (%d) to %s: %v", m.SequenceID, m.StepID, m.Email, err)
+					}
+
+					_ = a.core.FailSequenceSubscriber(m.SequenceID, m.ID, time.Now().Add(wait), maxAttempts)
+					continue
+				}
+
+				_ = a.core.AdvanceSequenceSubscriber(m.SequenceID, m.ID, m.StepID)
+			}
+		}
+	}
+}
+
+// sendSequenceMessage renders a sequence step's tx template for a subscriber
+// and sends it with the messenger.
+func (a *App) sendSequenceMessage(m models.SequenceMessage) error {
+	tpl, err := a.manager.GetTpl(m.TemplateID)
+	if err != nil {
+		return err
+	}
+
+	tx := models.TxMessage{
+		TemplateID: m.TemplateID,
+		Data:       map[string]any{},
+	}
+	if err := tx.Render(m.Subscriber, tpl); err != nil {
+		return err
+	}
+
+	msg := models.Message{}
+	msg.Subscriber = m.Subscriber
+	msg.To = []string{m.Email}
+	msg.From = m.FromEmail
+	msg.Subject = tx.Subject
+	msg.ContentType = m.ContentType
+	msg.Messenger = m.Messenger
+	msg.Body = tx.Body
+	msg.Headers = textproto.MIMEHeader{}
+	msg.Headers.Set(models.EmailHeaderSubscriberUUID, m.UUID)
+
+	return a.manager.SendMessage(msg)
+}
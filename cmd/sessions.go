@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// GetProfileSessions retrieves the active login sessions of the authenticated user.
+func (a *App) GetProfileSessions(c echo.Context) error {
+	return a.getUserSessions(c, auth.GetUser(c).ID)
+}
+
+// DeleteProfileSessions revokes all the login sessions of the authenticated user
+// other than the current one.
+func (a *App) DeleteProfileSessions(c echo.Context) error {
+	return a.deleteUserSessions(c, auth.GetUser(c).ID)
+}
+
+// DeleteProfileSession revokes a login session of the authenticated user.
+func (a *App) DeleteProfileSession(c echo.Context) error {
+	if err := a.core.DeleteUserSession(auth.GetUser(c).ID, c.Param("sessID")); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// GetUserSessions retrieves the active login sessions of a user.
+func (a *App) GetUserSessions(c echo.Context) error {
+	return a.getUserSessions(c, getID(c))
+}
+
+// DeleteUserSessions revokes all the login sessions of a user. If it's the authenticated
+// user, the current session is retained.
+func (a *App) DeleteUserSessions(c echo.Context) error {
+	return a.deleteUserSessions(c, getID(c))
+}
+
+// DeleteUserSession revokes a login session of a user.
+func (a *App) DeleteUserSession(c echo.Context) error {
+	if err := a.core.DeleteUserSession(getID(c), c.Param("sessID")); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// getUserSessions responds with the active login sessions of a user, marking the
+// session of the request, if any.
+func (a *App) getUserSessions(c echo.Context, userID int) error {
+	out, err := a.core.GetUserSessions(userID)
+	if err != nil {
+		return err
+	}
+
+	cur := auth.GetSessionID(c)
+	for i := range out {
+		out[i].Current = cur != "" && out[i].ID == cur
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// deleteUserSessions revokes all the login sessions of a user except for the session
+// of the request, if any.
+func (a *App) deleteUserSessions(c echo.Context, userID int) error {
+	n, err := a.revokeUserSessions(c, userID)
+	if err != nil {
+		return err
+	}
+	setAudit(c, nil, map[string]any{"user_id": userID, "sessions": n})
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// revokeUserSessions revokes all the login sessions of a user, for instance, when the
+// user is disabled or their password is changed. The session of the request, if any,
+// is retained so that users changing their own password aren't logged out.
+func (a *App) revokeUserSessions(c echo.Context, userID int) (int, error) {
+	var keep string
+	if auth.GetUser(c).ID == userID {
+		keep = auth.GetSessionID(c)
+	}
+
+	n, err := a.core.DeleteUserSessions(userID, "", keep)
+	if err != nil {
+		return 0, err
+	}
+
+	if n > 0 {
+		a.log.Printf("revoked %d login session(s) of user %d", n, userID)
+	}
+
+	return n, nil
+}
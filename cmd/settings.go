@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
 	"io"
 	"net/http"
 	"regexp"
@@ -17,6 +18,7 @@ import (
 	"github.com/knadh/koanf/parsers/json"
 	"github.com/knadh/koanf/providers/rawbytes"
 	"github.com/knadh/koanf/v2"
+	"github.com/knadh/listmonk/internal/auth"
 	"github.com/knadh/listmonk/internal/messenger/email"
 	"github.com/knadh/listmonk/internal/notifs"
 	"github.com/knadh/listmonk/models"
@@ -75,6 +77,7 @@ func (a *App) GetSettings(c echo.Context) error {
 	s.BounceForwardEmail.Key = strings.Repeat(pwdMask, utf8.RuneCountInString(s.BounceForwardEmail.Key))
 	s.SecurityCaptchaSecret = strings.Repeat(pwdMask, utf8.RuneCountInString(s.SecurityCaptchaSecret))
 	s.OIDC.ClientSecret = strings.Repeat(pwdMask, utf8.RuneCountInString(s.OIDC.ClientSecret))
+	s.SAML.SPPrivateKey = strings.Repeat(pwdMask, utf8.RuneCountInString(s.SAML.SPPrivateKey))
 
 	return c.JSON(http.StatusOK, okResp{s})
 }
@@ -225,6 +228,9 @@ func (a *App) UpdateSettings(c echo.Context) error {
 	if set.OIDC.ClientSecret == "" {
 		set.OIDC.ClientSecret = cur.OIDC.ClientSecret
 	}
+	if set.SAML.SPPrivateKey == "" {
+		set.SAML.SPPrivateKey = cur.SAML.SPPrivateKey
+	}
 
 	for n, v := range set.UploadExtensions {
 		set.UploadExtensions[n] = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(v), "."))
@@ -247,6 +253,159 @@ func (a *App) UpdateSettings(c echo.Context) error {
 	}
 	set.DomainAllowlist = doms
 
+	// Validate the default time zone.
+	if set.AppDefaultTimezone == "" {
+		set.AppDefaultTimezone = "UTC"
+	}
+	// LoadLocation() also accepts "Local" (the server's zone) which Postgres doesn't know.
+	if _, err := time.LoadLocation(set.AppDefaultTimezone); err != nil || set.AppDefaultTimezone == "Local" {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("settings.invalidTimezone", "name", set.AppDefaultTimezone))
+	}
+	if ok, err := a.core.IsValidTimezone(set.AppDefaultTimezone); err != nil {
+		return err
+	} else if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("settings.invalidTimezone", "name", set.AppDefaultTimezone))
+	}
+
+	// Validate the warm-up schedules and routing of SMTP servers.
+	for i, srv := range set.SMTP {
+		for _, n := range srv.WarmupSchedule {
+			if n < 1 {
+				return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("settings.smtp.invalidWarmup", "name", srv.Host))
+			}
+		}
+
+		if srv.Weight < 1 {
+			srv.Weight = 1
+		}
+		if srv.CooldownErrors < 0 {
+			srv.CooldownErrors = 0
+		}
+		if srv.CooldownDuration == "" {
+			srv.CooldownDuration = "5m"
+		}
+		if d, err := time.ParseDuration(srv.CooldownDuration); err != nil || d <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("settings.smtp.invalidCooldown", "name", srv.Host))
+		}
+
+		doms := make([]string, 0, len(srv.Domains))
+		for _, d := range srv.Domains {
+			if d = strings.TrimSpace(strings.ToLower(d)); d != "" {
+				doms = append(doms, d)
+			}
+		}
+		srv.Domains = doms
+
+		set.SMTP[i] = srv
+	}
+
+	// Validate the messenger send limits.
+	for n, l := range set.AppMessengerLimits {
+		l.Messenger = strings.TrimSpace(l.Messenger)
+		if l.Messenger == "" || l.Rate < 0 || l.Cap < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("settings.performance.invalidMessengerLimit", "name", l.Messenger))
+		}
+		if l.Window == "" {
+			l.Window = models.ThrottleWindowDay
+		}
+		if l.Window != models.ThrottleWindowHour && l.Window != models.ThrottleWindowDay {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("settings.performance.invalidMessengerLimit", "name", l.Messenger))
+		}
+		set.AppMessengerLimits[n] = l
+	}
+
+	// Validate the retries of deferred messages.
+	if set.AppRetryMaxAttempts < 0 {
+		set.AppRetryMaxAttempts = 0
+	}
+	if set.AppRetryBackoff == "" {
+		set.AppRetryBackoff = "5m"
+	}
+	if d, err := time.ParseDuration(set.AppRetryBackoff); err != nil || d <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "app.retry_backoff"))
+	}
+
+	if set.AppSegmentRefreshInterval == "" {
+		set.AppSegmentRefreshInterval = "1h"
+	}
+	if d, err := time.ParseDuration(set.AppSegmentRefreshInterval); err != nil || d < time.Minute {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "app.segment_refresh_interval"))
+	}
+
+	// Engagement scores and the sunset policy.
+	if set.AppEngagementHalfLife < 1 {
+		set.AppEngagementHalfLife = 30
+	}
+	if set.AppSunsetAction == "" {
+		set.AppSunsetAction = models.SunsetActionUnsubscribe
+	}
+	if set.AppSunsetEnabled {
+		if !set.PrivacyIndividualTracking {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("maintenance.sunsetNeedsTracking"))
+		}
+		if set.AppSunsetCampaigns < 0 || set.AppSunsetDays < 0 || (set.AppSunsetCampaigns == 0 && set.AppSunsetDays == 0) {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("maintenance.sunsetNoCriteria"))
+		}
+		if set.AppSunsetAction != models.SunsetActionUnsubscribe && set.AppSunsetAction != models.SunsetActionMove {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "app.sunset_action"))
+		}
+		if set.AppSunsetAction == models.SunsetActionMove && set.AppSunsetListID < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "app.sunset_list_id"))
+		}
+	}
+
+	if set.AppDeliveryLogRetention < 0 {
+		set.AppDeliveryLogRetention = 0
+	}
+	if set.SecurityAuditLogRetention < 0 {
+		set.SecurityAuditLogRetention = 0
+	}
+
+	// Validate the 2FA policy.
+	switch set.SecurityTOTPRequired {
+	case auth.TOTPRequiredOff, auth.TOTPRequiredAll, auth.TOTPRequiredRoles:
+	case "":
+		set.SecurityTOTPRequired = auth.TOTPRequiredOff
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "security.totp_required"))
+	}
+	if set.SecurityTOTPRequiredRoles == nil {
+		set.SecurityTOTPRequiredRoles = []int{}
+	}
+
+	// Validate the login lockout.
+	if set.SecurityLoginMaxAttempts < 0 {
+		set.SecurityLoginMaxAttempts = 0
+	}
+	if set.SecurityLoginMaxIPAttempts < 0 {
+		set.SecurityLoginMaxIPAttempts = 0
+	}
+	if set.SecurityLoginLockoutDuration == "" {
+		set.SecurityLoginLockoutDuration = "15m"
+	}
+	if d, err := time.ParseDuration(set.SecurityLoginLockoutDuration); err != nil || d < time.Minute {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "security.login_lockout_duration"))
+	}
+
+	// Validate SAML.
+	set.SAML.IDPMetadataURL = strings.TrimSpace(set.SAML.IDPMetadataURL)
+	set.SAML.AttrEmail = strings.TrimSpace(set.SAML.AttrEmail)
+	set.SAML.AttrName = strings.TrimSpace(set.SAML.AttrName)
+	set.SAML.AttrGroups = strings.TrimSpace(set.SAML.AttrGroups)
+	if set.SAML.AttrEmail == "" {
+		set.SAML.AttrEmail = "email"
+	}
+	if set.SAML.Enabled {
+		if set.SAML.IDPMetadataURL == "" && strings.TrimSpace(set.SAML.IDPMetadata) == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "security.saml.idp_metadata"))
+		}
+		if _, err := tls.X509KeyPair([]byte(set.SAML.SPCertificate), []byte(set.SAML.SPPrivateKey)); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "security.saml.sp_certificate"))
+		}
+	}
+	set.SAML.RoleMappings = cleanRoleMappings(set.SAML.RoleMappings)
+	set.OIDC.RoleMappings = cleanRoleMappings(set.OIDC.RoleMappings)
+
 	// Validate slow query caching cron.
 	if set.CacheSlowQueries {
 		if _, err := cron.ParseStandard(set.CacheSlowQueriesInterval); err != nil {
@@ -259,6 +418,9 @@ func (a *App) UpdateSettings(c echo.Context) error {
 		return err
 	}
 
+	// Record the names of the changed settings, and not their values which may be secrets.
+	setAudit(c, nil, map[string]any{"fields": changedSettings(cur, set)})
+
 	// If there are any active campaigns, don't do an auto reload and
 	// warn the user on the frontend.
 	if a.manager.HasRunningCampaigns() {
@@ -285,6 +447,62 @@ func (a *App) GetLogs(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{a.bufLog.Lines()})
 }
 
+// GetSMTPWarmups returns the warm-up status of the SMTP servers that have warm-up schedules.
+func (a *App) GetSMTPWarmups(c echo.Context) error {
+	type warmup struct {
+		UUID string `json:"uuid"`
+		Name string `json:"name"`
+		Host string `json:"host"`
+		email.WarmupStatus
+	}
+
+	var (
+		now = time.Now()
+		out = []warmup{}
+	)
+	for _, item := range ko.Slices("smtp") {
+		w, ok := a.smtpWarmups[item.String("uuid")]
+		if !ok {
+			continue
+		}
+
+		out = append(out, warmup{
+			UUID:         item.String("uuid"),
+			Name:         item.String("name"),
+			Host:         item.String("host"),
+			WarmupStatus: w.Status(now),
+		})
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// syncSMTPWarmups periodically saves the warm-up state of SMTP servers to the DB
+// so that it survives restarts.
+func (a *App) syncSMTPWarmups(interval time.Duration) {
+	if len(a.smtpWarmups) == 0 {
+		return
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for range t.C {
+		a.saveSMTPWarmups()
+	}
+}
+
+// saveSMTPWarmups saves the warm-up state of SMTP servers to the DB.
+func (a *App) saveSMTPWarmups() {
+	now := time.Now()
+	for uuid, w := range a.smtpWarmups {
+		st := w.Status(now)
+		if err := a.core.UpdateSMTPWarmup(uuid, st.Date, st.Sent); err != nil {
+			a.log.Printf("error saving SMTP warm-up: %v", err)
+		}
+	}
+}
+
 // TestSMTPSettings returns the log entries stored in the log buffer.
 func (a *App) TestSMTPSettings(c echo.Context) error {
 	// Copy the raw JSON post body.
@@ -351,3 +569,17 @@ func (a *App) GetAboutInfo(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, out)
 }
+
+// cleanRoleMappings trims SSO role mappings and drops the ones without a value or a user role.
+func cleanRoleMappings(mappings []models.SSORoleMapping) []models.SSORoleMapping {
+	out := make([]models.SSORoleMapping, 0, len(mappings))
+	for _, m := range mappings {
+		m.Claim = strings.TrimSpace(m.Claim)
+		m.Value = strings.TrimSpace(m.Value)
+		if m.Value != "" && m.UserRoleID > 0 {
+			out = append(out, m)
+		}
+	}
+
+	return out
+}
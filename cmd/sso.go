@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+// Claim that role mappings without a claim match for OIDC.
+const oidcGroupsClaim = "groups"
+
+// roleMapping assigns a user role, and optionally a list role, to SSO users who have
+// a value in a claim (OIDC) or an attribute (SAML), eg: "marketing" in "groups".
+type roleMapping struct {
+	Claim      string `koanf:"claim"`
+	Value      string `koanf:"value"`
+	UserRoleID int    `koanf:"user_role_id"`
+	ListRoleID int    `koanf:"list_role_id"`
+}
+
+// ssoUser is a user's identity asserted by an SSO provider.
+type ssoUser struct {
+	Email string
+	Name  string
+
+	// Values of the user's claims or attributes.
+	Claims map[string][]string
+}
+
+// ssoOptions configures how SSO users are provisioned.
+type ssoOptions struct {
+	// Create users who don't exist on their first login.
+	AutoCreate        bool
+	DefaultUserRoleID int
+
+	// Claim that mappings without a claim match.
+	GroupsClaim  string
+	RoleMappings []roleMapping
+}
+
+// getSSOUser returns the listmonk user of an identity asserted by an SSO provider. If
+// the user doesn't exist and auto-creation is on, the user is created with the roles
+// mapped from their claims, or the default role. If there are role mappings, the roles
+// of an existing user are synced with their claims on every login, falling back to the
+// default role (without a list role), or if there's none, the login is denied.
+func (a *App) getSSOUser(c echo.Context, u ssoUser, opt ssoOptions) (auth.User, error) {
+	// Validate the e-mail.
+	email := strings.TrimSpace(u.Email)
+	if email == "" {
+		return auth.User{}, errors.New(a.i18n.Ts("globals.messages.invalidFields", "name", "email"))
+	}
+	em, err := mail.ParseAddress(email)
+	if err != nil {
+		return auth.User{}, err
+	}
+	email = strings.ToLower(em.Address)
+
+	m, ok := matchRoleMapping(u.Claims, opt.GroupsClaim, opt.RoleMappings)
+	if !ok {
+		m = roleMapping{UserRoleID: opt.DefaultUserRoleID}
+	}
+
+	user, err := a.core.GetUser(0, "", email)
+	if err != nil {
+		if !opt.AutoCreate {
+			return auth.User{}, err
+		}
+
+		return a.createSSOUser(c, email, strings.TrimSpace(u.Name), m)
+	}
+
+	if user.Type != auth.UserTypeUser || user.Status == auth.UserStatusDisabled {
+		return auth.User{}, echo.NewHTTPError(http.StatusForbidden, a.i18n.T("users.invalidLogin"))
+	}
+
+	// Without role mappings, the roles of existing users are managed in listmonk.
+	if len(opt.RoleMappings) == 0 {
+		return user, nil
+	}
+
+	// The user matches no mapping and there's no default role to fall back to.
+	if m.UserRoleID == 0 {
+		a.log.Printf("SSO user %d (%s) has no mapped role and there's no default role", user.ID, user.Username)
+		return auth.User{}, echo.NewHTTPError(http.StatusForbidden, a.i18n.T("users.ssoNoRole"))
+	}
+
+	// Sync the roles with the claims. A mapping without a list role removes
+	// the user's list role.
+	curListRoleID := 0
+	if user.ListRoleID != nil {
+		curListRoleID = *user.ListRoleID
+	}
+	if m.UserRoleID == user.UserRoleID && m.ListRoleID == curListRoleID {
+		return user, nil
+	}
+
+	listRoleID := m.ListRoleID
+	if listRoleID == 0 {
+		listRoleID = -1
+	}
+	if err := a.core.UpdateUserRoles(user.ID, m.UserRoleID, listRoleID); err != nil {
+		a.log.Printf("error syncing SSO roles of user %d (%s): %v", user.ID, user.Username, err)
+		return auth.User{}, err
+	}
+	a.log.Printf("synced SSO roles of user %d (%s) to user role %d and list role %d", user.ID, user.Username, m.UserRoleID, m.ListRoleID)
+	a.logSSOUser(c, user.ID, user.Username, "users.sso_role_sync",
+		map[string]any{"user_role_id": user.UserRoleID, "list_role_id": user.ListRoleID},
+		map[string]any{"user_role_id": m.UserRoleID, "list_role_id": m.ListRoleID})
+
+	return a.core.GetUser(user.ID, "", "")
+}
+
+// createSSOUser creates a user on their first SSO login with the roles of a mapping.
+func (a *App) createSSOUser(c echo.Context, email, name string, m roleMapping) (auth.User, error) {
+	if m.UserRoleID == 0 {
+		a.log.Printf("SSO user %s has no mapped role and there's no default role", email)
+		return auth.User{}, echo.NewHTTPError(http.StatusForbidden, a.i18n.T("users.ssoNoRole"))
+	}
+
+	if name == "" {
+		name = email
+	}
+	u := auth.User{
+		Type:          auth.UserTypeUser,
+		Username:      email,
+		Name:          name,
+		Email:         null.StringFrom(email),
+		PasswordLogin: false,
+		UserRoleID:    m.UserRoleID,
+		Status:        auth.UserStatusEnabled,
+	}
+	if m.ListRoleID > 0 {
+		u.ListRoleID = &m.ListRoleID
+	}
+
+	user, err := a.core.CreateUser(u)
+	if err != nil {
+		return auth.User{}, err
+	}
+
+	a.log.Printf("created SSO user %d (%s) with user role %d and list role %d", user.ID, user.Username, m.UserRoleID, m.ListRoleID)
+	a.logSSOUser(c, user.ID, user.Username, "users.sso_create", nil, auditUser(user))
+
+	return user, nil
+}
+
+// logSSOUser records a change made to a user on SSO login in the audit log.
+func (a *App) logSSOUser(c echo.Context, id int, username, action string, before, after any) {
+	a.core.AddAuditLog(models.AuditLog{
+		UserID:     null.IntFrom(id),
+		Username:   username,
+		IP:         c.RealIP(),
+		Method:     c.Request().Method,
+		Path:       c.Path(),
+		Action:     action,
+		EntityType: "users",
+		EntityID:   strconv.Itoa(id),
+		Before:     auditJSON(before),
+		After:      auditJSON(after),
+		Status:     http.StatusOK,
+	})
+}
+
+// matchRoleMapping returns the first mapping whose value is in the values of its claim.
+// Mappings without a claim match the groups claim.
+func matchRoleMapping(claims map[string][]string, groupsClaim string, mappings []roleMapping) (roleMapping, bool) {
+	for _, m := range mappings {
+		for _, v := range claims[m.claim(groupsClaim)] {
+			if strings.EqualFold(strings.TrimSpace(m.Value), v) {
+				return m, true
+			}
+		}
+	}
+
+	return roleMapping{}, false
+}
+
+// claim returns the claim of a mapping, or the groups claim if it has none.
+func (m roleMapping) claim(groupsClaim string) string {
+	if c := strings.TrimSpace(m.Claim); c != "" {
+		return c
+	}
+
+	return groupsClaim
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -74,6 +75,40 @@ func (a *App) GetSubscriber(c echo.Context) error {
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// GetSubscriberActivity handles the retrieval of the activity timeline of a subscriber.
+func (a *App) GetSubscriberActivity(c echo.Context) error {
+	var (
+		user = auth.GetUser(c)
+		id   = getID(c)
+		pg   = a.pg.NewFromURL(c.Request().URL.Query())
+	)
+
+	// Check if the user has access to at least one of the lists on the subscriber.
+	if err := a.hasSubPerm(user, []int{id}); err != nil {
+		return err
+	}
+
+	// Optional types of activity to filter by.
+	types := []string{}
+	for _, t := range c.QueryParams()["type"] {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+
+	res, total, err := a.core.GetSubscriberActivity(id, types, pg.Offset, pg.Limit)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{models.PageResults{
+		Results: res,
+		Total:   total,
+		Page:    pg.Page,
+		PerPage: pg.PerPage,
+	}})
+}
+
 // QuerySubscribers handles querying subscribers based on an arbitrary SQL expression.
 func (a *App) QuerySubscribers(c echo.Context) error {
 	// Get the authenticated user.
@@ -254,13 +289,23 @@ func (a *App) UpdateSubscriber(c echo.Context) error {
 	// Filter lists against the current user's permitted lists.
 	listIDs := user.FilterListsByPerm(auth.PermTypeManage, req.Lists)
 
-	// Update the subscriber in the DB.
+	// Get the subscriber's state before the update to record what changed.
 	id := getID(c)
+	prev, err := a.core.GetSubscriber(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	// Update the subscriber in the DB.
 	out, _, err := a.core.UpdateSubscriberWithLists(id, req.Subscriber, listIDs, nil, req.PreconfirmSubs, true)
 	if err != nil {
 		return err
 	}
 
+	a.recordSubscriberUpdate(prev, out, user.ID)
+	setAudit(c, map[string]any{"email": prev.Email, "name": prev.Name, "status": prev.Status, "attribs": prev.Attribs},
+		map[string]any{"email": out.Email, "name": out.Name, "status": out.Status, "attribs": out.Attribs, "lists": listIDs})
+
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
@@ -289,6 +334,13 @@ func (a *App) BlocklistSubscriber(c echo.Context) error {
 		return err
 	}
 
+	a.core.AddSubscriberEvents([]int{id}, nil, models.SubscriberEvent{
+		Type:   models.SubscriberEventBlocklisted,
+		Source: models.SubscriberEventSourceAdmin,
+		UserID: auth.GetUser(c).ID,
+	})
+	setAudit(c, nil, map[string]any{"ids": []int{id}})
+
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
@@ -309,6 +361,13 @@ func (a *App) BlocklistSubscribers(c echo.Context) error {
 		return err
 	}
 
+	a.core.AddSubscriberEvents(req.SubscriberIDs, nil, models.SubscriberEvent{
+		Type:   models.SubscriberEventBlocklisted,
+		Source: models.SubscriberEventSourceAdmin,
+		UserID: auth.GetUser(c).ID,
+	})
+	setAudit(c, nil, map[string]any{"ids": req.SubscriberIDs})
+
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
@@ -357,14 +416,21 @@ func (a *App) ManageSubscriberLists(c echo.Context) error {
 	}
 
 	// Run the action in the DB.
-	var err error
+	var (
+		err error
+		ev  = models.SubscriberEvent{Source: models.SubscriberEventSourceAdmin, UserID: user.ID, ListIDs: listIDs}
+	)
 	switch req.Action {
 	case "add":
 		err = a.core.AddSubscriptions(subIDs, listIDs, req.Status)
+		ev.Type = models.SubscriberEventSubscribed
+		ev.Meta = models.JSON{"status": req.Status}
 	case "remove":
 		err = a.core.DeleteSubscriptions(subIDs, listIDs)
+		ev.Type = models.SubscriberEventSubscriptionRemoved
 	case "unsubscribe":
 		err = a.core.UnsubscribeLists(subIDs, listIDs, nil)
+		ev.Type = models.SubscriberEventUnsubscribed
 	default:
 		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("subscribers.invalidAction"))
 	}
@@ -373,17 +439,28 @@ func (a *App) ManageSubscriberLists(c echo.Context) error {
 		return err
 	}
 
+	a.core.AddSubscriberEvents(subIDs, nil, ev)
+	setAudit(c, nil, map[string]any{"ids": subIDs, "action": req.Action, "list_ids": listIDs, "status": req.Status})
+
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
 // DeleteSubscriber handles deletion of a single subscriber.
 func (a *App) DeleteSubscriber(c echo.Context) error {
-	// Delete the subscribers from the DB.
+	// Get the subscriber for the audit log.
 	id := getID(c)
+	sub, err := a.core.GetSubscriber(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	// Delete the subscribers from the DB.
 	if err := a.core.DeleteSubscribers([]int{id}, nil); err != nil {
 		return err
 	}
 
+	setAudit(c, map[string]any{"email": sub.Email, "name": sub.Name, "status": sub.Status}, nil)
+
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
@@ -442,6 +519,8 @@ func (a *App) DeleteSubscribersByQuery(c echo.Context) error {
 		return err
 	}
 
+	setAudit(c, nil, req)
+
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
@@ -467,11 +546,20 @@ func (a *App) BlocklistSubscribersByQuery(c echo.Context) error {
 		}
 	}
 
+	// Record the event before blocklisting as blocklisting may change which subscribers match the query.
+	a.core.AddSubscriberEventsByQuery(req.Search, req.Query, req.ListIDs, req.SubscriptionStatus, models.SubscriberEvent{
+		Type:   models.SubscriberEventBlocklisted,
+		Source: models.SubscriberEventSourceAdmin,
+		UserID: user.ID,
+	})
+
 	// Update the subscribers in the DB.
 	if err := a.core.BlocklistSubscribersByQuery(req.Search, req.Query, req.ListIDs, req.SubscriptionStatus); err != nil {
 		return err
 	}
 
+	setAudit(c, nil, req)
+
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
@@ -505,6 +593,22 @@ func (a *App) ManageSubscriberListsByQuery(c echo.Context) error {
 	sourceListIDs := user.FilterListsByPerm(auth.PermTypeGet|auth.PermTypeManage, req.ListIDs)
 	targetListIDs := user.FilterListsByPerm(auth.PermTypeGet|auth.PermTypeManage, req.TargetListIDs)
 
+	ev := models.SubscriberEvent{Source: models.SubscriberEventSourceAdmin, UserID: user.ID, ListIDs: targetListIDs}
+	switch req.Action {
+	case "add":
+		ev.Type = models.SubscriberEventSubscribed
+		ev.Meta = models.JSON{"status": req.Status}
+	case "remove":
+		ev.Type = models.SubscriberEventSubscriptionRemoved
+	case "unsubscribe":
+		ev.Type = models.SubscriberEventUnsubscribed
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("subscribers.invalidAction"))
+	}
+
+	// Record the event before the action as the action may change which subscribers match the query.
+	a.core.AddSubscriberEventsByQuery(req.Search, req.Query, sourceListIDs, req.SubscriptionStatus, ev)
+
 	// Run the action in the DB.
 	var err error
 	switch req.Action {
@@ -514,14 +618,14 @@ func (a *App) ManageSubscriberListsByQuery(c echo.Context) error {
 		err = a.core.DeleteSubscriptionsByQuery(req.Search, req.Query, sourceListIDs, targetListIDs, req.SubscriptionStatus)
 	case "unsubscribe":
 		err = a.core.UnsubscribeListsByQuery(req.Search, req.Query, sourceListIDs, targetListIDs, req.SubscriptionStatus)
-	default:
-		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("subscribers.invalidAction"))
 	}
 
 	if err != nil {
 		return err
 	}
 
+	setAudit(c, nil, req)
+
 	return c.JSON(http.StatusOK, okResp{true})
 }
 
@@ -647,6 +751,43 @@ func (a *App) filterListQueryByPerm(param string, qp url.Values, user auth.User)
 	return listIDs, nil
 }
 
+// recordSubscriberUpdate records the changes made to a subscriber by a user
+// in the subscriber's history.
+func (a *App) recordSubscriberUpdate(prev, cur models.Subscriber, userID int) {
+	fields := []string{}
+	if prev.Email != cur.Email {
+		fields = append(fields, "email")
+	}
+	if prev.Name != cur.Name {
+		fields = append(fields, "name")
+	}
+	if prev.Status != cur.Status {
+		fields = append(fields, "status")
+	}
+	pa, _ := json.Marshal(prev.Attribs)
+	ca, _ := json.Marshal(cur.Attribs)
+	if !bytes.Equal(pa, ca) {
+		fields = append(fields, "attribs")
+	}
+
+	if len(fields) > 0 {
+		a.core.AddSubscriberEvents([]int{cur.ID}, nil, models.SubscriberEvent{
+			Type:   models.SubscriberEventUpdated,
+			Source: models.SubscriberEventSourceAdmin,
+			UserID: userID,
+			Meta:   models.JSON{"fields": fields},
+		})
+	}
+
+	if cur.Status == models.SubscriberStatusBlockListed && prev.Status != cur.Status {
+		a.core.AddSubscriberEvents([]int{cur.ID}, nil, models.SubscriberEvent{
+			Type:   models.SubscriberEventBlocklisted,
+			Source: models.SubscriberEventSourceAdmin,
+			UserID: userID,
+		})
+	}
+}
+
 // formatSQLExp does basic sanitisation on arbitrary
 // SQL query expressions coming from the frontend.
 func formatSQLExp(q string) string {
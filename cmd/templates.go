@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/knadh/listmonk/internal/auth"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
 )
@@ -150,6 +151,12 @@ func (a *App) UpdateTemplate(c echo.Context) error {
 	if err := c.Bind(&o); err != nil {
 		return err
 	}
+
+	return a.updateTemplate(c, getID(c), o)
+}
+
+// updateTemplate validates, compiles, and saves the changes (o) to a template.
+func (a *App) updateTemplate(c echo.Context, id int, o models.Template) error {
 	if err := a.validateTemplate(o); err != nil {
 		return err
 	}
@@ -170,8 +177,7 @@ func (a *App) UpdateTemplate(c echo.Context) error {
 	}
 
 	// Update the template in the DB.
-	id := getID(c)
-	out, err := a.core.UpdateTemplate(id, o.Name, o.Subject, []byte(o.Body), o.BodySource)
+	out, err := a.core.UpdateTemplate(id, o.Name, o.Subject, []byte(o.Body), o.BodySource, auth.GetUser(c).ID)
 	if err != nil {
 		return err
 	}
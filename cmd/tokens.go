@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// Length of the random scoped API tokens.
+const apiTokenLen = 40
+
+// GetAPITokens retrieves the scoped API tokens of an API user.
+func (a *App) GetAPITokens(c echo.Context) error {
+	out, err := a.core.GetAPITokens(getID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// CreateAPIToken creates a scoped API token for an API user. The plaintext token is only
+// returned in the response and can't be retrieved again.
+func (a *App) CreateAPIToken(c echo.Context) error {
+	var t auth.APIToken
+	if err := c.Bind(&t); err != nil {
+		return err
+	}
+
+	user, err := a.core.GetUser(getID(c), "", "")
+	if err != nil {
+		return err
+	}
+
+	t.UserID = user.ID
+	t.Name = strings.TrimSpace(t.Name)
+	if err := a.validateAPIToken(t, user); err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateRandomString(apiTokenLen)
+	if err != nil {
+		a.log.Printf("error generating API token: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
+	}
+
+	out, err := a.core.CreateAPIToken(t, token)
+	if err != nil {
+		return err
+	}
+	setAudit(c, nil, auditAPIToken(user, out))
+
+	// Cache the token for in-memory, off-DB /api/* request auth.
+	if _, err := cacheUsers(a.core, a.auth); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{out})
+}
+
+// DeleteAPIToken revokes a scoped API token of an API user.
+func (a *App) DeleteAPIToken(c echo.Context) error {
+	tokenID, _ := strconv.Atoi(c.Param("tokenID"))
+	if tokenID < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("globals.messages.invalidID"))
+	}
+
+	if err := a.core.DeleteAPIToken(tokenID, getID(c)); err != nil {
+		return err
+	}
+
+	if _, err := cacheUsers(a.core, a.auth); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// validateAPIToken validates the fields of a new scoped API token. A token can only have
+// permissions that its user has.
+func (a *App) validateAPIToken(t auth.APIToken, user auth.User) error {
+	if user.Type != auth.UserTypeAPI {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.apiTokenNotAPIUser"))
+	}
+
+	if !strHasLen(t.Name, 1, stdInputMaxLen) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "name"))
+	}
+
+	if len(t.Permissions) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "permissions"))
+	}
+	for _, p := range t.Permissions {
+		if _, ok := a.cfg.Permissions[p]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "permission: "+p))
+		}
+
+		if _, ok := user.PermissionsMap[p]; !ok && user.UserRole.ID != auth.SuperAdminRoleID {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("users.apiTokenPermDenied", "name", p))
+		}
+	}
+
+	for _, id := range t.ListIDs {
+		if id < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "list_ids"))
+		}
+	}
+
+	if t.ExpiresAt.Valid && !t.ExpiresAt.Time.After(time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "expires_at"))
+	}
+
+	return nil
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/knadh/listmonk/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/zerodha/simplesessions/v3"
+)
+
+const (
+	// Failed codes of a user in the window after which further codes are rejected
+	// until the window passes, and logins pending two-factor authentication are cancelled.
+	maxTOTPAttempts   = 5
+	totpFailureWindow = time.Minute * 15
+)
+
+type loginTOTPTpl struct {
+	Title   string
+	NextURI string
+	Error   string
+
+	// Enrolment, for users who are required to use 2FA but haven't enrolled.
+	Setup  bool
+	Secret string
+	QR     template.URL
+
+	// One time recovery codes shown after enrolment.
+	RecoveryCodes []string
+}
+
+// LoginTOTPPage renders the two-factor authentication step of the login flow and handles
+// its form. Users who are required to use 2FA but haven't enrolled enrol here.
+func (a *App) LoginTOTPPage(c echo.Context) error {
+	// Only logins that are pending 2FA can be here.
+	sess, userID, err := a.auth.GetPendingSession(c)
+	if err != nil {
+		return c.Redirect(http.StatusFound, a.urlCfg.LoginURL)
+	}
+
+	user, err := a.core.GetUser(userID, "", "")
+	if err != nil {
+		return a.renderLoginPage(c, err)
+	}
+
+	// Process POST requests.
+	var loginErr error
+	if c.Request().Method == http.MethodPost {
+		// Locked out users and IPs, and too many failed codes, cancel the login.
+		if a.auth.IsLockedOut(user.Username, c.RealIP()) {
+			_ = sess.Destroy()
+			return a.renderLoginPage(c, echo.NewHTTPError(http.StatusTooManyRequests, a.i18n.T("users.loginLocked")))
+		}
+
+		codes, err := a.doLoginTOTP(c, sess, user)
+		if e, ok := err.(*echo.HTTPError); ok && e.Code == http.StatusTooManyRequests {
+			_ = sess.Destroy()
+			return a.renderLoginPage(c, err)
+		}
+		if err == nil {
+			// Show the recovery codes generated on enrolment before continuing.
+			if len(codes) > 0 {
+				return c.Render(http.StatusOK, "admin-login-2fa", loginTOTPTpl{
+					Title:         a.i18n.T("users.twoFactor"),
+					NextURI:       totpNextURI(c),
+					RecoveryCodes: codes,
+				})
+			}
+
+			return c.Redirect(http.StatusFound, totpNextURI(c))
+		}
+
+		loginErr = err
+	}
+
+	return a.renderLoginTOTPPage(c, user, loginErr)
+}
+
+// SetupProfileTOTP generates a new TOTP secret for the current user to enrol in
+// two-factor authentication with.
+func (a *App) SetupProfileTOTP(c echo.Context) error {
+	user := auth.GetUser(c)
+	if user.Type != auth.UserTypeUser {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.invalidRequest"))
+	}
+
+	// 2FA has to be disabled before enrolling again.
+	if user.TOTPEnabled {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.totpAlreadyEnabled"))
+	}
+
+	key, err := a.newTOTPKey(user, true)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, okResp{key})
+}
+
+// EnableProfileTOTP verifies a code generated with the current user's new TOTP secret,
+// enables two-factor authentication, and returns one time recovery codes.
+func (a *App) EnableProfileTOTP(c echo.Context) error {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	user, err := a.core.GetUser(auth.GetUser(c).ID, "", "")
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabled {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.totpAlreadyEnabled"))
+	}
+
+	codes, err := a.enableTOTP(user, req.Code)
+	if err != nil {
+		return err
+	}
+	setAudit(c, nil, map[string]any{"totp_enabled": true})
+
+	return c.JSON(http.StatusOK, okResp{struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{codes}})
+}
+
+// DisableProfileTOTP disables two-factor authentication for the current user on
+// verifying a TOTP code or a recovery code.
+func (a *App) DisableProfileTOTP(c echo.Context) error {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	user, err := a.core.GetUser(auth.GetUser(c).ID, "", "")
+	if err != nil {
+		return err
+	}
+
+	if err := a.verifyTOTP(c, user, req.Code); err != nil {
+		return err
+	}
+
+	if err := a.core.ResetUserTOTP(user.ID); err != nil {
+		return err
+	}
+
+	// Record a summary so that the code isn't recorded.
+	setAudit(c, nil, map[string]any{"totp_enabled": false})
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// ResetUserTOTP disables two-factor authentication for a user who has lost access to their
+// authenticator app and recovery codes. If 2FA is required for the user, they enrol again
+// on their next login.
+func (a *App) ResetUserTOTP(c echo.Context) error {
+	user, err := a.core.GetUser(getID(c), "", "")
+	if err != nil {
+		return err
+	}
+
+	if err := a.core.ResetUserTOTP(user.ID); err != nil {
+		return err
+	}
+	setAudit(c, map[string]any{"username": user.Username, "totp_enabled": user.TOTPEnabled},
+		map[string]any{"username": user.Username, "totp_enabled": false})
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
+// saveLoginSession saves the session of a user who has logged in. If the user has to
+// complete two-factor authentication, the session is saved as pending and true is returned.
+func (a *App) saveLoginSession(u auth.User, oidcToken string, c echo.Context) (bool, error) {
+	if u.NeedsTOTP(a.cfg.Security.TOTPRequired, a.cfg.Security.TOTPRequiredRoles) {
+		return true, a.auth.SavePendingSession(u, oidcToken, c)
+	}
+
+	return false, a.auth.SaveSession(u, oidcToken, c)
+}
+
+// doLoginTOTP verifies the code submitted on the 2FA login page and completes the login.
+// For users who are enrolling, it enables 2FA and returns the new recovery codes.
+func (a *App) doLoginTOTP(c echo.Context, sess *simplesessions.Session, user auth.User) ([]string, error) {
+	code := strings.TrimSpace(c.FormValue("code"))
+
+	var codes []string
+	if user.TOTPEnabled {
+		if err := a.verifyTOTP(c, user, code); err != nil {
+			return nil, err
+		}
+	} else {
+		rc, err := a.enableTOTP(user, code)
+		if err != nil {
+			return nil, err
+		}
+		codes = rc
+	}
+
+	if err := a.auth.CompletePendingSession(sess); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// renderLoginTOTPPage renders the 2FA login page.
+func (a *App) renderLoginTOTPPage(c echo.Context, user auth.User, loginErr error) error {
+	out := loginTOTPTpl{
+		Title:   a.i18n.T("users.twoFactor"),
+		NextURI: totpNextURI(c),
+	}
+
+	// The user is required to use 2FA but hasn't enrolled.
+	if !user.TOTPEnabled {
+		key, err := a.newTOTPKey(user, false)
+		if err != nil {
+			return a.renderLoginPage(c, err)
+		}
+
+		out.Setup = true
+		out.Secret = key.Secret
+		out.QR = template.URL(key.QR)
+	}
+
+	if loginErr != nil {
+		if e, ok := loginErr.(*echo.HTTPError); ok {
+			out.Error = e.Message.(string)
+		} else {
+			out.Error = loginErr.Error()
+		}
+	}
+
+	return c.Render(http.StatusOK, "admin-login-2fa", out)
+}
+
+// newTOTPKey returns the TOTP key for a user to enrol with. A new secret is generated if
+// renew is true or if the user doesn't have one yet.
+func (a *App) newTOTPKey(user auth.User, renew bool) (auth.TOTPKey, error) {
+	issuer := a.cfg.SiteName
+	if issuer == "" {
+		issuer = "listmonk"
+	}
+
+	secret := user.TOTPSecret.String
+	if renew || secret == "" {
+		s, err := auth.GenerateTOTPSecret(issuer, user.Username)
+		if err != nil {
+			a.log.Printf("error generating TOTP secret: %v", err)
+			return auth.TOTPKey{}, echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
+		}
+
+		if err := a.core.SetUserTOTPSecret(user.ID, s); err != nil {
+			return auth.TOTPKey{}, err
+		}
+		secret = s
+	}
+
+	key, err := auth.NewTOTPKey(issuer, user.Username, secret)
+	if err != nil {
+		a.log.Printf("error generating TOTP key: %v", err)
+		return auth.TOTPKey{}, echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
+	}
+
+	return key, nil
+}
+
+// enableTOTP verifies a code generated with the user's new TOTP secret, enables 2FA
+// for the user, and returns their one time recovery codes.
+func (a *App) enableTOTP(user auth.User, code string) ([]string, error) {
+	step, ok := auth.ValidateTOTP(code, user.TOTPSecret.String, time.Now())
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, a.i18n.T("users.totpInvalidCode"))
+	}
+
+	codes, err := auth.GenerateTOTPRecoveryCodes()
+	if err != nil {
+		a.log.Printf("error generating TOTP recovery codes: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, a.i18n.T("globals.messages.internalError"))
+	}
+
+	if err := a.core.EnableUserTOTP(user.ID, codes, step); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// verifyTOTP verifies a TOTP code or a recovery code of a user who has enabled 2FA.
+// Failed codes are counted per user and towards the login lockout. After maxTOTPAttempts
+// failures in totpFailureWindow, codes are rejected until the window passes.
+func (a *App) verifyTOTP(c echo.Context, user auth.User, code string) error {
+	if user.TOTPFailures >= maxTOTPAttempts && user.TOTPFailedAt.Valid &&
+		time.Since(user.TOTPFailedAt.Time) < totpFailureWindow {
+		return echo.NewHTTPError(http.StatusTooManyRequests, a.i18n.T("users.totpTooManyAttempts"))
+	}
+
+	ok, err := a.checkTOTPCode(user, code)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	n, err := a.core.AddUserTOTPFailure(user.ID, time.Now().Add(-totpFailureWindow))
+	if err != nil {
+		return err
+	}
+	a.auth.LoginFailed(user.Username, c.RealIP())
+
+	if n >= maxTOTPAttempts {
+		return echo.NewHTTPError(http.StatusTooManyRequests, a.i18n.T("users.totpTooManyAttempts"))
+	}
+
+	return echo.NewHTTPError(http.StatusForbidden, a.i18n.T("users.totpInvalidCode"))
+}
+
+// checkTOTPCode checks a TOTP code or a one time recovery code (which is used up) of a
+// user who has enabled 2FA. A TOTP code is only accepted once.
+func (a *App) checkTOTPCode(user auth.User, code string) (bool, error) {
+	if !user.TOTPEnabled || code == "" {
+		return false, nil
+	}
+
+	if step, ok := auth.ValidateTOTP(code, user.TOTPSecret.String, time.Now()); ok {
+		return a.core.UseUserTOTPStep(user.ID, step)
+	}
+
+	return a.core.UseUserTOTPRecoveryCode(user.ID, code)
+}
+
+// totpLoginURI returns the URI of the 2FA login page that continues to next.
+func totpLoginURI(next string) string {
+	return path.Join(uriAdmin, "/login/2fa") + "?next=" + url.QueryEscape(next)
+}
+
+// totpNextURI returns the sanitized URI to continue to after 2FA.
+func totpNextURI(c echo.Context) string {
+	next := utils.SanitizeURI(c.FormValue("next"))
+	if next == "/" {
+		next = uriAdmin
+	}
+
+	return next
+}
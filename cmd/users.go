@@ -87,6 +87,7 @@ func (a *App) CreateUser(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	setAudit(c, nil, auditUser(user))
 
 	// Blank out the password hash in the response.
 	if user.Type != auth.UserTypeAPI {
@@ -162,11 +163,26 @@ func (a *App) UpdateUser(c echo.Context) error {
 		u.Name = u.Username
 	}
 
+	// Get the user as it was before the update for the audit log.
+	cur, err := a.core.GetUser(id, "", "")
+	if err != nil {
+		return err
+	}
+
 	// Update the user in the DB.
 	user, err := a.core.UpdateUser(id, u)
 	if err != nil {
 		return err
 	}
+	setAudit(c, auditUser(cur), auditUser(user))
+
+	// Log the user out everywhere if they're disabled or their password login is changed.
+	if (user.Status == auth.UserStatusDisabled && cur.Status != auth.UserStatusDisabled) ||
+		(cur.PasswordLogin && !user.PasswordLogin) || (u.PasswordLogin && u.Password.String != "") {
+		if _, err := a.revokeUserSessions(c, id); err != nil {
+			return err
+		}
+	}
 
 	// Blank out the password hash in the response.
 	user.Password = null.String{}
@@ -181,11 +197,18 @@ func (a *App) UpdateUser(c echo.Context) error {
 
 // DeleteUser handles the deletion of a single user by ID.
 func (a *App) DeleteUser(c echo.Context) error {
-	// Delete the user(s) from the DB.
+	// Get the user for the audit log.
 	id := getID(c)
+	cur, err := a.core.GetUser(id, "", "")
+	if err != nil {
+		return err
+	}
+
+	// Delete the user(s) from the DB.
 	if err := a.core.DeleteUsers([]int{id}); err != nil {
 		return err
 	}
+	setAudit(c, auditUser(cur), nil)
 
 	// Cache the API token for in-memory, off-DB /api/* request auth.
 	if _, err := cacheUsers(a.core, a.auth); err != nil {
@@ -261,12 +284,43 @@ func (a *App) UpdateUserProfile(c echo.Context) error {
 		return err
 	}
 
+	// Log the user out of their other sessions on changing the password.
+	if u.PasswordLogin && u.Password.String != "" {
+		if _, err := a.revokeUserSessions(c, user.ID); err != nil {
+			return err
+		}
+	}
+
 	// Blank out the password hash in the response.
 	out.Password = null.String{}
 
 	return c.JSON(http.StatusOK, okResp{out})
 }
 
+// GetLoginLockouts retrieves the usernames and IPs that are locked out due to repeated
+// failed login attempts.
+func (a *App) GetLoginLockouts(c echo.Context) error {
+	return c.JSON(http.StatusOK, okResp{a.auth.GetLockouts()})
+}
+
+// DeleteLoginLockout unlocks a username or an IP that's locked out.
+func (a *App) DeleteLoginLockout(c echo.Context) error {
+	var (
+		typ = c.QueryParam("type")
+		key = c.QueryParam("key")
+	)
+	if typ != auth.LockoutTypeUsername && typ != auth.LockoutTypeIP {
+		return echo.NewHTTPError(http.StatusBadRequest, a.i18n.Ts("globals.messages.invalidFields", "name", "type"))
+	}
+
+	if !a.auth.UnlockLogin(typ, key) {
+		return echo.NewHTTPError(http.StatusNotFound, a.i18n.Ts("globals.messages.notFound", "name", key))
+	}
+	a.log.Printf("unlocked %s %s locked out due to failed login attempts", typ, key)
+
+	return c.JSON(http.StatusOK, okResp{true})
+}
+
 // cacheUsers fetches (API) users and caches them in the auth module.
 // It also returns a bool indicating whether there are any actual users in the DB at all,
 // which if there aren't, the first time user setup needs to be run.
@@ -289,5 +343,13 @@ func cacheUsers(co *core.Core, a *auth.Auth) (bool, error) {
 	}
 
 	a.CacheAPIUsers(apiUsers)
+
+	// Cache the scoped tokens of the (enabled) API users.
+	tokens, err := co.GetAPITokens(0)
+	if err != nil {
+		return false, err
+	}
+	a.CacheAPITokens(tokens, apiUsers)
+
 	return hasUser, nil
 }
@@ -174,6 +174,11 @@ export const getSubscriberBounces = async (id) => http.get(
   { loading: models.bounces },
 );
 
+export const getSubscriberActivity = async (id, params) => http.get(
+  `/api/subscribers/${id}/activity`,
+  { params },
+);
+
 export const deleteSubscriberBounces = async (id) => http.delete(
   `/api/subscribers/${id}/bounces`,
   { loading: models.bounces },
@@ -325,10 +330,37 @@ export const updateCampaign = async (id, data) => http.put(
   { loading: models.campaigns },
 );
 
-export const changeCampaignStatus = async (id, status) => http.put(
+export const changeCampaignStatus = async (id, status, note) => http.put(
   `/api/campaigns/${id}/status`,
-  { status },
+  { status, note },
+
+  { loading: models.campaigns },
+);
+
+export const getCampaignApprovals = async (id) => http.get(
+  `/api/campaigns/${id}/approvals`,
+  { loading: models.campaigns },
+);
+
+export const importCampaign = async (data) => http.post(
+  '/api/campaigns/import',
+  data,
+  { loading: models.campaigns },
+);
+
+export const getCampaignRevisions = async (id, params) => http.get(
+  `/api/campaigns/${id}/revisions`,
+  { params, loading: models.campaigns },
+);
 
+export const getCampaignRevisionDiff = async (id, revID) => http.get(
+  `/api/campaigns/${id}/revisions/${revID}/diff`,
+  { loading: models.campaigns, camelCase: false },
+);
+
+export const restoreCampaignRevision = async (id, revID) => http.post(
+  `/api/campaigns/${id}/revisions/${revID}/restore`,
+  {},
   { loading: models.campaigns },
 );
 
@@ -422,6 +454,15 @@ export const getLogs = async () => http.get(
   { loading: models.logs, camelCase: false },
 );
 
+export const getAuditLog = async (params) => http.get(
+  '/api/audit',
+  {
+    params,
+    loading: models.auditLog,
+    camelCase: (keyPath) => !keyPath.match(/^\.results\.\*\.(before|after)\./),
+  },
+);
+
 export const getLang = async (lang) => http.get(
   `/api/lang/${lang}`,
   { loading: models.lang, camelCase: false },
@@ -444,6 +485,22 @@ export const deleteGCSubscriptions = async (beforeDate) => http.delete(
   { loading: models.maintenance, params: { before_date: beforeDate } },
 );
 
+export const deleteGCDeliveries = async (beforeDate) => http.delete(
+  '/api/maintenance/deliveries',
+  { loading: models.maintenance, params: { before_date: beforeDate } },
+);
+
+export const getSunsetSubscribers = async (params) => http.get(
+  '/api/maintenance/sunset',
+  { loading: models.maintenance, params },
+);
+
+export const sunsetSubscribers = async (data) => http.post(
+  '/api/maintenance/sunset',
+  data,
+  { loading: models.maintenance },
+);
+
 // Users.
 export const getUsers = () => http.get(
   '/api/users',
@@ -494,6 +551,84 @@ export const updateUserProfile = (data) => http.put(
   { loading: models.users, store: models.profile },
 );
 
+export const setupTOTP = () => http.post(
+  '/api/profile/2fa',
+  {},
+  { loading: models.users },
+);
+
+export const enableTOTP = (code) => http.put(
+  '/api/profile/2fa',
+  { code },
+  { loading: models.users },
+);
+
+export const disableTOTP = (code) => http.delete(
+  '/api/profile/2fa',
+  { data: { code }, loading: models.users },
+);
+
+export const resetUserTOTP = (id) => http.delete(
+  `/api/users/${id}/2fa`,
+  { loading: models.users },
+);
+
+export const getProfileSessions = async () => http.get(
+  '/api/profile/sessions',
+  { loading: models.users },
+);
+
+export const deleteProfileSessions = () => http.delete(
+  '/api/profile/sessions',
+  { loading: models.users },
+);
+
+export const deleteProfileSession = (sessId) => http.delete(
+  `/api/profile/sessions/${sessId}`,
+  { loading: models.users },
+);
+
+export const getUserSessions = async (id) => http.get(
+  `/api/users/${id}/sessions`,
+  { loading: models.users },
+);
+
+export const deleteUserSessions = (id) => http.delete(
+  `/api/users/${id}/sessions`,
+  { loading: models.users },
+);
+
+export const deleteUserSession = (id, sessId) => http.delete(
+  `/api/users/${id}/sessions/${sessId}`,
+  { loading: models.users },
+);
+
+export const getLoginLockouts = async () => http.get(
+  '/api/users/lockouts',
+  { loading: models.users },
+);
+
+export const deleteLoginLockout = (params) => http.delete(
+  '/api/users/lockouts',
+  { params, loading: models.users },
+);
+
+export const getAPITokens = async (id) => http.get(
+  `/api/users/${id}/tokens`,
+  { loading: models.users },
+);
+
+export const createAPIToken = (id, data) => http.post(
+  `/api/users/${id}/tokens`,
+  data,
+  { loading: models.users },
+);
+
+export const deleteAPIToken = (id, tokenId) => http.delete(
+  `/api/users/${id}/tokens/${tokenId}`,
+  { loading: models.users },
+);
+
 export const getUserRoles = async () => http.get(
   '/api/roles/users',
   { loading: models.userRoles, store: models.userRoles },
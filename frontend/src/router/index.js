@@ -113,6 +113,12 @@ const routes = [
     meta: { title: 'logs.title', group: 'settings' },
     component: () => import('../views/Logs.vue'),
   },
+  {
+    path: '/settings/audit',
+    name: 'auditLog',
+    meta: { title: 'globals.terms.auditLog', group: 'settings' },
+    component: () => import('../views/AuditLog.vue'),
+  },
   {
     path: '/users',
     name: 'users',
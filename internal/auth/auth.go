@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/crewjam/saml"
 	"github.com/labstack/echo/v4"
 	"github.com/zerodha/simplesessions/stores/postgres/v3"
 	"github.com/zerodha/simplesessions/v3"
@@ -24,7 +25,12 @@ type OIDCclaim struct {
 	Email         string `json:"email"`
 	EmailVerified bool   `json:"email_verified"`
 	Sub           string `json:"sub"`
+	Name          string `json:"name"`
 	Picture       string `json:"picture"`
+
+	// All the claims flattened to their values (nested claims as dotted
+	// paths, eg: realm_access.roles) for mapping them to roles.
+	Claims map[string][]string `json:"-"`
 }
 
 type OIDCConfig struct {
@@ -33,6 +39,10 @@ type OIDCConfig struct {
 	RedirectURL  string `json:"redirect_url"`
 	ClientID     string `json:"client_id"`
 	ClientSecret string `json:"client_secret"`
+
+	// Claims that roles are mapped from. If the ID token doesn't have them,
+	// they're fetched from the userinfo endpoint.
+	Claims []string `json:"claims"`
 }
 
 type BasicAuthConfig struct {
@@ -43,7 +53,9 @@ type BasicAuthConfig struct {
 
 type Config struct {
 	OIDC      OIDCConfig
+	SAML      SAMLConfig
 	BasicAuth BasicAuthConfig
+	Lockout   LockoutConfig
 }
 
 // Callbacks takes two callback functions required by simplesessions.
@@ -51,18 +63,38 @@ type Callbacks struct {
 	SetCookie func(cookie *http.Cookie, w any) error
 	GetCookie func(name string, r any) (*http.Cookie, error)
 	GetUser   func(id int) (User, error)
+
+	// APITokenUsed is called (periodically, not on every request) when a scoped
+	// API token is used to record its last use.
+	APITokenUsed func(id int, ip string)
+
+	// OnLockout is called when a username or an IP is locked out due to
+	// repeated failed login attempts.
+	OnLockout func(l Lockout)
+
+	// Failed login attempts and lockouts are persisted with these (optional) so that
+	// they hold across restarts. GetLoginFailures is called once on init,
+	// SaveLoginFailures on every failed attempt, and DeleteLoginFailures when the
+	// failures of a username or an IP are cleared.
+	GetLoginFailures    func() ([]LoginFailures, error)
+	SaveLoginFailures   func(f LoginFailures)
+	DeleteLoginFailures func(typ, key string)
 }
 
 type Auth struct {
-	apiUsers map[string]User
+	apiUsers  map[string]User
+	apiTokens map[string]scopedAPIToken
+	tokenUse  map[int]time.Time
 	sync.RWMutex
 
 	cfg       Config
 	oauthCfg  oauth2.Config
 	verifier  *oidc.IDTokenVerifier
 	provider  *oidc.Provider
+	samlSP    *saml.ServiceProvider
 	sess      *simplesessions.Manager
 	sessStore *postgres.Store
+	lockouts  *lockouts
 	cb        *Callbacks
 	log       *log.Logger
 }
@@ -76,7 +108,10 @@ func New(cfg Config, db *sql.DB, cb *Callbacks, lo *log.Logger) (*Auth, error) {
 		cb:  cb,
 		log: lo,
 
-		apiUsers: map[string]User{},
+		apiUsers:  map[string]User{},
+		apiTokens: map[string]scopedAPIToken{},
+		tokenUse:  map[int]time.Time{},
+		lockouts:  newLockouts(cfg.Lockout, cb, lo),
 	}
 
 	// Initialize OIDC.
@@ -101,6 +136,14 @@ func New(cfg Config, db *sql.DB, cb *Callbacks, lo *log.Logger) (*Auth, error) {
 		}
 	}
 
+	// Initialize SAML.
+	if cfg.SAML.Enabled {
+		if err := a.initSAML(cfg.SAML); err != nil {
+			a.cfg.SAML.Enabled = false
+			lo.Printf("error initializing SAML: %v", err)
+		}
+	}
+
 	// Initialize session manager.
 	a.sess = simplesessions.New(simplesessions.Options{
 		EnableAutoCreate: false,
@@ -110,7 +153,7 @@ func New(cfg Config, db *sql.DB, cb *Callbacks, lo *log.Logger) (*Auth, error) {
 			MaxAge:     time.Hour * 24 * 7,
 		},
 	})
-	st, err := postgres.New(postgres.Opt{}, db)
+	st, err := postgres.New(postgres.Opt{TTL: SessionTTL}, db)
 	if err != nil {
 		return nil, err
 	}
@@ -149,6 +192,30 @@ func (o *Auth) CacheAPIUser(u User) {
 	o.Unlock()
 }
 
+// CacheAPITokens caches the scoped API tokens of the given API users for authenticating
+// requests. Like CacheAPIUsers, it wipes the existing cache every time. Tokens of users
+// who aren't in the given list (eg: disabled users) are ignored.
+func (o *Auth) CacheAPITokens(tokens []APIToken, users []User) {
+	byID := make(map[int]User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	out := make(map[string]scopedAPIToken, len(tokens))
+	for _, t := range tokens {
+		u, ok := byID[t.UserID]
+		if !ok {
+			continue
+		}
+
+		out[t.TokenHash] = scopedAPIToken{APIToken: t, user: u.Scope(t)}
+	}
+
+	o.Lock()
+	o.apiTokens = out
+	o.Unlock()
+}
+
 // GetAPIToken validates an API user+token.
 func (o *Auth) GetAPIToken(user string, token string) (User, bool) {
 	o.RLock()
@@ -162,6 +229,34 @@ func (o *Auth) GetAPIToken(user string, token string) (User, bool) {
 	return t, true
 }
 
+// getScopedAPIToken validates an API user+scoped token and returns the user with the
+// token's permissions. The last use of the token is recorded periodically.
+func (o *Auth) getScopedAPIToken(user, token, ip string) (User, bool) {
+	o.RLock()
+	t, ok := o.apiTokens[HashAPIToken(token)]
+	o.RUnlock()
+
+	if !ok || t.user.Username != user || t.IsExpired() {
+		return User{}, false
+	}
+
+	if o.cb.APITokenUsed != nil {
+		o.Lock()
+		last, ok := o.tokenUse[t.ID]
+		due := !ok || time.Since(last) > apiTokenUsageInterval
+		if due {
+			o.tokenUse[t.ID] = time.Now()
+		}
+		o.Unlock()
+
+		if due {
+			go o.cb.APITokenUsed(t.ID, ip)
+		}
+	}
+
+	return t.user, true
+}
+
 // GetOIDCAuthURL returns the OIDC provider's auth URL to redirect to.
 func (o *Auth) GetOIDCAuthURL(state, nonce string) string {
 	return o.oauthCfg.AuthCodeURL(state, oidc.Nonce(nonce))
@@ -189,22 +284,55 @@ func (o *Auth) ExchangeOIDCToken(code, nonce string) (string, OIDCclaim, error)
 		return "", OIDCclaim{}, echo.NewHTTPError(http.StatusUnauthorized, "nonce did not match")
 	}
 
-	var claims OIDCclaim
+	var (
+		claims OIDCclaim
+		raw    map[string]any
+	)
 	if err := idTk.Claims(&claims); err != nil {
 		return "", OIDCclaim{}, errors.New("error getting user from OIDC")
 	}
+	if err := idTk.Claims(&raw); err != nil {
+		return "", OIDCclaim{}, errors.New("error getting user from OIDC")
+	}
+	claims.Claims = flattenClaims(raw)
 
-	// If claims doesn't have the e-mail, attempt to fetch it from the userinfo endpoint.
-	if claims.Email == "" {
+	// If claims doesn't have the e-mail or the claims roles are mapped from, attempt
+	// to fetch them from the userinfo endpoint.
+	if claims.Email == "" || !hasClaims(claims.Claims, o.cfg.OIDC.Claims) {
 		userInfo, err := o.provider.UserInfo(context.TODO(), oauth2.StaticTokenSource(tk))
 		if err != nil {
 			return "", OIDCclaim{}, errors.New("error fetching user info from OIDC")
 		}
 
 		// Parse the UserInfo claims into the claims struct
-		if err := userInfo.Claims(&claims); err != nil {
+		var (
+			info    OIDCclaim
+			infoRaw map[string]any
+		)
+		if err := userInfo.Claims(&info); err != nil {
 			return "", OIDCclaim{}, errors.New("error parsing user info claims")
 		}
+		if err := userInfo.Claims(&infoRaw); err != nil {
+			return "", OIDCclaim{}, errors.New("error parsing user info claims")
+		}
+
+		if claims.Email == "" {
+			claims.Email = info.Email
+			claims.EmailVerified = info.EmailVerified
+		}
+		if claims.Name == "" {
+			claims.Name = info.Name
+		}
+		if claims.Picture == "" {
+			claims.Picture = info.Picture
+		}
+
+		// Claims in the ID token take precedence.
+		for k, v := range flattenClaims(infoRaw) {
+			if _, ok := claims.Claims[k]; !ok {
+				claims.Claims[k] = v
+			}
+		}
 	}
 
 	return rawIDTk, claims, nil
@@ -237,9 +365,22 @@ func (o *Auth) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
 				return next(c)
 			}
 
-			// Validate the token.
+			// Reject requests from locked out IPs without checking the credentials. Failed
+			// API requests are only counted against the IP so that an invalid token (of a
+			// stale API client) doesn't lock out the user of the same name.
+			ip := c.RealIP()
+			if o.IsLockedOut("", ip) {
+				c.Set(UserHTTPCtxKey, echo.NewHTTPError(http.StatusTooManyRequests, "too many failed login attempts. Try again later."))
+				return next(c)
+			}
+
+			// Validate the token, either the user's primary token or a scoped token.
 			user, ok := o.GetAPIToken(key, token)
 			if !ok {
+				user, ok = o.getScopedAPIToken(key, token, ip)
+			}
+			if !ok {
+				o.LoginFailed("", ip)
 				c.Set(UserHTTPCtxKey, echo.NewHTTPError(http.StatusForbidden, "invalid API credentials"))
 				return next(c)
 			}
@@ -299,13 +440,67 @@ func (o *Auth) Perm(next echo.HandlerFunc, perms ...string) echo.HandlerFunc {
 
 // SaveSession creates and sets a session (post successful login/auth).
 func (o *Auth) SaveSession(u User, oidcToken string, c echo.Context) error {
+	return o.saveSession(u, oidcToken, false, c)
+}
+
+// SavePendingSession creates and sets a session for a user who has logged in but is yet
+// to complete two-factor authentication. The session is not valid for anything else
+// until it's completed with CompletePendingSession().
+func (o *Auth) SavePendingSession(u User, oidcToken string, c echo.Context) error {
+	return o.saveSession(u, oidcToken, true, c)
+}
+
+// GetPendingSession returns the session of a user who is yet to complete two-factor
+// authentication and the user's ID.
+func (o *Auth) GetPendingSession(c echo.Context) (*simplesessions.Session, int, error) {
+	sess, err := o.sess.Acquire(context.TODO(), c, c)
+	if err != nil {
+		return nil, 0, echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+
+	vars, err := sess.GetAll()
+	if err != nil {
+		return nil, 0, echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+
+	if pending, _ := vars["totp_pending"].(bool); !pending {
+		return nil, 0, echo.NewHTTPError(http.StatusForbidden, "invalid session")
+	}
+
+	userID, err := o.sessStore.Int(vars["user_id"], nil)
+	if err != nil || userID < 1 {
+		return nil, 0, echo.NewHTTPError(http.StatusForbidden, "invalid session")
+	}
+
+	return sess, userID, nil
+}
+
+// CompletePendingSession marks a session as having completed two-factor authentication,
+// which makes it a regular login session.
+func (o *Auth) CompletePendingSession(sess *simplesessions.Session) error {
+	if err := sess.Set("totp_pending", false); err != nil {
+		o.log.Printf("error setting login session: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating session")
+	}
+
+	return nil
+}
+
+func (o *Auth) saveSession(u User, oidcToken string, pending bool, c echo.Context) error {
 	sess, err := o.sess.NewSession(c, c)
 	if err != nil {
 		o.log.Printf("error creating login session: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "error creating session")
 	}
 
-	if err := sess.SetMulti(map[string]any{"user_id": u.ID, "oidc_token": oidcToken}); err != nil {
+	if err := sess.SetMulti(map[string]any{
+		"user_id":      u.ID,
+		"oidc_token":   oidcToken,
+		"totp_pending": pending,
+		"ip":           c.RealIP(),
+		"user_agent":   c.Request().UserAgent(),
+		"last_seen":    time.Now().Unix(),
+	}); err != nil {
 		o.log.Printf("error setting login session: %v", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "error creating session")
 	}
@@ -322,11 +517,16 @@ func (o *Auth) validateSession(c echo.Context) (*simplesessions.Session, User, e
 	}
 
 	// Get the session variables.
-	vars, err := sess.GetMulti("user_id", "oidc_token")
+	vars, err := sess.GetAll()
 	if err != nil {
 		return nil, User{}, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
+	// Sessions that are yet to complete two-factor authentication aren't valid.
+	if pending, _ := vars["totp_pending"].(bool); pending {
+		return nil, User{}, echo.NewHTTPError(http.StatusForbidden, "invalid session")
+	}
+
 	// Validate the user ID in the session.
 	userID, err := o.sessStore.Int(vars["user_id"], nil)
 	if err != nil || userID < 1 {
@@ -338,8 +538,11 @@ func (o *Auth) validateSession(c echo.Context) (*simplesessions.Session, User, e
 	user, err := o.cb.GetUser(userID)
 	if err != nil {
 		o.log.Printf("error fetching session user: %v", err)
+		return sess, user, err
 	}
 
+	o.touchSession(sess, vars)
+
 	return sess, user, err
 }
 
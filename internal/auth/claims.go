@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// flattenClaims flattens the claims of an SSO identity to the string values of each
+// claim. Nested claims are keyed by their dotted paths, eg: realm_access.roles.
+func flattenClaims(raw map[string]any) map[string][]string {
+	out := map[string][]string{}
+	flattenClaim(out, "", raw)
+	return out
+}
+
+func flattenClaim(out map[string][]string, key string, v any) {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, sub := range val {
+			if key != "" {
+				k = key + "." + k
+			}
+			flattenClaim(out, k, sub)
+		}
+	case []any:
+		for _, sub := range val {
+			switch s := sub.(type) {
+			case map[string]any, []any, nil:
+				continue
+			default:
+				out[key] = append(out[key], strings.TrimSpace(fmt.Sprint(s)))
+			}
+		}
+	case nil:
+	default:
+		out[key] = append(out[key], strings.TrimSpace(fmt.Sprint(val)))
+	}
+}
+
+// hasClaims returns true if all the given claims are present.
+func hasClaims(claims map[string][]string, names []string) bool {
+	for _, n := range names {
+		if _, ok := claims[n]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Types of keys on which failed login attempts are tracked.
+	LockoutTypeUsername = "username"
+	LockoutTypeIP       = "ip"
+
+	lockoutPruneInterval = time.Minute
+)
+
+var (
+	// Delay after the first failed attempt. It doubles with every subsequent
+	// failure up to maxLoginDelay.
+	baseLoginDelay = time.Millisecond * 250
+	maxLoginDelay  = time.Second * 5
+)
+
+// LockoutConfig configures the tracking of failed login attempts. Failures are
+// counted in a sliding window of Duration. On reaching the max failures for a
+// username or an IP, it's locked out for Duration. 0 disables the respective limit.
+type LockoutConfig struct {
+	MaxAttempts   int
+	MaxIPAttempts int
+	Duration      time.Duration
+}
+
+// Lockout is a username or an IP that's locked out due to repeated failed login attempts.
+type Lockout struct {
+	Type        string    `json:"type"`
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// LoginFailures is the record of the recent failed login attempts of a username or an
+// IP, and the time until which it's locked out, if it is. It's what's persisted.
+type LoginFailures struct {
+	Type        string
+	Key         string
+	Attempts    []time.Time
+	LockedUntil time.Time
+}
+
+type loginFailures struct {
+	attempts    []time.Time
+	lockedUntil time.Time
+}
+
+// lockouts tracks failed login attempts per username and IP in memory, and writes
+// the changes through to the optional persistence callbacks.
+type lockouts struct {
+	cfg LockoutConfig
+	cb  *Callbacks
+	log *log.Logger
+
+	users map[string]*loginFailures
+	ips   map[string]*loginFailures
+	sync.Mutex
+}
+
+func newLockouts(cfg LockoutConfig, cb *Callbacks, lo *log.Logger) *lockouts {
+	if cb == nil {
+		cb = &Callbacks{}
+	}
+
+	l := &lockouts{
+		cfg:   cfg,
+		cb:    cb,
+		log:   lo,
+		users: map[string]*loginFailures{},
+		ips:   map[string]*loginFailures{},
+	}
+
+	// Load the failures and lockouts persisted before a restart.
+	if cb.GetLoginFailures != nil {
+		recs, err := cb.GetLoginFailures()
+		if err != nil {
+			lo.Printf("error loading failed login attempts: %v", err)
+		}
+
+		now := time.Now()
+		for _, r := range recs {
+			f := &loginFailures{attempts: r.Attempts, lockedUntil: r.LockedUntil}
+			f.attempts = f.recent(now, cfg.Duration)
+			if len(f.attempts) == 0 && !f.lockedUntil.After(now) {
+				continue
+			}
+
+			if r.Type == LockoutTypeIP {
+				l.ips[r.Key] = f
+			} else {
+				l.users[r.Key] = f
+			}
+		}
+	}
+
+	// Periodically forget old failures.
+	go func() {
+		for range time.Tick(lockoutPruneInterval) {
+			l.prune()
+		}
+	}()
+
+	return l
+}
+
+// IsLockedOut returns true if the username or the IP is locked out.
+func (o *Auth) IsLockedOut(username, ip string) bool {
+	l := o.lockouts
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	for _, f := range []*loginFailures{l.users[username], l.ips[ip]} {
+		if f != nil && f.lockedUntil.After(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LoginFailed records a failed login attempt for a username from an IP, locks either
+// out if it has reached its max failures, and blocks for a delay that increases with
+// the number of failures.
+func (o *Auth) LoginFailed(username, ip string) {
+	l := o.lockouts
+	if l.cfg.Duration <= 0 {
+		return
+	}
+
+	var (
+		now    = time.Now()
+		n      = 0
+		locked []Lockout
+		recs   []LoginFailures
+	)
+
+	l.Lock()
+	for _, k := range []struct {
+		typ string
+		key string
+		m   map[string]*loginFailures
+		max int
+	}{
+		{LockoutTypeUsername, username, l.users, l.cfg.MaxAttempts},
+		{LockoutTypeIP, ip, l.ips, l.cfg.MaxIPAttempts},
+	} {
+		if k.max <= 0 || k.key == "" {
+			continue
+		}
+
+		f, ok := k.m[k.key]
+		if !ok {
+			f = &loginFailures{}
+			k.m[k.key] = f
+		}
+		f.attempts = append(f.recent(now, l.cfg.Duration), now)
+		n = max(n, len(f.attempts))
+
+		// Lock out the key on hitting the max, once per lockout.
+		if len(f.attempts) >= k.max && !f.lockedUntil.After(now) {
+			f.lockedUntil = now.Add(l.cfg.Duration)
+			locked = append(locked, Lockout{Type: k.typ, Key: k.key, Failures: len(f.attempts), LockedUntil: f.lockedUntil})
+		}
+
+		recs = append(recs, LoginFailures{Type: k.typ, Key: k.key, Attempts: slices.Clone(f.attempts), LockedUntil: f.lockedUntil})
+	}
+	l.Unlock()
+
+	if l.cb.SaveLoginFailures != nil {
+		for _, r := range recs {
+			l.cb.SaveLoginFailures(r)
+		}
+	}
+
+	for _, lo := range locked {
+		o.log.Printf("locked out %s %s after %d failed login attempts until %s", lo.Type, lo.Key, lo.Failures, lo.LockedUntil.Format(time.RFC3339))
+		if l.cb.OnLockout != nil {
+			go l.cb.OnLockout(lo)
+		}
+	}
+
+	// Slow down subsequent attempts.
+	if n > 0 {
+		time.Sleep(min(baseLoginDelay<<(min(n, 16)-1), maxLoginDelay))
+	}
+}
+
+// LoginSucceeded clears the failed login attempts of a username.
+func (o *Auth) LoginSucceeded(username string) {
+	l := o.lockouts
+	l.Lock()
+	f, ok := l.users[username]
+	ok = ok && !f.lockedUntil.After(time.Now())
+	if ok {
+		delete(l.users, username)
+	}
+	l.Unlock()
+
+	if ok {
+		l.forget(LockoutTypeUsername, username)
+	}
+}
+
+// ClearLoginFailures clears the failed login attempts of a username and lifts its
+// lockout, if any, eg: when the user has reset their password.
+func (o *Auth) ClearLoginFailures(username string) {
+	l := o.lockouts
+	l.Lock()
+	_, ok := l.users[username]
+	delete(l.users, username)
+	l.Unlock()
+
+	if ok {
+		l.forget(LockoutTypeUsername, username)
+	}
+}
+
+// GetLockouts returns the usernames and IPs that are currently locked out.
+func (o *Auth) GetLockouts() []Lockout {
+	l := o.lockouts
+	l.Lock()
+	defer l.Unlock()
+
+	var (
+		now = time.Now()
+		out = []Lockout{}
+	)
+	for typ, m := range map[string]map[string]*loginFailures{LockoutTypeUsername: l.users, LockoutTypeIP: l.ips} {
+		for k, f := range m {
+			if f.lockedUntil.After(now) {
+				out = append(out, Lockout{Type: typ, Key: k, Failures: len(f.attempts), LockedUntil: f.lockedUntil})
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].LockedUntil.After(out[j].LockedUntil)
+	})
+
+	return out
+}
+
+// UnlockLogin lifts the lockout of a username or an IP and clears its failed attempts.
+// It returns false if it isn't locked out.
+func (o *Auth) UnlockLogin(typ, key string) bool {
+	l := o.lockouts
+	l.Lock()
+	m := l.users
+	if typ == LockoutTypeIP {
+		m = l.ips
+	}
+
+	f, ok := m[key]
+	if !ok || !f.lockedUntil.After(time.Now()) {
+		l.Unlock()
+		return false
+	}
+	delete(m, key)
+	l.Unlock()
+
+	l.forget(typ, key)
+	return true
+}
+
+// prune deletes the records of keys that have no recent failures and aren't locked out.
+func (l *lockouts) prune() {
+	var (
+		now    = time.Now()
+		pruned []LoginFailures
+	)
+
+	l.Lock()
+	for typ, m := range map[string]map[string]*loginFailures{LockoutTypeUsername: l.users, LockoutTypeIP: l.ips} {
+		for k, f := range m {
+			f.attempts = f.recent(now, l.cfg.Duration)
+			if len(f.attempts) == 0 && !f.lockedUntil.After(now) {
+				delete(m, k)
+				pruned = append(pruned, LoginFailures{Type: typ, Key: k})
+			}
+		}
+	}
+	l.Unlock()
+
+	for _, p := range pruned {
+		l.forget(p.Type, p.Key)
+	}
+}
+
+// forget deletes the persisted record of a key.
+func (l *lockouts) forget(typ, key string) {
+	if l.cb.DeleteLoginFailures != nil {
+		l.cb.DeleteLoginFailures(typ, key)
+	}
+}
+
+// recent returns the attempts within the window before now.
+func (f *loginFailures) recent(now time.Time, window time.Duration) []time.Time {
+	for i, t := range f.attempts {
+		if now.Sub(t) < window {
+			return f.attempts[i:]
+		}
+	}
+
+	return f.attempts[:0]
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memFailures is an in-memory store of persisted login failures.
+type memFailures struct {
+	recs map[string]LoginFailures
+	sync.Mutex
+}
+
+func (m *memFailures) callbacks() *Callbacks {
+	return &Callbacks{
+		GetLoginFailures: func() ([]LoginFailures, error) {
+			m.Lock()
+			defer m.Unlock()
+
+			out := []LoginFailures{}
+			for _, r := range m.recs {
+				out = append(out, r)
+			}
+			return out, nil
+		},
+		SaveLoginFailures: func(f LoginFailures) {
+			m.Lock()
+			m.recs[f.Type+":"+f.Key] = f
+			m.Unlock()
+		},
+		DeleteLoginFailures: func(typ, key string) {
+			m.Lock()
+			delete(m.recs, typ+":"+key)
+			m.Unlock()
+		},
+	}
+}
+
+func newTestAuth(cfg LockoutConfig, cb *Callbacks) *Auth {
+	baseLoginDelay = 0
+	lo := log.New(io.Discard, "", 0)
+	return &Auth{lockouts: newLockouts(cfg, cb, lo), log: lo}
+}
+
+var testLockoutCfg = LockoutConfig{MaxAttempts: 3, MaxIPAttempts: 5, Duration: time.Minute}
+
+func TestLockoutUsername(t *testing.T) {
+	a := newTestAuth(testLockoutCfg, nil)
+
+	for i := 0; i < 2; i++ {
+		a.LoginFailed("alice", "1.1.1.1")
+	}
+	if a.IsLockedOut("alice", "2.2.2.2") {
+		t.Fatal("locked out before the max attempts")
+	}
+
+	a.LoginFailed("alice", "1.1.1.1")
+	if !a.IsLockedOut("alice", "2.2.2.2") {
+		t.Fatal("username not locked out after the max attempts")
+	}
+	if a.IsLockedOut("bob", "2.2.2.2") {
+		t.Fatal("other username locked out")
+	}
+
+	// A successful login doesn't lift a lockout.
+	a.LoginSucceeded("alice")
+	if !a.IsLockedOut("alice", "2.2.2.2") {
+		t.Fatal("lockout lifted by a successful login")
+	}
+
+	l := a.GetLockouts()
+	if len(l) != 1 || l[0].Type != LockoutTypeUsername || l[0].Key != "alice" || l[0].Failures != 3 {
+		t.Fatalf("unexpected lockouts: %+v", l)
+	}
+
+	if !a.UnlockLogin(LockoutTypeUsername, "alice") {
+		t.Fatal("unlock failed")
+	}
+	if a.IsLockedOut("alice", "2.2.2.2") {
+		t.Fatal("locked out after unlocking")
+	}
+	if a.UnlockLogin(LockoutTypeUsername, "alice") {
+		t.Fatal("unlocked a username that isn't locked out")
+	}
+}
+
+func TestLockoutIP(t *testing.T) {
+	a := newTestAuth(testLockoutCfg, nil)
+
+	// Failures of different usernames from the same IP.
+	for _, u := range []string{"a", "b", "c", "d", "e"} {
+		a.LoginFailed(u, "1.1.1.1")
+	}
+	if !a.IsLockedOut("f", "1.1.1.1") {
+		t.Fatal("IP not locked out after the max attempts")
+	}
+	if a.IsLockedOut("f", "2.2.2.2") {
+		t.Fatal("other IP locked out")
+	}
+
+	// IP-only failures (API requests) don't touch usernames.
+	a = newTestAuth(testLockoutCfg, nil)
+	for i := 0; i < 5; i++ {
+		a.LoginFailed("", "1.1.1.1")
+	}
+	if !a.IsLockedOut("", "1.1.1.1") {
+		t.Fatal("IP not locked out after the max attempts")
+	}
+	if len(a.GetLockouts()) != 1 {
+		t.Fatalf("unexpected lockouts: %+v", a.GetLockouts())
+	}
+}
+
+func TestLockoutSucceededClears(t *testing.T) {
+	a := newTestAuth(testLockoutCfg, nil)
+
+	a.LoginFailed("alice", "1.1.1.1")
+	a.LoginFailed("alice", "1.1.1.1")
+	a.LoginSucceeded("alice")
+	a.LoginFailed("alice", "1.1.1.1")
+	a.LoginFailed("alice", "1.1.1.1")
+	if a.IsLockedOut("alice", "2.2.2.2") {
+		t.Fatal("failures before a successful login counted")
+	}
+}
+
+func TestLockoutClearLoginFailures(t *testing.T) {
+	a := newTestAuth(testLockoutCfg, nil)
+	for i := 0; i < 3; i++ {
+		a.LoginFailed("alice", "1.1.1.1")
+	}
+
+	a.ClearLoginFailures("alice")
+	if a.IsLockedOut("alice", "2.2.2.2") {
+		t.Fatal("locked out after clearing failures")
+	}
+}
+
+func TestLockoutDisabled(t *testing.T) {
+	for _, cfg := range []LockoutConfig{
+		{MaxAttempts: 3, MaxIPAttempts: 5},
+		{Duration: time.Minute},
+	} {
+		a := newTestAuth(cfg, nil)
+		for i := 0; i < 10; i++ {
+			a.LoginFailed("alice", "1.1.1.1")
+		}
+		if a.IsLockedOut("alice", "1.1.1.1") {
+			t.Fatalf("locked out with limits disabled: %+v", cfg)
+		}
+	}
+}
+
+func TestLockoutWindow(t *testing.T) {
+	f := &loginFailures{}
+	now := time.Now()
+	f.attempts = []time.Time{now.Add(-time.Minute * 2), now.Add(-time.Second * 30), now}
+
+	if n := len(f.recent(now, time.Minute)); n != 2 {
+		t.Fatalf("expected 2 recent attempts, got %d", n)
+	}
+	if n := len(f.recent(now.Add(time.Hour), time.Minute)); n != 0 {
+		t.Fatalf("expected 0 recent attempts, got %d", n)
+	}
+}
+
+func TestLockoutPersistence(t *testing.T) {
+	var (
+		m  = &memFailures{recs: map[string]LoginFailures{}}
+		cb = m.callbacks()
+		a  = newTestAuth(testLockoutCfg, cb)
+	)
+
+	for i := 0; i < 3; i++ {
+		a.LoginFailed("alice", "1.1.1.1")
+	}
+	a.LoginFailed("bob", "1.1.1.1")
+
+	// A new instance (restart) picks up the lockout and the failures.
+	a = newTestAuth(testLockoutCfg, cb)
+	if !a.IsLockedOut("alice", "2.2.2.2") {
+		t.Fatal("lockout not restored")
+	}
+	a.LoginFailed("bob", "3.3.3.3")
+	a.LoginFailed("bob", "3.3.3.3")
+	if !a.IsLockedOut("bob", "2.2.2.2") {
+		t.Fatal("failures not restored")
+	}
+
+	// Unlocking and clearing delete the records.
+	a.UnlockLogin(LockoutTypeUsername, "alice")
+	a.ClearLoginFailures("bob")
+	a = newTestAuth(testLockoutCfg, cb)
+	if a.IsLockedOut("alice", "2.2.2.2") || a.IsLockedOut("bob", "2.2.2.2") {
+		t.Fatal("cleared lockouts restored")
+	}
+
+	// Expired records aren't restored.
+	m.recs["username:old"] = LoginFailures{
+		Type:        LockoutTypeUsername,
+		Key:         "old",
+		Attempts:    []time.Time{time.Now().Add(-time.Hour)},
+		LockedUntil: time.Now().Add(-time.Minute),
+	}
+	a = newTestAuth(testLockoutCfg, cb)
+	if _, ok := a.lockouts.users["old"]; ok {
+		t.Fatal("expired record restored")
+	}
+}
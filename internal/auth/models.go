@@ -57,6 +57,7 @@ const (
 	PermCampaignsGetAnalytics = "campaigns:get_analytics"
 	PermCampaignsManage       = "campaigns:manage"
 	PermCampaignsManageAll    = "campaigns:manage_all"
+	PermCampaignsApprove      = "campaigns:approve"
 	PermBouncesGet            = "bounces:get"
 	PermBouncesManage         = "bounces:manage"
 	PermWebhooksPostBounce    = "webhooks:post_bounce"
@@ -64,6 +65,10 @@ const (
 	PermMediaManage           = "media:manage"
 	PermTemplatesGet          = "templates:get"
 	PermTemplatesManage       = "templates:manage"
+	PermSegmentsGet           = "segments:get"
+	PermSegmentsManage        = "segments:manage"
+	PermSequencesGet          = "sequences:get"
+	PermSequencesManage       = "sequences:manage"
 	PermUsersGet              = "users:get"
 	PermUsersManage           = "users:manage"
 	PermRolesGet              = "roles:get"
@@ -71,6 +76,7 @@ const (
 	PermSettingsGet           = "settings:get"
 	PermSettingsManage        = "settings:manage"
 	PermSettingsMaintain      = "settings:maintain"
+	PermAuditGet              = "audit:get"
 )
 
 // Base holds common fields shared across models.
@@ -95,6 +101,12 @@ type User struct {
 	Type          string           `db:"type" json:"type"`
 	Status        string           `db:"status" json:"status"`
 	Avatar        null.String      `db:"avatar" json:"avatar"`
+	TOTPEnabled   bool             `db:"totp_enabled" json:"totp_enabled"`
+	TOTPSecret    null.String      `db:"totp_secret" json:"-"`
+	TOTPCodes     pq.StringArray   `db:"totp_recovery_codes" json:"-"`
+	TOTPLastStep  int64            `db:"totp_last_step" json:"-"`
+	TOTPFailures  int              `db:"totp_failures" json:"-"`
+	TOTPFailedAt  null.Time        `db:"totp_failed_at" json:"-"`
 	LoggedInAt    null.Time        `db:"loggedin_at" json:"loggedin_at"`
 	UserRoleID    int              `db:"user_role_id" json:"user_role_id,omitempty"`
 	UserRoleName  string           `db:"user_role_name" json:"-"`
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+)
+
+const (
+	// SAML SP endpoints relative to the root URL.
+	SAMLMetadataURI = "/auth/saml/metadata"
+	SAMLACSURI      = "/auth/saml/acs"
+
+	samlMetadataTimeout = time.Second * 30
+)
+
+// SAMLConfig configures listmonk as a SAML 2.0 service provider (SP).
+type SAMLConfig struct {
+	Enabled bool
+
+	// The IdP's metadata is fetched from the URL if it's set, or read from the XML.
+	IDPMetadataURL string
+	IDPMetadata    string
+
+	// PEM encoded certificate and private key of the SP.
+	Certificate string
+	PrivateKey  string
+
+	// Root URL of the listmonk installation on which the SP endpoints are served.
+	RootURL string
+
+	// Names of the assertion attributes that carry the user's details.
+	AttrEmail string
+	AttrName  string
+}
+
+// SAMLclaim is the user's identity asserted by the IdP.
+type SAMLclaim struct {
+	NameID string
+	Email  string
+	Name   string
+
+	// Values of all the attributes keyed by their names and friendly names,
+	// for mapping them to roles.
+	Attributes map[string][]string
+}
+
+// initSAML sets up the SAML service provider.
+func (o *Auth) initSAML(cfg SAMLConfig) error {
+	keyPair, err := tls.X509KeyPair([]byte(cfg.Certificate), []byte(cfg.PrivateKey))
+	if err != nil {
+		return fmt.Errorf("error loading SP certificate and key: %v", err)
+	}
+	cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("error parsing SP certificate: %v", err)
+	}
+	key, ok := keyPair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return errors.New("unsupported SP private key")
+	}
+
+	md := []byte(cfg.IDPMetadata)
+	if cfg.IDPMetadataURL != "" {
+		md, err = fetchSAMLMetadata(cfg.IDPMetadataURL)
+		if err != nil {
+			return err
+		}
+	}
+	idp, err := parseSAMLMetadata(md)
+	if err != nil {
+		return err
+	}
+
+	root := strings.TrimRight(cfg.RootURL, "/")
+	mdURL, err := url.Parse(root + SAMLMetadataURI)
+	if err != nil {
+		return err
+	}
+	acsURL, err := url.Parse(root + SAMLACSURI)
+	if err != nil {
+		return err
+	}
+
+	o.samlSP = &saml.ServiceProvider{
+		EntityID:          mdURL.String(),
+		Key:               key,
+		Certificate:       cert,
+		MetadataURL:       *mdURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idp,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+	}
+
+	return nil
+}
+
+// SAMLEnabled returns true if SAML is enabled and its SP is set up.
+func (o *Auth) SAMLEnabled() bool {
+	return o.samlSP != nil
+}
+
+// GetSAMLMetadata returns the SP's metadata XML to be registered with the IdP.
+func (o *Auth) GetSAMLMetadata() ([]byte, error) {
+	b, err := xml.MarshalIndent(o.samlSP.Metadata(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), b...), nil
+}
+
+// GetSAMLAuthURL returns the IdP URL to redirect to for login along with the ID of the
+// authentication request, which has to be checked against the IdP's response.
+func (o *Auth) GetSAMLAuthURL() (string, string, error) {
+	req, err := o.samlSP.MakeAuthenticationRequest(o.samlSP.GetSSOBindingLocation(saml.HTTPRedirectBinding),
+		saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", err
+	}
+
+	u, err := req.Redirect("", o.samlSP)
+	if err != nil {
+		return "", "", err
+	}
+
+	return u.String(), req.ID, nil
+}
+
+// ParseSAMLResponse validates the IdP's response POSTed to the ACS endpoint against the
+// ID of the authentication request and returns the asserted identity.
+func (o *Auth) ParseSAMLResponse(r *http.Request, requestID string) (SAMLclaim, error) {
+	if err := r.ParseForm(); err != nil {
+		return SAMLclaim{}, err
+	}
+
+	as, err := o.samlSP.ParseResponse(r, []string{requestID})
+	if err != nil {
+		// The public error is deliberately vague. Log the actual reason.
+		var e *saml.InvalidResponseError
+		if errors.As(err, &e) {
+			o.log.Printf("invalid SAML response: %v", e.PrivateErr)
+		}
+		return SAMLclaim{}, err
+	}
+
+	out := SAMLclaim{Attributes: map[string][]string{}}
+	if as.Subject != nil && as.Subject.NameID != nil {
+		out.NameID = as.Subject.NameID.Value
+	}
+
+	for _, st := range as.AttributeStatements {
+		for _, attr := range st.Attributes {
+			var vals []string
+			for _, v := range attr.Values {
+				if s := strings.TrimSpace(v.Value); s != "" {
+					vals = append(vals, s)
+				}
+			}
+			if len(vals) == 0 {
+				continue
+			}
+
+			switch {
+			case samlAttrIs(attr, o.cfg.SAML.AttrEmail):
+				out.Email = vals[0]
+			case samlAttrIs(attr, o.cfg.SAML.AttrName):
+				out.Name = vals[0]
+			}
+
+			for _, n := range []string{attr.Name, attr.FriendlyName} {
+				if n != "" {
+					out.Attributes[n] = append(out.Attributes[n], vals...)
+				}
+			}
+		}
+	}
+
+	// Without an e-mail attribute, fall back to the NameID if it's an e-mail.
+	if out.Email == "" && strings.Contains(out.NameID, "@") {
+		out.Email = out.NameID
+	}
+
+	return out, nil
+}
+
+// samlAttrIs checks if an assertion attribute has the given name or friendly name.
+func samlAttrIs(attr saml.Attribute, name string) bool {
+	return name != "" && (attr.Name == name || attr.FriendlyName == name)
+}
+
+// fetchSAMLMetadata fetches the IdP's metadata XML from a URL.
+func fetchSAMLMetadata(u string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), samlMetadataTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching IdP metadata: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching IdP metadata: %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseSAMLMetadata parses an IdP's metadata XML, which is either a single entity
+// or a list of entities, of which the first IdP is picked.
+func parseSAMLMetadata(b []byte) (*saml.EntityDescriptor, error) {
+	var ed saml.EntityDescriptor
+	if err := xml.Unmarshal(b, &ed); err == nil && len(ed.IDPSSODescriptors) > 0 {
+		return &ed, nil
+	}
+
+	var eds saml.EntitiesDescriptor
+	if err := xml.Unmarshal(b, &eds); err != nil {
+		return nil, fmt.Errorf("error parsing IdP metadata: %v", err)
+	}
+	for _, e := range eds.EntityDescriptors {
+		if len(e.IDPSSODescriptors) > 0 {
+			return &e, nil
+		}
+	}
+
+	return nil, errors.New("no IdP found in the IdP metadata")
+}
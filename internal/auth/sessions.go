@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zerodha/simplesessions/v3"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	// Duration after creation for which a login session is valid.
+	SessionTTL = time.Hour * 24
+
+	// Minimum interval between recording the last activity on a session.
+	sessLastSeenInterval = time.Minute
+)
+
+// Session is an active login session of a user. Session IDs are secrets that
+// authenticate requests, so sessions are only identified by the hashes of their IDs.
+type Session struct {
+	ID         string    `db:"id" json:"id"`
+	IP         string    `db:"ip" json:"ip"`
+	UserAgent  string    `db:"user_agent" json:"user_agent"`
+	CreatedAt  null.Time `db:"created_at" json:"created_at"`
+	LastSeenAt null.Time `db:"last_seen_at" json:"last_seen_at"`
+
+	// Whether it's the session of the request that fetched it.
+	Current bool `db:"-" json:"current"`
+}
+
+// HashSessionID returns the hash of a session ID by which a session is identified.
+func HashSessionID(id string) string {
+	h := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(h[:])
+}
+
+// GetSessionID returns the hashed ID of the login session of an authenticated HTTP
+// handler request, or an empty string if the request is authenticated with an API token.
+func GetSessionID(c echo.Context) string {
+	sess, ok := c.Get(SessionKey).(*simplesessions.Session)
+	if !ok || sess == nil {
+		return ""
+	}
+
+	return HashSessionID(sess.ID())
+}
+
+// touchSession records the time of the last activity on a session at most once
+// every sessLastSeenInterval.
+func (o *Auth) touchSession(sess *simplesessions.Session, vars map[string]any) {
+	now := time.Now()
+	if t, _ := vars["last_seen"].(float64); now.Sub(time.Unix(int64(t), 0)) < sessLastSeenInterval {
+		return
+	}
+
+	if err := sess.Set("last_seen", now.Unix()); err != nil {
+		o.log.Printf("error updating login session: %v", err)
+	}
+}
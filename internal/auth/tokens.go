@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/lib/pq"
+	null "gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	// Number of leading characters of a scoped API token stored in plaintext to identify it.
+	APITokenPrefixLen = 8
+
+	// Minimum interval between recording the last use of a scoped API token.
+	apiTokenUsageInterval = time.Minute
+)
+
+// APIToken is a named token of an API user with a subset of the user's permissions,
+// an optional list scope, and an optional expiry.
+type APIToken struct {
+	ID          int            `db:"id" json:"id"`
+	UserID      int            `db:"user_id" json:"user_id"`
+	Name        string         `db:"name" json:"name"`
+	Prefix      string         `db:"token_prefix" json:"token_prefix"`
+	Permissions pq.StringArray `db:"permissions" json:"permissions"`
+
+	// Lists the token is restricted to. If empty, the user's list permissions apply.
+	ListIDs pq.Int64Array `db:"list_ids" json:"list_ids"`
+
+	ExpiresAt  null.Time `db:"expires_at" json:"expires_at"`
+	LastUsedAt null.Time `db:"last_used_at" json:"last_used_at"`
+	LastUsedIP string    `db:"last_used_ip" json:"last_used_ip"`
+	CreatedAt  null.Time `db:"created_at" json:"created_at"`
+	UpdatedAt  null.Time `db:"updated_at" json:"updated_at"`
+
+	TokenHash string `db:"token_hash" json:"-"`
+
+	// The plaintext token. This is only available when the token is created.
+	Token string `db:"-" json:"token,omitempty"`
+}
+
+// scopedAPIToken is a cached API token along with the user it authenticates as, with
+// the permissions narrowed down to the token's scope.
+type scopedAPIToken struct {
+	APIToken
+	user User
+}
+
+// HashAPIToken returns the hash of a scoped API token that's stored in the DB.
+func HashAPIToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// IsExpired returns true if the token has an expiry that has passed.
+func (t *APIToken) IsExpired() bool {
+	return t.ExpiresAt.Valid && !t.ExpiresAt.Time.After(time.Now())
+}
+
+// Scope returns a copy of the user with only the permissions of the given token that the
+// user has. If the token has a list scope, the copy only has access to those lists, and
+// the blanket permissions that span all lists (lists:*_all, campaigns:*_all,
+// subscribers:get_all, and subscribers:sql_query) are dropped.
+func (u User) Scope(t APIToken) User {
+	var (
+		out     = u
+		isSuper = u.UserRole.ID == SuperAdminRoleID
+	)
+
+	permsMap := make(map[string]struct{}, len(t.Permissions))
+	for _, p := range t.Permissions {
+		if _, ok := u.PermissionsMap[p]; ok || isSuper {
+			permsMap[p] = struct{}{}
+		}
+	}
+
+	// Restrict list access to the token's lists.
+	if len(t.ListIDs) > 0 {
+		_, getAll := permsMap[PermListGetAll]
+		_, manageAll := permsMap[PermListManageAll]
+
+		out.ListPermissionsMap = make(map[int]map[string]struct{}, len(t.ListIDs))
+		out.GetListIDs = nil
+		out.ManageListIDs = nil
+		for _, id := range t.ListIDs {
+			listID := int(id)
+
+			p := map[string]struct{}{}
+			if getAll || u.hasListPerm(PermListGet, listID) {
+				p[PermListGet] = struct{}{}
+				out.GetListIDs = append(out.GetListIDs, listID)
+			}
+			if manageAll || u.hasListPerm(PermListManage, listID) {
+				p[PermListManage] = struct{}{}
+				out.ManageListIDs = append(out.ManageListIDs, listID)
+			}
+
+			if len(p) > 0 {
+				out.ListPermissionsMap[listID] = p
+			}
+		}
+
+		delete(permsMap, PermListGetAll)
+		delete(permsMap, PermListManageAll)
+		delete(permsMap, PermSubscribersGetAll)
+		delete(permsMap, PermSubscribersSqlQuery)
+		delete(permsMap, PermCampaignsGetAll)
+		delete(permsMap, PermCampaignsManageAll)
+	}
+
+	perms := make([]string, 0, len(permsMap))
+	for _, p := range t.Permissions {
+		if _, ok := permsMap[p]; ok {
+			perms = append(perms, p)
+		}
+	}
+
+	// The super admin role bypasses permission checks. A scoped token never does.
+	out.UserRole.ID = 0
+	out.UserRole.Permissions = perms
+	out.UserRoleID = 0
+	out.PermissionsMap = permsMap
+	out.Password = null.String{}
+
+	return out
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"image/png"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// Users who must use TOTP two-factor authentication (security.totp_required).
+	TOTPRequiredOff   = "off"
+	TOTPRequiredAll   = "all"
+	TOTPRequiredRoles = "roles"
+
+	// Number of one time recovery codes generated on enrolment, and the number of
+	// random bytes in each.
+	numTOTPRecoveryCodes  = 10
+	totpRecoveryCodeBytes = 10
+
+	// TOTP codes are valid for a period, and are accepted for a period on either
+	// side of the current one to allow for clock drift.
+	totpPeriod = 30
+	totpSkew   = 1
+
+	totpQRSize = 200
+)
+
+// TOTPKey is a TOTP secret that a user enrols with in an authenticator app.
+type TOTPKey struct {
+	Secret string `json:"secret"`
+
+	// otpauth:// URI of the secret and its QR code image as a PNG data URI.
+	URI string `json:"uri"`
+	QR  string `json:"qr"`
+}
+
+// GenerateTOTPSecret generates a new random TOTP secret.
+func GenerateTOTPSecret(issuer, account string) (string, error) {
+	k, err := totp.Generate(totp.GenerateOpts{Issuer: issuer, AccountName: account})
+	if err != nil {
+		return "", err
+	}
+
+	return k.Secret(), nil
+}
+
+// NewTOTPKey returns the enrolment URI and the QR code of a TOTP secret.
+func NewTOTPKey(issuer, account, secret string) (TOTPKey, error) {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+
+	k, err := otp.NewKeyFromURL(u.String())
+	if err != nil {
+		return TOTPKey{}, err
+	}
+
+	img, err := k.Image(totpQRSize, totpQRSize)
+	if err != nil {
+		return TOTPKey{}, err
+	}
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return TOTPKey{}, err
+	}
+
+	return TOTPKey{
+		Secret: secret,
+		URI:    k.URL(),
+		QR:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(b.Bytes()),
+	}, nil
+}
+
+// ValidateTOTP checks whether a code generated by an authenticator app is valid for the
+// secret at the given time, and returns the time step (counter) of the code. A code should
+// only be accepted once, that is, if its step is after the last accepted step.
+func ValidateTOTP(code, secret string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if secret == "" || len(code) != int(otp.DigitsSix) {
+		return 0, false
+	}
+
+	for i := -totpSkew; i <= totpSkew; i++ {
+		t := now.Add(time.Duration(i*totpPeriod) * time.Second)
+		c, err := totp.GenerateCodeCustom(secret, t, totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c), []byte(code)) == 1 {
+			return t.Unix() / totpPeriod, true
+		}
+	}
+
+	return 0, false
+}
+
+// GenerateTOTPRecoveryCodes generates one time recovery codes that can be used to log in
+// in place of a TOTP code, eg: 3f9a1-0c2be-77d10-a94e5.
+func GenerateTOTPRecoveryCodes() ([]string, error) {
+	out := make([]string, 0, numTOTPRecoveryCodes)
+	for range numTOTPRecoveryCodes {
+		b := make([]byte, totpRecoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		s := hex.EncodeToString(b)
+		out = append(out, s[:5]+"-"+s[5:10]+"-"+s[10:15]+"-"+s[15:])
+	}
+
+	return out, nil
+}
+
+// HashTOTPRecoveryCode returns the hash of a recovery code, as entered by a user,
+// which is what's stored in the DB.
+func HashTOTPRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+
+	h := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(h[:])
+}
+
+// NeedsTOTP returns true if the user has to complete two-factor authentication on login,
+// either because they've enrolled or because the given policy requires them to.
+func (u *User) NeedsTOTP(required string, roleIDs []int) bool {
+	if u.Type != UserTypeUser {
+		return false
+	}
+
+	if u.TOTPEnabled {
+		return true
+	}
+
+	// The role is only set on UserRole on users fetched with their roles.
+	roleID := u.UserRole.ID
+	if roleID == 0 {
+		roleID = u.UserRoleID
+	}
+
+	switch required {
+	case TOTPRequiredAll:
+		return true
+	case TOTPRequiredRoles:
+		return slices.Contains(roleIDs, roleID)
+	}
+
+	return false
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	c, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+		Period:    totpPeriod,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestValidateTOTP(t *testing.T) {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	now := time.Unix(1_700_000_015, 0)
+	step := now.Unix() / totpPeriod
+
+	cases := []struct {
+		name string
+		at   time.Time
+		ok   bool
+		step int64
+	}{
+		{"current", now, true, step},
+		{"previous period", now.Add(-time.Second * totpPeriod), true, step - 1},
+		{"next period", now.Add(time.Second * totpPeriod), true, step + 1},
+		{"too old", now.Add(-time.Second * totpPeriod * 2), false, 0},
+		{"too new", now.Add(time.Second * totpPeriod * 2), false, 0},
+	}
+
+	for _, c := range cases {
+		got, ok := ValidateTOTP(totpCode(t, secret, c.at), secret, now)
+		if ok != c.ok || got != c.step {
+			t.Errorf("%s: expected (%d, %v), got (%d, %v)", c.name, c.step, c.ok, got, ok)
+		}
+	}
+
+	// Replays are detected by the step, which is the same for every code of a period.
+	s1, _ := ValidateTOTP(totpCode(t, secret, now), secret, now)
+	s2, _ := ValidateTOTP(totpCode(t, secret, now), secret, now.Add(time.Second*10))
+	if s1 != s2 {
+		t.Errorf("expected the same step for a code in its period, got %d and %d", s1, s2)
+	}
+
+	code := totpCode(t, secret, now)
+	for _, c := range []struct {
+		name, code, secret string
+		ok                 bool
+	}{
+		{"spaces", code[:3] + " " + code[3:], secret, true},
+		{"empty", "", secret, false},
+		{"short", code[:5], secret, false},
+		{"long", code + "0", secret, false},
+		{"no secret", code, "", false},
+		{"other secret", code, "JBSWY3DPEHPK3PXP", false},
+	} {
+		if _, ok := ValidateTOTP(c.code, c.secret, now); ok != c.ok {
+			t.Errorf("%s: expected %v, got %v", c.name, c.ok, ok)
+		}
+	}
+}
+
+func TestGenerateTOTPRecoveryCodes(t *testing.T) {
+	codes, err := GenerateTOTPRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != numTOTPRecoveryCodes {
+		t.Fatalf("expected %d codes, got %d", numTOTPRecoveryCodes, len(codes))
+	}
+
+	re := regexp.MustCompile(`^[0-9a-f]{5}-[0-9a-f]{5}-[0-9a-f]{5}-[0-9a-f]{5}$`)
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if !re.MatchString(c) {
+			t.Errorf("invalid code format: %s", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicate code: %s", c)
+		}
+		seen[c] = true
+	}
+}
+
+func TestHashTOTPRecoveryCode(t *testing.T) {
+	h := HashTOTPRecoveryCode("3f9a1-0c2be-77d10-a94e5")
+	if len(h) != 64 {
+		t.Fatalf("expected a SHA256 hex hash, got %s", h)
+	}
+
+	// The code as entered is normalized.
+	for _, c := range []string{"3f9a10c2be77d10a94e5", " 3F9A1-0C2BE-77D10-A94E5 ", "3f9a1 0c2be 77d10 a94e5"} {
+		if got := HashTOTPRecoveryCode(c); got != h {
+			t.Errorf("%q: expected %s, got %s", c, h, got)
+		}
+	}
+
+	if HashTOTPRecoveryCode("3f9a1-0c2be-77d10-a94e6") == h {
+		t.Error("different codes have the same hash")
+	}
+}
+
+func TestNeedsTOTP(t *testing.T) {
+	var (
+		user    = User{Type: UserTypeUser, UserRoleID: 2}
+		enabled = User{Type: UserTypeUser, TOTPEnabled: true}
+		api     = User{Type: UserTypeAPI, UserRoleID: 2}
+	)
+
+	cases := []struct {
+		name     string
+		u        User
+		required string
+		roles    []int
+		exp      bool
+	}{
+		{"off", user, TOTPRequiredOff, nil, false},
+		{"enrolled", enabled, TOTPRequiredOff, nil, true},
+		{"all", user, TOTPRequiredAll, nil, true},
+		{"role", user, TOTPRequiredRoles, []int{1, 2}, true},
+		{"other role", user, TOTPRequiredRoles, []int{1}, false},
+		{"api", api, TOTPRequiredAll, nil, false},
+	}
+
+	for _, c := range cases {
+		if got := c.u.NeedsTOTP(c.required, c.roles); got != c.exp {
+			t.Errorf("%s: expected %v, got %v", c.name, c.exp, got)
+		}
+	}
+}
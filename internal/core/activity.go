@@ -0,0 +1,74 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetSubscriberActivity retrieves the paginated activity timeline of a subscriber, latest
+// first, optionally filtered by the types of activity. It also returns the total number
+// of entries in the timeline.
+func (c *Core) GetSubscriberActivity(subID int, types []string, offset, limit int) ([]models.SubscriberActivity, int, error) {
+	if types == nil {
+		types = []string{}
+	}
+
+	out := []models.SubscriberActivity{}
+	if err := c.q.GetSubscriberActivity.Select(&out, subID, pq.StringArray(types), offset, limit); err != nil {
+		c.log.Printf("error fetching subscriber activity: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{subscribers.activity}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// AddSubscriberEvents records an event in the history of the given subscribers by ID or UUID.
+// Events are a record of changes that have already been made, so errors are only logged.
+func (c *Core) AddSubscriberEvents(subIDs []int, subUUIDs []string, e models.SubscriberEvent) {
+	if subIDs == nil {
+		subIDs = []int{}
+	}
+	if subUUIDs == nil {
+		subUUIDs = []string{}
+	}
+	if e.ListIDs == nil {
+		e.ListIDs = []int{}
+	}
+	if e.ListUUIDs == nil {
+		e.ListUUIDs = []string{}
+	}
+	if e.Meta == nil {
+		e.Meta = models.JSON{}
+	}
+
+	if _, err := c.q.AddSubscriberEvents.Exec(pq.Array(subIDs), pq.StringArray(subUUIDs),
+		e.Type, e.Source, e.UserID, e.CampaignUUID, e.Meta, pq.Array(e.ListIDs), pq.StringArray(e.ListUUIDs)); err != nil {
+		c.log.Printf("error recording subscriber event (%s): %v", e.Type, err)
+	}
+}
+
+// AddSubscriberEventsByQuery records an event in the history of the subscribers who match
+// an arbitrary query expression. It has to be called before the change is made as the
+// change may affect which subscribers match the query.
+func (c *Core) AddSubscriberEventsByQuery(searchStr, queryExp string, listIDs []int, subStatus string, e models.SubscriberEvent) {
+	if e.ListIDs == nil {
+		e.ListIDs = []int{}
+	}
+	if e.Meta == nil {
+		e.Meta = models.JSON{}
+	}
+
+	if err := c.q.ExecSubQueryTpl(searchStr, sanitizeSQLExp(queryExp), c.q.AddSubscriberEventsByQuery, listIDs, c.db, subStatus,
+		e.Type, e.Source, e.UserID, e.Meta, pq.Array(e.ListIDs)); err != nil {
+		c.log.Printf("error recording subscriber events (%s): %v", e.Type, err)
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetCampaignApprovals retrieves the approval history of a campaign, latest first.
+func (c *Core) GetCampaignApprovals(campID int) ([]models.CampaignApproval, error) {
+	out := []models.CampaignApproval{}
+	if err := c.q.GetCampaignApprovals.Select(&out, campID); err != nil {
+		c.log.Printf("error fetching campaign approvals: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.approvals}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// AddCampaignApproval records an action (request, approval, rejection) in the
+// approval history of a campaign.
+func (c *Core) AddCampaignApproval(campID, userID int, action, note string) error {
+	if _, err := c.q.AddCampaignApproval.Exec(campID, userID, action, note); err != nil {
+		c.log.Printf("error recording campaign approval: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.approval}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// InvalidateCampaignApproval reverts a campaign that's pending approval or has been
+// approved back to a draft, for instance, when its content is edited.
+func (c *Core) InvalidateCampaignApproval(campID, userID int, note string) error {
+	if _, err := c.q.InvalidateCampaignApproval.Exec(campID, userID, note); err != nil {
+		c.log.Printf("error invalidating campaign approval: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetCampaignApprovers retrieves the e-mails of the users who can approve
+// campaigns, excluding the given user.
+func (c *Core) GetCampaignApprovers(excludeUserID int) ([]string, error) {
+	out := []string{}
+	if err := c.q.GetCampaignApprovers.Select(&out, excludeUserID); err != nil {
+		c.log.Printf("error fetching campaign approvers: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.users}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
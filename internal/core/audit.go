@@ -0,0 +1,51 @@
+package core
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+// QueryAuditLog retrieves paginated audit log entries, latest first, optionally filtered
+// by the user, the entity, the action (prefix), and the time range. It also returns the
+// total number of matching entries.
+func (c *Core) QueryAuditLog(userID int, entityType, entityID, action string, from, to null.Time, offset, limit int) ([]models.AuditLog, int, error) {
+	out := []models.AuditLog{}
+	if err := c.q.QueryAuditLog.Select(&out, userID, entityType, entityID, action, from, to, offset, limit); err != nil {
+		c.log.Printf("error fetching audit log: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.auditLog}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// AddAuditLog records an entry in the audit log. The change it records has already
+// been made, so errors are only logged.
+func (c *Core) AddAuditLog(l models.AuditLog) {
+	if _, err := c.q.AddAuditLog.Exec(l.UserID.Int, l.Username, l.IP, l.Method, l.Path, l.Action,
+		l.EntityType, l.EntityID, l.Status, string(l.Before), string(l.After)); err != nil {
+		c.log.Printf("error recording audit log (%s %s): %v", l.Method, l.Path, err)
+	}
+}
+
+// DeleteAuditLog deletes audit log entries older than the given date.
+func (c *Core) DeleteAuditLog(beforeDate time.Time) (int, error) {
+	res, err := c.q.DeleteAuditLog.Exec(beforeDate)
+	if err != nil {
+		c.log.Printf("error deleting audit log: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.auditLog}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
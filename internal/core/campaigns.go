@@ -168,6 +168,11 @@ func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int)
 			c.i18n.Ts("globals.messages.errorUUID", "error", err.Error()))
 	}
 
+	// Required for pq.Array()
+	if o.SegmentIDs == nil {
+		o.SegmentIDs = pq.Int64Array{}
+	}
+
 	// Insert and read ID.
 	var newID int
 	if err := c.q.CreateCampaign.Get(&newID,
@@ -191,6 +196,17 @@ func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int)
 		o.ArchiveMeta,
 		pq.Array(mediaIDs),
 		o.BodySource,
+		o.ABMetric,
+		o.ABWait,
+		o.SendMode,
+		o.RecurCron,
+		o.RecurFeedURL,
+		o.ParentID,
+		o.FeedItems,
+		o.ThrottleRate,
+		o.ThrottleCap,
+		o.ThrottleWindow,
+		o.SegmentIDs,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return models.Campaign{}, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("campaigns.noSubs"))
@@ -209,9 +225,19 @@ func (c *Core) CreateCampaign(o models.Campaign, listIDs []int, mediaIDs []int)
 	return out, nil
 }
 
-// UpdateCampaign updates a campaign.
-func (c *Core) UpdateCampaign(id int, o models.Campaign, listIDs []int, mediaIDs []int) (models.Campaign, error) {
-	_, err := c.q.UpdateCampaign.Exec(id,
+// UpdateCampaign updates a campaign and records a revision of its content
+// authored by the given user if the content has changed.
+func (c *Core) UpdateCampaign(id int, o models.Campaign, listIDs []int, mediaIDs []int, userID int) (models.Campaign, error) {
+	prev, err := c.GetCampaign(id, "", "")
+	if err != nil {
+		return models.Campaign{}, err
+	}
+
+	if o.SegmentIDs == nil {
+		o.SegmentIDs = pq.Int64Array{}
+	}
+
+	_, err = c.q.UpdateCampaign.Exec(id,
 		o.Name,
 		o.Subject,
 		o.FromEmail,
@@ -229,7 +255,16 @@ func (c *Core) UpdateCampaign(id int, o models.Campaign, listIDs []int, mediaIDs
 		o.ArchiveTemplateID,
 		o.ArchiveMeta,
 		pq.Array(mediaIDs),
-		o.BodySource)
+		o.BodySource,
+		o.ABMetric,
+		o.ABWait,
+		o.SendMode,
+		o.RecurCron,
+		o.RecurFeedURL,
+		o.ThrottleRate,
+		o.ThrottleCap,
+		o.ThrottleWindow,
+		o.SegmentIDs)
 	if err != nil {
 		c.log.Printf("error updating campaign: %v", err)
 		return models.Campaign{}, echo.NewHTTPError(http.StatusInternalServerError,
@@ -241,6 +276,8 @@ func (c *Core) UpdateCampaign(id int, o models.Campaign, listIDs []int, mediaIDs
 		return models.Campaign{}, err
 	}
 
+	c.addRevision(id, 0, userID, campaignRevisionData(prev), campaignRevisionData(out), prev.UpdatedAt)
+
 	return out, nil
 }
 
@@ -254,21 +291,37 @@ func (c *Core) UpdateCampaignStatus(id int, status string) (models.Campaign, err
 	errMsg := ""
 	switch status {
 	case models.CampaignStatusDraft:
-		if cm.Status != models.CampaignStatusScheduled {
+		if cm.Status != models.CampaignStatusScheduled &&
+			cm.Status != models.CampaignStatusPendingApproval && cm.Status != models.CampaignStatusApproved {
 			errMsg = c.i18n.T("campaigns.onlyScheduledAsDraft")
 		}
+	case models.CampaignStatusPendingApproval:
+		if cm.Status != models.CampaignStatusDraft {
+			errMsg = c.i18n.T("campaigns.onlyDraftForApproval")
+		}
+	case models.CampaignStatusApproved:
+		if cm.Status != models.CampaignStatusPendingApproval {
+			errMsg = c.i18n.T("campaigns.onlyPendingApprove")
+		}
 	case models.CampaignStatusScheduled:
-		if cm.Status != models.CampaignStatusDraft && cm.Status != models.CampaignStatusPaused {
+		if cm.Status != models.CampaignStatusDraft && cm.Status != models.CampaignStatusPaused &&
+			cm.Status != models.CampaignStatusApproved {
 			errMsg = c.i18n.T("campaigns.onlyDraftAsScheduled")
 		}
-		if !cm.SendAt.Valid {
+		// Recurring campaigns run on their cron schedule and send_at, if set, is only their start time.
+		if !cm.SendAt.Valid && cm.RecurCron == "" {
 			errMsg = c.i18n.T("campaigns.needsSendAt")
 		}
 
 	case models.CampaignStatusRunning:
-		if cm.Status != models.CampaignStatusPaused && cm.Status != models.CampaignStatusDraft {
+		if cm.Status != models.CampaignStatusPaused && cm.Status != models.CampaignStatusDraft &&
+			cm.Status != models.CampaignStatusApproved {
 			errMsg = c.i18n.T("campaigns.onlyPausedDraft")
 		}
+		// Recurring campaigns are never sent themselves.
+		if cm.RecurCron != "" {
+			errMsg = c.i18n.T("campaigns.recurringNoRun")
+		}
 	case models.CampaignStatusPaused:
 		if cm.Status != models.CampaignStatusRunning {
 			errMsg = c.i18n.T("campaigns.onlyActivePause")
@@ -283,6 +336,18 @@ func (c *Core) UpdateCampaignStatus(id int, status string) (models.Campaign, err
 		return models.Campaign{}, echo.NewHTTPError(http.StatusBadRequest, errMsg)
 	}
 
+	// Refresh the segments that the campaign targets right before it's sent.
+	if status == models.CampaignStatusRunning && len(cm.SegmentIDs) > 0 {
+		ids := make([]int, 0, len(cm.SegmentIDs))
+		for _, id := range cm.SegmentIDs {
+			ids = append(ids, int(id))
+		}
+
+		if err := c.RefreshSegments(ids); err != nil {
+			return models.Campaign{}, err
+		}
+	}
+
 	res, err := c.q.UpdateCampaignStatus.Exec(cm.ID, status)
 	if err != nil {
 		c.log.Printf("error updating campaign status: %v", err)
@@ -300,6 +365,30 @@ func (c *Core) UpdateCampaignStatus(id int, status string) (models.Campaign, err
 	return cm, nil
 }
 
+// GetRecurringCampaigns retrieves the IDs of active recurring campaigns.
+func (c *Core) GetRecurringCampaigns() ([]int, error) {
+	var out []int
+	if err := c.q.GetRecurringCampaigns.Select(&out); err != nil {
+		c.log.Printf("error fetching recurring campaigns: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.campaigns}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// UpdateCampaignRecurrence records a run of a recurring campaign, and the publish date
+// of the latest feed item that was sent and the GUIDs of the feed's items, if any.
+func (c *Core) UpdateCampaignRecurrence(id int, runAt time.Time, lastItemAt *time.Time, items []string) error {
+	if _, err := c.q.UpdateCampaignRecurrence.Exec(id, runAt, lastItemAt, pq.StringArray(items)); err != nil {
+		c.log.Printf("error updating campaign recurrence: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.campaign}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
 // UpdateCampaignArchive updates a campaign's archive properties.
 func (c *Core) UpdateCampaignArchive(id int, enabled bool, tplID int, meta models.JSON, archiveSlug string) error {
 	if _, err := c.q.UpdateCampaignArchive.Exec(id, enabled, archiveSlug, tplID, meta); err != nil {
@@ -400,6 +489,94 @@ func (c *Core) GetCampaignAnalyticsLinks(campIDs []int, typ, fromDate, toDate st
 	return out, nil
 }
 
+// GetCampaignAnalyticsVariants returns the sample sizes and unique view and click
+// counts of the A/B test variants of the given campaign IDs.
+func (c *Core) GetCampaignAnalyticsVariants(campIDs []int, fromDate, toDate string) ([]models.CampaignVariantCount, error) {
+	out := []models.CampaignVariantCount{}
+	if err := c.q.GetCampaignVariantCounts.Select(&out, pq.Array(campIDs), fromDate, toDate); err != nil {
+		c.log.Printf("error fetching campaign variant counts: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.analytics}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetCampaignVariants retrieves the A/B test variants of a campaign.
+func (c *Core) GetCampaignVariants(campID int) ([]models.CampaignVariant, error) {
+	out := []models.CampaignVariant{}
+	if err := c.q.GetCampaignVariants.Select(&out, campID, 0); err != nil {
+		c.log.Printf("error fetching campaign variants: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.variants}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetCampaignVariant retrieves a single A/B test variant of a campaign.
+func (c *Core) GetCampaignVariant(campID, id int) (models.CampaignVariant, error) {
+	var out []models.CampaignVariant
+	if err := c.q.GetCampaignVariants.Select(&out, campID, id); err != nil {
+		c.log.Printf("error fetching campaign variant: %v", err)
+		return models.CampaignVariant{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.variant}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.CampaignVariant{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.variant}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateCampaignVariant creates a new A/B test variant on a campaign.
+func (c *Core) CreateCampaignVariant(campID int, v models.CampaignVariant) (models.CampaignVariant, error) {
+	var newID int
+	if err := c.q.CreateCampaignVariant.Get(&newID, campID, v.Name, v.Subject, v.Body, v.AltBody, v.Percent); err != nil {
+		c.log.Printf("error creating campaign variant: %v", err)
+		return models.CampaignVariant{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.variant}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetCampaignVariant(campID, newID)
+}
+
+// UpdateCampaignVariant updates an A/B test variant of a campaign.
+func (c *Core) UpdateCampaignVariant(campID, id int, v models.CampaignVariant) (models.CampaignVariant, error) {
+	res, err := c.q.UpdateCampaignVariant.Exec(id, campID, v.Name, v.Subject, v.Body, v.AltBody, v.Percent)
+	if err != nil {
+		c.log.Printf("error updating campaign variant: %v", err)
+		return models.CampaignVariant{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.variant}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.CampaignVariant{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.variant}"))
+	}
+
+	return c.GetCampaignVariant(campID, id)
+}
+
+// DeleteCampaignVariant deletes an A/B test variant of a campaign.
+func (c *Core) DeleteCampaignVariant(campID, id int) error {
+	res, err := c.q.DeleteCampaignVariant.Exec(id, campID)
+	if err != nil {
+		c.log.Printf("error deleting campaign variant: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.variant}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.variant}"))
+	}
+
+	return nil
+}
+
 // RegisterCampaignView registers a subscriber's view on a campaign.
 func (c *Core) RegisterCampaignView(campUUID, subUUID string) error {
 	if _, err := c.q.RegisterCampaignView.Exec(campUUID, subUUID); err != nil {
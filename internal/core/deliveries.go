@@ -0,0 +1,142 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+var deliveryQuerySortFields = []string{"email", "status", "server", "created_at", "updated_at"}
+
+var deferredQuerySortFields = []string{"email", "campaign_id", "attempts", "status", "next_retry_at", "created_at", "updated_at"}
+
+// QueryDeferredDeliveries retrieves paginated deferred deliveries based on the given params.
+// It also returns the total number of deferred deliveries in the DB.
+func (c *Core) QueryDeferredDeliveries(campID, subID int, status, orderBy, order string, offset, limit int) ([]models.DeferredDelivery, int, error) {
+	if !strSliceContains(orderBy, deferredQuerySortFields) {
+		orderBy = "created_at"
+	}
+	if order != SortAsc && order != SortDesc {
+		order = SortDesc
+	}
+
+	out := []models.DeferredDelivery{}
+	stmt := strings.ReplaceAll(c.q.QueryDeferredDeliveries, "%order%", orderBy+" "+order)
+	if err := c.db.Select(&out, stmt, campID, subID, status, offset, limit); err != nil {
+		c.log.Printf("error fetching deferred deliveries: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.delivery}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// GetDueDeferredDeliveries retrieves pending deferred deliveries that are due for a retry.
+func (c *Core) GetDueDeferredDeliveries(limit int) ([]models.DeferredDelivery, error) {
+	out := []models.DeferredDelivery{}
+	if err := c.q.GetDueDeferredDeliveries.Select(&out, limit); err != nil {
+		c.log.Printf("error fetching deferred deliveries: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.delivery}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// UpdateDeferredDelivery records a failed retry of a deferred delivery.
+func (c *Core) UpdateDeferredDelivery(id int, status, errMsg string, nextRetryAt time.Time) error {
+	if _, err := c.q.UpdateDeferredDelivery.Exec(id, status, errMsg, nextRetryAt); err != nil {
+		c.log.Printf("error updating deferred delivery: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.delivery}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// RetryDeferredDeliveries queues the given deferred deliveries (or all if ids is empty)
+// for an immediate retry with their attempts reset.
+func (c *Core) RetryDeferredDeliveries(ids []int) error {
+	if _, err := c.q.RetryDeferredDeliveries.Exec(pq.Array(ids)); err != nil {
+		c.log.Printf("error updating deferred deliveries: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.delivery}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// DeleteDeferredDeliveries deletes the given deferred deliveries (or all if ids is empty).
+func (c *Core) DeleteDeferredDeliveries(ids []int) error {
+	if _, err := c.q.DeleteDeferredDeliveries.Exec(pq.Array(ids)); err != nil {
+		c.log.Printf("error deleting deferred deliveries: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.delivery}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// QueryCampaignDeliveries retrieves the paginated delivery log of a campaign based on the
+// given params. It also returns the total number of matching entries in the DB.
+func (c *Core) QueryCampaignDeliveries(campID, subID int, status, email, orderBy, order string, offset, limit int) ([]models.Delivery, int, error) {
+	if !strSliceContains(orderBy, deliveryQuerySortFields) {
+		orderBy = "updated_at"
+	}
+	if order != SortAsc && order != SortDesc {
+		order = SortDesc
+	}
+
+	if email != "" {
+		email = fmt.Sprintf("%%%s%%", strings.ToLower(email))
+	}
+
+	out := []models.Delivery{}
+	stmt := strings.ReplaceAll(c.q.QueryCampaignDeliveries, "%order%", orderBy+" "+order)
+	if err := c.db.Select(&out, stmt, campID, subID, status, email, offset, limit); err != nil {
+		c.log.Printf("error fetching deliveries: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.delivery}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// LogDelivery records the delivery status of a campaign message in the delivery log.
+func (c *Core) LogDelivery(campID, subID int, messenger, server, response, status string) error {
+	if _, err := c.q.LogDelivery.Exec(campID, subID, messenger, server, response, status); err != nil {
+		c.log.Printf("error logging delivery: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.delivery}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// DeleteDeliveries deletes the delivery log entries last updated before the given date.
+func (c *Core) DeleteDeliveries(beforeDate time.Time) (int, error) {
+	res, err := c.q.DeleteDeliveries.Exec(beforeDate)
+	if err != nil {
+		c.log.Printf("error deleting deliveries: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.delivery}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// UpdateEngagementScores recomputes the engagement scores of all subscribers where
+// the weight of every view, click, and bounce halves every halfLife days.
+func (c *Core) UpdateEngagementScores(halfLife int) (int, error) {
+	res, err := c.q.UpdateEngagementScores.Exec(halfLife)
+	if err != nil {
+		c.log.Printf("error updating engagement scores: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// GetSunsetSubscribers returns the subscribers (limit at most) that a sunset policy
+// would affect along with their total count.
+func (c *Core) GetSunsetSubscribers(p models.SunsetPolicy, limit int) (models.Subscribers, int, error) {
+	var res []struct {
+		models.Subscriber
+		Total int `db:"total"`
+	}
+	stmt := strings.ReplaceAll(c.q.GetSunsetSubscribers, "%query%", c.q.SunsetSubscribersTpl)
+	if err := c.db.Select(&res, stmt, append(sunsetArgs(p), limit)...); err != nil {
+		c.log.Printf("error fetching sunset subscribers: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	out := make(models.Subscribers, 0, len(res))
+	for _, r := range res {
+		out = append(out, r.Subscriber)
+	}
+
+	total := 0
+	if len(res) > 0 {
+		total = res[0].Total
+	}
+
+	return out, total, nil
+}
+
+// SunsetSubscribers applies a sunset policy: inactive subscribers are unsubscribed
+// from their lists, and moved to the policy's re-engagement list if the action is move.
+func (c *Core) SunsetSubscribers(p models.SunsetPolicy) (int, error) {
+	var n int
+	stmt := strings.ReplaceAll(c.q.SunsetSubscribers, "%query%", c.q.SunsetSubscribersTpl)
+	if err := c.db.Get(&n, stmt, append(sunsetArgs(p), p.Action)...); err != nil {
+		c.log.Printf("error sunsetting subscribers: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return n, nil
+}
+
+// sunsetArgs returns the arguments of the sunset subscribers query template.
+func sunsetArgs(p models.SunsetPolicy) []any {
+	// Subscriptions to the re-engagement list are left alone.
+	listID := 0
+	if p.Action == models.SunsetActionMove {
+		listID = p.ListID
+	}
+
+	return []any{p.Campaigns, p.Days, listID}
+}
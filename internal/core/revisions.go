@@ -0,0 +1,307 @@
+package core
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+// Max number of lines x lines compared in a line-wise diff of a field. Bigger
+// changes are diffed as a whole.
+const maxDiffCells = 4_000_000
+
+// GetRevisions retrieves the paginated revisions of a campaign or a template (without
+// their data), latest first. It also returns the total number of revisions.
+func (c *Core) GetRevisions(campID, tplID, offset, limit int) ([]models.Revision, int, error) {
+	out := []models.Revision{}
+	if err := c.q.GetRevisions.Select(&out, campID, tplID, offset, limit); err != nil {
+		c.log.Printf("error fetching revisions: %v", err)
+		return nil, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.revisions}", "error", pqErrMsg(err)))
+	}
+
+	total := 0
+	if len(out) > 0 {
+		total = out[0].Total
+	}
+
+	return out, total, nil
+}
+
+// GetRevision retrieves a revision of a campaign or a template.
+func (c *Core) GetRevision(campID, tplID, revID int) (models.Revision, error) {
+	var out models.Revision
+	if err := c.q.GetRevision.Get(&out, revID, campID, tplID); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusNotFound,
+				c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.revision}"))
+		}
+
+		c.log.Printf("error fetching revision: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.revision}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// DiffCampaignRevision returns the fields that differ between a revision of a campaign
+// and another revision (toRevID), or the campaign's current content if toRevID is 0.
+func (c *Core) DiffCampaignRevision(campID, revID, toRevID int) ([]models.RevisionDiff, error) {
+	return c.diffRevision(campID, 0, revID, toRevID, func() (map[string]any, error) {
+		cm, err := c.GetCampaign(campID, "", "")
+		if err != nil {
+			return nil, err
+		}
+		return campaignRevisionData(cm), nil
+	})
+}
+
+// DiffTemplateRevision returns the fields that differ between a revision of a template
+// and another revision (toRevID), or the template's current content if toRevID is 0.
+func (c *Core) DiffTemplateRevision(tplID, revID, toRevID int) ([]models.RevisionDiff, error) {
+	return c.diffRevision(0, tplID, revID, toRevID, func() (map[string]any, error) {
+		tpl, err := c.GetTemplate(tplID, false)
+		if err != nil {
+			return nil, err
+		}
+		return templateRevisionData(tpl), nil
+	})
+}
+
+func (c *Core) diffRevision(campID, tplID, revID, toRevID int, getCurrent func() (map[string]any, error)) ([]models.RevisionDiff, error) {
+	from, err := c.GetRevision(campID, tplID, revID)
+	if err != nil {
+		return nil, err
+	}
+
+	var to json.RawMessage
+	if toRevID > 0 {
+		r, err := c.GetRevision(campID, tplID, toRevID)
+		if err != nil {
+			return nil, err
+		}
+		to = r.Data
+	} else {
+		cur, err := getCurrent()
+		if err != nil {
+			return nil, err
+		}
+		to, _ = json.Marshal(cur)
+	}
+
+	var a, b map[string]json.RawMessage
+	if err := json.Unmarshal(from.Data, &a); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.revision}", "error", err.Error()))
+	}
+	if err := json.Unmarshal(to, &b); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.revision}", "error", err.Error()))
+	}
+
+	// Compare the fields in both revisions in a stable order.
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	out := []models.RevisionDiff{}
+	for _, k := range keys {
+		va, vb := normalizeJSON(a[k]), normalizeJSON(b[k])
+		if bytes.Equal(va, vb) {
+			continue
+		}
+
+		d := models.RevisionDiff{Field: k, From: va, To: vb}
+
+		// Diff text fields line by line.
+		var sa, sb null.String
+		if json.Unmarshal(va, &sa) == nil && json.Unmarshal(vb, &sb) == nil {
+			d.Lines = diffLines(sa.String, sb.String)
+		}
+
+		out = append(out, d)
+	}
+
+	return out, nil
+}
+
+// addRevision records a revision of a campaign or a template if any of its fields
+// have changed. prev is the state of the fields before the change, which is recorded
+// as the original revision if there are no revisions yet.
+func (c *Core) addRevision(campID, tplID, userID int, prev, cur map[string]any, prevAt null.Time) {
+	fields := changedFields(prev, cur)
+	if len(fields) == 0 {
+		return
+	}
+
+	prevData, err := json.Marshal(prev)
+	if err != nil {
+		c.log.Printf("error marshalling revision: %v", err)
+		return
+	}
+	curData, err := json.Marshal(cur)
+	if err != nil {
+		c.log.Printf("error marshalling revision: %v", err)
+		return
+	}
+
+	if _, err := c.q.AddRevision.Exec(campID, tplID, userID, pq.StringArray(fields), curData, prevData, prevAt); err != nil {
+		c.log.Printf("error recording revision: %v", err)
+	}
+}
+
+// campaignRevisionData returns the content fields of a campaign that are recorded
+// in its revisions, keyed by their JSON names.
+func campaignRevisionData(o models.Campaign) map[string]any {
+	return map[string]any{
+		"name":         o.Name,
+		"subject":      o.Subject,
+		"from_email":   o.FromEmail,
+		"body":         o.Body,
+		"body_source":  o.BodySource,
+		"altbody":      o.AltBody,
+		"content_type": o.ContentType,
+		"template_id":  o.TemplateID,
+		"headers":      o.Headers,
+		"messenger":    o.Messenger,
+	}
+}
+
+// templateRevisionData returns the fields of a template that are recorded
+// in its revisions, keyed by their JSON names.
+func templateRevisionData(o models.Template) map[string]any {
+	return map[string]any{
+		"name":        o.Name,
+		"subject":     o.Subject,
+		"body":        o.Body,
+		"body_source": o.BodySource,
+	}
+}
+
+// changedFields returns the sorted names of the fields that differ between a and b.
+func changedFields(a, b map[string]any) []string {
+	out := []string{}
+	for k, v := range b {
+		va, _ := json.Marshal(a[k])
+		vb, _ := json.Marshal(v)
+		if !bytes.Equal(va, vb) {
+			out = append(out, k)
+		}
+	}
+	slices.Sort(out)
+
+	return out
+}
+
+// normalizeJSON re-encodes a JSON value so that values from the DB (JSONB) and
+// from Go compare equal.
+func normalizeJSON(b json.RawMessage) json.RawMessage {
+	if len(b) == 0 {
+		return json.RawMessage("null")
+	}
+
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return b
+	}
+
+	out, _ := json.Marshal(v)
+	return out
+}
+
+// diffLines returns the line-wise diff of two strings computed from their
+// longest common subsequence of lines.
+func diffLines(a, b string) []models.DiffLine {
+	var (
+		la = strings.Split(a, "\n")
+		lb = strings.Split(b, "\n")
+	)
+
+	// Skip the common prefix and suffix.
+	pre := 0
+	for pre < len(la) && pre < len(lb) && la[pre] == lb[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(la)-pre && suf < len(lb)-pre && la[len(la)-1-suf] == lb[len(lb)-1-suf] {
+		suf++
+	}
+
+	out := make([]models.DiffLine, 0, len(la)+len(lb))
+	for _, l := range la[:pre] {
+		out = append(out, models.DiffLine{Op: "=", Text: l})
+	}
+
+	var (
+		ma = la[pre : len(la)-suf]
+		mb = lb[pre : len(lb)-suf]
+	)
+	if len(ma)*len(mb) > maxDiffCells {
+		// Too big to compare line by line. Replace the whole block.
+		for _, l := range ma {
+			out = append(out, models.DiffLine{Op: "-", Text: l})
+		}
+		for _, l := range mb {
+			out = append(out, models.DiffLine{Op: "+", Text: l})
+		}
+	} else {
+		// lcs[i][j] is the length of the LCS of ma[i:] and mb[j:].
+		lcs := make([][]int, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(ma) && j < len(mb) {
+			switch {
+			case ma[i] == mb[j]:
+				out = append(out, models.DiffLine{Op: "=", Text: ma[i]})
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				out = append(out, models.DiffLine{Op: "-", Text: ma[i]})
+				i++
+			default:
+				out = append(out, models.DiffLine{Op: "+", Text: mb[j]})
+				j++
+			}
+		}
+		for ; i < len(ma); i++ {
+			out = append(out, models.DiffLine{Op: "-", Text: ma[i]})
+		}
+		for ; j < len(mb); j++ {
+			out = append(out, models.DiffLine{Op: "+", Text: mb[j]})
+		}
+	}
+
+	for _, l := range la[len(la)-suf:] {
+		out = append(out, models.DiffLine{Op: "=", Text: l})
+	}
+
+	return out
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/knadh/listmonk/internal/segment"
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+)
+
+// GetSegments retrieves all segments.
+func (c *Core) GetSegments() ([]models.Segment, error) {
+	out := []models.Segment{}
+	if err := c.q.GetSegments.Select(&out, 0); err != nil {
+		c.log.Printf("error fetching segments: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.segments}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetSegment retrieves a segment.
+func (c *Core) GetSegment(id int) (models.Segment, error) {
+	var out []models.Segment
+	if err := c.q.GetSegments.Select(&out, id); err != nil {
+		c.log.Printf("error fetching segment: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.segment}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateSegment creates a new segment and materializes its subscribers.
+func (c *Core) CreateSegment(s models.Segment) (models.Segment, error) {
+	rules, err := json.Marshal(s.Rules)
+	if err != nil {
+		return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var newID int
+	if err := c.q.CreateSegment.Get(&newID, s.Name, s.Description, string(rules)); err != nil {
+		c.log.Printf("error creating segment: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	if err := c.RefreshSegment(newID); err != nil {
+		return models.Segment{}, err
+	}
+
+	return c.GetSegment(newID)
+}
+
+// UpdateSegment updates a segment and re-materializes its subscribers.
+func (c *Core) UpdateSegment(id int, s models.Segment) (models.Segment, error) {
+	rules, err := json.Marshal(s.Rules)
+	if err != nil {
+		return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	res, err := c.q.UpdateSegment.Exec(id, s.Name, s.Description, string(rules))
+	if err != nil {
+		c.log.Printf("error updating segment: %v", err)
+		return models.Segment{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.Segment{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.segment}"))
+	}
+
+	if err := c.RefreshSegment(id); err != nil {
+		return models.Segment{}, err
+	}
+
+	return c.GetSegment(id)
+}
+
+// DeleteSegment deletes a segment. Segments that are targeted by campaigns
+// that are yet to finish can't be deleted.
+func (c *Core) DeleteSegment(id int) error {
+	if _, err := c.GetSegment(id); err != nil {
+		return err
+	}
+
+	var out []int
+	if err := c.q.DeleteSegment.Select(&out, id); err != nil {
+		c.log.Printf("error deleting segment: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("segments.inUse"))
+	}
+
+	return nil
+}
+
+// RefreshSegment materializes the subscribers who match a segment's rules
+// and updates its subscriber count.
+func (c *Core) RefreshSegment(id int) error {
+	s, err := c.GetSegment(id)
+	if err != nil {
+		return err
+	}
+
+	// The segment's ID is $1 in the query.
+	cond, args, err := segment.Compile(s.Rules, 1)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, c.i18n.Ts("segments.invalidRules", "error", err.Error()))
+	}
+
+	stmt := strings.ReplaceAll(c.q.RefreshSegment, "%query%", cond)
+	if _, err := c.db.Exec(stmt, append([]any{id}, args...)...); err != nil {
+		c.log.Printf("error refreshing segment %d: %v", id, err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.segment}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// RefreshSegments refreshes the given segments, or all segments if no IDs are given.
+func (c *Core) RefreshSegments(ids []int) error {
+	if len(ids) == 0 {
+		segs, err := c.GetSegments()
+		if err != nil {
+			return err
+		}
+
+		for _, s := range segs {
+			ids = append(ids, s.ID)
+		}
+	}
+
+	for _, id := range ids {
+		if err := c.RefreshSegment(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CountSegmentSubscribers returns the number of subscribers who match the given rules
+// without saving them. It's used to preview segments.
+func (c *Core) CountSegmentSubscribers(rules models.SegmentRule) (int, error) {
+	cond, args, err := segment.Compile(rules, 0)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, c.i18n.Ts("segments.invalidRules", "error", err.Error()))
+	}
+
+	tx, err := c.db.BeginTxx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		c.log.Printf("error preparing segment query: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+	defer tx.Rollback()
+
+	total := 0
+	stmt := strings.ReplaceAll(c.q.CountSegmentSubscribers, "%query%", cond)
+	if err := tx.Get(&total, stmt, args...); err != nil {
+		c.log.Printf("error counting segment subscribers: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
+	}
+
+	return total, nil
+}
@@ -0,0 +1,242 @@
+package core
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// GetSequences retrieves all sequences.
+func (c *Core) GetSequences() ([]models.Sequence, error) {
+	out := []models.Sequence{}
+	if err := c.q.GetSequences.Select(&out, 0); err != nil {
+		c.log.Printf("error fetching sequences: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.sequences}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetSequence retrieves a sequence.
+func (c *Core) GetSequence(id int) (models.Sequence, error) {
+	var out []models.Sequence
+	if err := c.q.GetSequences.Select(&out, id); err != nil {
+		c.log.Printf("error fetching sequence: %v", err)
+		return models.Sequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.sequence}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.Sequence{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.sequence}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateSequence creates a new sequence.
+func (c *Core) CreateSequence(s models.Sequence) (models.Sequence, error) {
+	var newID int
+	if err := c.q.CreateSequence.Get(&newID, s.Name, s.ListID, s.Status, s.ExitListIDs, s.FromEmail, s.Messenger); err != nil {
+		c.log.Printf("error creating sequence: %v", err)
+		return models.Sequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.sequence}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetSequence(newID)
+}
+
+// UpdateSequence updates a sequence.
+func (c *Core) UpdateSequence(id int, s models.Sequence) (models.Sequence, error) {
+	res, err := c.q.UpdateSequence.Exec(id, s.Name, s.ListID, s.ExitListIDs, s.FromEmail, s.Messenger)
+	if err != nil {
+		c.log.Printf("error updating sequence: %v", err)
+		return models.Sequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.sequence}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.Sequence{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.sequence}"))
+	}
+
+	return c.GetSequence(id)
+}
+
+// UpdateSequenceStatus pauses or resumes a sequence.
+func (c *Core) UpdateSequenceStatus(id int, status string) (models.Sequence, error) {
+	res, err := c.q.UpdateSequenceStatus.Exec(id, status)
+	if err != nil {
+		c.log.Printf("error updating sequence status: %v", err)
+		return models.Sequence{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.sequence}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.Sequence{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.sequence}"))
+	}
+
+	return c.GetSequence(id)
+}
+
+// DeleteSequence deletes a sequence along with its steps and subscriber progress.
+func (c *Core) DeleteSequence(id int) error {
+	if _, err := c.q.DeleteSequence.Exec(id); err != nil {
+		c.log.Printf("error deleting sequence: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.sequence}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetSequenceSteps retrieves the steps of a sequence along with their stats.
+func (c *Core) GetSequenceSteps(seqID int) ([]models.SequenceStep, error) {
+	out := []models.SequenceStep{}
+	if err := c.q.GetSequenceSteps.Select(&out, seqID, 0); err != nil {
+		c.log.Printf("error fetching sequence steps: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.steps}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// GetSequenceStep retrieves a step of a sequence.
+func (c *Core) GetSequenceStep(seqID, id int) (models.SequenceStep, error) {
+	var out []models.SequenceStep
+	if err := c.q.GetSequenceSteps.Select(&out, seqID, id); err != nil {
+		c.log.Printf("error fetching sequence step: %v", err)
+		return models.SequenceStep{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.step}", "error", pqErrMsg(err)))
+	}
+
+	if len(out) == 0 {
+		return models.SequenceStep{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.step}"))
+	}
+
+	return out[0], nil
+}
+
+// CreateSequenceStep appends a new step to a sequence.
+func (c *Core) CreateSequenceStep(seqID int, s models.SequenceStep) (models.SequenceStep, error) {
+	var newID int
+	if err := c.q.CreateSequenceStep.Get(&newID, seqID, s.TemplateID, s.DelayMins, s.ContentType); err != nil {
+		c.log.Printf("error creating sequence step: %v", err)
+		return models.SequenceStep{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.step}", "error", pqErrMsg(err)))
+	}
+
+	return c.GetSequenceStep(seqID, newID)
+}
+
+// UpdateSequenceStep updates a step of a sequence.
+func (c *Core) UpdateSequenceStep(seqID, id int, s models.SequenceStep) (models.SequenceStep, error) {
+	res, err := c.q.UpdateSequenceStep.Exec(id, seqID, s.TemplateID, s.DelayMins, s.ContentType)
+	if err != nil {
+		c.log.Printf("error updating sequence step: %v", err)
+		return models.SequenceStep{}, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.step}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.SequenceStep{}, echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.step}"))
+	}
+
+	return c.GetSequenceStep(seqID, id)
+}
+
+// DeleteSequenceStep deletes a step of a sequence. Subscribers waiting on the
+// step move on to the next one.
+func (c *Core) DeleteSequenceStep(seqID, id int) error {
+	res, err := c.q.DeleteSequenceStep.Exec(id, seqID)
+	if err != nil {
+		c.log.Printf("error deleting sequence step: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.step}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.step}"))
+	}
+
+	return nil
+}
+
+// StartSequences starts the sequences of the lists that the given subscribers
+// have joined. As it's a side effect of subscribing, errors are only logged.
+func (c *Core) StartSequences(subIDs []int) {
+	if _, err := c.q.AddSequenceSubscribers.Exec(pq.Array(subIDs), pq.Array([]int{}), time.Time{}); err != nil {
+		c.log.Printf("error starting sequences: %v", err)
+	}
+}
+
+// StartSequencesByLists starts the sequences of the given lists for all subscribers
+// who have joined them since the given time.
+func (c *Core) StartSequencesByLists(listIDs []int, since time.Time) {
+	if _, err := c.q.AddSequenceSubscribers.Exec(pq.Array([]int{}), pq.Array(listIDs), since); err != nil {
+		c.log.Printf("error starting sequences: %v", err)
+	}
+}
+
+// ExitSequenceSubscribers exits subscribers from sequences whose exit conditions
+// have been met and returns the number of subscribers exited.
+func (c *Core) ExitSequenceSubscribers() (int, error) {
+	res, err := c.q.ExitSequenceSubscribers.Exec()
+	if err != nil {
+		c.log.Printf("error exiting sequence subscribers: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.sequences}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// NextSequenceMessages retrieves a batch of subscribers who are due to be sent the
+// next step of their sequences. The batch is claimed until the given time, by when
+// each message should've been recorded with AdvanceSequenceSubscriber or
+// FailSequenceSubscriber, or it's picked up again.
+func (c *Core) NextSequenceMessages(limit int, claimUntil time.Time) ([]models.SequenceMessage, error) {
+	out := []models.SequenceMessage{}
+	if err := c.q.NextSequenceMessages.Select(&out, limit, claimUntil); err != nil {
+		c.log.Printf("error fetching sequence messages: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.sequences}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// AdvanceSequenceSubscriber advances a subscriber's progress in a sequence to
+// a step that has been sent to them.
+func (c *Core) AdvanceSequenceSubscriber(seqID, subID, stepID int) error {
+	if _, err := c.q.AdvanceSequenceSubscriber.Exec(seqID, subID, stepID); err != nil {
+		c.log.Printf("error advancing sequence subscriber: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.sequences}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// FailSequenceSubscriber records a failed attempt to send the next step of a sequence
+// to a subscriber, to be retried at the given time. Once the attempts reach maxAttempts,
+// the subscriber is marked as failed and isn't sent further steps.
+func (c *Core) FailSequenceSubscriber(seqID, subID int, retryAt time.Time, maxAttempts int) error {
+	if _, err := c.q.FailSequenceSubscriber.Exec(seqID, subID, retryAt, maxAttempts); err != nil {
+		c.log.Printf("error updating failed sequence subscriber: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.sequences}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
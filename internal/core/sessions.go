@@ -0,0 +1,50 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// GetUserSessions retrieves the active login sessions of a user.
+func (c *Core) GetUserSessions(userID int) ([]auth.Session, error) {
+	out := []auth.Session{}
+	if err := c.q.GetUserSessions.Select(&out, userID, auth.SessionTTL.Seconds()); err != nil {
+		c.log.Printf("error fetching sessions: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.sessions}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// DeleteUserSession revokes a login session of a user by its hashed ID.
+func (c *Core) DeleteUserSession(userID int, id string) error {
+	n, err := c.DeleteUserSessions(userID, id, "")
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.session}"))
+	}
+
+	return nil
+}
+
+// DeleteUserSessions revokes the login session of a user with the hashed ID id, or all
+// the user's sessions if id is empty, except for the session with the hashed ID keepID.
+// It returns the number of sessions revoked.
+func (c *Core) DeleteUserSessions(userID int, id, keepID string) (int, error) {
+	res, err := c.q.DeleteUserSessions.Exec(userID, id, keepID)
+	if err != nil {
+		c.log.Printf("error deleting sessions: %v", err)
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.sessions}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
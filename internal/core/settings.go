@@ -3,10 +3,12 @@ package core
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/jmoiron/sqlx/types"
 	"github.com/knadh/listmonk/models"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 )
 
 // GetSettings returns settings from the DB.
@@ -48,3 +50,39 @@ func (c *Core) UpdateSettings(s models.Settings) error {
 
 	return nil
 }
+
+// IsValidTimezone checks if a time zone name is known to the database.
+func (c *Core) IsValidTimezone(name string) (bool, error) {
+	var ok bool
+	if err := c.q.IsValidTimezone.Get(&ok, name); err != nil {
+		c.log.Printf("error checking time zone: %v", err)
+		return false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.settings}", "error", pqErrMsg(err)))
+	}
+
+	return ok, nil
+}
+
+// GetSMTPWarmups retrieves the warm-up state of the given SMTP servers, starting
+// the warm-up of the ones that don't have one yet.
+func (c *Core) GetSMTPWarmups(uuids []string) ([]models.SMTPWarmup, error) {
+	out := []models.SMTPWarmup{}
+	if err := c.q.GetSMTPWarmups.Select(&out, pq.Array(uuids)); err != nil {
+		c.log.Printf("error fetching SMTP warm-ups: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "SMTP", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// UpdateSMTPWarmup updates the number of messages sent on a day via an SMTP server being warmed up.
+func (c *Core) UpdateSMTPWarmup(uuid string, day time.Time, sent int) error {
+	if _, err := c.q.UpdateSMTPWarmup.Exec(uuid, day, sent); err != nil {
+		c.log.Printf("error updating SMTP warm-up: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "SMTP", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
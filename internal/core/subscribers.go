@@ -321,6 +321,9 @@ func (c *Core) InsertSubscriber(sub models.Subscriber, listIDs []int, listUUIDs
 		return models.Subscriber{}, false, err
 	}
 
+	// Start the sequences of the lists the subscriber has joined.
+	c.StartSequences([]int{out.ID})
+
 	hasOptin := false
 	if !preconfirm && c.consts.SendOptinConfirmation {
 		// Send a confirmation e-mail (if there are any double opt-in lists).
@@ -406,6 +409,9 @@ func (c *Core) UpdateSubscriberWithLists(id int, sub models.Subscriber, listIDs
 		return models.Subscriber{}, false, err
 	}
 
+	// Start the sequences of the lists the subscriber has joined.
+	c.StartSequences([]int{out.ID})
+
 	hasOptin := false
 	if !preconfirm && c.consts.SendOptinConfirmation {
 		// Send a confirmation e-mail (if there are any double opt-in lists).
@@ -491,6 +497,11 @@ func (c *Core) ConfirmOptionSubscription(subUUID string, listUUIDs []string, met
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
 	}
 
+	// Sequences of double opt-in lists start on confirmation.
+	if sub, err := c.GetSubscriber(0, subUUID, ""); err == nil {
+		c.StartSequences([]int{sub.ID})
+	}
+
 	return nil
 }
 
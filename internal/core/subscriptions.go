@@ -30,6 +30,8 @@ func (c *Core) AddSubscriptions(subIDs, listIDs []int, status string) error {
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", err.Error()))
 	}
 
+	c.StartSequences(subIDs)
+
 	return nil
 }
 
@@ -40,6 +42,7 @@ func (c *Core) AddSubscriptionsByQuery(searchStr, queryExp string, sourceListIDs
 		sourceListIDs = []int{}
 	}
 
+	start := time.Now()
 	err := c.q.ExecSubQueryTpl(searchStr, queryExp, c.q.AddSubscribersToListsByQuery, sourceListIDs, c.db, subStatus, pq.Array(targetListIDs), status)
 	if err != nil {
 		c.log.Printf("error adding subscriptions by query: %v", err)
@@ -47,6 +50,8 @@ func (c *Core) AddSubscriptionsByQuery(searchStr, queryExp string, sourceListIDs
 			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.subscribers}", "error", pqErrMsg(err)))
 	}
 
+	c.StartSequencesByLists(targetListIDs, start)
+
 	return nil
 }
 
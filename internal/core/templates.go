@@ -47,8 +47,14 @@ func (c *Core) CreateTemplate(name, typ, subject string, body []byte, bodySource
 	return c.GetTemplate(newID, false)
 }
 
-// UpdateTemplate updates a given template.
-func (c *Core) UpdateTemplate(id int, name, subject string, body []byte, bodySource null.String) (models.Template, error) {
+// UpdateTemplate updates a given template and records a revision authored
+// by the given user if it has changed.
+func (c *Core) UpdateTemplate(id int, name, subject string, body []byte, bodySource null.String, userID int) (models.Template, error) {
+	prev, err := c.GetTemplate(id, false)
+	if err != nil {
+		return models.Template{}, err
+	}
+
 	res, err := c.q.UpdateTemplate.Exec(id, name, subject, body, bodySource)
 	if err != nil {
 		return models.Template{}, echo.NewHTTPError(http.StatusInternalServerError,
@@ -60,7 +66,14 @@ func (c *Core) UpdateTemplate(id int, name, subject string, body []byte, bodySou
 			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.template}"))
 	}
 
-	return c.GetTemplate(id, false)
+	out, err := c.GetTemplate(id, false)
+	if err != nil {
+		return models.Template{}, err
+	}
+
+	c.addRevision(0, id, userID, templateRevisionData(prev), templateRevisionData(out), prev.UpdatedAt)
+
+	return out, nil
 }
 
 // SetDefaultTemplate sets a template as default.
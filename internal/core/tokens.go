@@ -0,0 +1,76 @@
+package core
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/knadh/listmonk/internal/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// GetAPITokens retrieves the scoped API tokens of an API user, or of all users if userID is 0.
+func (c *Core) GetAPITokens(userID int) ([]auth.APIToken, error) {
+	out := []auth.APIToken{}
+	if err := c.q.GetUserAPITokens.Select(&out, userID); err != nil {
+		c.log.Printf("error fetching API tokens: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.apiTokens}", "error", pqErrMsg(err)))
+	}
+
+	return out, nil
+}
+
+// CreateAPIToken creates a scoped API token for an API user. The token is stored as a hash
+// and the returned token has the plaintext token set.
+func (c *Core) CreateAPIToken(t auth.APIToken, token string) (auth.APIToken, error) {
+	if t.Permissions == nil {
+		t.Permissions = []string{}
+	}
+	if t.ListIDs == nil {
+		t.ListIDs = []int64{}
+	}
+
+	var out auth.APIToken
+	if err := c.q.CreateAPIToken.Get(&out, t.UserID, t.Name, auth.HashAPIToken(token),
+		token[:auth.APITokenPrefixLen], t.Permissions, t.ListIDs, t.ExpiresAt); err != nil {
+		if err == sql.ErrNoRows {
+			return out, echo.NewHTTPError(http.StatusBadRequest,
+				c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.user}"))
+		}
+
+		c.log.Printf("error creating API token: %v", err)
+		return out, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.apiToken}", "error", pqErrMsg(err)))
+	}
+	out.Token = token
+
+	return out, nil
+}
+
+// DeleteAPIToken revokes a scoped API token of an API user.
+func (c *Core) DeleteAPIToken(id, userID int) error {
+	res, err := c.q.DeleteAPIToken.Exec(id, userID)
+	if err != nil {
+		c.log.Printf("error deleting API token: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.apiToken}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.apiToken}"))
+	}
+
+	return nil
+}
+
+// UpdateAPITokenUsage records the last use of a scoped API token.
+func (c *Core) UpdateAPITokenUsage(id int, ip string) error {
+	if _, err := c.q.UpdateAPITokenUsage.Exec(id, ip); err != nil {
+		c.log.Printf("error updating API token usage: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.apiToken}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
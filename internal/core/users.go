@@ -1,10 +1,14 @@
 package core
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"time"
 
+	"github.com/jmoiron/sqlx/types"
 	"github.com/knadh/listmonk/internal/auth"
 	"github.com/knadh/listmonk/internal/utils"
 	"github.com/labstack/echo/v4"
@@ -112,6 +116,22 @@ func (c *Core) UpdateUserProfile(id int, u auth.User) (auth.User, error) {
 	return c.GetUser(id, "", "")
 }
 
+// UpdateUserRoles sets the user role and the list role of a user. listRoleID 0 leaves
+// the list role unchanged and -1 removes it.
+func (c *Core) UpdateUserRoles(id, userRoleID, listRoleID int) error {
+	res, err := c.q.UpdateUserRoles.Exec(id, userRoleID, listRoleID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("users.needSuper"))
+	}
+
+	return nil
+}
+
 // UpdateUserLogin updates a user's record post-login.
 func (c *Core) UpdateUserLogin(id int, avatar string) error {
 	if _, err := c.q.UpdateUserLogin.Exec(id, avatar); err != nil {
@@ -122,6 +142,170 @@ func (c *Core) UpdateUserLogin(id int, avatar string) error {
 	return nil
 }
 
+// SetUserTOTPSecret sets a new TOTP secret for a user to enrol in two-factor authentication
+// with. It disables 2FA for the user until it's enabled with EnableUserTOTP().
+func (c *Core) SetUserTOTPSecret(id int, secret string) error {
+	res, err := c.q.SetUserTOTPSecret.Exec(id, secret)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.user}"))
+	}
+
+	return nil
+}
+
+// EnableUserTOTP enables two-factor authentication for a user who has a TOTP secret
+// and stores the hashes of the given one time recovery codes. step is the time step of
+// the code verified on enrolment, which can't be used again.
+func (c *Core) EnableUserTOTP(id int, recoveryCodes []string, step int64) error {
+	codes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		codes = append(codes, auth.HashTOTPRecoveryCode(code))
+	}
+
+	res, err := c.q.EnableUserTOTP.Exec(id, pq.StringArray(codes), step)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.user}"))
+	}
+
+	return nil
+}
+
+// ResetUserTOTP disables two-factor authentication for a user and deletes their TOTP
+// secret and recovery codes.
+func (c *Core) ResetUserTOTP(id int) error {
+	res, err := c.q.ResetUserTOTP.Exec(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			c.i18n.Ts("globals.messages.notFound", "name", "{globals.terms.user}"))
+	}
+
+	return nil
+}
+
+// UseUserTOTPRecoveryCode checks a one time recovery code of a user against the stored
+// hashes and deletes it if it matches. It returns false if the code doesn't match.
+func (c *Core) UseUserTOTPRecoveryCode(id int, code string) (bool, error) {
+	res, err := c.q.UseUserTOTPCode.Exec(id, auth.HashTOTPRecoveryCode(code))
+	if err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// UseUserTOTPStep records the time step of a valid TOTP code of a user. It returns false
+// if a code of the step, or a later one, has already been used, that is, the code is a replay.
+func (c *Core) UseUserTOTPStep(id int, step int64) (bool, error) {
+	res, err := c.q.UseUserTOTPStep.Exec(id, step)
+	if err != nil {
+		return false, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// AddUserTOTPFailure counts a failed TOTP code of a user, forgetting the failures before
+// since, and returns the number of failures.
+func (c *Core) AddUserTOTPFailure(id int, since time.Time) (int, error) {
+	var n int
+	if err := c.q.AddUserTOTPFail.Get(&n, id, since); err != nil {
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	return n, nil
+}
+
+// CreatePasswordReset records a password reset request. If a token is given, it's stored
+// as a hash that's valid until expiresAt. Requests that don't issue a token (eg: for unknown
+// e-mails) are recorded for rate-limiting.
+func (c *Core) CreatePasswordReset(userID int, email, token, ip string, expiresAt null.Time) error {
+	hash := ""
+	if token != "" {
+		hash = hashPasswordResetToken(token)
+	}
+
+	if _, err := c.q.CreatePasswordReset.Exec(userID, email, hash, ip, expiresAt); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorCreating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// GetPasswordResetCounts returns the number of password reset requests made from an IP
+// and the number of tokens issued to a user since the given time.
+func (c *Core) GetPasswordResetCounts(ip string, userID int, since time.Time) (int, int, error) {
+	var out struct {
+		IP   int `db:"ip_count"`
+		User int `db:"user_count"`
+	}
+	if err := c.q.GetPasswordResetCounts.Get(&out, ip, userID, since); err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	return out.IP, out.User, nil
+}
+
+// GetPasswordResetUser returns the ID of the user of a valid password reset token.
+func (c *Core) GetPasswordResetUser(token string) (int, error) {
+	var id int
+	if err := c.q.GetPasswordReset.Get(&id, hashPasswordResetToken(token)); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("users.resetPasswordInvalid"))
+		}
+
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	return id, nil
+}
+
+// ResetUserPassword sets a new password for the user of a valid password reset token,
+// uses up the token, and logs the user out of all their sessions. It returns the user's ID.
+func (c *Core) ResetUserPassword(token, password string) (int, error) {
+	var id int
+	if err := c.q.ResetUserPassword.Get(&id, hashPasswordResetToken(token), password); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, echo.NewHTTPError(http.StatusBadRequest, c.i18n.T("users.resetPasswordInvalid"))
+		}
+
+		return 0, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	return id, nil
+}
+
+// hashPasswordResetToken returns the hash of a password reset token that's stored in the DB.
+func hashPasswordResetToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
 // DeleteUsers deletes a given user.
 func (c *Core) DeleteUsers(ids []int) error {
 	res, err := c.q.DeleteUsers.Exec(pq.Array(ids))
@@ -212,3 +396,62 @@ func (c *Core) setupUserFields(users []auth.User) []auth.User {
 
 	return users
 }
+
+// GetLoginFailures retrieves the persisted failed login attempts and lockouts.
+func (c *Core) GetLoginFailures() ([]auth.LoginFailures, error) {
+	var recs []struct {
+		Type        string         `db:"type"`
+		Key         string         `db:"key"`
+		Attempts    types.JSONText `db:"attempts"`
+		LockedUntil null.Time      `db:"locked_until"`
+	}
+	if err := c.q.GetLoginFailures.Select(&recs); err != nil {
+		c.log.Printf("error fetching login failures: %v", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorFetching", "name", "{globals.terms.users}", "error", pqErrMsg(err)))
+	}
+
+	out := make([]auth.LoginFailures, 0, len(recs))
+	for _, r := range recs {
+		f := auth.LoginFailures{Type: r.Type, Key: r.Key, LockedUntil: r.LockedUntil.Time}
+		if err := r.Attempts.Unmarshal(&f.Attempts); err != nil {
+			c.log.Printf("error reading login failures of %s %s: %v", r.Type, r.Key, err)
+			continue
+		}
+		out = append(out, f)
+	}
+
+	return out, nil
+}
+
+// SaveLoginFailures persists the failed login attempts and the lockout, if any, of a username or an IP.
+func (c *Core) SaveLoginFailures(f auth.LoginFailures) error {
+	attempts, err := json.Marshal(f.Attempts)
+	if err != nil {
+		return err
+	}
+
+	var lockedUntil null.Time
+	if !f.LockedUntil.IsZero() {
+		lockedUntil = null.TimeFrom(f.LockedUntil)
+	}
+
+	if _, err := c.q.UpsertLoginFailures.Exec(f.Type, f.Key, types.JSONText(attempts), lockedUntil); err != nil {
+		c.log.Printf("error saving login failures: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorUpdating", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
+
+// DeleteLoginFailures deletes the persisted failed login attempts and lockout of a username or an IP.
+func (c *Core) DeleteLoginFailures(typ, key string) error {
+	if _, err := c.q.DeleteLoginFailures.Exec(typ, key); err != nil {
+		c.log.Printf("error deleting login failures: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError,
+			c.i18n.Ts("globals.messages.errorDeleting", "name", "{globals.terms.user}", "error", pqErrMsg(err)))
+	}
+
+	return nil
+}
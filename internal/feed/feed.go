@@ -0,0 +1,263 @@
+// Package feed implements a minimal RSS 2.0 and Atom feed fetcher that is used
+// to fill recurring campaigns with the latest items of a feed.
+package feed
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+const (
+	// maxBodySize is the maximum size of a feed that's read.
+	maxBodySize = 10 * 1024 * 1024
+
+	maxRedirects = 5
+)
+
+var (
+	errScheme  = errors.New("feed URL should be an http(s) URL")
+	errAddress = errors.New("feed URL doesn't resolve to a public address")
+
+	// Carrier-grade NAT (shared address space) that IsPrivate() doesn't cover.
+	cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+)
+
+// Date formats seen in the wild in RSS (RFC 822 and variants) and Atom (RFC 3339) feeds.
+var dateFormats = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339,
+	time.RFC3339Nano,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+type rss struct {
+	Items []struct {
+		GUID        string `xml:"guid"`
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+		Author      string `xml:"author"`
+		Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		PubDate     string `xml:"pubDate"`
+		Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	} `xml:"channel>item"`
+}
+
+type atom struct {
+	Entries []struct {
+		ID    string `xml:"id"`
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+		Author    string `xml:"author>name"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+	} `xml:"entry"`
+}
+
+// Fetch fetches and parses an RSS or Atom feed and returns its items, latest first.
+// Only http(s) URLs that resolve to public addresses are fetched, including on
+// redirects, so that feeds can't be used to reach internal services.
+func Fetch(u string, timeout time.Duration) ([]models.FeedItem, error) {
+	if err := checkURL(u); err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: timeout, Control: checkAddr}
+	client := http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// No proxy as the address that's checked has to be that of the feed.
+			Proxy: nil,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkURL(req.URL.String())
+		},
+	}
+
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned status %d", resp.StatusCode)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(b)
+}
+
+// Parse parses an RSS or Atom feed and returns its items, latest first.
+func Parse(b []byte) ([]models.FeedItem, error) {
+	// Peek at the root element to figure out the feed format.
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(b, &root); err != nil {
+		return nil, err
+	}
+
+	var out []models.FeedItem
+	switch root.XMLName.Local {
+	case "rss":
+		var f rss
+		if err := xml.Unmarshal(b, &f); err != nil {
+			return nil, err
+		}
+
+		out = make([]models.FeedItem, 0, len(f.Items))
+		for _, i := range f.Items {
+			item := models.FeedItem{
+				GUID:        strings.TrimSpace(i.GUID),
+				Title:       strings.TrimSpace(i.Title),
+				URL:         strings.TrimSpace(i.Link),
+				Description: strings.TrimSpace(i.Description),
+				Content:     strings.TrimSpace(i.Content),
+				Author:      strings.TrimSpace(i.Author),
+				PublishedAt: parseDate(i.PubDate, i.Date),
+			}
+			if item.Author == "" {
+				item.Author = strings.TrimSpace(i.Creator)
+			}
+			out = append(out, withGUID(item))
+		}
+
+	case "feed":
+		var f atom
+		if err := xml.Unmarshal(b, &f); err != nil {
+			return nil, err
+		}
+
+		out = make([]models.FeedItem, 0, len(f.Entries))
+		for _, e := range f.Entries {
+			item := models.FeedItem{
+				GUID:        strings.TrimSpace(e.ID),
+				Title:       strings.TrimSpace(e.Title),
+				Description: strings.TrimSpace(e.Summary),
+				Content:     strings.TrimSpace(e.Content),
+				Author:      strings.TrimSpace(e.Author),
+				PublishedAt: parseDate(e.Published, e.Updated),
+			}
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					item.URL = strings.TrimSpace(l.Href)
+					break
+				}
+			}
+			out = append(out, withGUID(item))
+		}
+
+	default:
+		return nil, errors.New("unknown feed format")
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].PublishedAt.After(out[j].PublishedAt)
+	})
+
+	return out, nil
+}
+
+// withGUID sets the GUID of an item that doesn't have one to its URL, or if
+// there's no URL, its title, so that every item can be told apart.
+func withGUID(i models.FeedItem) models.FeedItem {
+	if i.GUID == "" {
+		i.GUID = i.URL
+	}
+	if i.GUID == "" {
+		i.GUID = i.Title
+	}
+
+	return i
+}
+
+// checkURL checks that a feed URL is an http(s) URL.
+func checkURL(u string) error {
+	p, err := url.Parse(u)
+	if err != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+		return errScheme
+	}
+
+	return nil
+}
+
+// checkAddr is a net.Dialer Control function that rejects connections to loopback,
+// private, link-local, and other non-public addresses. It runs after the hostname
+// is resolved, and so, covers names that resolve to internal addresses.
+func checkAddr(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return errAddress
+	}
+
+	return nil
+}
+
+// isPublicIP returns true if an IP is a public unicast address.
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !cgnat.Contains(ip)
+}
+
+// parseDate returns the first of the given date strings that can be parsed.
+func parseDate(dates ...string) time.Time {
+	for _, d := range dates {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+
+		for _, f := range dateFormats {
+			if t, err := time.Parse(f, d); err == nil {
+				return t
+			}
+		}
+	}
+
+	return time.Time{}
+}
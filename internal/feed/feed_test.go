@@ -0,0 +1,89 @@
+package feed
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	cases := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+
+	for _, c := range cases {
+		if got := isPublicIP(net.ParseIP(c.ip)); got != c.public {
+			t.Errorf("%s: expected %v, got %v", c.ip, c.public, got)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for u, ok := range map[string]bool{
+		"https://example.com/feed.xml": true,
+		"http://example.com/rss":       true,
+		"file:///etc/passwd":           false,
+		"gopher://example.com":         false,
+		"ftp://example.com/feed":       false,
+		"/feed.xml":                    false,
+		"":                             false,
+	} {
+		if err := checkURL(u); (err == nil) != ok {
+			t.Errorf("%q: expected ok=%v, got %v", u, ok, err)
+		}
+	}
+}
+
+func TestFetchBlocksInternal(t *testing.T) {
+	for _, u := range []string{"http://127.0.0.1:9/feed", "http://[::1]:9/feed", "http://localhost:9/feed"} {
+		if _, err := Fetch(u, 0); err == nil {
+			t.Errorf("%s: expected an error", u)
+		}
+	}
+}
+
+func TestParseGUID(t *testing.T) {
+	items, err := Parse([]byte(`<rss><channel>
+		<item><guid>g1</guid><title>One</title><link>https://x.com/1</link></item>
+		<item><title>Two</title><link>https://x.com/2</link></item>
+		<item><title>Three</title></item>
+	</channel></rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{"g1", "https://x.com/2", "Three"}
+	for n, i := range items {
+		if i.GUID != exp[n] {
+			t.Errorf("item %d: expected GUID %q, got %q", n, exp[n], i.GUID)
+		}
+	}
+
+	items, err = Parse([]byte(`<feed xmlns="http://www.w3.org/2005/Atom">
+		<entry><id>urn:1</id><title>One</title><link href="https://x.com/1"/></entry>
+		<entry><title>Two</title><link href="https://x.com/2"/></entry>
+	</feed>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items[0].GUID != "urn:1" || items[1].GUID != "https://x.com/2" {
+		t.Errorf("unexpected Atom GUIDs: %q, %q", items[0].GUID, items[1].GUID)
+	}
+}
@@ -0,0 +1,236 @@
+package manager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+const (
+	DryRunStatusRunning  = "running"
+	DryRunStatusFinished = "finished"
+	DryRunStatusFailed   = "failed"
+
+	// Max number of render failures listed in a dry run report.
+	maxDryRunFailures = 1000
+)
+
+// ErrDryRunRunning is returned when a dry run of a campaign is already in progress.
+var ErrDryRunRunning = errors.New("a dry run of the campaign is already in progress")
+
+// DryRunReport is the report of a dry run of a campaign, where messages to all of the
+// campaign's subscribers are rendered, but pushed to a sink instead of the messenger.
+type DryRunReport struct {
+	CampaignID int        `json:"campaign_id"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+
+	Subscribers int             `json:"subscribers"`
+	Rendered    int             `json:"rendered"`
+	Failed      int             `json:"failed"`
+	Failures    []DryRunFailure `json:"failures"`
+
+	// Sizes (bytes) of the rendered messages including attachments.
+	TotalBytes int64         `json:"total_bytes"`
+	AvgBytes   int64         `json:"avg_bytes"`
+	Largest    DryRunMessage `json:"largest"`
+
+	// Render times (milliseconds) of messages.
+	AvgRenderMS float64       `json:"avg_render_ms"`
+	Slowest     DryRunMessage `json:"slowest"`
+
+	// The effective send rate (messages / second) and the estimated duration of
+	// the send at that rate.
+	SendRate          int     `json:"send_rate"`
+	EstimatedDuration float64 `json:"estimated_duration_seconds"`
+}
+
+// DryRunFailure is a message that couldn't be rendered for a subscriber.
+type DryRunFailure struct {
+	SubscriberID int    `json:"subscriber_id"`
+	Email        string `json:"email"`
+	Error        string `json:"error"`
+}
+
+// DryRunMessage is a rendered message in a dry run.
+type DryRunMessage struct {
+	SubscriberID int     `json:"subscriber_id"`
+	Email        string  `json:"email"`
+	Bytes        int64   `json:"bytes"`
+	RenderMS     float64 `json:"render_ms"`
+}
+
+// sink is a Messenger that discards messages and records their sizes.
+type sink struct {
+	size int64
+}
+
+func (s *sink) Name() string {
+	return "sink"
+}
+
+// Push discards a message after recording its approximate size on the wire.
+func (s *sink) Push(m models.Message) error {
+	n := len(m.From) + len(m.Subject) + len(m.Body) + len(m.AltBody)
+	for _, t := range m.To {
+		n += len(t)
+	}
+	for k, v := range m.Headers {
+		for _, h := range v {
+			n += len(k) + len(h)
+		}
+	}
+	for _, a := range m.Attachments {
+		n += len(a.Content)
+	}
+
+	s.size = int64(n)
+	return nil
+}
+
+func (s *sink) Flush() error {
+	return nil
+}
+
+func (s *sink) Close() error {
+	return nil
+}
+
+// DryRun starts a dry run of a campaign in the background. Messages to all of the
+// campaign's subscribers are rendered exactly as they would be when the campaign
+// is sent, but are pushed to a sink instead of the campaign's messenger. The
+// campaign's checkpoint, counts, and analytics are left untouched. The report
+// can be fetched with GetDryRun while the run is in progress and after.
+func (m *Manager) DryRun(c *models.Campaign) error {
+	m.dryRunsMut.Lock()
+	if r, ok := m.dryRuns[c.ID]; ok && r.Status == DryRunStatusRunning {
+		m.dryRunsMut.Unlock()
+		return ErrDryRunRunning
+	}
+
+	rep := DryRunReport{
+		CampaignID: c.ID,
+		Status:     DryRunStatusRunning,
+		StartedAt:  time.Now(),
+		Failures:   []DryRunFailure{},
+		SendRate:   m.sendRate(c),
+	}
+	m.dryRuns[c.ID] = rep
+	m.dryRunsMut.Unlock()
+
+	go func() {
+		if err := m.dryRun(c, &rep); err != nil {
+			m.log.Printf("error in dry run of campaign %s: %v", c.Name, err)
+			rep.Status = DryRunStatusFailed
+			rep.Error = err.Error()
+		} else {
+			rep.Status = DryRunStatusFinished
+		}
+
+		now := time.Now()
+		rep.FinishedAt = &now
+		m.saveDryRun(rep)
+	}()
+
+	return nil
+}
+
+// GetDryRun returns the report of the last dry run of a campaign.
+func (m *Manager) GetDryRun(campID int) (DryRunReport, bool) {
+	m.dryRunsMut.RLock()
+	defer m.dryRunsMut.RUnlock()
+
+	r, ok := m.dryRuns[campID]
+	return r, ok
+}
+
+// dryRun renders the messages of a campaign to all of its subscribers batch by
+// batch and fills the report, publishing it after every batch.
+func (m *Manager) dryRun(c *models.Campaign, rep *DryRunReport) error {
+	if err := c.CompileTemplate(m.TemplateFuncs(c)); err != nil {
+		return err
+	}
+
+	if err := m.attachMedia(c); err != nil {
+		return err
+	}
+
+	var (
+		sk      = &sink{}
+		lastID  = 0
+		totalMS float64
+	)
+	for {
+		subs, err := m.store.DryRunSubscribers(c.ID, lastID, m.cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(subs) == 0 {
+			break
+		}
+
+		for _, s := range subs {
+			lastID = s.ID
+			rep.Subscribers++
+
+			start := time.Now()
+			msg, err := m.NewCampaignMessage(c, s)
+			if err != nil {
+				rep.Failed++
+				if len(rep.Failures) < maxDryRunFailures {
+					rep.Failures = append(rep.Failures, DryRunFailure{SubscriberID: s.ID, Email: s.Email, Error: err.Error()})
+				}
+				continue
+			}
+
+			_ = sk.Push(m.makeMessage(msg))
+			ms := float64(time.Since(start).Microseconds()) / 1000
+
+			rep.Rendered++
+			rep.TotalBytes += sk.size
+			totalMS += ms
+
+			if sk.size > rep.Largest.Bytes {
+				rep.Largest = DryRunMessage{SubscriberID: s.ID, Email: s.Email, Bytes: sk.size, RenderMS: ms}
+			}
+			if ms > rep.Slowest.RenderMS {
+				rep.Slowest = DryRunMessage{SubscriberID: s.ID, Email: s.Email, Bytes: sk.size, RenderMS: ms}
+			}
+		}
+
+		if rep.Rendered > 0 {
+			rep.AvgBytes = rep.TotalBytes / int64(rep.Rendered)
+			rep.AvgRenderMS = totalMS / float64(rep.Rendered)
+		}
+		rep.EstimatedDuration = float64(rep.Rendered) / float64(rep.SendRate)
+		m.saveDryRun(*rep)
+	}
+
+	return nil
+}
+
+// saveDryRun publishes a copy of a dry run report.
+func (m *Manager) saveDryRun(rep DryRunReport) {
+	rep.Failures = append([]DryRunFailure{}, rep.Failures...)
+
+	m.dryRunsMut.Lock()
+	m.dryRuns[rep.CampaignID] = rep
+	m.dryRunsMut.Unlock()
+}
+
+// sendRate returns the max number of messages per second at which a campaign
+// can be sent as per the concurrency, message rate, and the campaign's throttle.
+func (m *Manager) sendRate(c *models.Campaign) int {
+	n := m.cfg.Concurrency * m.cfg.MessageRate
+	if c.ThrottleRate > 0 {
+		n = min(n, c.ThrottleRate)
+	}
+	if l, ok := m.cfg.MessengerLimits[c.Messenger]; ok && l.Rate > 0 {
+		n = min(n, l.Rate)
+	}
+
+	return max(1, n)
+}
@@ -39,9 +39,37 @@ type Store interface {
 	GetAttachment(mediaID int) (models.Attachment, error)
 	UpdateCampaignStatus(campID int, status string) error
 	UpdateCampaignCounts(campID int, toSend int, sent int, lastSubID int) error
+	UpdateCampaignSent(campID int, sent int) error
 	CreateLink(url string) (string, error)
 	BlocklistSubscriber(id int64) error
 	DeleteSubscriber(id int64) error
+
+	// A/B testing of campaign variants.
+	GetCampaignVariants(campID int) ([]models.CampaignVariant, error)
+	AssignCampaignVariants(campID int) error
+	NextVariantSubscribers(variantID, limit int) ([]models.Subscriber, error)
+	UpdateCampaignABStatus(campID int, status string, decideAt time.Time) error
+	PickCampaignVariantWinner(campID int) (models.CampaignVariant, error)
+
+	// Per-subscriber delivery schedules (send_mode != default).
+	ScheduleCampaignSubscribers(campID int, defaultTZ string) error
+	NextScheduledSubscribers(campID, limit int) ([]models.Subscriber, error)
+	GetCampaignSchedulePending(campID int) (int, error)
+
+	// DeferMessage records a campaign message that failed to send to be retried later.
+	// variantID is the A/B test variant the message was rendered from, if any.
+	DeferMessage(campID, subID, variantID int, messenger, errMsg string) error
+
+	// LogDelivery records the delivery status of a campaign message to a subscriber.
+	LogDelivery(campID, subID int, messenger, server, response, status string) error
+
+	// Message counts of the cap windows of campaign and messenger send limits.
+	GetSendLimitCount(key string, winStart time.Time) (int, error)
+	AddSendLimitCount(key string, winStart time.Time, n int) error
+
+	// DryRunSubscribers retrieves the next batch of subscribers that a campaign
+	// would be sent to without touching the campaign's checkpoint.
+	DryRunSubscribers(campID, afterID, limit int) ([]models.Subscriber, error)
 }
 
 // Messenger is an interface for a generic messaging backend,
@@ -53,6 +81,19 @@ type Messenger interface {
 	Close() error
 }
 
+// Reporter is implemented by messengers that can report the server a message was
+// sent via and its response (eg: the Message-Id) for the delivery log.
+type Reporter interface {
+	PushReport(models.Message) (server string, response string, err error)
+}
+
+// Throttler is implemented by messengers that limit the number of messages
+// that they can send, eg: SMTP servers being warmed up. Avail returns the number
+// of messages that can be sent right now, and if that's 0, when more can be sent.
+type Throttler interface {
+	Avail(now time.Time) (int, time.Time)
+}
+
 // CampStats contains campaign stats like per minute send rate.
 type CampStats struct {
 	SendRate int
@@ -91,6 +132,14 @@ type Manager struct {
 	slidingCount int
 	slidingStart time.Time
 
+	// Send limits of messengers that are shared by all campaigns and messages
+	// sent via them.
+	msgrLimits map[string]*limiter
+
+	// Reports of the last dry runs of campaigns.
+	dryRuns    map[int]DryRunReport
+	dryRunsMut sync.RWMutex
+
 	tplFuncs template.FuncMap
 }
 
@@ -107,6 +156,9 @@ type CampaignMessage struct {
 	altBody  []byte
 	unsubURL string
 
+	// A/B test variant the message is rendered from, if any.
+	variantID int
+
 	pipe *pipe
 }
 
@@ -120,6 +172,7 @@ type Config struct {
 	SlidingWindow         bool
 	SlidingWindowDuration time.Duration
 	SlidingWindowRate     int
+	MessengerLimits       map[string]Limit
 	RequeueOnError        bool
 	FromEmail             string
 	IndividualTracking    bool
@@ -132,6 +185,12 @@ type Config struct {
 	RootURL               string
 	UnsubHeader           bool
 
+	// Time zone of subscribers who don't have a valid attribs.timezone.
+	DefaultTimezone string
+
+	// Record the delivery status of every campaign message in the delivery log.
+	DeliveryLog bool
+
 	// Interval to scan the DB for active campaign checkpoints.
 	ScanInterval time.Duration
 
@@ -173,9 +232,17 @@ func New(cfg Config, store Store, i *i18n.I18n, l *log.Logger) *Manager {
 		campMsgQ:     make(chan CampaignMessage, cfg.Concurrency*cfg.MessageRate*2),
 		msgQ:         make(chan models.Message, cfg.Concurrency*cfg.MessageRate*2),
 		slidingStart: time.Now(),
+		dryRuns:      make(map[int]DryRunReport),
 	}
 	m.tplFuncs = m.makeGnericFuncMap()
 
+	m.msgrLimits = make(map[string]*limiter, len(cfg.MessengerLimits))
+	for name, l := range cfg.MessengerLimits {
+		if lim := newLimiter(l, "messenger:"+name, store, m.log); lim != nil {
+			m.msgrLimits[name] = lim
+		}
+	}
+
 	return m
 }
 
@@ -283,6 +350,24 @@ func (m *Manager) Run() {
 		}
 
 		if has {
+			// The campaign or its messenger has hit its send limit. Queue again
+			// when the limit resets without holding up other campaigns. Waits longer
+			// than a scan are left to the campaign scan, which also ends the campaign
+			// if it's paused or cancelled in the meantime.
+			if wait := time.Until(p.resumeTime()); wait > 0 {
+				if wait > time.Second {
+					m.log.Printf("campaign (%s) hit its send limit. resuming at %s", p.camp.Name, p.resumeTime().Format(time.RFC822Z))
+				}
+				if wait < m.cfg.ScanInterval {
+					time.AfterFunc(wait, func() {
+						m.resumePipe(p)
+					})
+				} else {
+					p.parked.Store(true)
+				}
+				continue
+			}
+
 			// There are more subscribers to fetch. Queue again.
 			select {
 			case m.nextPipes <- p:
@@ -371,6 +456,13 @@ func (m *Manager) TemplateFuncs(c *models.Campaign) template.FuncMap {
 		"RootURL": func() string {
 			return m.cfg.RootURL
 		},
+		"FeedItems": func() models.FeedItems {
+			// Only the runs of recurring campaigns are filled with feed items.
+			if c == nil {
+				return nil
+			}
+			return c.FeedItems
+		},
 	}
 
 	maps.Copy(f, m.tplFuncs)
@@ -406,6 +498,8 @@ func (m *Manager) scanCampaigns(tick time.Duration) {
 
 	// Periodically scan the data source for campaigns to process.
 	for range t.C {
+		m.resumeParked()
+
 		ids, counts := m.getCurrentCampaigns()
 		campaigns, err := m.store.NextCampaigns(ids, counts)
 		if err != nil {
@@ -433,6 +527,51 @@ func (m *Manager) scanCampaigns(tick time.Duration) {
 	}
 }
 
+// resumeParked queues the pipes parked on a send limit whose limit has reset. Pipes
+// whose campaigns have been stopped, paused, or cancelled in the meantime are ended.
+func (m *Manager) resumeParked() {
+	var (
+		now    = time.Now()
+		parked []*pipe
+	)
+	m.pipesMut.RLock()
+	for _, p := range m.pipes {
+		if p.parked.Load() && (p.stopped.Load() || !now.Before(p.resumeTime())) {
+			parked = append(parked, p)
+		}
+	}
+	m.pipesMut.RUnlock()
+
+	for _, p := range parked {
+		// Check that the campaign is still running before queuing it again.
+		if !p.stopped.Load() {
+			c, err := m.store.GetCampaign(p.camp.ID)
+			if err != nil {
+				m.log.Printf("error fetching campaign (%s) status: %v", p.camp.Name, err)
+				continue
+			}
+			if c.Status != models.CampaignStatusRunning {
+				p.Stop(false)
+			}
+		}
+
+		p.parked.Store(false)
+		m.resumePipe(p)
+	}
+}
+
+// resumePipe queues a pipe that was waiting on a send limit to fetch its next batch
+// of subscribers. If the pipe has been stopped in the meantime, it's ended instead.
+func (m *Manager) resumePipe(p *pipe) {
+	if p.stopped.Load() {
+		// Mark down the pipe's initial +1 so that it ends (see Run()).
+		p.wg.Done()
+		return
+	}
+
+	m.nextPipes <- p
+}
+
 // worker is a blocking function that perpetually listents to events (message) on different
 // queues and processes them.
 func (m *Manager) worker() {
@@ -460,43 +599,8 @@ func (m *Manager) worker() {
 			}
 			numMsg++
 
-			// Outgoing message.
-			out := models.Message{
-				From:        msg.from,
-				To:          []string{msg.to},
-				Subject:     msg.subject,
-				ContentType: msg.Campaign.ContentType,
-				Body:        msg.body,
-				AltBody:     msg.altBody,
-				Subscriber:  msg.Subscriber,
-				Campaign:    msg.Campaign,
-				Attachments: msg.Campaign.Attachments,
-			}
-
-			h := textproto.MIMEHeader{}
-			h.Set(models.EmailHeaderCampaignUUID, msg.Campaign.UUID)
-			h.Set(models.EmailHeaderSubscriberUUID, msg.Subscriber.UUID)
-
-			// Attach List-Unsubscribe headers?
-			if m.cfg.UnsubHeader {
-				h.Set("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
-				h.Set("List-Unsubscribe", `<`+msg.unsubURL+`>`)
-			}
-
-			// Attach any custom headers.
-			if len(msg.Campaign.Headers) > 0 {
-				for _, set := range msg.Campaign.Headers {
-					for hdr, val := range set {
-						h.Add(hdr, val)
-					}
-				}
-			}
-
-			// Set the headers.
-			out.Headers = h
-
 			// Push the message to the messenger.
-			err := m.messengers[msg.Campaign.Messenger].Push(out)
+			server, resp, err := m.push(msg)
 			if err != nil {
 				m.log.Printf("error sending message in campaign %s: subscriber %d: %v", msg.Campaign.Name, msg.Subscriber.ID, err)
 			}
@@ -507,16 +611,27 @@ func (m *Manager) worker() {
 				msg.pipe.wg.Done()
 
 				if err != nil {
+					// Record the message to be retried later.
+					status := models.DeliveryStatusDeferred
+					if err := m.store.DeferMessage(msg.Campaign.ID, msg.Subscriber.ID, msg.variantID, msg.Campaign.Messenger, err.Error()); err != nil {
+						m.log.Printf("error deferring message in campaign %s: subscriber %d: %v", msg.Campaign.Name, msg.Subscriber.ID, err)
+						status = models.DeliveryStatusFailed
+					}
+					m.logDelivery(msg, server, err.Error(), status)
+
 					// Call the error callback, which keeps track of the error count
 					// and stops the campaign if the error count exceeds the threshold.
 					msg.pipe.OnError()
 				} else {
+					// Messages to the samples of A/B test variants don't advance the
+					// campaign's checkpoint as they're not in the campaign's ID order.
 					id := uint64(msg.Subscriber.ID)
-					if id > msg.pipe.lastID.Load() {
+					if len(msg.pipe.variants) == 0 && id > msg.pipe.lastID.Load() {
 						msg.pipe.lastID.Store(uint64(msg.Subscriber.ID))
 					}
 					msg.pipe.rate.Incr(1)
 					msg.pipe.sent.Add(1)
+					m.logDelivery(msg, server, resp, models.DeliveryStatusSent)
 				}
 			}
 
@@ -526,6 +641,9 @@ func (m *Manager) worker() {
 				return
 			}
 
+			// Arbitrary messages aren't throttled, but count towards the messenger's limits.
+			m.msgrLimits[msg.Messenger].add(time.Now(), 1)
+
 			// Push the message to the messenger.
 			if err := m.messengers[msg.Messenger].Push(msg); err != nil {
 				m.log.Printf("error sending message '%s': %v", msg.Subject, err)
@@ -534,6 +652,118 @@ func (m *Manager) worker() {
 	}
 }
 
+// CompileCampaign compiles the templates of a campaign and loads its media/attachments
+// so that messages can be rendered from it with NewCampaignMessage and sent with
+// SendCampaignMessage. It should be called once per campaign.
+func (m *Manager) CompileCampaign(c *models.Campaign) error {
+	if err := c.CompileTemplate(m.TemplateFuncs(c)); err != nil {
+		return fmt.Errorf("error compiling template: %v", err)
+	}
+
+	return m.attachMedia(c)
+}
+
+// SendCampaignMessage sends a campaign message right away, bypassing the queue and
+// the campaign's send limits, and returns the messenger's error, if any. The campaign
+// should've been compiled with CompileCampaign. It's used to retry deferred messages.
+func (m *Manager) SendCampaignMessage(msg CampaignMessage) error {
+	if _, ok := m.messengers[msg.Campaign.Messenger]; !ok {
+		return fmt.Errorf("unknown messenger %s", msg.Campaign.Messenger)
+	}
+
+	m.msgrLimits[msg.Campaign.Messenger].add(time.Now(), 1)
+	server, resp, err := m.push(msg)
+	if err != nil {
+		return err
+	}
+
+	// Count the message towards the campaign's sent count. Retries aren't in the
+	// campaign's subscriber order and don't move its checkpoint.
+	if err := m.store.UpdateCampaignSent(msg.Campaign.ID, 1); err != nil {
+		m.log.Printf("error updating campaign counts (%s): %v", msg.Campaign.Name, err)
+	}
+
+	m.logDelivery(msg, server, resp, models.DeliveryStatusSent)
+	return nil
+}
+
+// SendMessage sends an arbitrary message right away, bypassing the queue, and returns
+// the messenger's error, if any. Like queued messages, it counts towards the messenger's
+// limits.
+func (m *Manager) SendMessage(msg models.Message) error {
+	msgr, ok := m.messengers[msg.Messenger]
+	if !ok {
+		return fmt.Errorf("unknown messenger %s", msg.Messenger)
+	}
+
+	m.msgrLimits[msg.Messenger].add(time.Now(), 1)
+	return msgr.Push(msg)
+}
+
+// push pushes a campaign message to its messenger and returns the server
+// and the response of the messenger if it reports them.
+func (m *Manager) push(msg CampaignMessage) (string, string, error) {
+	var (
+		msgr = m.messengers[msg.Campaign.Messenger]
+		out  = m.makeMessage(msg)
+	)
+	if r, ok := msgr.(Reporter); ok {
+		return r.PushReport(out)
+	}
+
+	return "", "", msgr.Push(out)
+}
+
+// logDelivery records a campaign message's delivery status in the delivery log, if it's enabled.
+func (m *Manager) logDelivery(msg CampaignMessage, server, resp, status string) {
+	if !m.cfg.DeliveryLog {
+		return
+	}
+
+	if err := m.store.LogDelivery(msg.Campaign.ID, msg.Subscriber.ID, msg.Campaign.Messenger, server, resp, status); err != nil {
+		m.log.Printf("error logging delivery in campaign %s: subscriber %d: %v", msg.Campaign.Name, msg.Subscriber.ID, err)
+	}
+}
+
+// makeMessage returns the outgoing Message of a CampaignMessage with its headers.
+func (m *Manager) makeMessage(msg CampaignMessage) models.Message {
+	out := models.Message{
+		From:        msg.from,
+		To:          []string{msg.to},
+		Subject:     msg.subject,
+		ContentType: msg.Campaign.ContentType,
+		Body:        msg.body,
+		AltBody:     msg.altBody,
+		Subscriber:  msg.Subscriber,
+		Campaign:    msg.Campaign,
+		Attachments: msg.Campaign.Attachments,
+	}
+
+	h := textproto.MIMEHeader{}
+	h.Set(models.EmailHeaderCampaignUUID, msg.Campaign.UUID)
+	h.Set(models.EmailHeaderSubscriberUUID, msg.Subscriber.UUID)
+
+	// Attach List-Unsubscribe headers?
+	if m.cfg.UnsubHeader {
+		h.Set("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+		h.Set("List-Unsubscribe", `<`+msg.unsubURL+`>`)
+	}
+
+	// Attach any custom headers.
+	if len(msg.Campaign.Headers) > 0 {
+		for _, set := range msg.Campaign.Headers {
+			for hdr, val := range set {
+				h.Add(hdr, val)
+			}
+		}
+	}
+
+	// Set the headers.
+	out.Headers = h
+
+	return out
+}
+
 // getCurrentCampaigns returns the IDs of campaigns currently being processed
 // and their sent counts.
 func (m *Manager) getCurrentCampaigns() ([]int64, []int64) {
@@ -20,9 +20,32 @@ type pipe struct {
 	stopped    atomic.Bool
 	withErrors atomic.Bool
 
+	// The pipe is waiting on a send limit and is picked up by the campaign
+	// scan once resumeAt has passed.
+	parked atomic.Bool
+
+	// If the campaign or its messenger has hit a send limit, the time
+	// (Unix nanoseconds) when fetching subscribers can resume.
+	resumeAt atomic.Int64
+
+	// A/B test variants of the campaign that are being sent to their
+	// samples of subscribers. Empty if there's no test in progress.
+	variants []*variant
+
+	// The campaign's send limits.
+	limit *limiter
+
 	m *Manager
 }
 
+// variant is a compiled A/B test variant of a campaign. camp is a copy
+// of the campaign with the variant's content.
+type variant struct {
+	id   int
+	camp *models.Campaign
+	done bool
+}
+
 // newPipe adds a campaign to the process queue.
 func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 	// Validate messenger.
@@ -31,6 +54,22 @@ func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 		return nil, fmt.Errorf("unknown messenger %s on campaign %s", c.Messenger, c.Name)
 	}
 
+	// If the campaign is being A/B tested, get the variants to be sent to
+	// their samples, or if the test is over, pick the winner.
+	vars, err := m.getVariants(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the campaign is sent on a per-subscriber schedule, create the schedule
+	// the first time it's picked up. Subscribers sampled for A/B test variants
+	// are sent to first and are excluded from the schedule.
+	if c.SendMode != models.CampaignSendModeDefault && len(vars) == 0 {
+		if err := m.store.ScheduleCampaignSubscribers(c.ID, m.cfg.DefaultTimezone); err != nil {
+			return nil, fmt.Errorf("error scheduling subscribers of campaign %s: %v", c.Name, err)
+		}
+	}
+
 	// Load the template.
 	if err := c.CompileTemplate(m.TemplateFuncs(c)); err != nil {
 		return nil, err
@@ -47,6 +86,26 @@ func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 		rate: ratecounter.NewRateCounter(time.Minute),
 		wg:   &sync.WaitGroup{},
 		m:    m,
+		limit: newLimiter(Limit{
+			Rate:   c.ThrottleRate,
+			Cap:    c.ThrottleCap,
+			Window: ThrottleWindow(c.ThrottleWindow),
+		}, fmt.Sprintf("campaign:%d", c.ID), m.store, m.log),
+	}
+
+	// Compile a copy of the campaign for every variant.
+	for _, v := range vars {
+		vc := *c
+		vc.Subject = v.Subject
+		vc.Body = v.Body
+		vc.AltBody = v.AltBody
+		vc.SubjectTpl = nil
+		vc.AltBodyTpl = nil
+		if err := vc.CompileTemplate(m.TemplateFuncs(&vc)); err != nil {
+			return nil, fmt.Errorf("error compiling variant %s: %v", v.Name, err)
+		}
+
+		p.variants = append(p.variants, &variant{id: v.ID, camp: &vc})
 	}
 
 	// Increment the waitgroup so that Wait() blocks immediately. This is necessary
@@ -74,8 +133,49 @@ func (m *Manager) newPipe(c *models.Campaign) (*pipe, error) {
 // in the current batch or not. A false indicates that all subscribers
 // have been processed, or that a campaign has been paused or cancelled.
 func (p *pipe) NextSubscribers() (bool, error) {
-	// Fetch the next batch of subscribers from a 'running' campaign.
-	subs, err := p.m.store.NextSubscribers(p.camp.ID, p.m.cfg.BatchSize)
+	var (
+		camp  = p.camp
+		varID int
+		subs  []models.Subscriber
+		err   error
+	)
+
+	// Fetch only as many subscribers as the campaign's and its messenger's send
+	// limits allow. If either is exhausted, wait until it resets.
+	now := time.Now()
+	msgrLimit := p.m.msgrLimits[p.camp.Messenger]
+	nCamp, campUntil := p.limit.avail(now)
+	nMsgr, msgrUntil := msgrLimit.avail(now)
+
+	// The messenger may have limits of its own.
+	if t, ok := p.m.messengers[p.camp.Messenger].(Throttler); ok {
+		n, until := t.Avail(now)
+		nMsgr = min(nMsgr, n)
+		if until.After(msgrUntil) {
+			msgrUntil = until
+		}
+	}
+
+	if nCamp == 0 || nMsgr == 0 {
+		until := campUntil
+		if msgrUntil.After(until) {
+			until = msgrUntil
+		}
+		p.resumeAt.Store(until.UnixNano())
+		return true, nil
+	}
+	limit := min(p.m.cfg.BatchSize, nCamp, nMsgr)
+
+	// Fetch the next batch of subscribers from a 'running' campaign, or if
+	// there's an A/B test in progress, from the variants' samples, or if the
+	// campaign has a delivery schedule, the subscribers who are due.
+	if len(p.variants) > 0 {
+		camp, varID, subs, err = p.nextVariantSubscribers(limit)
+	} else if p.camp.SendMode != models.CampaignSendModeDefault {
+		subs, err = p.m.store.NextScheduledSubscribers(p.camp.ID, limit)
+	} else {
+		subs, err = p.m.store.NextSubscribers(p.camp.ID, limit)
+	}
 	if err != nil {
 		return false, fmt.Errorf("error fetching campaign subscribers (%s): %v", p.camp.Name, err)
 	}
@@ -86,6 +186,9 @@ func (p *pipe) NextSubscribers() (bool, error) {
 		return false, nil
 	}
 
+	p.limit.add(now, len(subs))
+	msgrLimit.add(now, len(subs))
+
 	// Is there a sliding window limit configured?
 	hasSliding := p.m.cfg.SlidingWindow &&
 		p.m.cfg.SlidingWindowRate > 0 &&
@@ -93,7 +196,7 @@ func (p *pipe) NextSubscribers() (bool, error) {
 
 	// Push messages.
 	for _, s := range subs {
-		msg, err := p.newMessage(s)
+		msg, err := p.newMessage(camp, varID, s)
 		if err != nil {
 			p.m.log.Printf("error rendering message (%s) (%s): %v", p.camp.Name, s.Email, err)
 			continue
@@ -134,6 +237,28 @@ func (p *pipe) NextSubscribers() (bool, error) {
 	return true, nil
 }
 
+// nextVariantSubscribers fetches the next batch of subscribers sampled for the
+// first variant that hasn't been exhausted, returning the variant's campaign and ID.
+func (p *pipe) nextVariantSubscribers(limit int) (*models.Campaign, int, []models.Subscriber, error) {
+	for _, v := range p.variants {
+		if v.done {
+			continue
+		}
+
+		subs, err := p.m.store.NextVariantSubscribers(v.id, limit)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+
+		if len(subs) > 0 {
+			return v.camp, v.id, subs, nil
+		}
+		v.done = true
+	}
+
+	return p.camp, 0, nil, nil
+}
+
 // OnError keeps track of the number of errors that occur while sending messages
 // and pauses the campaign if the error threshold is met.
 func (p *pipe) OnError() {
@@ -170,12 +295,13 @@ func (p *pipe) Stop(withErrors bool) {
 // newMessage returns a campaign message while internally incrementing the
 // number of messages in the pipe wait group so that the status of every
 // message can be atomically tracked.
-func (p *pipe) newMessage(s models.Subscriber) (CampaignMessage, error) {
-	msg, err := p.m.NewCampaignMessage(p.camp, s)
+func (p *pipe) newMessage(c *models.Campaign, variantID int, s models.Subscriber) (CampaignMessage, error) {
+	msg, err := p.m.NewCampaignMessage(c, s)
 	if err != nil {
 		return msg, err
 	}
 
+	msg.variantID = variantID
 	msg.pipe = p
 	p.wg.Add(1)
 
@@ -192,8 +318,13 @@ func (p *pipe) cleanup() {
 		p.m.pipesMut.Unlock()
 	}()
 
-	// Update campaign's 'sent count.
-	if err := p.m.store.UpdateCampaignCounts(p.camp.ID, 0, int(p.sent.Load()), int(p.lastID.Load())); err != nil {
+	// Update campaign's 'sent count. Messages to the samples of A/B test variants
+	// don't move the campaign's checkpoint, which the winner is sent from.
+	if len(p.variants) > 0 {
+		if err := p.m.store.UpdateCampaignSent(p.camp.ID, int(p.sent.Load())); err != nil {
+			p.m.log.Printf("error updating campaign counts (%s): %v", p.camp.Name, err)
+		}
+	} else if err := p.m.store.UpdateCampaignCounts(p.camp.ID, 0, int(p.sent.Load()), int(p.lastID.Load())); err != nil {
 		p.m.log.Printf("error updating campaign counts (%s): %v", p.camp.Name, err)
 	}
 
@@ -215,6 +346,38 @@ func (p *pipe) cleanup() {
 		return
 	}
 
+	// The A/B test variants have been sent to their samples. The campaign stays
+	// running, but is only picked up again after the wait, when the winner is
+	// picked and sent to the rest of the subscribers.
+	if len(p.variants) > 0 {
+		wait, err := time.ParseDuration(p.camp.ABWait)
+		if err != nil {
+			p.m.log.Printf("invalid A/B test wait duration (%s): %v", p.camp.Name, err)
+		}
+
+		if err := p.m.store.UpdateCampaignABStatus(p.camp.ID, models.CampaignABStatusWaiting, time.Now().Add(wait)); err != nil {
+			p.m.log.Printf("error updating campaign (%s) A/B test status: %v", p.camp.Name, err)
+		} else {
+			p.m.log.Printf("campaign (%s) variants sent. picking winner in %s", p.camp.Name, wait)
+		}
+		return
+	}
+
+	// The subscribers who are due on the campaign's delivery schedule have been
+	// sent to. The campaign stays running and is picked up again when the next
+	// subscribers are due.
+	if p.camp.SendMode != models.CampaignSendModeDefault {
+		n, err := p.m.store.GetCampaignSchedulePending(p.camp.ID)
+		if err != nil {
+			p.m.log.Printf("error fetching pending subscribers of campaign (%s): %v", p.camp.Name, err)
+			return
+		}
+		if n > 0 {
+			p.m.log.Printf("campaign (%s) waiting on the schedule of %d subscriber(s)", p.camp.Name, n)
+			return
+		}
+	}
+
 	// Campaign wasn't manually stopped and subscribers were naturally exhausted.
 	// Fetch the up-to-date campaign status from the DB.
 	c, err := p.m.store.GetCampaign(p.camp.ID)
@@ -238,3 +401,50 @@ func (p *pipe) cleanup() {
 	// Notify admin.
 	_ = p.m.sendNotif(c, c.Status, "")
 }
+
+// getVariants returns the A/B test variants of a campaign that are to be sent to
+// their samples. If the test's wait is over, the winning variant's content is
+// copied on to the campaign instead, so that it's sent to the rest of the subscribers.
+func (m *Manager) getVariants(c *models.Campaign) ([]models.CampaignVariant, error) {
+	if c.ABStatus.String == models.CampaignABStatusDone {
+		return nil, nil
+	}
+
+	vars, err := m.store.GetCampaignVariants(c.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching variants of campaign %s: %v", c.Name, err)
+	}
+	if len(vars) == 0 {
+		return nil, nil
+	}
+
+	switch c.ABStatus.String {
+	// The test hasn't started. Sample subscribers for every variant.
+	case "":
+		if err := m.store.AssignCampaignVariants(c.ID); err != nil {
+			return nil, fmt.Errorf("error sampling subscribers for variants of campaign %s: %v", c.Name, err)
+		}
+		c.ABStatus.String, c.ABStatus.Valid = models.CampaignABStatusTesting, true
+
+	// The wait is over. Pick the winner.
+	case models.CampaignABStatusWaiting:
+		v, err := m.store.PickCampaignVariantWinner(c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error picking winning variant of campaign %s: %v", c.Name, err)
+		}
+		m.log.Printf("variant (%s) won the A/B test of campaign (%s)", v.Name, c.Name)
+
+		c.Subject = v.Subject
+		c.Body = v.Body
+		c.AltBody = v.AltBody
+		c.ABStatus.String = models.CampaignABStatusDone
+		return nil, nil
+	}
+
+	return vars, nil
+}
+
+// resumeTime returns the time when a pipe that has hit a send limit can resume.
+func (p *pipe) resumeTime() time.Time {
+	return time.Unix(0, p.resumeAt.Load())
+}
@@ -0,0 +1,154 @@
+package manager
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+)
+
+// Limit is a send limit of a campaign or a messenger.
+type Limit struct {
+	// Max messages per second. 0 = unlimited.
+	Rate int
+
+	// Max messages per Window. 0 = unlimited. On hitting the cap, sending is
+	// paused until the next window (eg: the next hour or day) begins.
+	Cap    int
+	Window time.Duration
+}
+
+// limitCounter persists the message counts of the cap windows of limiters so that
+// caps hold across restarts, and across pipes of the same campaign.
+type limitCounter interface {
+	GetSendLimitCount(key string, winStart time.Time) (int, error)
+	AddSendLimitCount(key string, winStart time.Time, n int) error
+}
+
+// limiter keeps track of the messages sent in the current second and the current
+// cap window of a Limit. Windows are aligned to the clock, eg: a 24h window
+// starts at 00:00 UTC. If there's a counter, the count of the cap window is
+// loaded from and recorded in it under key.
+type limiter struct {
+	l Limit
+
+	key     string
+	counter limitCounter
+	log     *log.Logger
+
+	secStart time.Time
+	secCount int
+	winStart time.Time
+	winCount int
+
+	mut sync.Mutex
+}
+
+// ThrottleWindow returns the duration of a named throttle window (hour, day).
+func ThrottleWindow(name string) time.Duration {
+	if name == models.ThrottleWindowHour {
+		return time.Hour
+	}
+
+	return time.Hour * 24
+}
+
+// newLimiter returns a limiter for the given Limit whose cap window counts are
+// persisted in counter (optional) under key. If the Limit has no rate or cap,
+// nil is returned. All methods are nil-safe.
+func newLimiter(l Limit, key string, counter limitCounter, lo *log.Logger) *limiter {
+	if l.Rate < 1 && !l.capped() {
+		return nil
+	}
+
+	return &limiter{l: l, key: key, counter: counter, log: lo}
+}
+
+// capped returns true if the Limit has a cap per window.
+func (l Limit) capped() bool {
+	return l.Cap > 0 && l.Window > 0
+}
+
+// avail returns the number of messages that can be sent right now, and if that's 0,
+// the time when more messages can be sent.
+func (l *limiter) avail(now time.Time) (int, time.Time) {
+	if l == nil {
+		return math.MaxInt, time.Time{}
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	l.roll(now)
+
+	var (
+		n     = math.MaxInt
+		until time.Time
+	)
+	if l.l.Rate > 0 {
+		if left := l.l.Rate - l.secCount; left <= 0 {
+			n, until = 0, l.secStart.Add(time.Second)
+		} else {
+			n = left
+		}
+	}
+
+	if l.l.capped() {
+		if left := l.l.Cap - l.winCount; left <= 0 {
+			n, until = 0, l.winStart.Add(l.l.Window)
+		} else {
+			n = min(n, left)
+		}
+	}
+
+	if n > 0 {
+		until = time.Time{}
+	}
+
+	return n, until
+}
+
+// add counts n messages as sent.
+func (l *limiter) add(now time.Time, n int) {
+	if l == nil {
+		return
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	l.roll(now)
+	l.secCount += n
+	l.winCount += n
+
+	if l.counter != nil && l.l.capped() {
+		if err := l.counter.AddSendLimitCount(l.key, l.winStart, n); err != nil {
+			l.log.Printf("error recording send limit count (%s): %v", l.key, err)
+		}
+	}
+}
+
+// roll starts new windows if the current ones are over.
+func (l *limiter) roll(now time.Time) {
+	if now.Sub(l.secStart) >= time.Second {
+		l.secStart = now.Truncate(time.Second)
+		l.secCount = 0
+	}
+
+	if l.l.capped() && now.Sub(l.winStart) >= l.l.Window {
+		l.winStart = now.Truncate(l.l.Window)
+		l.winCount = 0
+
+		// Pick up the messages already sent in the window, eg: before a restart.
+		if l.counter != nil {
+			n, err := l.counter.GetSendLimitCount(l.key, l.winStart)
+			if err != nil {
+				l.log.Printf("error fetching send limit count (%s): %v", l.key, err)
+			} else {
+				l.winCount = n
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"io"
+	"log"
+	"math"
+	"testing"
+	"time"
+)
+
+// memCounter is an in-memory limitCounter.
+type memCounter map[string]struct {
+	start time.Time
+	n     int
+}
+
+func (c memCounter) GetSendLimitCount(key string, winStart time.Time) (int, error) {
+	if v, ok := c[key]; ok && v.start.Equal(winStart) {
+		return v.n, nil
+	}
+	return 0, nil
+}
+
+func (c memCounter) AddSendLimitCount(key string, winStart time.Time, n int) error {
+	v := c[key]
+	if !v.start.Equal(winStart) {
+		v.start, v.n = winStart, 0
+	}
+	v.n += n
+	c[key] = v
+	return nil
+}
+
+var testLog = log.New(io.Discard, "", 0)
+
+func TestNewLimiter(t *testing.T) {
+	cases := []struct {
+		name  string
+		l     Limit
+		isNil bool
+	}{
+		{"none", Limit{}, true},
+		{"cap without window", Limit{Cap: 10}, true},
+		{"window without cap", Limit{Window: time.Hour}, true},
+		{"rate", Limit{Rate: 5}, false},
+		{"cap", Limit{Cap: 10, Window: time.Hour}, false},
+	}
+
+	for _, c := range cases {
+		if got := newLimiter(c.l, "k", nil, testLog); (got == nil) != c.isNil {
+			t.Errorf("%s: expected nil=%v, got %v", c.name, c.isNil, got)
+		}
+	}
+}
+
+func TestLimiterNil(t *testing.T) {
+	var l *limiter
+	n, until := l.avail(time.Now())
+	if n != math.MaxInt || !until.IsZero() {
+		t.Errorf("expected unlimited, got %d, %v", n, until)
+	}
+	l.add(time.Now(), 10)
+}
+
+func TestLimiterRate(t *testing.T) {
+	var (
+		l   = newLimiter(Limit{Rate: 5}, "k", nil, testLog)
+		now = time.Date(2026, 1, 1, 10, 0, 0, 200, time.UTC)
+	)
+
+	if n, _ := l.avail(now); n != 5 {
+		t.Fatalf("expected 5, got %d", n)
+	}
+
+	l.add(now, 3)
+	if n, _ := l.avail(now); n != 2 {
+		t.Fatalf("expected 2, got %d", n)
+	}
+
+	l.add(now, 2)
+	n, until := l.avail(now)
+	if n != 0 || !until.Equal(now.Truncate(time.Second).Add(time.Second)) {
+		t.Fatalf("expected 0 until the next second, got %d, %v", n, until)
+	}
+
+	if n, _ := l.avail(now.Add(time.Second)); n != 5 {
+		t.Fatalf("expected 5 in the next second, got %d", n)
+	}
+}
+
+func TestLimiterCap(t *testing.T) {
+	var (
+		l   = newLimiter(Limit{Rate: 100, Cap: 10, Window: time.Hour}, "k", nil, testLog)
+		now = time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC)
+	)
+
+	// The rate is the lower of the two.
+	if n, _ := l.avail(now); n != 10 {
+		t.Fatalf("expected 10, got %d", n)
+	}
+
+	l.add(now, 10)
+	n, until := l.avail(now.Add(time.Second * 5))
+	if n != 0 || !until.Equal(time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected 0 until the top of the hour, got %d, %v", n, until)
+	}
+
+	if n, _ := l.avail(time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC)); n != 10 {
+		t.Fatalf("expected 10 in the next window, got %d", n)
+	}
+}
+
+func TestLimiterCounter(t *testing.T) {
+	var (
+		c   = memCounter{}
+		lim = Limit{Cap: 10, Window: time.Hour * 24}
+		now = time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	)
+
+	l := newLimiter(lim, "campaign:1", c, testLog)
+	l.avail(now)
+	l.add(now, 4)
+
+	// A new limiter for the same key, eg: after a restart, picks up the count.
+	l = newLimiter(lim, "campaign:1", c, testLog)
+	if n, _ := l.avail(now.Add(time.Hour)); n != 6 {
+		t.Fatalf("expected 6 after reload, got %d", n)
+	}
+
+	// Other keys aren't affected.
+	if n, _ := newLimiter(lim, "campaign:2", c, testLog).avail(now); n != 10 {
+		t.Fatalf("expected 10 for another key, got %d", n)
+	}
+
+	// The count starts afresh in the next window.
+	next := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	l = newLimiter(lim, "campaign:1", c, testLog)
+	if n, _ := l.avail(next); n != 10 {
+		t.Fatalf("expected 10 in the next window, got %d", n)
+	}
+	l.add(next, 1)
+	if got := c["campaign:1"]; got.n != 1 || !got.start.Equal(next) {
+		t.Fatalf("expected a count of 1 from %v, got %d from %v", next, got.n, got.start)
+	}
+}
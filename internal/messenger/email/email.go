@@ -3,11 +3,14 @@ package email
 import (
 	"crypto/tls"
 	"fmt"
-	"math/rand"
+	"math"
+	"net/mail"
 	"net/smtp"
 	"net/textproto"
 	"strings"
+	"time"
 
+	"github.com/gofrs/uuid/v5"
 	"github.com/knadh/listmonk/models"
 	"github.com/knadh/smtppool/v2"
 )
@@ -18,12 +21,14 @@ const (
 	hdrReturnPath = "Return-Path"
 	hdrBcc        = "Bcc"
 	hdrCc         = "Cc"
+	hdrMessageID  = "Message-Id"
 )
 
 // Server represents an SMTP server's credentials.
 type Server struct {
 	// Name is a unique identifier for the server.
 	Name          string            `json:"name"`
+	UUID          string            `json:"uuid"`
 	Username      string            `json:"username"`
 	Password      string            `json:"password"`
 	AuthProtocol  string            `json:"auth_protocol"`
@@ -31,12 +36,29 @@ type Server struct {
 	TLSSkipVerify bool              `json:"tls_skip_verify"`
 	EmailHeaders  map[string]string `json:"email_headers"`
 
+	// Daily ceilings of the server's warm-up, eg: [500, 1000, 2000].
+	// Warmup tracks the server's warm-up and is nil if there's no schedule.
+	WarmupSchedule []int   `json:"warmup_schedule"`
+	Warmup         *Warmup `json:"-"`
+
+	// Weight is the server's share of messages relative to the other servers (default 1).
+	// Domains are the recipient domains (eg: gmail.com, *.outlook.com) that are routed
+	// to the server. Servers without domains receive the rest of the messages.
+	Weight  int      `json:"weight"`
+	Domains []string `json:"domains"`
+
+	// After CooldownErrors consecutive errors (0 = never), the server is taken
+	// out of rotation for CooldownDuration.
+	CooldownErrors   int           `json:"cooldown_errors"`
+	CooldownDuration time.Duration `json:"cooldown_duration"`
+
 	// Rest of the options are embedded directly from the smtppool lib.
 	// The JSON tag is for config unmarshal to work.
 	//lint:ignore SA5008 ,squash is needed by koanf/mapstructure config unmarshal.
 	smtppool.Opt `json:",squash"`
 
-	pool *smtppool.Pool
+	pool   *smtppool.Pool
+	health *health
 }
 
 // Emailer is the SMTP e-mail messenger.
@@ -96,6 +118,19 @@ func New(name string, servers ...Server) (*Emailer, error) {
 		}
 
 		s.pool = pool
+
+		if s.Weight < 1 {
+			s.Weight = 1
+		}
+		for i, d := range s.Domains {
+			s.Domains[i] = strings.ToLower(strings.TrimSpace(d))
+		}
+
+		s.health = &health{maxErrors: s.CooldownErrors, cooldown: s.CooldownDuration}
+		if s.health.cooldown <= 0 {
+			s.health.cooldown = defaultCooldown
+		}
+
 		e.servers = append(e.servers, &s)
 	}
 
@@ -109,17 +144,24 @@ func (e *Emailer) Name() string {
 
 // Push pushes a message to the server.
 func (e *Emailer) Push(m models.Message) error {
-	// If there are more than one SMTP servers, send to a random
-	// one from the list.
-	var (
-		ln  = len(e.servers)
-		srv *Server
-	)
-	if ln > 1 {
-		srv = e.servers[rand.Intn(ln)]
-	} else {
-		srv = e.servers[0]
+	_, _, err := e.PushReport(m)
+	return err
+}
+
+// PushReport pushes a message to the server and returns the name (or host) of
+// the SMTP server it was sent via and the message's Message-Id.
+func (e *Emailer) PushReport(m models.Message) (string, string, error) {
+	// If there are more than one SMTP servers, route the message to one as per
+	// the recipient's domain and the servers' weights, health, and warm-ups.
+	// The warm-up ceilings only hold back campaign messages. Transactional and
+	// system messages (password resets, 2FA, alerts) are always sent, but count
+	// towards the day's warm-up.
+	now := time.Now()
+	srv := e.pickServer(rcptDomain(m.To), now, m.Campaign != nil)
+	if srv == nil {
+		return "", "", ErrWarmupCeiling
 	}
+	srv.Warmup.add(now)
 
 	// Are there attachments?
 	var files []smtppool.Attachment
@@ -189,7 +231,59 @@ func (e *Emailer) Push(m models.Message) error {
 		}
 	}
 
-	return srv.pool.Send(em)
+	// Set a Message-Id to identify the message in the delivery log and the server's logs.
+	msgID := em.Headers.Get(hdrMessageID)
+	if msgID == "" {
+		msgID = makeMessageID(m.From, srv.Host)
+		em.Headers.Set(hdrMessageID, msgID)
+	}
+
+	name := srv.Name
+	if name == "" {
+		name = srv.Host
+	}
+
+	err := srv.pool.Send(em)
+	if srv.health.record(err, time.Now()) {
+		return name, "", fmt.Errorf("%v (SMTP server %s taken out of rotation for %s)", err, srv.Host, srv.health.cooldown)
+	}
+	if err != nil {
+		return name, "", err
+	}
+
+	return name, msgID, nil
+}
+
+// makeMessageID returns a unique RFC 5322 Message-Id on the domain of the
+// from address, or the SMTP host if the address can't be parsed.
+func makeMessageID(from, host string) string {
+	domain := host
+	if a, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(a.Address, "@"); i > -1 {
+			domain = a.Address[i+1:]
+		}
+	}
+
+	return fmt.Sprintf("<%s@%s>", uuid.Must(uuid.NewV4()).String(), domain)
+}
+
+// Avail returns the number of messages that can be sent today as per the warm-up
+// schedules of the servers, and if there are none, the time when more can be sent.
+func (e *Emailer) Avail(now time.Time) (int, time.Time) {
+	n := 0
+	for _, s := range e.servers {
+		a := s.Warmup.avail(now)
+		if a == math.MaxInt {
+			return a, time.Time{}
+		}
+		n += a
+	}
+
+	if n > 0 {
+		return n, time.Time{}
+	}
+
+	return 0, toDate(now).Add(time.Hour * 24)
 }
 
 // Flush flushes the message queue to the server.
@@ -0,0 +1,156 @@
+package email
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCooldown is the cool-down period of a failing server if none is set.
+const defaultCooldown = time.Minute * 5
+
+// health keeps track of the consecutive send errors of a server, and on reaching
+// the threshold, takes it out of rotation until the cool-down period is over.
+type health struct {
+	maxErrors int
+	cooldown  time.Duration
+
+	errors int
+	until  time.Time
+	mut    sync.Mutex
+}
+
+// isUp returns whether the server is in rotation (not cooling down).
+func (h *health) isUp(now time.Time) bool {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	return !now.Before(h.until)
+}
+
+// record records the result of a send and returns true if the server has
+// been taken out of rotation as a result.
+func (h *health) record(err error, now time.Time) bool {
+	if h.maxErrors < 1 {
+		return false
+	}
+
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	if err == nil {
+		h.errors = 0
+		return false
+	}
+
+	h.errors++
+	if h.errors < h.maxErrors {
+		return false
+	}
+
+	h.errors = 0
+	h.until = now.Add(h.cooldown)
+	return true
+}
+
+// pickServer returns a server to send a message to the given recipient domain.
+// Servers that have routing rules for the domain are preferred, and the others
+// without rules are used otherwise. Servers are picked at random as per their
+// weights, skipping the ones that are cooling down after errors, or if ceiling
+// is set, that have reached the day's ceiling of their warm-ups. If all servers are
+// cooling down, they're used anyway. nil is returned if all servers have reached
+// their ceilings.
+func (e *Emailer) pickServer(domain string, now time.Time, ceiling bool) *Server {
+	if len(e.servers) == 1 {
+		if !ceiling || e.servers[0].Warmup.avail(now) > 0 {
+			return e.servers[0]
+		}
+		return nil
+	}
+
+	var (
+		matched []*Server
+		general []*Server
+		others  []*Server
+		cooling []*Server
+	)
+	for _, s := range e.servers {
+		if ceiling && s.Warmup.avail(now) < 1 {
+			continue
+		}
+
+		switch {
+		case !s.health.isUp(now):
+			cooling = append(cooling, s)
+		case len(s.Domains) == 0:
+			general = append(general, s)
+		case s.matchDomain(domain):
+			matched = append(matched, s)
+		default:
+			others = append(others, s)
+		}
+	}
+
+	// Fail over to the general servers if the servers for the domain are down,
+	// then to the servers for other domains, and if all are down, to any server.
+	for _, l := range [][]*Server{matched, general, others, cooling} {
+		if len(l) > 0 {
+			return pickWeighted(l)
+		}
+	}
+
+	return nil
+}
+
+// matchDomain checks if a recipient domain matches the server's routing rules.
+// A rule is either a domain (gmail.com) or a wildcard for its subdomains (*.outlook.com).
+func (s *Server) matchDomain(domain string) bool {
+	for _, d := range s.Domains {
+		if d == domain {
+			return true
+		}
+
+		if strings.HasPrefix(d, "*.") && strings.HasSuffix(domain, d[1:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pickWeighted picks a random server as per the servers' weights.
+func pickWeighted(servers []*Server) *Server {
+	if len(servers) == 1 {
+		return servers[0]
+	}
+
+	total := 0
+	for _, s := range servers {
+		total += s.Weight
+	}
+
+	n := rand.Intn(total)
+	for _, s := range servers {
+		if n < s.Weight {
+			return s
+		}
+		n -= s.Weight
+	}
+
+	return servers[len(servers)-1]
+}
+
+// rcptDomain returns the lowercased domain of the first recipient of a message.
+func rcptDomain(to []string) string {
+	if len(to) == 0 {
+		return ""
+	}
+
+	addr := strings.TrimSuffix(to[0], ">")
+	if i := strings.LastIndex(addr, "@"); i > -1 {
+		return strings.ToLower(strings.TrimSpace(addr[i+1:]))
+	}
+
+	return ""
+}
@@ -0,0 +1,129 @@
+package email
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrWarmupCeiling is returned when all the SMTP servers of a messenger
+// have reached the day's ceiling of their warm-up schedules.
+var ErrWarmupCeiling = errors.New("all SMTP servers have reached their warm-up ceilings for the day")
+
+// Warmup tracks the warm-up of an SMTP server, where the number of messages
+// sent via the server on a day (UTC) is capped by a ceiling that ramps up
+// every day as per the schedule. Once the schedule is over, the server is warmed
+// up and there's no ceiling. A Warmup is shared by all the messengers that
+// use the server.
+type Warmup struct {
+	schedule  []int
+	startedOn time.Time
+	day       time.Time
+	sent      int
+
+	mut sync.Mutex
+}
+
+// WarmupStatus is the warm-up status of an SMTP server on a day.
+type WarmupStatus struct {
+	Schedule  []int     `json:"schedule"`
+	StartedOn time.Time `json:"started_on"`
+	Date      time.Time `json:"date"`
+
+	// Day is the 1-indexed day of the schedule. Ceiling is the max messages
+	// on the day and is 0 once the warm-up is done.
+	Day     int  `json:"day"`
+	Ceiling int  `json:"ceiling"`
+	Sent    int  `json:"sent"`
+	Done    bool `json:"done"`
+}
+
+// NewWarmup returns a Warmup for a server with the given schedule of daily ceilings
+// that started on the given day, with n messages already sent on the day `day`.
+func NewWarmup(schedule []int, startedOn, day time.Time, sent int) *Warmup {
+	return &Warmup{
+		schedule:  schedule,
+		startedOn: toDate(startedOn),
+		day:       toDate(day),
+		sent:      sent,
+	}
+}
+
+// Status returns the warm-up status of the server on the given day.
+func (w *Warmup) Status(now time.Time) WarmupStatus {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	w.roll(now)
+	ceil, ok := w.ceiling()
+
+	return WarmupStatus{
+		Schedule:  w.schedule,
+		StartedOn: w.startedOn,
+		Date:      w.day,
+		Day:       w.dayNum() + 1,
+		Ceiling:   ceil,
+		Sent:      w.sent,
+		Done:      !ok,
+	}
+}
+
+// avail returns the number of messages that can be sent via the server today.
+func (w *Warmup) avail(now time.Time) int {
+	if w == nil {
+		return math.MaxInt
+	}
+
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	w.roll(now)
+	ceil, ok := w.ceiling()
+	if !ok {
+		return math.MaxInt
+	}
+
+	return max(0, ceil-w.sent)
+}
+
+// add counts a message as sent via the server.
+func (w *Warmup) add(now time.Time) {
+	if w == nil {
+		return
+	}
+
+	w.mut.Lock()
+	w.roll(now)
+	w.sent++
+	w.mut.Unlock()
+}
+
+// ceiling returns the ceiling of the current day of the schedule, or false
+// if the warm-up is over.
+func (w *Warmup) ceiling() (int, bool) {
+	n := w.dayNum()
+	if n >= len(w.schedule) {
+		return 0, false
+	}
+
+	return w.schedule[n], true
+}
+
+// dayNum returns the 0-indexed day of the schedule.
+func (w *Warmup) dayNum() int {
+	return max(0, int(w.day.Sub(w.startedOn).Hours()/24))
+}
+
+// roll resets the sent count on a new day.
+func (w *Warmup) roll(now time.Time) {
+	if d := toDate(now); !d.Equal(w.day) {
+		w.day = d
+		w.sent = 0
+	}
+}
+
+// toDate returns the UTC date of a time.
+func toDate(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour * 24)
+}
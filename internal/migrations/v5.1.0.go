@@ -0,0 +1,499 @@
+package migrations
+
+import (
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/knadh/koanf/v2"
+	"github.com/knadh/stuffbin"
+)
+
+// V5_1_0 performs the DB migrations.
+func V5_1_0(db *sqlx.DB, fs stuffbin.FileSystem, ko *koanf.Koanf, lo *log.Logger) error {
+	// A/B testing of campaign variants.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'campaign_ab_status') THEN
+				CREATE TYPE campaign_ab_status AS ENUM ('testing', 'waiting', 'done');
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'campaign_ab_metric') THEN
+				CREATE TYPE campaign_ab_metric AS ENUM ('views', 'clicks');
+			END IF;
+		END$$;
+
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_status campaign_ab_status NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_metric campaign_ab_metric NOT NULL DEFAULT 'views';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_wait TEXT NOT NULL DEFAULT '4h';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ab_decide_at TIMESTAMP WITH TIME ZONE NULL;
+
+		CREATE TABLE IF NOT EXISTS campaign_variants (
+			id               SERIAL PRIMARY KEY,
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			name             TEXT NOT NULL,
+			subject          TEXT NOT NULL,
+			body             TEXT NOT NULL,
+			altbody          TEXT NULL,
+			percent          INT NOT NULL DEFAULT 10 CHECK (percent > 0 AND percent < 100),
+			last_subscriber_id INT NOT NULL DEFAULT 0,
+			winner           BOOLEAN NOT NULL DEFAULT false,
+			created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_camp_variants_camp_id ON campaign_variants(campaign_id);
+
+		CREATE TABLE IF NOT EXISTS campaign_variant_subscribers (
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			variant_id       INTEGER NOT NULL REFERENCES campaign_variants(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			PRIMARY KEY (campaign_id, subscriber_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_camp_variant_subs ON campaign_variant_subscribers(variant_id, subscriber_id);
+	`); err != nil {
+		return err
+	}
+
+	// Per-subscriber send time optimisation.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'campaign_send_mode') THEN
+				CREATE TYPE campaign_send_mode AS ENUM ('default', 'optimal', 'local');
+			END IF;
+		END$$;
+
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS send_mode campaign_send_mode NOT NULL DEFAULT 'default';
+
+		CREATE TABLE IF NOT EXISTS campaign_schedule (
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			timezone         TEXT NULL,
+			send_at          TIMESTAMP WITH TIME ZONE NOT NULL,
+			sent             BOOLEAN NOT NULL DEFAULT false,
+			PRIMARY KEY (campaign_id, subscriber_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_camp_schedule_send_at ON campaign_schedule(campaign_id, send_at) WHERE sent = false;
+
+		INSERT INTO settings (key, value) VALUES ('app.default_timezone', '"UTC"') ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Drip sequences.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'sequence_status') THEN
+				CREATE TYPE sequence_status AS ENUM ('active', 'paused');
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'sequence_subscriber_status') THEN
+				CREATE TYPE sequence_subscriber_status AS ENUM ('active', 'finished', 'exited', 'failed');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS sequences (
+			id               SERIAL PRIMARY KEY,
+			name             TEXT NOT NULL,
+			list_id          INTEGER NULL REFERENCES lists(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			status           sequence_status NOT NULL DEFAULT 'active',
+			exit_list_ids    INTEGER[] NOT NULL DEFAULT '{}',
+			from_email       TEXT NOT NULL,
+			messenger        TEXT NOT NULL,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_sequences_list_id ON sequences(list_id);
+
+		CREATE TABLE IF NOT EXISTS sequence_steps (
+			id               SERIAL PRIMARY KEY,
+			sequence_id      INTEGER NOT NULL REFERENCES sequences(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			position         INTEGER NOT NULL,
+			template_id      INTEGER NOT NULL REFERENCES templates(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			content_type     content_type NOT NULL DEFAULT 'html',
+			delay_mins       INTEGER NOT NULL DEFAULT 0 CHECK (delay_mins >= 0),
+			sent             INTEGER NOT NULL DEFAULT 0,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			UNIQUE (sequence_id, position)
+		);
+
+		CREATE TABLE IF NOT EXISTS sequence_subscribers (
+			sequence_id      INTEGER NOT NULL REFERENCES sequences(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			status           sequence_subscriber_status NOT NULL DEFAULT 'active',
+			position         INTEGER NOT NULL DEFAULT 0,
+			last_sent_at     TIMESTAMP WITH TIME ZONE NULL,
+			attempts         INTEGER NOT NULL DEFAULT 0,
+			retry_at         TIMESTAMP WITH TIME ZONE NULL,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (sequence_id, subscriber_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_seq_subs_status ON sequence_subscribers(sequence_id, status);
+		CREATE INDEX IF NOT EXISTS idx_seq_subs_subscriber_id ON sequence_subscribers(subscriber_id);
+
+		UPDATE roles SET permissions = permissions || '{sequences:get}' WHERE id = 1 AND NOT permissions @> '{sequences:get}';
+		UPDATE roles SET permissions = permissions || '{sequences:manage}' WHERE id = 1 AND NOT permissions @> '{sequences:manage}';
+	`); err != nil {
+		return err
+	}
+
+	// Recurring campaigns.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS recur_cron TEXT NOT NULL DEFAULT '';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS recur_feed_url TEXT NOT NULL DEFAULT '';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS recur_last_run_at TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS recur_last_item_at TIMESTAMP WITH TIME ZONE NULL;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS recur_last_items TEXT[] NOT NULL DEFAULT '{}';
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS parent_id INTEGER NULL REFERENCES campaigns(id) ON DELETE SET NULL ON UPDATE CASCADE;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS feed_items JSONB NOT NULL DEFAULT '[]';
+	`); err != nil {
+		return err
+	}
+
+	// Send throttling of campaigns and messengers.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'throttle_window') THEN
+				CREATE TYPE throttle_window AS ENUM ('hour', 'day');
+			END IF;
+		END$$;
+
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS throttle_rate INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS throttle_cap INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS throttle_window throttle_window NOT NULL DEFAULT 'day';
+
+		INSERT INTO settings (key, value) VALUES ('app.messenger_limits', '[]') ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Warm-up of SMTP servers.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS smtp_warmup (
+			uuid            TEXT NOT NULL PRIMARY KEY,
+			started_on      DATE NOT NULL DEFAULT CURRENT_DATE,
+			day             DATE NOT NULL DEFAULT CURRENT_DATE,
+			sent            INTEGER NOT NULL DEFAULT 0,
+			updated_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Message counts of the cap windows of send limits.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS send_limits (
+			key             TEXT NOT NULL PRIMARY KEY,
+			window_start    TIMESTAMP WITH TIME ZONE NOT NULL,
+			sent            INTEGER NOT NULL DEFAULT 0,
+			updated_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+	`); err != nil {
+		return err
+	}
+
+	// Deferred deliveries of failed campaign messages.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'deferred_status') THEN
+				CREATE TYPE deferred_status AS ENUM ('pending', 'failed');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS deferred_deliveries (
+			id               BIGSERIAL PRIMARY KEY,
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			variant_id       INTEGER NULL REFERENCES campaign_variants(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			messenger        TEXT NOT NULL,
+			error            TEXT NOT NULL DEFAULT '',
+			attempts         INTEGER NOT NULL DEFAULT 0,
+			status           deferred_status NOT NULL DEFAULT 'pending',
+			next_retry_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			UNIQUE (campaign_id, subscriber_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_deferred_status ON deferred_deliveries(status, next_retry_at);
+		CREATE INDEX IF NOT EXISTS idx_deferred_sub_id ON deferred_deliveries(subscriber_id);
+
+		INSERT INTO settings (key, value) VALUES ('app.retry_max_attempts', '5'), ('app.retry_backoff', '"5m"') ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Per-recipient delivery log of campaigns.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'delivery_status') THEN
+				CREATE TYPE delivery_status AS ENUM ('sent', 'failed', 'deferred', 'bounced');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS deliveries (
+			id               BIGSERIAL PRIMARY KEY,
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			messenger        TEXT NOT NULL,
+			server           TEXT NOT NULL DEFAULT '',
+			response         TEXT NOT NULL DEFAULT '',
+			status           delivery_status NOT NULL,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			UNIQUE (campaign_id, subscriber_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_deliveries_sub_id ON deliveries(subscriber_id);
+		CREATE INDEX IF NOT EXISTS idx_deliveries_updated_at ON deliveries(updated_at);
+
+		INSERT INTO settings (key, value) VALUES ('app.delivery_log', 'false'), ('app.delivery_log_retention', '30') ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Campaign approval workflow.
+	if _, err := db.Exec(`ALTER TYPE campaign_status ADD VALUE IF NOT EXISTS 'pending_approval' AFTER 'draft'`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`ALTER TYPE campaign_status ADD VALUE IF NOT EXISTS 'approved' AFTER 'pending_approval'`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'approval_action') THEN
+				CREATE TYPE approval_action AS ENUM ('requested', 'approved', 'rejected', 'invalidated');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS campaign_approvals (
+			id               BIGSERIAL PRIMARY KEY,
+			campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			user_id          INTEGER NULL REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			action           approval_action NOT NULL,
+			note             TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_camp_approvals_camp_id ON campaign_approvals(campaign_id);
+
+		UPDATE roles SET permissions = permissions || '{campaigns:approve}' WHERE id = 1 AND NOT permissions @> '{campaigns:approve}';
+
+		INSERT INTO settings (key, value) VALUES ('app.campaign_approval', 'false') ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Content revisions of campaigns and templates.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS revisions (
+			id               BIGSERIAL PRIMARY KEY,
+			campaign_id      INTEGER NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			template_id      INTEGER NULL REFERENCES templates(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			user_id          INTEGER NULL REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			fields           TEXT[] NOT NULL DEFAULT '{}',
+			data             JSONB NOT NULL DEFAULT '{}',
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			CHECK ((campaign_id IS NULL) != (template_id IS NULL))
+		);
+		CREATE INDEX IF NOT EXISTS idx_revisions_camp_id ON revisions(campaign_id) WHERE campaign_id IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_revisions_tpl_id ON revisions(template_id) WHERE template_id IS NOT NULL;
+	`); err != nil {
+		return err
+	}
+
+	// Saved segments.
+	if _, err := db.Exec(`
+		ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS segment_ids INTEGER[] NOT NULL DEFAULT '{}';
+
+		CREATE TABLE IF NOT EXISTS segments (
+			id               SERIAL PRIMARY KEY,
+			name             TEXT NOT NULL,
+			description      TEXT NOT NULL DEFAULT '',
+			rules            JSONB NOT NULL DEFAULT '{}',
+			subscriber_count INTEGER NOT NULL DEFAULT 0,
+			refreshed_at     TIMESTAMP WITH TIME ZONE NULL,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS segment_subscribers (
+			segment_id       INTEGER NOT NULL REFERENCES segments(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			PRIMARY KEY (segment_id, subscriber_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_seg_subs_subscriber_id ON segment_subscribers(subscriber_id);
+
+		UPDATE roles SET permissions = permissions || '{segments:get}' WHERE id = 1 AND NOT permissions @> '{segments:get}';
+		UPDATE roles SET permissions = permissions || '{segments:manage}' WHERE id = 1 AND NOT permissions @> '{segments:manage}';
+
+		INSERT INTO settings (key, value) VALUES ('app.segment_refresh_interval', '"1h"') ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Engagement scores and sunsetting of inactive subscribers.
+	if _, err := db.Exec(`
+		ALTER TABLE subscribers ADD COLUMN IF NOT EXISTS engagement_score DOUBLE PRECISION NOT NULL DEFAULT 0;
+		CREATE INDEX IF NOT EXISTS idx_subs_engagement_score ON subscribers(engagement_score);
+
+		INSERT INTO settings (key, value) VALUES
+			('app.engagement_half_life', '30'),
+			('app.sunset_enabled', 'false'),
+			('app.sunset_campaigns', '0'),
+			('app.sunset_days', '0'),
+			('app.sunset_action', '"unsubscribe"'),
+			('app.sunset_list_id', '0')
+		ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Subscriber event history.
+	if _, err := db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'subscriber_event_type') THEN
+				CREATE TYPE subscriber_event_type AS ENUM ('updated', 'blocklisted', 'subscribed', 'unsubscribed', 'subscription_removed', 'optin_confirmed', 'preferences_updated');
+			END IF;
+		END$$;
+
+		CREATE TABLE IF NOT EXISTS subscriber_events (
+			id               BIGSERIAL PRIMARY KEY,
+			subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			type             subscriber_event_type NOT NULL,
+			source           TEXT NOT NULL DEFAULT '',
+			user_id          INTEGER NULL REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			campaign_id      INTEGER NULL REFERENCES campaigns(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			meta             JSONB NOT NULL DEFAULT '{}',
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_sub_events_sub_id ON subscriber_events(subscriber_id, created_at);
+	`); err != nil {
+		return err
+	}
+
+	// Audit log of changes made by users.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id               BIGSERIAL PRIMARY KEY,
+			user_id          INTEGER NULL REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			username         TEXT NOT NULL DEFAULT '',
+			ip               TEXT NOT NULL DEFAULT '',
+			method           TEXT NOT NULL,
+			path             TEXT NOT NULL,
+			action           TEXT NOT NULL,
+			entity_type      TEXT NOT NULL DEFAULT '',
+			entity_id        TEXT NOT NULL DEFAULT '',
+			status           INTEGER NOT NULL DEFAULT 0,
+			before           JSONB NULL,
+			after            JSONB NULL,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity_type, entity_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log(user_id);
+
+		UPDATE roles SET permissions = permissions || '{audit:get}' WHERE id = 1 AND NOT permissions @> '{audit:get}';
+
+		INSERT INTO settings (key, value) VALUES ('security.audit_log_retention', '90') ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// TOTP two-factor authentication for users.
+	if _, err := db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT NULL;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_recovery_codes TEXT[] NOT NULL DEFAULT '{}';
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_failures INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_failed_at TIMESTAMP WITH TIME ZONE NULL;
+
+		INSERT INTO settings (key, value) VALUES
+			('security.totp_required', '"off"'),
+			('security.totp_required_roles', '[]')
+			ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// Self-service password resets.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS password_resets (
+			id               BIGSERIAL PRIMARY KEY,
+			user_id          INTEGER NULL REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			email            TEXT NOT NULL,
+			token_hash       TEXT NULL UNIQUE,
+			ip               TEXT NOT NULL DEFAULT '',
+			expires_at       TIMESTAMP WITH TIME ZONE NULL,
+			used_at          TIMESTAMP WITH TIME ZONE NULL,
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_password_resets_created_at ON password_resets(created_at);
+	`); err != nil {
+		return err
+	}
+
+	// Scoped API tokens.
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id               SERIAL PRIMARY KEY,
+			user_id          INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			name             TEXT NOT NULL,
+			token_hash       TEXT NOT NULL UNIQUE,
+			token_prefix     TEXT NOT NULL,
+			permissions      TEXT[] NOT NULL DEFAULT '{}',
+			list_ids         INTEGER[] NOT NULL DEFAULT '{}',
+			expires_at       TIMESTAMP WITH TIME ZONE NULL,
+			last_used_at     TIMESTAMP WITH TIME ZONE NULL,
+			last_used_ip     TEXT NOT NULL DEFAULT '',
+			created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+	`); err != nil {
+		return err
+	}
+
+	// Login brute-force protection.
+	if _, err := db.Exec(`
+		INSERT INTO settings (key, value) VALUES
+			('security.login_max_attempts', '5'),
+			('security.login_max_ip_attempts', '20'),
+			('security.login_lockout_duration', '"15m"')
+		ON CONFLICT DO NOTHING;
+
+		CREATE TABLE IF NOT EXISTS login_failures (
+			type             TEXT NOT NULL,
+			key              TEXT NOT NULL,
+			attempts         JSONB NOT NULL DEFAULT '[]',
+			locked_until     TIMESTAMP WITH TIME ZONE NULL,
+			updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (type, key)
+		);
+	`); err != nil {
+		return err
+	}
+
+	// SAML SSO settings.
+	if _, err := db.Exec(`
+		INSERT INTO settings (key, value) VALUES
+			('security.saml', '{"enabled": false, "provider_name": "", "idp_metadata_url": "", "idp_metadata": "", "sp_certificate": "", "sp_private_key": "", "attr_email": "email", "attr_name": "name", "attr_groups": "groups", "auto_create_users": false, "default_user_role_id": 0, "role_mappings": []}')
+		ON CONFLICT DO NOTHING;
+	`); err != nil {
+		return err
+	}
+
+	// OIDC user provisioning and role mapping settings.
+	if _, err := db.Exec(`
+		UPDATE settings SET value = '{"auto_create_users": false, "default_user_role_id": 0, "role_mappings": []}'::JSONB || value
+			WHERE key = 'security.oidc' AND NOT value ? 'role_mappings';
+	`); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -17,10 +17,13 @@ import (
 )
 
 const (
-	TplImport          = "import-status"
-	TplCampaignStatus  = "campaign-status"
-	TplSubscriberOptin = "subscriber-optin"
-	TplSubscriberData  = "subscriber-data"
+	TplImport           = "import-status"
+	TplCampaignStatus   = "campaign-status"
+	TplCampaignApproval = "campaign-approval"
+	TplSubscriberOptin  = "subscriber-optin"
+	TplSubscriberData   = "subscriber-data"
+	TplPasswordReset    = "password-reset"
+	TplLoginLockout     = "login-lockout"
 )
 
 type FuncPush func(msg models.Message) error
@@ -0,0 +1,495 @@
+// Package segment compiles the rule trees of saved segments into parametrized
+// SQL conditions on the subscribers table. Rules never carry SQL. Fields and
+// operators are picked from fixed sets and values are always passed as arguments.
+package segment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/lib/pq"
+)
+
+// Rule group matches.
+const (
+	MatchAll = "all"
+	MatchAny = "any"
+)
+
+// Rule (condition) types.
+const (
+	// Subscriber fields: email, name, status, created_at, updated_at.
+	TypeField = "field"
+
+	// Subscriber attributes, where the field is the path of the key, eg: city, address.zip.
+	TypeAttribute = "attribute"
+
+	// Membership of any of the given lists. The field is an optional subscription status.
+	TypeList = "list"
+
+	// Views or clicks on any of the last N campaigns.
+	TypeEngagement = "engagement"
+
+	// Number of bounces. The field is an optional bounce type.
+	TypeBounces = "bounces"
+)
+
+const (
+	// Max depth of nested rule groups and the max number of conditions in a tree.
+	maxDepth = 8
+	maxRules = 100
+
+	// Max number of last campaigns that engagement is checked against.
+	maxLastCampaigns = 1000
+)
+
+var (
+	textFields = map[string]string{
+		"email": "subscribers.email",
+		"name":  "subscribers.name",
+	}
+	dateFields = map[string]string{
+		"created_at": "subscribers.created_at",
+		"updated_at": "subscribers.updated_at",
+	}
+	subStatuses = []string{
+		models.SubscriberStatusEnabled,
+		models.SubscriberStatusDisabled,
+		models.SubscriberStatusBlockListed,
+	}
+	subscriptionStatuses = []string{
+		models.SubscriptionStatusUnconfirmed,
+		models.SubscriptionStatusConfirmed,
+		models.SubscriptionStatusUnsubscribed,
+	}
+	bounceTypes = []string{
+		models.BounceTypeHard,
+		models.BounceTypeSoft,
+		models.BounceTypeComplaint,
+	}
+	compareOps = map[string]string{
+		"eq":  "=",
+		"neq": "!=",
+		"gt":  ">",
+		"gte": ">=",
+		"lt":  "<",
+		"lte": "<=",
+	}
+
+	// likeEsc escapes the wildcards in LIKE patterns.
+	likeEsc = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+)
+
+type compiler struct {
+	args   []any
+	offset int
+	num    int
+}
+
+// Compile compiles a rule tree into an SQL condition on the subscribers table.
+// The condition's placeholders start from $(argOffset+1) and args are their values.
+func Compile(r models.SegmentRule, argOffset int) (string, []any, error) {
+	c := &compiler{offset: argOffset}
+
+	out, err := c.compile(r, 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return out, c.args, nil
+}
+
+// Validate checks whether a rule tree compiles.
+func Validate(r models.SegmentRule) error {
+	_, _, err := Compile(r, 0)
+	return err
+}
+
+// ListIDs returns the IDs of the lists that the list rules in a rule tree refer to.
+// Rules whose values aren't lists of IDs are skipped as they don't compile anyway.
+func ListIDs(r models.SegmentRule) []int {
+	var out []int
+	if r.Type == TypeList {
+		var ids []int
+		if err := json.Unmarshal(r.Value, &ids); err == nil {
+			out = append(out, ids...)
+		}
+	}
+
+	for _, sub := range r.Rules {
+		out = append(out, ListIDs(sub)...)
+	}
+
+	return out
+}
+
+func (c *compiler) compile(r models.SegmentRule, depth int) (string, error) {
+	if depth > maxDepth {
+		return "", fmt.Errorf("rules are nested deeper than %d levels", maxDepth)
+	}
+
+	// It's a condition.
+	if r.Type != "" {
+		c.num++
+		if c.num > maxRules {
+			return "", fmt.Errorf("there are more than %d rules", maxRules)
+		}
+
+		return c.condition(r)
+	}
+
+	// It's a group of rules.
+	var sep string
+	switch r.Match {
+	case MatchAll, "":
+		sep = " AND "
+	case MatchAny:
+		sep = " OR "
+	default:
+		return "", fmt.Errorf("unknown match: %s", r.Match)
+	}
+
+	// An empty group matches everyone.
+	if len(r.Rules) == 0 {
+		return "TRUE", nil
+	}
+
+	conds := make([]string, 0, len(r.Rules))
+	for _, sub := range r.Rules {
+		cond, err := c.compile(sub, depth+1)
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, cond)
+	}
+
+	return "(" + strings.Join(conds, sep) + ")", nil
+}
+
+func (c *compiler) condition(r models.SegmentRule) (string, error) {
+	var (
+		out string
+		err error
+	)
+	switch r.Type {
+	case TypeField:
+		out, err = c.field(r)
+	case TypeAttribute:
+		out, err = c.attribute(r)
+	case TypeList:
+		out, err = c.list(r)
+	case TypeEngagement:
+		out, err = c.engagement(r)
+	case TypeBounces:
+		out, err = c.bounces(r)
+	default:
+		return "", fmt.Errorf("unknown rule type: %s", r.Type)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("%s rule (%s): %v", r.Type, r.Field, err)
+	}
+
+	return "(" + out + ")", nil
+}
+
+// field compiles conditions on the subscriber's fields.
+func (c *compiler) field(r models.SegmentRule) (string, error) {
+	// Text fields.
+	if col, ok := textFields[r.Field]; ok {
+		v, err := stringVal(r.Value)
+		if err != nil {
+			return "", err
+		}
+
+		if r.Operator == "eq" || r.Operator == "neq" {
+			return fmt.Sprintf("LOWER(%s) %s LOWER(%s)", col, compareOps[r.Operator], c.arg(v)), nil
+		}
+
+		return c.like(col, r.Operator, v)
+	}
+
+	// Dates.
+	if col, ok := dateFields[r.Field]; ok {
+		switch r.Operator {
+		case "before", "after":
+			v, err := stringVal(r.Value)
+			if err != nil {
+				return "", err
+			}
+			t, err := parseDate(v)
+			if err != nil {
+				return "", err
+			}
+
+			op := "<"
+			if r.Operator == "after" {
+				op = ">"
+			}
+			return fmt.Sprintf("%s %s %s", col, op, c.arg(t)), nil
+
+		case "within_days", "older_than_days":
+			n, err := intVal(r.Value, 0)
+			if err != nil {
+				return "", err
+			}
+
+			op := ">="
+			if r.Operator == "older_than_days" {
+				op = "<"
+			}
+			return fmt.Sprintf("%s %s NOW() - MAKE_INTERVAL(days => %s::INT)", col, op, c.arg(n)), nil
+		}
+
+		return "", fmt.Errorf("unknown operator: %s", r.Operator)
+	}
+
+	// Subscriber status.
+	if r.Field == "status" {
+		v, err := stringVal(r.Value)
+		if err != nil {
+			return "", err
+		}
+		if !inList(v, subStatuses) {
+			return "", fmt.Errorf("unknown status: %s", v)
+		}
+		if r.Operator != "eq" && r.Operator != "neq" {
+			return "", fmt.Errorf("unknown operator: %s", r.Operator)
+		}
+
+		return fmt.Sprintf("subscribers.status %s %s::subscriber_status", compareOps[r.Operator], c.arg(v)), nil
+	}
+
+	return "", errors.New("unknown field")
+}
+
+// attribute compiles conditions on the values in the subscriber's attributes.
+func (c *compiler) attribute(r models.SegmentRule) (string, error) {
+	path := strings.Split(r.Field, ".")
+	for _, p := range path {
+		if strings.TrimSpace(p) == "" {
+			return "", errors.New("invalid attribute path")
+		}
+	}
+
+	var (
+		p    = c.arg(pq.StringArray(path))
+		val  = fmt.Sprintf("(subscribers.attribs #> %s::TEXT[])", p)
+		text = fmt.Sprintf("(subscribers.attribs #>> %s::TEXT[])", p)
+	)
+
+	switch r.Operator {
+	case "exists":
+		return val + " IS NOT NULL", nil
+
+	case "not_exists":
+		return val + " IS NULL", nil
+
+	case "eq", "neq":
+		v, err := jsonVal(r.Value)
+		if err != nil {
+			return "", err
+		}
+
+		op := "="
+		if r.Operator == "neq" {
+			op = "IS DISTINCT FROM"
+		}
+		return fmt.Sprintf("%s %s %s::JSONB", val, op, c.arg(v)), nil
+
+	case "gt", "gte", "lt", "lte":
+		var v float64
+		if err := json.Unmarshal(r.Value, &v); err != nil {
+			return "", errors.New("value should be a number")
+		}
+
+		// Only numeric values are compared.
+		return fmt.Sprintf("(CASE WHEN JSONB_TYPEOF(%s) = 'number' THEN %s::NUMERIC END) %s %s",
+			val, text, compareOps[r.Operator], c.arg(v)), nil
+
+	case "in", "not_in":
+		var v []json.RawMessage
+		if err := json.Unmarshal(r.Value, &v); err != nil || len(v) == 0 {
+			return "", errors.New("value should be a list of values")
+		}
+		b, _ := json.Marshal(v)
+
+		cond := fmt.Sprintf("EXISTS (SELECT 1 FROM JSONB_ARRAY_ELEMENTS(%s::JSONB) e WHERE e.value = %s)", c.arg(string(b)), val)
+		if r.Operator == "not_in" {
+			cond = "NOT " + cond
+		}
+		return cond, nil
+	}
+
+	v, err := stringVal(r.Value)
+	if err != nil {
+		return "", err
+	}
+	return c.like(text, r.Operator, v)
+}
+
+// list compiles list membership conditions.
+func (c *compiler) list(r models.SegmentRule) (string, error) {
+	var ids []int
+	if err := json.Unmarshal(r.Value, &ids); err != nil || len(ids) == 0 {
+		return "", errors.New("value should be a list of list IDs")
+	}
+
+	status := "sl.status != 'unsubscribed'"
+	if r.Field != "" {
+		if !inList(r.Field, subscriptionStatuses) {
+			return "", fmt.Errorf("unknown subscription status: %s", r.Field)
+		}
+		status = fmt.Sprintf("sl.status = %s::subscription_status", c.arg(r.Field))
+	}
+
+	cond := fmt.Sprintf("EXISTS (SELECT 1 FROM subscriber_lists sl WHERE sl.subscriber_id = subscribers.id AND sl.list_id = ANY(%s::INT[]) AND %s)",
+		c.arg(pq.Array(ids)), status)
+
+	switch r.Operator {
+	case "in":
+		return cond, nil
+	case "not_in":
+		return "NOT " + cond, nil
+	}
+
+	return "", fmt.Errorf("unknown operator: %s", r.Operator)
+}
+
+// engagement compiles conditions on views or clicks on the last N campaigns.
+func (c *compiler) engagement(r models.SegmentRule) (string, error) {
+	var table string
+	switch r.Field {
+	case "views":
+		table = "campaign_views"
+	case "clicks":
+		table = "link_clicks"
+	default:
+		return "", errors.New("unknown field")
+	}
+
+	n, err := intVal(r.Value, 1)
+	if err != nil {
+		return "", err
+	}
+	if n > maxLastCampaigns {
+		return "", fmt.Errorf("value should be at most %d", maxLastCampaigns)
+	}
+
+	cond := fmt.Sprintf(`EXISTS (SELECT 1 FROM %s e WHERE e.subscriber_id = subscribers.id AND e.campaign_id IN (
+		SELECT id FROM campaigns WHERE started_at IS NOT NULL ORDER BY started_at DESC LIMIT %s::INT))`, table, c.arg(n))
+
+	switch r.Operator {
+	case "any":
+		return cond, nil
+	case "none":
+		return "NOT " + cond, nil
+	}
+
+	return "", fmt.Errorf("unknown operator: %s", r.Operator)
+}
+
+// bounces compiles conditions on the number of bounces.
+func (c *compiler) bounces(r models.SegmentRule) (string, error) {
+	op, ok := compareOps[r.Operator]
+	if !ok {
+		return "", fmt.Errorf("unknown operator: %s", r.Operator)
+	}
+
+	n, err := intVal(r.Value, 0)
+	if err != nil {
+		return "", err
+	}
+
+	typ := ""
+	if r.Field != "" {
+		if !inList(r.Field, bounceTypes) {
+			return "", fmt.Errorf("unknown bounce type: %s", r.Field)
+		}
+		typ = fmt.Sprintf(" AND b.type = %s::bounce_type", c.arg(r.Field))
+	}
+
+	return fmt.Sprintf("(SELECT COUNT(*) FROM bounces b WHERE b.subscriber_id = subscribers.id%s) %s %s",
+		typ, op, c.arg(n)), nil
+}
+
+// like compiles case-insensitive text pattern conditions.
+func (c *compiler) like(col, op, v string) (string, error) {
+	v = likeEsc.Replace(v)
+
+	switch op {
+	case "contains":
+		return fmt.Sprintf("%s ILIKE %s", col, c.arg("%"+v+"%")), nil
+	case "not_contains":
+		return fmt.Sprintf("NOT COALESCE(%s ILIKE %s, FALSE)", col, c.arg("%"+v+"%")), nil
+	case "starts_with":
+		return fmt.Sprintf("%s ILIKE %s", col, c.arg(v+"%")), nil
+	case "ends_with":
+		return fmt.Sprintf("%s ILIKE %s", col, c.arg("%"+v)), nil
+	}
+
+	return "", fmt.Errorf("unknown operator: %s", op)
+}
+
+// arg adds an argument and returns its placeholder.
+func (c *compiler) arg(v any) string {
+	c.args = append(c.args, v)
+	return fmt.Sprintf("$%d", c.offset+len(c.args))
+}
+
+func stringVal(b json.RawMessage) (string, error) {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return "", errors.New("value should be a string")
+	}
+
+	return v, nil
+}
+
+func intVal(b json.RawMessage, min int) (int, error) {
+	var v int
+	if err := json.Unmarshal(b, &v); err != nil || v < min {
+		return 0, fmt.Errorf("value should be a number >= %d", min)
+	}
+
+	return v, nil
+}
+
+// jsonVal returns a valid, compact JSON value.
+func jsonVal(b json.RawMessage) (string, error) {
+	var v any
+	if len(b) == 0 || json.Unmarshal(b, &v) != nil {
+		return "", errors.New("value is missing")
+	}
+
+	out, _ := json.Marshal(v)
+	return string(out), nil
+}
+
+// parseDate parses an RFC3339 timestamp or a YYYY-MM-DD date.
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return t, errors.New("value should be a date (YYYY-MM-DD) or timestamp (RFC3339)")
+	}
+
+	return t, nil
+}
+
+func inList(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,376 @@
+package segment
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knadh/listmonk/models"
+	"github.com/lib/pq"
+)
+
+func rule(t *testing.T, s string) models.SegmentRule {
+	t.Helper()
+
+	var r models.SegmentRule
+	if err := json.Unmarshal([]byte(s), &r); err != nil {
+		t.Fatalf("invalid rule %s: %v", s, err)
+	}
+	return r
+}
+
+func TestCompileField(t *testing.T) {
+	date := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		rule string
+		sql  string
+		args []any
+	}{
+		// Text fields.
+		{`{"type": "field", "field": "email", "operator": "eq", "value": "a@b.com"}`,
+			`(LOWER(subscribers.email) = LOWER($1))`, []any{"a@b.com"}},
+		{`{"type": "field", "field": "email", "operator": "neq", "value": "a@b.com"}`,
+			`(LOWER(subscribers.email) != LOWER($1))`, []any{"a@b.com"}},
+		{`{"type": "field", "field": "email", "operator": "contains", "value": "b.com"}`,
+			`(subscribers.email ILIKE $1)`, []any{"%b.com%"}},
+		{`{"type": "field", "field": "email", "operator": "not_contains", "value": "b.com"}`,
+			`(NOT COALESCE(subscribers.email ILIKE $1, FALSE))`, []any{"%b.com%"}},
+		{`{"type": "field", "field": "email", "operator": "starts_with", "value": "a"}`,
+			`(subscribers.email ILIKE $1)`, []any{"a%"}},
+		{`{"type": "field", "field": "email", "operator": "ends_with", "value": "@b.com"}`,
+			`(subscribers.email ILIKE $1)`, []any{"%@b.com"}},
+		{`{"type": "field", "field": "name", "operator": "eq", "value": "John"}`,
+			`(LOWER(subscribers.name) = LOWER($1))`, []any{"John"}},
+		{`{"type": "field", "field": "name", "operator": "neq", "value": "John"}`,
+			`(LOWER(subscribers.name) != LOWER($1))`, []any{"John"}},
+		{`{"type": "field", "field": "name", "operator": "contains", "value": "oh"}`,
+			`(subscribers.name ILIKE $1)`, []any{"%oh%"}},
+		{`{"type": "field", "field": "name", "operator": "not_contains", "value": "oh"}`,
+			`(NOT COALESCE(subscribers.name ILIKE $1, FALSE))`, []any{"%oh%"}},
+		{`{"type": "field", "field": "name", "operator": "starts_with", "value": "Jo"}`,
+			`(subscribers.name ILIKE $1)`, []any{"Jo%"}},
+		{`{"type": "field", "field": "name", "operator": "ends_with", "value": "hn"}`,
+			`(subscribers.name ILIKE $1)`, []any{"%hn"}},
+
+		// LIKE wildcards in values are escaped.
+		{`{"type": "field", "field": "name", "operator": "contains", "value": "50%_\\"}`,
+			`(subscribers.name ILIKE $1)`, []any{`%50\%\_\\%`}},
+
+		// Dates.
+		{`{"type": "field", "field": "created_at", "operator": "before", "value": "2025-01-02"}`,
+			`(subscribers.created_at < $1)`, []any{date}},
+		{`{"type": "field", "field": "created_at", "operator": "after", "value": "2025-01-02T00:00:00Z"}`,
+			`(subscribers.created_at > $1)`, []any{date}},
+		{`{"type": "field", "field": "created_at", "operator": "within_days", "value": 7}`,
+			`(subscribers.created_at >= NOW() - MAKE_INTERVAL(days => $1::INT))`, []any{7}},
+		{`{"type": "field", "field": "created_at", "operator": "older_than_days", "value": 7}`,
+			`(subscribers.created_at < NOW() - MAKE_INTERVAL(days => $1::INT))`, []any{7}},
+		{`{"type": "field", "field": "updated_at", "operator": "before", "value": "2025-01-02"}`,
+			`(subscribers.updated_at < $1)`, []any{date}},
+		{`{"type": "field", "field": "updated_at", "operator": "after", "value": "2025-01-02"}`,
+			`(subscribers.updated_at > $1)`, []any{date}},
+		{`{"type": "field", "field": "updated_at", "operator": "within_days", "value": 0}`,
+			`(subscribers.updated_at >= NOW() - MAKE_INTERVAL(days => $1::INT))`, []any{0}},
+		{`{"type": "field", "field": "updated_at", "operator": "older_than_days", "value": 30}`,
+			`(subscribers.updated_at < NOW() - MAKE_INTERVAL(days => $1::INT))`, []any{30}},
+
+		// Status.
+		{`{"type": "field", "field": "status", "operator": "eq", "value": "enabled"}`,
+			`(subscribers.status = $1::subscriber_status)`, []any{"enabled"}},
+		{`{"type": "field", "field": "status", "operator": "neq", "value": "blocklisted"}`,
+			`(subscribers.status != $1::subscriber_status)`, []any{"blocklisted"}},
+		{`{"type": "field", "field": "status", "operator": "eq", "value": "disabled"}`,
+			`(subscribers.status = $1::subscriber_status)`, []any{"disabled"}},
+	}
+
+	for _, c := range cases {
+		checkCompile(t, c.rule, c.sql, c.args)
+	}
+}
+
+func TestCompileAttribute(t *testing.T) {
+	var (
+		path = pq.StringArray{"address", "city"}
+		val  = `(subscribers.attribs #> $1::TEXT[])`
+		text = `(subscribers.attribs #>> $1::TEXT[])`
+	)
+
+	cases := []struct {
+		rule string
+		sql  string
+		args []any
+	}{
+		{`{"type": "attribute", "field": "address.city", "operator": "exists"}`,
+			`(` + val + ` IS NOT NULL)`, []any{path}},
+		{`{"type": "attribute", "field": "address.city", "operator": "not_exists"}`,
+			`(` + val + ` IS NULL)`, []any{path}},
+		{`{"type": "attribute", "field": "address.city", "operator": "eq", "value": "Berlin"}`,
+			`(` + val + ` = $2::JSONB)`, []any{path, `"Berlin"`}},
+		{`{"type": "attribute", "field": "address.city", "operator": "neq", "value": {"a":  1}}`,
+			`(` + val + ` IS DISTINCT FROM $2::JSONB)`, []any{path, `{"a":1}`}},
+		{`{"type": "attribute", "field": "address.city", "operator": "in", "value": ["Berlin", 1]}`,
+			`(EXISTS (SELECT 1 FROM JSONB_ARRAY_ELEMENTS($2::JSONB) e WHERE e.value = ` + val + `))`,
+			[]any{path, `["Berlin",1]`}},
+		{`{"type": "attribute", "field": "address.city", "operator": "not_in", "value": ["Berlin"]}`,
+			`(NOT EXISTS (SELECT 1 FROM JSONB_ARRAY_ELEMENTS($2::JSONB) e WHERE e.value = ` + val + `))`,
+			[]any{path, `["Berlin"]`}},
+		{`{"type": "attribute", "field": "address.city", "operator": "contains", "value": "erl"}`,
+			`(` + text + ` ILIKE $2)`, []any{path, "%erl%"}},
+		{`{"type": "attribute", "field": "address.city", "operator": "not_contains", "value": "erl"}`,
+			`(NOT COALESCE(` + text + ` ILIKE $2, FALSE))`, []any{path, "%erl%"}},
+		{`{"type": "attribute", "field": "address.city", "operator": "starts_with", "value": "Be"}`,
+			`(` + text + ` ILIKE $2)`, []any{path, "Be%"}},
+		{`{"type": "attribute", "field": "address.city", "operator": "ends_with", "value": "in"}`,
+			`(` + text + ` ILIKE $2)`, []any{path, "%in"}},
+	}
+
+	// Numeric comparisons. eq and neq compare JSON values.
+	for _, op := range []string{"gt", "gte", "lt", "lte"} {
+		sym := compareOps[op]
+		cases = append(cases, struct {
+			rule string
+			sql  string
+			args []any
+		}{
+			`{"type": "attribute", "field": "address.city", "operator": "` + op + `", "value": 10.5}`,
+			`((CASE WHEN JSONB_TYPEOF(` + val + `) = 'number' THEN ` + text + `::NUMERIC END) ` + sym + ` $2)`,
+			[]any{path, 10.5},
+		})
+	}
+
+	for _, c := range cases {
+		checkCompile(t, c.rule, c.sql, c.args)
+	}
+}
+
+func TestCompileList(t *testing.T) {
+	ids := pq.Array([]int{1, 2})
+
+	cases := []struct {
+		rule string
+		sql  string
+		args []any
+	}{
+		{`{"type": "list", "operator": "in", "value": [1, 2]}`,
+			`(EXISTS (SELECT 1 FROM subscriber_lists sl WHERE sl.subscriber_id = subscribers.id AND sl.list_id = ANY($1::INT[]) AND sl.status != 'unsubscribed'))`,
+			[]any{ids}},
+		{`{"type": "list", "operator": "not_in", "value": [1, 2]}`,
+			`(NOT EXISTS (SELECT 1 FROM subscriber_lists sl WHERE sl.subscriber_id = subscribers.id AND sl.list_id = ANY($1::INT[]) AND sl.status != 'unsubscribed'))`,
+			[]any{ids}},
+	}
+
+	for _, s := range subscriptionStatuses {
+		cases = append(cases, struct {
+			rule string
+			sql  string
+			args []any
+		}{
+			`{"type": "list", "field": "` + s + `", "operator": "in", "value": [1, 2]}`,
+			`(EXISTS (SELECT 1 FROM subscriber_lists sl WHERE sl.subscriber_id = subscribers.id AND sl.list_id = ANY($2::INT[]) AND sl.status = $1::subscription_status))`,
+			[]any{s, ids},
+		})
+	}
+
+	for _, c := range cases {
+		checkCompile(t, c.rule, c.sql, c.args)
+	}
+}
+
+func TestCompileEngagement(t *testing.T) {
+	for field, table := range map[string]string{"views": "campaign_views", "clicks": "link_clicks"} {
+		for op, not := range map[string]string{"any": "", "none": "NOT "} {
+			cond := `(` + not + `EXISTS (SELECT 1 FROM ` + table + ` e WHERE e.subscriber_id = subscribers.id AND e.campaign_id IN (
+		SELECT id FROM campaigns WHERE started_at IS NOT NULL ORDER BY started_at DESC LIMIT $1::INT)))`
+
+			checkCompile(t, `{"type": "engagement", "field": "`+field+`", "operator": "`+op+`", "value": 5}`, cond, []any{5})
+		}
+	}
+}
+
+func TestCompileBounces(t *testing.T) {
+	for op, sym := range compareOps {
+		checkCompile(t, `{"type": "bounces", "operator": "`+op+`", "value": 2}`,
+			`((SELECT COUNT(*) FROM bounces b WHERE b.subscriber_id = subscribers.id) `+sym+` $1)`, []any{2})
+
+		for _, typ := range bounceTypes {
+			checkCompile(t, `{"type": "bounces", "field": "`+typ+`", "operator": "`+op+`", "value": 2}`,
+				`((SELECT COUNT(*) FROM bounces b WHERE b.subscriber_id = subscribers.id AND b.type = $1::bounce_type) `+sym+` $2)`,
+				[]any{typ, 2})
+		}
+	}
+}
+
+func TestCompileGroups(t *testing.T) {
+	r := rule(t, `{"match": "any", "rules": [
+		{"type": "field", "field": "email", "operator": "eq", "value": "a@b.com"},
+		{"match": "all", "rules": [
+			{"type": "bounces", "operator": "eq", "value": 0},
+			{"type": "field", "field": "status", "operator": "eq", "value": "enabled"}
+		]}
+	]}`)
+
+	sql, args, err := Compile(r, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exp := `((LOWER(subscribers.email) = LOWER($3)) OR (((SELECT COUNT(*) FROM bounces b WHERE b.subscriber_id = subscribers.id) = $4) AND (subscribers.status = $5::subscriber_status)))`
+	if sql != exp {
+		t.Errorf("expected\n%s\ngot\n%s", exp, sql)
+	}
+	if !reflect.DeepEqual(args, []any{"a@b.com", 0, "enabled"}) {
+		t.Errorf("unexpected args: %#v", args)
+	}
+
+	// An empty group matches everyone.
+	if sql, _, err := Compile(models.SegmentRule{}, 0); err != nil || sql != "TRUE" {
+		t.Errorf("expected TRUE for an empty group, got %q, %v", sql, err)
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		rule string
+	}{
+		{"unknown type", `{"type": "sql", "field": "email", "operator": "eq", "value": "x"}`},
+		{"unknown match", `{"match": "xor", "rules": []}`},
+
+		// Unknown fields.
+		{"unknown field", `{"type": "field", "field": "password", "operator": "eq", "value": "x"}`},
+		{"empty field", `{"type": "field", "operator": "eq", "value": "x"}`},
+		{"unknown engagement field", `{"type": "engagement", "field": "opens", "operator": "any", "value": 1}`},
+		{"unknown subscription status", `{"type": "list", "field": "pending", "operator": "in", "value": [1]}`},
+		{"unknown bounce type", `{"type": "bounces", "field": "medium", "operator": "eq", "value": 1}`},
+		{"unknown status", `{"type": "field", "field": "status", "operator": "eq", "value": "deleted"}`},
+		{"empty attribute path", `{"type": "attribute", "field": "", "operator": "exists"}`},
+		{"empty attribute path segment", `{"type": "attribute", "field": "a..b", "operator": "exists"}`},
+
+		// Unknown operators.
+		{"unknown text op", `{"type": "field", "field": "email", "operator": "regex", "value": "x"}`},
+		{"unknown date op", `{"type": "field", "field": "created_at", "operator": "eq", "value": "2025-01-01"}`},
+		{"unknown status op", `{"type": "field", "field": "status", "operator": "contains", "value": "enabled"}`},
+		{"unknown attribute op", `{"type": "attribute", "field": "city", "operator": "like", "value": "x"}`},
+		{"unknown list op", `{"type": "list", "operator": "eq", "value": [1]}`},
+		{"unknown engagement op", `{"type": "engagement", "field": "views", "operator": "all", "value": 1}`},
+		{"unknown bounces op", `{"type": "bounces", "operator": "contains", "value": 1}`},
+
+		// Invalid values.
+		{"text value not a string", `{"type": "field", "field": "email", "operator": "eq", "value": 1}`},
+		{"invalid date", `{"type": "field", "field": "created_at", "operator": "before", "value": "yesterday"}`},
+		{"negative days", `{"type": "field", "field": "created_at", "operator": "within_days", "value": -1}`},
+		{"missing attribute value", `{"type": "attribute", "field": "city", "operator": "eq"}`},
+		{"attribute compare not a number", `{"type": "attribute", "field": "age", "operator": "gt", "value": "10"}`},
+		{"empty attribute in", `{"type": "attribute", "field": "city", "operator": "in", "value": []}`},
+		{"empty list IDs", `{"type": "list", "operator": "in", "value": []}`},
+		{"list IDs not numbers", `{"type": "list", "operator": "in", "value": ["1"]}`},
+		{"zero last campaigns", `{"type": "engagement", "field": "views", "operator": "any", "value": 0}`},
+		{"too many last campaigns", `{"type": "engagement", "field": "views", "operator": "any", "value": 1001}`},
+		{"negative bounces", `{"type": "bounces", "operator": "gt", "value": -1}`},
+
+		// Injection attempts in fields and operators, which are only matched against fixed sets.
+		{"field injection", `{"type": "field", "field": "email = email OR 1=1 --", "operator": "eq", "value": "x"}`},
+		{"operator injection", `{"type": "field", "field": "email", "operator": "= '' OR 1=1 --", "value": "x"}`},
+		{"list status injection", `{"type": "list", "field": "confirmed' OR '1'='1", "operator": "in", "value": [1]}`},
+		{"bounce type injection", `{"type": "bounces", "field": "hard'; DROP TABLE subscribers; --", "operator": "eq", "value": 1}`},
+		{"list IDs injection", `{"type": "list", "operator": "in", "value": "1) OR (1=1"}`},
+		{"days injection", `{"type": "field", "field": "created_at", "operator": "within_days", "value": "1; DROP TABLE subscribers"}`},
+	}
+
+	for _, c := range cases {
+		if sql, _, err := Compile(rule(t, c.rule), 0); err == nil {
+			t.Errorf("%s: expected an error, got %s", c.name, sql)
+		}
+	}
+}
+
+func TestCompileInjectionValues(t *testing.T) {
+	// Values and attribute paths are always passed as arguments and never end up in the SQL.
+	const inj = `x'); DROP TABLE subscribers; --`
+
+	rules := []string{
+		`{"type": "field", "field": "email", "operator": "eq", "value": "` + inj + `"}`,
+		`{"type": "field", "field": "name", "operator": "contains", "value": "` + inj + `"}`,
+		`{"type": "attribute", "field": "` + inj + `", "operator": "exists"}`,
+		`{"type": "attribute", "field": "city", "operator": "eq", "value": "` + inj + `"}`,
+		`{"type": "attribute", "field": "city", "operator": "in", "value": ["` + inj + `"]}`,
+		`{"type": "attribute", "field": "city", "operator": "starts_with", "value": "` + inj + `"}`,
+	}
+
+	for _, s := range rules {
+		sql, args, err := Compile(rule(t, s), 0)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", s, err)
+			continue
+		}
+		if strings.Contains(sql, "DROP") {
+			t.Errorf("%s: value in SQL: %s", s, sql)
+		}
+		if len(args) == 0 {
+			t.Errorf("%s: expected args", s)
+		}
+	}
+}
+
+func TestCompileLimits(t *testing.T) {
+	// Nesting.
+	r := models.SegmentRule{Type: TypeBounces, Operator: "eq", Value: json.RawMessage(`0`)}
+	for range maxDepth + 1 {
+		r = models.SegmentRule{Rules: []models.SegmentRule{r}}
+	}
+	if _, _, err := Compile(r, 0); err == nil {
+		t.Error("expected an error for rules nested too deep")
+	}
+
+	// Number of conditions.
+	cond := models.SegmentRule{Type: TypeBounces, Operator: "eq", Value: json.RawMessage(`0`)}
+	r = models.SegmentRule{}
+	for range maxRules {
+		r.Rules = append(r.Rules, cond)
+	}
+	if _, _, err := Compile(r, 0); err != nil {
+		t.Errorf("unexpected error for %d rules: %v", maxRules, err)
+	}
+
+	r.Rules = append(r.Rules, cond)
+	if _, _, err := Compile(r, 0); err == nil {
+		t.Error("expected an error for too many rules")
+	}
+}
+
+func TestListIDs(t *testing.T) {
+	r := rule(t, `{"match": "any", "rules": [
+		{"type": "list", "operator": "in", "value": [1, 2]},
+		{"type": "field", "field": "email", "operator": "eq", "value": "a@b.com"},
+		{"match": "all", "rules": [
+			{"type": "list", "field": "confirmed", "operator": "not_in", "value": [3]}
+		]}
+	]}`)
+
+	if got := ListIDs(r); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("expected [1 2 3], got %v", got)
+	}
+
+	if got := ListIDs(rule(t, `{"type": "bounces", "operator": "eq", "value": 0}`)); len(got) != 0 {
+		t.Errorf("expected no list IDs, got %v", got)
+	}
+}
+
+func checkCompile(t *testing.T, r, sql string, args []any) {
+	t.Helper()
+
+	gotSQL, gotArgs, err := Compile(rule(t, r), 0)
+	if err != nil {
+		t.Errorf("%s: unexpected error: %v", r, err)
+		return
+	}
+	if gotSQL != sql {
+		t.Errorf("%s: expected\n%s\ngot\n%s", r, sql, gotSQL)
+	}
+	if !reflect.DeepEqual(gotArgs, args) {
+		t.Errorf("%s: expected args %#v, got %#v", r, args, gotArgs)
+	}
+}
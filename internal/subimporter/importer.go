@@ -21,6 +21,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/knadh/listmonk/internal/i18n"
@@ -73,6 +74,10 @@ type Options struct {
 	UpdateListDateStmt *sql.Stmt
 	PostCB             func(subject string, data any) error
 
+	// SubscribeCB is called after subscribers are imported into lists
+	// with the time at which the import started.
+	SubscribeCB func(listIDs []int, since time.Time)
+
 	DomainBlocklist []string
 	DomainAllowlist []string
 }
@@ -273,6 +278,8 @@ func (s *Session) Start() {
 	listIDs := make([]int, len(s.opt.ListIDs))
 	copy(listIDs, s.opt.ListIDs)
 
+	start := time.Now()
+
 	for sub := range s.subQueue {
 		if cur == 0 {
 			// New transaction batch.
@@ -330,6 +337,7 @@ func (s *Session) Start() {
 		if _, err := s.im.opt.UpdateListDateStmt.Exec(pq.Array(listIDs)); err != nil {
 			s.log.Printf("error updating lists date: %v", err)
 		}
+		s.subscribed(listIDs, start)
 		s.im.sendNotif(StatusFinished)
 		return
 	}
@@ -349,10 +357,21 @@ func (s *Session) Start() {
 	if _, err := s.im.opt.UpdateListDateStmt.Exec(pq.Array(listIDs)); err != nil {
 		s.log.Printf("error updating lists date: %v", err)
 	}
+	s.subscribed(listIDs, start)
 
 	s.im.sendNotif(StatusFinished)
 }
 
+// subscribed invokes the subscription callback, if there's one, after
+// subscribers have been imported into lists.
+func (s *Session) subscribed(listIDs []int, since time.Time) {
+	if s.opt.Mode != ModeSubscribe || s.im.opt.SubscribeCB == nil || len(listIDs) == 0 {
+		return
+	}
+
+	s.im.opt.SubscribeCB(listIDs, since)
+}
+
 // Stop stops an active import session.
 func (s *Session) Stop() {
 	close(s.subQueue)
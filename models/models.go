@@ -49,6 +49,28 @@ const (
 	CampaignContentTypeMarkdown = "markdown"
 	CampaignContentTypePlain    = "plain"
 	CampaignContentTypeVisual   = "visual"
+	CampaignABStatusTesting     = "testing"
+	CampaignABStatusWaiting     = "waiting"
+	CampaignABStatusDone        = "done"
+	CampaignABMetricViews       = "views"
+	CampaignABMetricClicks      = "clicks"
+	CampaignSendModeDefault     = "default"
+	CampaignSendModeOptimal     = "optimal"
+	CampaignSendModeLocal       = "local"
+
+	CampaignStatusPendingApproval = "pending_approval"
+	CampaignStatusApproved        = "approved"
+
+	// Throttle windows of the send caps of campaigns and messengers.
+	ThrottleWindowHour = "hour"
+	ThrottleWindowDay  = "day"
+
+	// Sequence.
+	SequenceStatusActive             = "active"
+	SequenceStatusPaused             = "paused"
+	SequenceSubscriberStatusActive   = "active"
+	SequenceSubscriberStatusFinished = "finished"
+	SequenceSubscriberStatusExited   = "exited"
 
 	// List.
 	ListTypePrivate = "private"
@@ -78,6 +100,34 @@ const (
 	BounceTypeSoft      = "soft"
 	BounceTypeComplaint = "complaint"
 
+	DeferredStatusPending = "pending"
+	DeferredStatusFailed  = "failed"
+
+	DeliveryStatusSent     = "sent"
+	DeliveryStatusFailed   = "failed"
+	DeliveryStatusDeferred = "deferred"
+	DeliveryStatusBounced  = "bounced"
+
+	ApprovalActionRequested   = "requested"
+	ApprovalActionApproved    = "approved"
+	ApprovalActionRejected    = "rejected"
+	ApprovalActionInvalidated = "invalidated"
+
+	SunsetActionUnsubscribe = "unsubscribe"
+	SunsetActionMove        = "move"
+
+	// Subscriber events.
+	SubscriberEventUpdated             = "updated"
+	SubscriberEventBlocklisted         = "blocklisted"
+	SubscriberEventSubscribed          = "subscribed"
+	SubscriberEventUnsubscribed        = "unsubscribed"
+	SubscriberEventSubscriptionRemoved = "subscription_removed"
+	SubscriberEventOptinConfirmed      = "optin_confirmed"
+	SubscriberEventPrefsUpdated        = "preferences_updated"
+
+	SubscriberEventSourceAdmin      = "admin"
+	SubscriberEventSourceSubscriber = "subscriber"
+
 	// Templates.
 	TemplateTypeCampaign       = "campaign"
 	TemplateTypeCampaignVisual = "campaign_visual"
@@ -149,6 +199,9 @@ type Subscriber struct {
 	Attribs JSON           `db:"attribs" json:"attribs"`
 	Status  string         `db:"status" json:"status"`
 	Lists   types.JSONText `db:"lists" json:"lists"`
+
+	// Engagement score from views, clicks, and bounces, decayed over time.
+	EngagementScore float64 `db:"engagement_score" json:"engagement_score"`
 }
 type subLists struct {
 	SubscriberID int            `db:"subscriber_id"`
@@ -241,6 +294,39 @@ type Campaign struct {
 	ArchiveTemplateID null.Int        `db:"archive_template_id" json:"archive_template_id"`
 	ArchiveMeta       json.RawMessage `db:"archive_meta" json:"archive_meta"`
 
+	// SendMode is either default (everyone at once) or a per-subscriber
+	// delivery schedule (campaign_schedule).
+	SendMode string `db:"send_mode" json:"send_mode"`
+
+	// Send throttling. ThrottleRate is the max messages per second and ThrottleCap
+	// is the max messages per ThrottleWindow (hour, day). 0 = unlimited.
+	ThrottleRate   int    `db:"throttle_rate" json:"throttle_rate"`
+	ThrottleCap    int    `db:"throttle_cap" json:"throttle_cap"`
+	ThrottleWindow string `db:"throttle_window" json:"throttle_window"`
+
+	// Recurring campaigns (RecurCron is set) are never sent themselves. On every
+	// run of the cron schedule, they're cloned into a new campaign (ParentID)
+	// that's sent, optionally filled with the new items of RecurFeedURL (FeedItems).
+	RecurCron       string    `db:"recur_cron" json:"recur_cron"`
+	RecurFeedURL    string    `db:"recur_feed_url" json:"recur_feed_url"`
+	RecurLastRunAt  null.Time `db:"recur_last_run_at" json:"recur_last_run_at"`
+	RecurLastItemAt null.Time `db:"recur_last_item_at" json:"recur_last_item_at"`
+	ParentID        null.Int  `db:"parent_id" json:"parent_id"`
+	FeedItems       FeedItems `db:"feed_items" json:"feed_items"`
+
+	// GUIDs of the items in the feed on the last run. Items seen before aren't sent again,
+	// which also covers feeds whose items aren't dated.
+	RecurLastItems pq.StringArray `db:"recur_last_items" json:"-"`
+
+	// Saved segments that narrow down the audience of the campaign's lists.
+	SegmentIDs pq.Int64Array `db:"segment_ids" json:"segment_ids"`
+
+	// A/B testing of the campaign's variants, if there are any.
+	ABStatus   null.String `db:"ab_status" json:"ab_status"`
+	ABMetric   string      `db:"ab_metric" json:"ab_metric"`
+	ABWait     string      `db:"ab_wait" json:"ab_wait"`
+	ABDecideAt null.Time   `db:"ab_decide_at" json:"ab_decide_at"`
+
 	// TemplateBody is joined in from templates by the next-campaigns query.
 	TemplateBody        string             `db:"template_body" json:"-"`
 	ArchiveTemplateBody string             `db:"archive_template_body" json:"-"`
@@ -260,6 +346,21 @@ type Campaign struct {
 	Total int `db:"total" json:"-"`
 }
 
+// FeedItem represents an item of an RSS or Atom feed that a recurring campaign is filled with.
+type FeedItem struct {
+	// GUID is the item's guid (RSS) or id (Atom), or if there's none, its URL or title.
+	GUID        string    `json:"guid"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Content     string    `json:"content"`
+	Author      string    `json:"author"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// FeedItems represents a list of feed items stored as JSON.
+type FeedItems []FeedItem
+
 // CampaignMeta contains fields tracking a campaign's progress.
 type CampaignMeta struct {
 	CampaignID int `db:"campaign_id" json:"-"`
@@ -289,6 +390,9 @@ type CampaignStats struct {
 	UpdatedAt null.Time `db:"updated_at" json:"updated_at"`
 	Rate      int       `json:"rate"`
 	NetRate   int       `json:"net_rate"`
+
+	// Progress of every time zone if the campaign is sent at subscribers' local time.
+	Zones types.JSONText `db:"zones" json:"zones"`
 }
 
 type CampaignAnalyticsCount struct {
@@ -302,6 +406,164 @@ type CampaignAnalyticsLink struct {
 	Count int    `db:"count" json:"count"`
 }
 
+// CampaignVariant represents an A/B test variant of a campaign's content that's
+// sent to a percentage of the campaign's audience before a winner is picked.
+type CampaignVariant struct {
+	Base
+
+	CampaignID int         `db:"campaign_id" json:"campaign_id"`
+	Name       string      `db:"name" json:"name"`
+	Subject    string      `db:"subject" json:"subject"`
+	Body       string      `db:"body" json:"body"`
+	AltBody    null.String `db:"altbody" json:"altbody"`
+	Percent    int         `db:"percent" json:"percent"`
+	Winner     bool        `db:"winner" json:"winner"`
+}
+
+// CampaignVariantCount represents the engagement counts of a campaign variant's sample.
+type CampaignVariantCount struct {
+	CampaignID  int    `db:"campaign_id" json:"campaign_id"`
+	VariantID   int    `db:"variant_id" json:"variant_id"`
+	Name        string `db:"name" json:"name"`
+	Percent     int    `db:"percent" json:"percent"`
+	Winner      bool   `db:"winner" json:"winner"`
+	Subscribers int    `db:"subscribers" json:"subscribers"`
+	Views       int    `db:"views" json:"views"`
+	Clicks      int    `db:"clicks" json:"clicks"`
+}
+
+// Sequence represents an ordered set of messages (steps) that are sent with
+// delays to subscribers who join its list.
+type Sequence struct {
+	Base
+
+	Name        string        `db:"name" json:"name"`
+	ListID      null.Int      `db:"list_id" json:"list_id"`
+	ListName    null.String   `db:"list_name" json:"list_name"`
+	Status      string        `db:"status" json:"status"`
+	ExitListIDs pq.Int64Array `db:"exit_list_ids" json:"exit_list_ids"`
+	FromEmail   string        `db:"from_email" json:"from_email"`
+	Messenger   string        `db:"messenger" json:"messenger"`
+
+	// Number of subscribers in the sequence by their status, eg: {"active": 10, "exited": 1}.
+	SubscriberCounts types.JSONText `db:"subscriber_counts" json:"subscriber_counts"`
+}
+
+// SunsetPolicy picks inactive subscribers, that is, those who haven't viewed or clicked
+// on any of the last Campaigns campaigns sent to them and any campaign in the last Days
+// days (0 to ignore either), and either unsubscribes them or moves them to ListID.
+type SunsetPolicy struct {
+	Campaigns int    `json:"campaigns"`
+	Days      int    `json:"days"`
+	Action    string `json:"action"`
+	ListID    int    `json:"list_id"`
+}
+
+// SubscriberEvent is a change to a subscriber or their subscriptions that's recorded
+// in their history, eg: an unsubscription, or an edit by an admin (UserID).
+type SubscriberEvent struct {
+	Type         string
+	Source       string
+	UserID       int
+	CampaignUUID string
+	ListIDs      []int
+	ListUUIDs    []string
+	Meta         JSON
+}
+
+// SubscriberActivity is an entry in the activity timeline of a subscriber.
+type SubscriberActivity struct {
+	Type         string          `db:"type" json:"type"`
+	Source       string          `db:"source" json:"source"`
+	CampaignID   null.Int        `db:"campaign_id" json:"campaign_id"`
+	CampaignName null.String     `db:"campaign_name" json:"campaign_name"`
+	ListID       null.Int        `db:"list_id" json:"list_id"`
+	ListName     null.String     `db:"list_name" json:"list_name"`
+	UserID       null.Int        `db:"user_id" json:"user_id"`
+	Username     null.String     `db:"username" json:"username"`
+	Meta         json.RawMessage `db:"meta" json:"meta"`
+	CreatedAt    null.Time       `db:"created_at" json:"created_at"`
+
+	Total int `db:"total" json:"-"`
+}
+
+// AuditLog is an entry in the audit log of changes made by users via the API.
+type AuditLog struct {
+	ID         int64           `db:"id" json:"id"`
+	UserID     null.Int        `db:"user_id" json:"user_id"`
+	Username   string          `db:"username" json:"username"`
+	IP         string          `db:"ip" json:"ip"`
+	Method     string          `db:"method" json:"method"`
+	Path       string          `db:"path" json:"path"`
+	Action     string          `db:"action" json:"action"`
+	EntityType string          `db:"entity_type" json:"entity_type"`
+	EntityID   string          `db:"entity_id" json:"entity_id"`
+	Status     int             `db:"status" json:"status"`
+	Before     json.RawMessage `db:"before" json:"before"`
+	After      json.RawMessage `db:"after" json:"after"`
+	CreatedAt  null.Time       `db:"created_at" json:"created_at"`
+
+	Total int `db:"total" json:"-"`
+}
+
+// Segment represents a saved, named filter of subscribers defined by a tree of rules.
+// Its members are periodically materialized and its count refreshed.
+type Segment struct {
+	Base
+
+	Name            string      `db:"name" json:"name"`
+	Description     string      `db:"description" json:"description"`
+	Rules           SegmentRule `db:"rules" json:"rules"`
+	SubscriberCount int         `db:"subscriber_count" json:"subscriber_count"`
+	RefreshedAt     null.Time   `db:"refreshed_at" json:"refreshed_at"`
+}
+
+// SegmentRule is a node in the rule tree of a segment. A node is either a group of
+// rules (Rules) that are all (Match=all) or any (Match=any) satisfied, or a
+// condition (Type) that compares Field with Value using Operator.
+type SegmentRule struct {
+	Match string        `json:"match,omitempty"`
+	Rules []SegmentRule `json:"rules,omitempty"`
+
+	Type     string          `json:"type,omitempty"`
+	Field    string          `json:"field,omitempty"`
+	Operator string          `json:"operator,omitempty"`
+	Value    json.RawMessage `json:"value,omitempty"`
+}
+
+// SequenceStep represents a message in a sequence that is sent DelayMins after
+// the previous step, or after the subscriber joins the sequence.
+type SequenceStep struct {
+	Base
+
+	SequenceID   int         `db:"sequence_id" json:"sequence_id"`
+	Position     int         `db:"position" json:"position"`
+	TemplateID   int         `db:"template_id" json:"template_id"`
+	TemplateName null.String `db:"template_name" json:"template_name"`
+	DelayMins    int         `db:"delay_mins" json:"delay_mins"`
+	ContentType  string      `db:"content_type" json:"content_type"`
+
+	// Number of subscribers who have been sent the step, and who are
+	// waiting to be sent it.
+	Sent    int `db:"sent" json:"sent"`
+	Waiting int `db:"waiting" json:"waiting"`
+}
+
+// SequenceMessage represents a subscriber who is due to be sent a sequence step.
+type SequenceMessage struct {
+	Subscriber
+
+	SequenceID  int    `db:"sequence_id"`
+	StepID      int    `db:"step_id"`
+	TemplateID  int    `db:"template_id"`
+	ContentType string `db:"content_type"`
+	FromEmail   string `db:"from_email"`
+	Messenger   string `db:"messenger"`
+
+	// Number of failed attempts to send the step so far.
+	Attempts int `db:"attempts"`
+}
+
 // Campaigns represents a slice of Campaigns.
 type Campaigns []Campaign
 
@@ -322,6 +584,14 @@ type Template struct {
 	Tpl        *template.Template `json:"-"`
 }
 
+// SMTPWarmup represents the stored warm-up state of an SMTP server.
+type SMTPWarmup struct {
+	UUID      string    `db:"uuid" json:"uuid"`
+	StartedOn time.Time `db:"started_on" json:"started_on"`
+	Day       time.Time `db:"day" json:"day"`
+	Sent      int       `db:"sent" json:"sent"`
+}
+
 // Bounce represents a single bounce event.
 type Bounce struct {
 	ID        int             `db:"id" json:"id"`
@@ -343,6 +613,96 @@ type Bounce struct {
 	Total int `db:"total" json:"-"`
 }
 
+// DeferredDelivery is a campaign message that failed to send and is retried later.
+type DeferredDelivery struct {
+	ID           int       `db:"id" json:"id"`
+	CampaignID   int       `db:"campaign_id" json:"campaign_id"`
+	SubscriberID int       `db:"subscriber_id" json:"subscriber_id"`
+	VariantID    null.Int  `db:"variant_id" json:"variant_id"`
+	Messenger    string    `db:"messenger" json:"messenger"`
+	Error        string    `db:"error" json:"error"`
+	Attempts     int       `db:"attempts" json:"attempts"`
+	Status       string    `db:"status" json:"status"`
+	NextRetryAt  time.Time `db:"next_retry_at" json:"next_retry_at"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+
+	SubscriberUUID string           `db:"subscriber_uuid" json:"subscriber_uuid,omitempty"`
+	Email          string           `db:"email" json:"email,omitempty"`
+	Campaign       *json.RawMessage `db:"campaign" json:"campaign,omitempty"`
+
+	// Pseudofield for getting the total number of deliveries
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// Delivery is the delivery log entry of a campaign message to a subscriber.
+type Delivery struct {
+	ID           int       `db:"id" json:"id"`
+	CampaignID   int       `db:"campaign_id" json:"campaign_id"`
+	SubscriberID int       `db:"subscriber_id" json:"subscriber_id"`
+	Messenger    string    `db:"messenger" json:"messenger"`
+	Server       string    `db:"server" json:"server"`
+	Response     string    `db:"response" json:"response"`
+	Status       string    `db:"status" json:"status"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+
+	SubscriberUUID string `db:"subscriber_uuid" json:"subscriber_uuid"`
+	Email          string `db:"email" json:"email"`
+
+	// Pseudofield for getting the total number of deliveries
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// CampaignApproval is an entry in the approval history of a campaign.
+type CampaignApproval struct {
+	ID         int       `db:"id" json:"id"`
+	CampaignID int       `db:"campaign_id" json:"campaign_id"`
+	UserID     null.Int  `db:"user_id" json:"user_id"`
+	Action     string    `db:"action" json:"action"`
+	Note       string    `db:"note" json:"note"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+
+	Username null.String `db:"username" json:"username"`
+	Name     null.String `db:"name" json:"name"`
+	Email    null.String `db:"email" json:"-"`
+}
+
+// Revision is a recorded change to the content of a campaign or a template.
+type Revision struct {
+	ID         int             `db:"id" json:"id"`
+	CampaignID null.Int        `db:"campaign_id" json:"campaign_id"`
+	TemplateID null.Int        `db:"template_id" json:"template_id"`
+	UserID     null.Int        `db:"user_id" json:"user_id"`
+	Fields     pq.StringArray  `db:"fields" json:"fields"`
+	Data       json.RawMessage `db:"data" json:"data,omitempty"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+
+	Username null.String `db:"username" json:"username"`
+	Name     null.String `db:"name" json:"name"`
+
+	// Pseudofield for getting the total number of revisions
+	// in searches and queries.
+	Total int `db:"total" json:"-"`
+}
+
+// RevisionDiff is the difference in a field between two revisions. For text
+// fields, Lines has the line-wise diff.
+type RevisionDiff struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+	Lines []DiffLine      `json:"lines,omitempty"`
+}
+
+// DiffLine is a line in a diff. Op is one of "=" (unchanged), "-" (removed), or "+" (added).
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
 // Message is the message pushed to a Messenger.
 type Message struct {
 	From        string
@@ -695,6 +1055,45 @@ func (s Subscriber) LastName() string {
 	return s.Name
 }
 
+// Scan implements the sql.Scanner interface.
+func (r *SegmentRule) Scan(src any) error {
+	var b []byte
+	switch src := src.(type) {
+	case []byte:
+		b = src
+	case string:
+		b = []byte(src)
+	case nil:
+		return nil
+	}
+
+	return json.Unmarshal(b, r)
+}
+
+// Scan implements the sql.Scanner interface.
+func (f *FeedItems) Scan(src any) error {
+	var b []byte
+	switch src := src.(type) {
+	case []byte:
+		b = src
+	case string:
+		b = []byte(src)
+	case nil:
+		return nil
+	}
+
+	return json.Unmarshal(b, f)
+}
+
+// Value implements the driver.Valuer interface.
+func (f FeedItems) Value() (driver.Value, error) {
+	if len(f) == 0 {
+		return "[]", nil
+	}
+
+	return json.Marshal(f)
+}
+
 // Scan implements the sql.Scanner interface.
 func (h *Headers) Scan(src any) error {
 	var b []byte
@@ -49,6 +49,19 @@ type Queries struct {
 	DeleteSubscriptionsByQuery             string     `query:"delete-subscriptions-by-query"`
 	UnsubscribeSubscribersFromListsByQuery string     `query:"unsubscribe-subscribers-from-lists-by-query"`
 
+	UpdateEngagementScores *sqlx.Stmt `query:"update-engagement-scores"`
+	SunsetSubscribersTpl   string     `query:"sunset-subscribers-template"`
+	GetSunsetSubscribers   string     `query:"get-sunset-subscribers"`
+	SunsetSubscribers      string     `query:"sunset-subscribers"`
+
+	AddSubscriberEvents        *sqlx.Stmt `query:"add-subscriber-events"`
+	AddSubscriberEventsByQuery string     `query:"add-subscriber-events-by-query"`
+	GetSubscriberActivity      *sqlx.Stmt `query:"get-subscriber-activity"`
+
+	AddAuditLog    *sqlx.Stmt `query:"add-audit-log"`
+	QueryAuditLog  *sqlx.Stmt `query:"query-audit-log"`
+	DeleteAuditLog *sqlx.Stmt `query:"delete-audit-log"`
+
 	CreateList      *sqlx.Stmt `query:"create-list"`
 	QueryLists      string     `query:"query-lists"`
 	GetLists        *sqlx.Stmt `query:"get-lists"`
@@ -84,10 +97,61 @@ type Queries struct {
 	UpdateCampaign           *sqlx.Stmt `query:"update-campaign"`
 	UpdateCampaignStatus     *sqlx.Stmt `query:"update-campaign-status"`
 	UpdateCampaignCounts     *sqlx.Stmt `query:"update-campaign-counts"`
+	UpdateCampaignSent       *sqlx.Stmt `query:"update-campaign-sent"`
 	UpdateCampaignArchive    *sqlx.Stmt `query:"update-campaign-archive"`
 	RegisterCampaignView     *sqlx.Stmt `query:"register-campaign-view"`
 	DeleteCampaign           *sqlx.Stmt `query:"delete-campaign"`
 
+	ScheduleCampaignSubscribers *sqlx.Stmt `query:"schedule-campaign-subscribers"`
+	NextScheduledSubscribers    *sqlx.Stmt `query:"next-scheduled-subscribers"`
+	GetCampaignSchedulePending  *sqlx.Stmt `query:"get-campaign-schedule-pending"`
+
+	GetDryRunSubscribers *sqlx.Stmt `query:"get-dry-run-subscribers"`
+
+	AddCampaignApproval        *sqlx.Stmt `query:"add-campaign-approval"`
+	InvalidateCampaignApproval *sqlx.Stmt `query:"invalidate-campaign-approval"`
+	GetCampaignApprovals       *sqlx.Stmt `query:"get-campaign-approvals"`
+	GetCampaignApprovers       *sqlx.Stmt `query:"get-campaign-approvers"`
+
+	AddRevision  *sqlx.Stmt `query:"add-revision"`
+	GetRevisions *sqlx.Stmt `query:"get-revisions"`
+	GetRevision  *sqlx.Stmt `query:"get-revision"`
+
+	GetRecurringCampaigns    *sqlx.Stmt `query:"get-recurring-campaigns"`
+	UpdateCampaignRecurrence *sqlx.Stmt `query:"update-campaign-recurrence"`
+
+	GetCampaignVariants       *sqlx.Stmt `query:"get-campaign-variants"`
+	CreateCampaignVariant     *sqlx.Stmt `query:"create-campaign-variant"`
+	UpdateCampaignVariant     *sqlx.Stmt `query:"update-campaign-variant"`
+	DeleteCampaignVariant     *sqlx.Stmt `query:"delete-campaign-variant"`
+	AssignCampaignVariants    *sqlx.Stmt `query:"assign-campaign-variants"`
+	NextVariantSubscribers    *sqlx.Stmt `query:"next-variant-subscribers"`
+	UpdateCampaignABStatus    *sqlx.Stmt `query:"update-campaign-ab-status"`
+	PickCampaignVariantWinner *sqlx.Stmt `query:"pick-campaign-variant-winner"`
+	GetCampaignVariantCounts  *sqlx.Stmt `query:"get-campaign-variant-counts"`
+
+	GetSequences              *sqlx.Stmt `query:"get-sequences"`
+	CreateSequence            *sqlx.Stmt `query:"create-sequence"`
+	UpdateSequence            *sqlx.Stmt `query:"update-sequence"`
+	UpdateSequenceStatus      *sqlx.Stmt `query:"update-sequence-status"`
+	DeleteSequence            *sqlx.Stmt `query:"delete-sequence"`
+	GetSequenceSteps          *sqlx.Stmt `query:"get-sequence-steps"`
+	CreateSequenceStep        *sqlx.Stmt `query:"create-sequence-step"`
+	UpdateSequenceStep        *sqlx.Stmt `query:"update-sequence-step"`
+	DeleteSequenceStep        *sqlx.Stmt `query:"delete-sequence-step"`
+	AddSequenceSubscribers    *sqlx.Stmt `query:"add-sequence-subscribers"`
+	ExitSequenceSubscribers   *sqlx.Stmt `query:"exit-sequence-subscribers"`
+	NextSequenceMessages      *sqlx.Stmt `query:"next-sequence-messages"`
+	AdvanceSequenceSubscriber *sqlx.Stmt `query:"advance-sequence-subscriber"`
+	FailSequenceSubscriber    *sqlx.Stmt `query:"fail-sequence-subscriber"`
+
+	GetSegments             *sqlx.Stmt `query:"get-segments"`
+	CreateSegment           *sqlx.Stmt `query:"create-segment"`
+	UpdateSegment           *sqlx.Stmt `query:"update-segment"`
+	DeleteSegment           *sqlx.Stmt `query:"delete-segment"`
+	RefreshSegment          string     `query:"refresh-segment"`
+	CountSegmentSubscribers string     `query:"count-segment-subscribers"`
+
 	InsertMedia *sqlx.Stmt `query:"insert-media"`
 	GetMedia    *sqlx.Stmt `query:"get-media"`
 	QueryMedia  *sqlx.Stmt `query:"query-media"`
@@ -102,8 +166,15 @@ type Queries struct {
 	CreateLink        *sqlx.Stmt `query:"create-link"`
 	RegisterLinkClick *sqlx.Stmt `query:"register-link-click"`
 
-	GetSettings    *sqlx.Stmt `query:"get-settings"`
-	UpdateSettings *sqlx.Stmt `query:"update-settings"`
+	GetSettings     *sqlx.Stmt `query:"get-settings"`
+	UpdateSettings  *sqlx.Stmt `query:"update-settings"`
+	IsValidTimezone *sqlx.Stmt `query:"is-valid-timezone"`
+
+	GetSMTPWarmups   *sqlx.Stmt `query:"get-smtp-warmups"`
+	UpdateSMTPWarmup *sqlx.Stmt `query:"update-smtp-warmup"`
+
+	GetSendLimitCount *sqlx.Stmt `query:"get-send-limit-count"`
+	AddSendLimitCount *sqlx.Stmt `query:"add-send-limit-count"`
 
 	// GetStats *sqlx.Stmt `query:"get-stats"`
 	RecordBounce              *sqlx.Stmt `query:"record-bounce"`
@@ -112,15 +183,50 @@ type Queries struct {
 	DeleteBouncesBySubscriber *sqlx.Stmt `query:"delete-bounces-by-subscriber"`
 	GetDBInfo                 string     `query:"get-db-info"`
 
+	DeferDelivery            *sqlx.Stmt `query:"defer-delivery"`
+	GetDueDeferredDeliveries *sqlx.Stmt `query:"get-due-deferred-deliveries"`
+	UpdateDeferredDelivery   *sqlx.Stmt `query:"update-deferred-delivery"`
+	RetryDeferredDeliveries  *sqlx.Stmt `query:"retry-deferred-deliveries"`
+	DeleteDeferredDeliveries *sqlx.Stmt `query:"delete-deferred-deliveries"`
+	QueryDeferredDeliveries  string     `query:"query-deferred-deliveries"`
+
+	LogDelivery             *sqlx.Stmt `query:"log-delivery"`
+	QueryCampaignDeliveries string     `query:"query-campaign-deliveries"`
+	DeleteDeliveries        *sqlx.Stmt `query:"delete-deliveries"`
+
 	CreateUser        *sqlx.Stmt `query:"create-user"`
 	UpdateUser        *sqlx.Stmt `query:"update-user"`
 	UpdateUserProfile *sqlx.Stmt `query:"update-user-profile"`
 	UpdateUserLogin   *sqlx.Stmt `query:"update-user-login"`
+	UpdateUserRoles   *sqlx.Stmt `query:"update-user-roles"`
 	DeleteUsers       *sqlx.Stmt `query:"delete-users"`
 	GetUsers          *sqlx.Stmt `query:"get-users"`
 	GetUser           *sqlx.Stmt `query:"get-user"`
 	GetAPITokens      *sqlx.Stmt `query:"get-api-tokens"`
 	LoginUser         *sqlx.Stmt `query:"login-user"`
+	SetUserTOTPSecret *sqlx.Stmt `query:"set-user-totp-secret"`
+	EnableUserTOTP    *sqlx.Stmt `query:"enable-user-totp"`
+	ResetUserTOTP     *sqlx.Stmt `query:"reset-user-totp"`
+	UseUserTOTPCode   *sqlx.Stmt `query:"use-user-totp-recovery-code"`
+	UseUserTOTPStep   *sqlx.Stmt `query:"use-user-totp-step"`
+	AddUserTOTPFail   *sqlx.Stmt `query:"add-user-totp-failure"`
+
+	GetUserAPITokens    *sqlx.Stmt `query:"get-user-api-tokens"`
+	CreateAPIToken      *sqlx.Stmt `query:"create-api-token"`
+	DeleteAPIToken      *sqlx.Stmt `query:"delete-api-token"`
+	UpdateAPITokenUsage *sqlx.Stmt `query:"update-api-token-usage"`
+
+	CreatePasswordReset    *sqlx.Stmt `query:"create-password-reset"`
+	GetPasswordResetCounts *sqlx.Stmt `query:"get-password-reset-counts"`
+	GetPasswordReset       *sqlx.Stmt `query:"get-password-reset"`
+	ResetUserPassword      *sqlx.Stmt `query:"reset-user-password"`
+
+	GetLoginFailures    *sqlx.Stmt `query:"get-login-failures"`
+	UpsertLoginFailures *sqlx.Stmt `query:"upsert-login-failures"`
+	DeleteLoginFailures *sqlx.Stmt `query:"delete-login-failures"`
+
+	GetUserSessions    *sqlx.Stmt `query:"get-user-sessions"`
+	DeleteUserSessions *sqlx.Stmt `query:"delete-user-sessions"`
 
 	CreateRole            *sqlx.Stmt `query:"create-role"`
 	GetUserRoles          *sqlx.Stmt `query:"get-user-roles"`
@@ -14,6 +14,7 @@ type Settings struct {
 	SendOptinConfirmation         bool     `json:"app.send_optin_confirmation"`
 	CheckUpdates                  bool     `json:"app.check_updates"`
 	AppLang                       string   `json:"app.lang"`
+	AppDefaultTimezone            string   `json:"app.default_timezone"`
 
 	AppBatchSize             int    `json:"app.batch_size"`
 	AppConcurrency           int    `json:"app.concurrency"`
@@ -26,6 +27,37 @@ type Settings struct {
 	AppMessageSlidingWindowDuration string `json:"app.message_sliding_window_duration"`
 	AppMessageSlidingWindowRate     int    `json:"app.message_sliding_window_rate"`
 
+	AppMessengerLimits []struct {
+		Messenger string `json:"messenger"`
+		Rate      int    `json:"rate"`
+		Cap       int    `json:"cap"`
+		Window    string `json:"window"`
+	} `json:"app.messenger_limits"`
+
+	// Max retries of a deferred (failed) campaign message, and the backoff before
+	// the first retry that doubles on every attempt.
+	AppRetryMaxAttempts int    `json:"app.retry_max_attempts"`
+	AppRetryBackoff     string `json:"app.retry_backoff"`
+
+	// Per-recipient delivery log of campaigns, and the days to keep it for (0 = forever).
+	AppDeliveryLog          bool `json:"app.delivery_log"`
+	AppDeliveryLogRetention int  `json:"app.delivery_log_retention"`
+
+	// Require campaigns to be approved by a second user before they're sent.
+	AppCampaignApproval bool `json:"app.campaign_approval"`
+
+	// Interval at which the members of saved segments are refreshed.
+	AppSegmentRefreshInterval string `json:"app.segment_refresh_interval"`
+
+	// Half-life (days) of the weights of the events in engagement scores, and the
+	// policy for automatically sunsetting inactive subscribers.
+	AppEngagementHalfLife int    `json:"app.engagement_half_life"`
+	AppSunsetEnabled      bool   `json:"app.sunset_enabled"`
+	AppSunsetCampaigns    int    `json:"app.sunset_campaigns"`
+	AppSunsetDays         int    `json:"app.sunset_days"`
+	AppSunsetAction       string `json:"app.sunset_action"`
+	AppSunsetListID       int    `json:"app.sunset_list_id"`
+
 	PrivacyIndividualTracking bool     `json:"privacy.individual_tracking"`
 	PrivacyUnsubHeader        bool     `json:"privacy.unsubscribe_header"`
 	PrivacyAllowBlocklist     bool     `json:"privacy.allow_blocklist"`
@@ -41,14 +73,54 @@ type Settings struct {
 	SecurityCaptchaKey    string `json:"security.captcha_key"`
 	SecurityCaptchaSecret string `json:"security.captcha_secret"`
 
+	// Days to keep the audit log of changes made by users for (0 = forever).
+	SecurityAuditLogRetention int `json:"security.audit_log_retention"`
+
+	// Users who must use two-factor authentication (off, all, roles) and
+	// the user roles it's required for when it's roles.
+	SecurityTOTPRequired      string `json:"security.totp_required"`
+	SecurityTOTPRequiredRoles []int  `json:"security.totp_required_roles"`
+
+	// Failed login attempts per username and per IP after which they're locked
+	// out for the lockout duration (0 = no limit).
+	SecurityLoginMaxAttempts     int    `json:"security.login_max_attempts"`
+	SecurityLoginMaxIPAttempts   int    `json:"security.login_max_ip_attempts"`
+	SecurityLoginLockoutDuration string `json:"security.login_lockout_duration"`
+
 	OIDC struct {
 		Enabled      bool   `json:"enabled"`
 		ProviderURL  string `json:"provider_url"`
 		ProviderName string `json:"provider_name"`
 		ClientID     string `json:"client_id"`
 		ClientSecret string `json:"client_secret"`
+
+		// Create users on their first login with the roles mapped from their
+		// claims, or the default role if no claim is mapped.
+		AutoCreateUsers   bool             `json:"auto_create_users"`
+		DefaultUserRoleID int              `json:"default_user_role_id"`
+		RoleMappings      []SSORoleMapping `json:"role_mappings"`
 	} `json:"security.oidc"`
 
+	SAML struct {
+		Enabled        bool   `json:"enabled"`
+		ProviderName   string `json:"provider_name"`
+		IDPMetadataURL string `json:"idp_metadata_url"`
+		IDPMetadata    string `json:"idp_metadata"`
+		SPCertificate  string `json:"sp_certificate"`
+		SPPrivateKey   string `json:"sp_private_key"`
+
+		// Names of the assertion attributes that carry the user's details.
+		AttrEmail  string `json:"attr_email"`
+		AttrName   string `json:"attr_name"`
+		AttrGroups string `json:"attr_groups"`
+
+		// Create users on their first login with the roles mapped from their
+		// attributes, or the default role if no attribute is mapped.
+		AutoCreateUsers   bool             `json:"auto_create_users"`
+		DefaultUserRoleID int              `json:"default_user_role_id"`
+		RoleMappings      []SSORoleMapping `json:"role_mappings"`
+	} `json:"security.saml"`
+
 	UploadProvider             string   `json:"upload.provider"`
 	UploadExtensions           []string `json:"upload.extensions"`
 	UploadFilesystemUploadPath string   `json:"upload.filesystem.upload_path"`
@@ -81,6 +153,16 @@ type Settings struct {
 		WaitTimeout   string              `json:"wait_timeout"`
 		TLSType       string              `json:"tls_type"`
 		TLSSkipVerify bool                `json:"tls_skip_verify"`
+
+		// Daily send ceilings of a new server that ramp up every day, eg: [500, 1000, 2000].
+		WarmupSchedule []int `json:"warmup_schedule"`
+
+		// Routing of messages across servers by weight and recipient domains, and
+		// the consecutive errors after which a server is taken out of rotation.
+		Weight           int      `json:"weight"`
+		Domains          []string `json:"domains"`
+		CooldownErrors   int      `json:"cooldown_errors"`
+		CooldownDuration string   `json:"cooldown_duration"`
 	} `json:"smtp"`
 
 	Messengers []struct {
@@ -133,3 +215,13 @@ type Settings struct {
 	PublicCustomCSS string `json:"appearance.public.custom_css"`
 	PublicCustomJS  string `json:"appearance.public.custom_js"`
 }
+
+// SSORoleMapping assigns a user role, and optionally a list role, to SSO users who
+// have a value in an OIDC claim or a SAML attribute. Without a claim, the groups
+// claim or attribute is matched.
+type SSORoleMapping struct {
+	Claim      string `json:"claim"`
+	Value      string `json:"value"`
+	UserRoleID int    `json:"user_role_id"`
+	ListRoleID int    `json:"list_role_id"`
+}
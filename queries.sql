@@ -426,6 +426,182 @@ UPDATE subscriber_lists SET status='unsubscribed', updated_at=NOW()
     WHERE (subscriber_id, list_id) = ANY(SELECT a, b FROM UNNEST(ARRAY(SELECT id FROM subs)) a, UNNEST($5::INT[]) b);
 
 
+-- engagement
+-- name: update-engagement-scores
+-- Recomputes the engagement scores of subscribers from their campaign views (1), link clicks (3),
+-- and bounces (soft -2, hard -10, complaint -20), where the weight of every event halves every
+-- $1 days. Only the scores that have changed are updated.
+WITH events AS (
+    SELECT subscriber_id, 1::DOUBLE PRECISION AS weight, created_at FROM campaign_views WHERE subscriber_id IS NOT NULL
+    UNION ALL
+    SELECT subscriber_id, 3::DOUBLE PRECISION AS weight, created_at FROM link_clicks WHERE subscriber_id IS NOT NULL
+    UNION ALL
+    SELECT subscriber_id,
+        (CASE type WHEN 'hard' THEN -10 WHEN 'complaint' THEN -20 ELSE -2 END)::DOUBLE PRECISION AS weight, created_at
+    FROM bounces
+),
+scores AS (
+    SELECT subscriber_id, ROUND(SUM(
+        weight * POWER(0.5, EXTRACT(EPOCH FROM NOW() - created_at)::DOUBLE PRECISION / 86400 / $1::INT)
+    )::NUMERIC, 2)::DOUBLE PRECISION AS score
+    FROM events GROUP BY subscriber_id
+)
+UPDATE subscribers SET engagement_score = COALESCE(scores.score, 0)
+    FROM subscribers s LEFT JOIN scores ON (scores.subscriber_id = s.id)
+    WHERE subscribers.id = s.id AND subscribers.engagement_score != COALESCE(scores.score, 0);
+
+-- name: sunset-subscribers-template
+-- raw: true
+-- Inactive subscribers as per a sunset policy: enabled subscribers with subscriptions (other than
+-- to the re-engagement list, $3) who haven't viewed or clicked on any of the last $1 campaigns sent
+-- to their lists, nor on anything in the last $2 days. 0 ignores either condition.
+-- It's embedded in other queries, and for the same reason, it is not terminated with a semicolon.
+SELECT s.id FROM subscribers s
+WHERE s.status = 'enabled'
+    AND ($1::INT > 0 OR $2::INT > 0)
+    AND EXISTS (
+        SELECT 1 FROM subscriber_lists sl WHERE sl.subscriber_id = s.id AND sl.status != 'unsubscribed' AND sl.list_id != $3::INT
+    )
+    AND ($1::INT = 0 OR (
+        SELECT COUNT(*) = $1::INT AND NOT BOOL_OR(last.engaged) FROM (
+            SELECT (
+                EXISTS (SELECT 1 FROM campaign_views v WHERE v.campaign_id = c.id AND v.subscriber_id = s.id)
+                OR EXISTS (SELECT 1 FROM link_clicks lc WHERE lc.campaign_id = c.id AND lc.subscriber_id = s.id)
+            ) AS engaged
+            FROM campaigns c
+            WHERE c.type = 'regular' AND c.status IN ('running', 'finished') AND c.started_at > s.created_at
+            AND EXISTS (
+                SELECT 1 FROM campaign_lists cl JOIN subscriber_lists sl ON (sl.list_id = cl.list_id)
+                WHERE cl.campaign_id = c.id AND sl.subscriber_id = s.id
+            )
+            ORDER BY c.started_at DESC LIMIT $1::INT
+        ) last
+    ))
+    AND ($2::INT = 0 OR (
+        s.created_at < NOW() - MAKE_INTERVAL(days => $2::INT)
+        AND NOT EXISTS (
+            SELECT 1 FROM campaign_views v WHERE v.subscriber_id = s.id AND v.created_at > NOW() - MAKE_INTERVAL(days => $2::INT)
+        )
+        AND NOT EXISTS (
+            SELECT 1 FROM link_clicks lc WHERE lc.subscriber_id = s.id AND lc.created_at > NOW() - MAKE_INTERVAL(days => $2::INT)
+        )
+    ))
+
+-- name: get-sunset-subscribers
+-- raw: true
+-- Returns the subscribers that a sunset policy would affect ($4 at most) along with their total count.
+WITH subs AS (%query%)
+SELECT COUNT(*) OVER () AS total, subscribers.* FROM subscribers
+    WHERE id = ANY(SELECT id FROM subs) ORDER BY id LIMIT $4;
+
+-- name: sunset-subscribers
+-- raw: true
+-- Unsubscribes the subscribers that a sunset policy picks from all their lists, and if the
+-- action ($4) is 'move', subscribes them to the re-engagement list ($3).
+WITH subs AS (%query%),
+mv AS (
+    INSERT INTO subscriber_lists (subscriber_id, list_id, status)
+        SELECT id, $3::INT, 'confirmed' FROM subs WHERE $4 = 'move'
+    ON CONFLICT (subscriber_id, list_id) DO UPDATE SET status = 'confirmed', updated_at = NOW()
+),
+u AS (
+    UPDATE subscriber_lists SET status = 'unsubscribed', updated_at = NOW()
+        WHERE subscriber_id = ANY(SELECT id FROM subs) AND list_id != $3::INT AND status != 'unsubscribed'
+)
+SELECT COUNT(*) FROM subs;
+
+
+-- subscriber activity
+-- name: add-subscriber-events
+-- Records an event against subscribers by ID ($1) or UUID ($2). The lists that the event
+-- concerns, by ID ($8) or UUID ($9), are recorded in the meta along with their names
+-- as they may be renamed or deleted later.
+INSERT INTO subscriber_events (subscriber_id, type, source, user_id, campaign_id, meta)
+    SELECT s.id, $3::subscriber_event_type, $4, NULLIF($5, 0),
+        (SELECT id FROM campaigns WHERE uuid = NULLIF($6, '')::UUID),
+        $7::JSONB || (CASE WHEN CARDINALITY($8::INT[]) = 0 AND CARDINALITY($9::UUID[]) = 0 THEN '{}'::JSONB
+            ELSE JSONB_BUILD_OBJECT('lists', (
+                SELECT COALESCE(JSONB_AGG(JSONB_BUILD_OBJECT('id', l.id, 'name', l.name)), '[]')
+                FROM lists l WHERE l.id = ANY($8::INT[]) OR l.uuid = ANY($9::UUID[])
+            )) END)
+    FROM subscribers s WHERE s.id = ANY($1::INT[]) OR s.uuid = ANY($2::UUID[]);
+
+-- name: add-subscriber-events-by-query
+-- raw: true
+-- Records an event ($5) against the subscribers who match a query. Args are the same as add-subscriber-events.
+WITH subs AS (%query%)
+INSERT INTO subscriber_events (subscriber_id, type, source, user_id, meta)
+    SELECT subs.id, $5::subscriber_event_type, $6, NULLIF($7, 0),
+        $8::JSONB || (CASE WHEN CARDINALITY($9::INT[]) = 0 THEN '{}'::JSONB
+            ELSE JSONB_BUILD_OBJECT('lists', (
+                SELECT COALESCE(JSONB_AGG(JSONB_BUILD_OBJECT('id', l.id, 'name', l.name)), '[]')
+                FROM lists l WHERE l.id = ANY($9::INT[])
+            )) END)
+    FROM subs;
+
+-- name: get-subscriber-activity
+-- Retrieves the chronological timeline of a subscriber ($1), latest first, assembled from
+-- their subscriptions, delivery log, views, clicks, bounces, and recorded events.
+-- $2 optionally filters by the types of activity.
+WITH act AS (
+    SELECT 'created' AS type, '' AS source, NULL::INT AS campaign_id, NULL::INT AS list_id,
+        NULL::INT AS user_id, '{}'::JSONB AS meta, created_at
+        FROM subscribers WHERE id = $1
+    UNION ALL
+    SELECT 'subscription', '', NULL, list_id, NULL,
+        JSONB_BUILD_OBJECT('status', status, 'updated_at', updated_at), created_at
+        FROM subscriber_lists WHERE subscriber_id = $1
+    UNION ALL
+    SELECT 'campaign', messenger, campaign_id, NULL, NULL,
+        JSONB_BUILD_OBJECT('status', status, 'server', server), created_at
+        FROM deliveries WHERE subscriber_id = $1
+    UNION ALL
+    SELECT 'view', '', campaign_id, NULL, NULL, '{}'::JSONB, created_at
+        FROM campaign_views WHERE subscriber_id = $1
+    UNION ALL
+    SELECT 'click', '', k.campaign_id, NULL, NULL, JSONB_BUILD_OBJECT('url', links.url), k.created_at
+        FROM link_clicks k LEFT JOIN links ON (links.id = k.link_id) WHERE k.subscriber_id = $1
+    UNION ALL
+    SELECT 'bounce', source, campaign_id, NULL, NULL, JSONB_BUILD_OBJECT('type', type, 'meta', meta), created_at
+        FROM bounces WHERE subscriber_id = $1
+    UNION ALL
+    SELECT type::TEXT, source, campaign_id, NULL, user_id, meta, created_at
+        FROM subscriber_events WHERE subscriber_id = $1
+)
+SELECT COUNT(*) OVER () AS total, act.*, c.name AS campaign_name, l.name AS list_name, u.username
+    FROM act
+    LEFT JOIN campaigns c ON (c.id = act.campaign_id)
+    LEFT JOIN lists l ON (l.id = act.list_id)
+    LEFT JOIN users u ON (u.id = act.user_id)
+    WHERE (CARDINALITY($2::TEXT[]) = 0 OR act.type = ANY($2::TEXT[]))
+    ORDER BY act.created_at DESC
+    OFFSET $3 LIMIT (CASE WHEN $4 < 1 THEN NULL ELSE $4 END);
+
+
+
+-- audit log
+-- name: add-audit-log
+INSERT INTO audit_log (user_id, username, ip, method, path, action, entity_type, entity_id, status, before, after)
+    VALUES(NULLIF($1, 0), $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10::TEXT, '')::JSONB, NULLIF($11::TEXT, '')::JSONB);
+
+-- name: query-audit-log
+-- Retrieves audit log entries, latest first, optionally filtered by the user ($1), entity type ($2)
+-- and ID ($3), action prefix ($4), and the time range ($5, $6).
+SELECT COUNT(*) OVER () AS total, audit_log.* FROM audit_log
+    WHERE ($1 = 0 OR user_id = $1)
+    AND ($2 = '' OR entity_type = $2)
+    AND ($3 = '' OR entity_id = $3)
+    AND ($4 = '' OR action LIKE $4 || '%')
+    AND ($5::TIMESTAMP WITH TIME ZONE IS NULL OR created_at >= $5)
+    AND ($6::TIMESTAMP WITH TIME ZONE IS NULL OR created_at < $6)
+    ORDER BY created_at DESC, id DESC
+    OFFSET $7 LIMIT (CASE WHEN $8 < 1 THEN NULL ELSE $8 END);
+
+-- name: delete-audit-log
+DELETE FROM audit_log WHERE created_at < $1;
+
+
+
 -- lists
 -- name: get-lists
 SELECT * FROM lists WHERE (CASE WHEN $1 = '' THEN 1=1 ELSE type=$1::list_type END)
@@ -535,11 +711,15 @@ counts AS (
         (l.optin = 'double' AND sl.status = 'confirmed') OR
         (l.optin != 'double' AND sl.status != 'unsubscribed')
       )
+      -- If segments are given, only count the subscribers in them.
+      AND (CARDINALITY($31::INT[]) = 0 OR EXISTS (SELECT 1 FROM segment_subscribers ss WHERE ss.subscriber_id = s.id AND ss.segment_id = ANY($31::INT[])))
 ),
 camp AS (
     INSERT INTO campaigns (uuid, type, name, subject, from_email, body, altbody,
         content_type, send_at, headers, tags, messenger, template_id, to_send,
-        max_subscriber_id, archive, archive_slug, archive_template_id, archive_meta, body_source)
+        max_subscriber_id, archive, archive_slug, archive_template_id, archive_meta, body_source,
+        ab_metric, ab_wait, send_mode, recur_cron, recur_feed_url, parent_id, feed_items,
+        throttle_rate, throttle_cap, throttle_window, segment_ids)
         SELECT $1, $2, $3, $4, $5,
             -- body
             COALESCE(NULLIF($6, ''), (SELECT body FROM tpl), ''),
@@ -554,7 +734,11 @@ camp AS (
             $17,
             $18,
             -- body_source
-            COALESCE($20, (SELECT body_source FROM tpl))
+            COALESCE($20, (SELECT body_source FROM tpl)),
+            $21::campaign_ab_metric, $22,
+            $23::campaign_send_mode,
+            $24, $25, $26, $27,
+            $28, $29, $30::throttle_window, $31::INT[]
         RETURNING id
 ),
 med AS (
@@ -677,7 +861,16 @@ LEFT JOIN templates ON (templates.id = (CASE WHEN $2=0 THEN campaigns.template_i
 WHERE campaigns.id = $1;
 
 -- name: get-campaign-status
-SELECT id, status, to_send, sent, started_at, updated_at FROM campaigns WHERE status=$1;
+-- zones is the progress of every time zone of campaigns that are sent at the local time of subscribers.
+SELECT id, status, to_send, sent, started_at, updated_at,
+    (
+        SELECT COALESCE(JSON_AGG(z ORDER BY z.send_at, z.timezone), '[]') FROM (
+            SELECT timezone, MIN(send_at) AS send_at, COUNT(*) AS to_send, COUNT(*) FILTER (WHERE sent) AS sent
+            FROM campaign_schedule WHERE campaign_id = campaigns.id AND timezone IS NOT NULL
+            GROUP BY timezone
+        ) z
+    ) AS zones
+FROM campaigns WHERE status=$1;
 
 -- name: campaign-has-lists
 -- Returns TRUE if the campaign $1 has any of the lists given in $2.
@@ -699,6 +892,21 @@ WITH camps AS (
     LEFT JOIN templates ON (templates.id = campaigns.template_id)
     WHERE (status='running' OR (status='scheduled' AND NOW() >= campaigns.send_at))
     AND NOT(campaigns.id = ANY($1::INT[]))
+    -- Recurring campaigns are never sent themselves, only their clones are.
+    AND campaigns.recur_cron = ''
+    -- Skip campaigns whose A/B test variants are awaiting the pick of a winner.
+    AND (campaigns.ab_status IS DISTINCT FROM 'waiting' OR NOW() >= campaigns.ab_decide_at)
+    -- Skip scheduled send campaigns that have no subscribers due yet. Those with
+    -- no pending subscribers are picked up so that they can be scheduled or finished.
+    AND (
+        campaigns.send_mode = 'default'
+        OR EXISTS (
+            SELECT 1 FROM campaign_schedule cs WHERE cs.campaign_id = campaigns.id AND NOT cs.sent AND cs.send_at <= NOW()
+        )
+        OR NOT EXISTS (
+            SELECT 1 FROM campaign_schedule cs WHERE cs.campaign_id = campaigns.id AND NOT cs.sent
+        )
+    )
 ),
 campLists AS (
     -- Get the list_ids and their optin statuses for the campaigns found in the previous step.
@@ -725,6 +933,8 @@ counts AS (
             END
         )
     JOIN subscribers s ON (s.id = sl.subscriber_id AND s.status != 'blocklisted')
+    -- Campaigns that target segments are only sent to the subscribers in them.
+    WHERE (CARDINALITY(camps.segment_ids) = 0 OR EXISTS (SELECT 1 FROM segment_subscribers ss WHERE ss.subscriber_id = s.id AND ss.segment_id = ANY(camps.segment_ids)))
     GROUP BY camps.id
 ),
 updateCounts AS (
@@ -815,6 +1025,9 @@ WITH campLists AS (
     LEFT JOIN campaign_lists ON campaign_lists.list_id = lists.id
     WHERE campaign_lists.campaign_id = $1
 ),
+campSegments AS (
+    SELECT segment_ids AS ids FROM campaigns WHERE id = $1
+),
 subs AS (
     SELECT s.*
     FROM (
@@ -830,6 +1043,12 @@ subs AS (
             AND s.id <= $4
              -- Subscriber should not be blacklisted.
             AND s.status != 'blocklisted'
+            -- Subscribers sampled for A/B test variants have already received the campaign.
+            AND NOT EXISTS (
+                SELECT 1 FROM campaign_variant_subscribers cvs WHERE cvs.campaign_id = $1 AND cvs.subscriber_id = s.id
+            )
+            -- If the campaign targets segments, the subscriber should be in one of them.
+            AND (CARDINALITY((SELECT ids FROM campSegments)) = 0 OR EXISTS (SELECT 1 FROM segment_subscribers ss WHERE ss.subscriber_id = s.id AND ss.segment_id = ANY((SELECT ids FROM campSegments))))
             AND (
                 -- If it's an optin campaign and the list is double-optin, only pick unconfirmed subscribers.
                 ($2 = 'optin' AND sl.status = 'unconfirmed' AND campLists.optin = 'double')
@@ -854,6 +1073,275 @@ u AS (
 )
 SELECT * FROM subs;
 
+-- name: get-dry-run-subscribers
+-- Returns a batch of subscribers that a campaign would be sent to after the given subscriber ID ($2)
+-- for a dry run. The conditions mirror next-campaign-subscribers, but the campaign's checkpoint
+-- isn't updated.
+WITH camp AS (
+    SELECT type, segment_ids FROM campaigns WHERE id = $1
+),
+campLists AS (
+    SELECT lists.id AS list_id, optin FROM lists
+    LEFT JOIN campaign_lists ON campaign_lists.list_id = lists.id
+    WHERE campaign_lists.campaign_id = $1
+)
+SELECT s.* FROM (
+    SELECT DISTINCT s.id
+    FROM subscriber_lists sl
+    JOIN campLists ON sl.list_id = campLists.list_id
+    JOIN subscribers s ON s.id = sl.subscriber_id
+    WHERE s.id > $2 AND s.status != 'blocklisted'
+        AND (CARDINALITY((SELECT segment_ids FROM camp)) = 0 OR EXISTS (SELECT 1 FROM segment_subscribers ss WHERE ss.subscriber_id = s.id AND ss.segment_id = ANY((SELECT segment_ids FROM camp))))
+        AND (
+            ((SELECT type FROM camp) = 'optin' AND sl.status = 'unconfirmed' AND campLists.optin = 'double')
+            OR (
+                (SELECT type FROM camp) != 'optin' AND (
+                    (campLists.optin = 'double' AND sl.status = 'confirmed') OR
+                    (campLists.optin != 'double' AND sl.status != 'unsubscribed')
+                )
+            )
+        )
+    ORDER BY s.id LIMIT $3
+) subIDs JOIN subscribers s ON (s.id = subIDs.id) ORDER BY s.id;
+
+-- name: schedule-campaign-subscribers
+-- Creates the per-subscriber delivery schedule of a campaign (send_mode != default) once, excluding
+-- subscribers sampled for A/B test variants.
+-- optimal: Every subscriber is scheduled at the next occurrence of the (UTC) hour of the day at which
+-- they have most viewed or clicked on campaigns in the past. Subscribers with no history are scheduled
+-- at the campaign's send_at.
+-- local: send_at's wall-clock time in the default time zone ($2) is the time at which every subscriber
+-- is sent to in their own time zone (attribs.timezone, or $2 if it's absent or invalid). Zones where
+-- the time has already passed at send_at are sent to the next day, rolling the campaign over ~24 hours.
+WITH camp AS (
+    SELECT id, type, send_mode, segment_ids, COALESCE(send_at, NOW()) AS send_at FROM campaigns
+    WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM campaign_schedule WHERE campaign_id = $1)
+),
+zones AS (
+    SELECT name FROM pg_timezone_names
+),
+audience AS (
+    SELECT DISTINCT sl.subscriber_id AS id, COALESCE(z.name, $2) AS timezone
+    FROM subscriber_lists sl
+    JOIN camp ON TRUE
+    JOIN campaign_lists cl ON (cl.list_id = sl.list_id AND cl.campaign_id = $1)
+    JOIN lists l ON (l.id = sl.list_id)
+    JOIN subscribers s ON (s.id = sl.subscriber_id AND s.status != 'blocklisted')
+    LEFT JOIN zones z ON (camp.send_mode = 'local' AND z.name = s.attribs->>'timezone')
+    WHERE (
+        CASE
+            WHEN camp.type = 'optin' THEN sl.status = 'unconfirmed' AND l.optin = 'double'
+            WHEN l.optin = 'double' THEN sl.status = 'confirmed'
+            ELSE sl.status != 'unsubscribed'
+        END
+    )
+    AND (CARDINALITY(camp.segment_ids) = 0 OR EXISTS (SELECT 1 FROM segment_subscribers ss WHERE ss.subscriber_id = sl.subscriber_id AND ss.segment_id = ANY(camp.segment_ids)))
+    AND NOT EXISTS (
+        SELECT 1 FROM campaign_variant_subscribers cvs WHERE cvs.campaign_id = $1 AND cvs.subscriber_id = sl.subscriber_id
+    )
+),
+hist AS (
+    SELECT subscriber_id, EXTRACT(HOUR FROM created_at AT TIME ZONE 'UTC')::INT AS hour FROM campaign_views
+        WHERE subscriber_id = ANY(SELECT id FROM audience) AND (SELECT send_mode FROM camp) = 'optimal'
+    UNION ALL
+    SELECT subscriber_id, EXTRACT(HOUR FROM created_at AT TIME ZONE 'UTC')::INT AS hour FROM link_clicks
+        WHERE subscriber_id = ANY(SELECT id FROM audience) AND (SELECT send_mode FROM camp) = 'optimal'
+),
+best AS (
+    -- The most active hour of every subscriber. Ties go to the earlier hour.
+    SELECT DISTINCT ON (subscriber_id) subscriber_id, hour FROM (
+        SELECT subscriber_id, hour, COUNT(*) AS num FROM hist GROUP BY subscriber_id, hour
+    ) h ORDER BY subscriber_id, num DESC, hour
+),
+slots AS (
+    SELECT a.id,
+        (CASE WHEN camp.send_mode = 'local' THEN a.timezone ELSE NULL END) AS timezone,
+        (CASE
+            WHEN camp.send_mode = 'local' THEN (camp.send_at AT TIME ZONE $2) AT TIME ZONE a.timezone
+            WHEN b.hour IS NOT NULL THEN (DATE_TRUNC('day', NOW() AT TIME ZONE 'UTC') + MAKE_INTERVAL(hours => b.hour)) AT TIME ZONE 'UTC'
+            ELSE NULL
+        END) AS slot,
+        -- Slots before this are moved to the next day.
+        (CASE WHEN camp.send_mode = 'local' THEN camp.send_at ELSE NOW() END) AS after
+    FROM audience a
+    JOIN camp ON TRUE
+    LEFT JOIN best b ON (b.subscriber_id = a.id)
+)
+INSERT INTO campaign_schedule (campaign_id, subscriber_id, timezone, send_at)
+    SELECT $1, slots.id, slots.timezone,
+        (CASE
+            WHEN slots.slot IS NULL THEN camp.send_at
+            WHEN slots.slot < slots.after THEN slots.slot + INTERVAL '1 day'
+            ELSE slots.slot
+        END)
+    FROM slots, camp
+ON CONFLICT DO NOTHING;
+
+-- name: next-scheduled-subscribers
+-- Returns a batch of subscribers of a running campaign whose scheduled delivery time is due
+-- and marks them as sent.
+WITH due AS (
+    SELECT cs.subscriber_id FROM campaign_schedule cs
+    JOIN campaigns c ON (c.id = cs.campaign_id AND c.status = 'running')
+    WHERE cs.campaign_id = $1 AND NOT cs.sent AND cs.send_at <= NOW()
+    ORDER BY cs.send_at, cs.subscriber_id LIMIT $2
+),
+u AS (
+    UPDATE campaign_schedule SET sent = true
+    WHERE campaign_id = $1 AND subscriber_id = ANY(SELECT subscriber_id FROM due)
+)
+SELECT s.* FROM subscribers s
+    JOIN due ON (due.subscriber_id = s.id)
+    WHERE s.status != 'blocklisted'
+    -- Skip subscribers who have unsubscribed since they were scheduled.
+    AND EXISTS (
+        SELECT 1 FROM subscriber_lists sl
+        JOIN campaign_lists cl ON (cl.list_id = sl.list_id AND cl.campaign_id = $1)
+        WHERE sl.subscriber_id = s.id AND sl.status != 'unsubscribed'
+    )
+    ORDER BY s.id;
+
+-- name: get-campaign-schedule-pending
+SELECT COUNT(*) FROM campaign_schedule WHERE campaign_id = $1 AND NOT sent;
+
+-- name: get-campaign-variants
+-- Returns all the variants of a campaign, or a particular one if $2 > 0.
+SELECT * FROM campaign_variants WHERE campaign_id = $1 AND ($2 = 0 OR id = $2) ORDER BY id;
+
+-- name: create-campaign-variant
+INSERT INTO campaign_variants (campaign_id, name, subject, body, altbody, percent)
+    VALUES($1, $2, $3, $4, (CASE WHEN $5 = '' THEN NULL ELSE $5 END), $6)
+    RETURNING id;
+
+-- name: update-campaign-variant
+UPDATE campaign_variants SET
+    name=$3,
+    subject=$4,
+    body=$5,
+    altbody=(CASE WHEN $6 = '' THEN NULL ELSE $6 END),
+    percent=$7,
+    updated_at=NOW()
+WHERE id = $1 AND campaign_id = $2;
+
+-- name: delete-campaign-variant
+DELETE FROM campaign_variants WHERE id = $1 AND campaign_id = $2;
+
+-- name: assign-campaign-variants
+-- Randomly samples subscribers from a campaign's audience and assigns them to the campaign's
+-- A/B test variants as per the percentage of each variant, and marks the campaign's test as started.
+-- The rest of the audience receives the winning variant later (pick-campaign-variant-winner).
+WITH camp AS (
+    SELECT id, type, segment_ids FROM campaigns WHERE id = $1
+),
+audience AS (
+    SELECT DISTINCT sl.subscriber_id AS id
+    FROM subscriber_lists sl
+    JOIN campaign_lists cl ON (cl.list_id = sl.list_id AND cl.campaign_id = $1)
+    JOIN lists l ON (l.id = sl.list_id)
+    JOIN subscribers s ON (s.id = sl.subscriber_id AND s.status != 'blocklisted')
+    WHERE (
+        CASE
+            WHEN (SELECT type FROM camp) = 'optin' THEN sl.status = 'unconfirmed' AND l.optin = 'double'
+            WHEN l.optin = 'double' THEN sl.status = 'confirmed'
+            ELSE sl.status != 'unsubscribed'
+        END
+    )
+    AND (CARDINALITY((SELECT segment_ids FROM camp)) = 0 OR EXISTS (SELECT 1 FROM segment_subscribers ss WHERE ss.subscriber_id = sl.subscriber_id AND ss.segment_id = ANY((SELECT segment_ids FROM camp))))
+),
+sample AS (
+    SELECT id, ROW_NUMBER() OVER (ORDER BY RANDOM()) AS n, COUNT(*) OVER () AS total FROM audience
+),
+vars AS (
+    -- Cumulative percentages of variants that slice the shuffled audience.
+    SELECT id, percent, SUM(percent) OVER (ORDER BY id) AS upto FROM campaign_variants WHERE campaign_id = $1
+),
+ins AS (
+    INSERT INTO campaign_variant_subscribers (campaign_id, variant_id, subscriber_id)
+        SELECT $1, vars.id, sample.id FROM sample
+        JOIN vars ON (
+            sample.n > FLOOR((vars.upto - vars.percent) * sample.total / 100.0)
+            AND sample.n <= FLOOR(vars.upto * sample.total / 100.0)
+        )
+    ON CONFLICT DO NOTHING
+)
+UPDATE campaigns SET ab_status='testing', updated_at=NOW() WHERE id = $1;
+
+-- name: next-variant-subscribers
+-- Returns the next batch of subscribers sampled for an A/B test variant of a running campaign
+-- starting from the variant's checkpoint (last_subscriber_id). Every fetch updates the checkpoint.
+WITH subs AS (
+    SELECT s.* FROM campaign_variant_subscribers cvs
+    JOIN campaign_variants v ON (v.id = cvs.variant_id)
+    JOIN campaigns c ON (c.id = v.campaign_id AND c.status = 'running')
+    JOIN subscribers s ON (s.id = cvs.subscriber_id AND s.status != 'blocklisted')
+    WHERE cvs.variant_id = $1 AND s.id > v.last_subscriber_id
+    ORDER BY s.id LIMIT $2
+),
+u AS (
+    UPDATE campaign_variants
+    SET last_subscriber_id = (SELECT MAX(id) FROM subs), updated_at = NOW()
+    WHERE (SELECT COUNT(id) FROM subs) > 0 AND id = $1
+)
+SELECT * FROM subs;
+
+-- name: update-campaign-ab-status
+UPDATE campaigns SET ab_status=$2::campaign_ab_status, ab_decide_at=$3, updated_at=NOW() WHERE id = $1;
+
+-- name: pick-campaign-variant-winner
+-- Picks the A/B test variant with the most unique views or clicks (campaigns.ab_metric) amongst
+-- its sampled subscribers, copies its content on to the campaign so that it's sent to the rest
+-- of the audience, and marks the test as done. Ties go to the variant created first.
+WITH camp AS (
+    SELECT id, ab_metric FROM campaigns WHERE id = $1
+),
+scores AS (
+    SELECT v.id, (
+        CASE WHEN (SELECT ab_metric FROM camp) = 'clicks' THEN (
+            SELECT COUNT(DISTINCT lc.subscriber_id) FROM link_clicks lc
+            JOIN campaign_variant_subscribers cvs ON (cvs.campaign_id = lc.campaign_id AND cvs.subscriber_id = lc.subscriber_id)
+            WHERE lc.campaign_id = $1 AND cvs.variant_id = v.id
+        )
+        ELSE (
+            SELECT COUNT(DISTINCT cv.subscriber_id) FROM campaign_views cv
+            JOIN campaign_variant_subscribers cvs ON (cvs.campaign_id = cv.campaign_id AND cvs.subscriber_id = cv.subscriber_id)
+            WHERE cv.campaign_id = $1 AND cvs.variant_id = v.id
+        )
+        END
+    ) AS score
+    FROM campaign_variants v WHERE v.campaign_id = $1
+),
+winner AS (
+    SELECT v.* FROM campaign_variants v
+    JOIN scores ON (scores.id = v.id)
+    ORDER BY scores.score DESC, v.id ASC LIMIT 1
+),
+vu AS (
+    UPDATE campaign_variants SET winner = (id = (SELECT id FROM winner)) WHERE campaign_id = $1
+),
+cu AS (
+    UPDATE campaigns SET subject=winner.subject, body=winner.body, altbody=winner.altbody,
+        ab_status='done', updated_at=NOW()
+    FROM winner WHERE campaigns.id = $1
+)
+SELECT * FROM winner;
+
+-- name: get-campaign-variant-counts
+-- Returns the number of sampled subscribers, and unique views and clicks from them for
+-- every A/B test variant of the given campaigns.
+SELECT v.campaign_id, v.id AS variant_id, v.name, v.percent, v.winner,
+    (SELECT COUNT(*) FROM campaign_variant_subscribers WHERE variant_id = v.id) AS subscribers,
+    (
+        SELECT COUNT(DISTINCT cv.subscriber_id) FROM campaign_views cv
+        JOIN campaign_variant_subscribers cvs ON (cvs.campaign_id = cv.campaign_id AND cvs.subscriber_id = cv.subscriber_id)
+        WHERE cv.campaign_id = v.campaign_id AND cvs.variant_id = v.id AND cv.created_at >= $2 AND cv.created_at <= $3
+    ) AS views,
+    (
+        SELECT COUNT(DISTINCT lc.subscriber_id) FROM link_clicks lc
+        JOIN campaign_variant_subscribers cvs ON (cvs.campaign_id = lc.campaign_id AND cvs.subscriber_id = lc.subscriber_id)
+        WHERE lc.campaign_id = v.campaign_id AND cvs.variant_id = v.id AND lc.created_at >= $2 AND lc.created_at <= $3
+    ) AS clicks
+FROM campaign_variants v WHERE v.campaign_id = ANY($1) ORDER BY v.campaign_id, v.id;
+
 -- name: delete-campaign-views
 DELETE FROM campaign_views WHERE created_at < $1;
 
@@ -880,7 +1368,7 @@ WITH camp AS (
         send_at=$8::TIMESTAMP WITH TIME ZONE,
         status=(
             CASE
-                WHEN status = 'scheduled' AND $8 IS NULL THEN 'draft'
+                WHEN status = 'scheduled' AND $8 IS NULL AND $23 = '' THEN 'draft'
                 ELSE status
             END
         ),
@@ -894,6 +1382,15 @@ WITH camp AS (
         archive_template_id=(CASE WHEN $7::content_type = 'visual' THEN NULL ELSE $16::INT END),
         archive_meta=$17,
         body_source=$19,
+        ab_metric=$20::campaign_ab_metric,
+        ab_wait=$21,
+        send_mode=$22::campaign_send_mode,
+        recur_cron=$23,
+        recur_feed_url=$24,
+        throttle_rate=$25,
+        throttle_cap=$26,
+        throttle_window=$27::throttle_window,
+        segment_ids=$28::INT[],
         updated_at=NOW()
     WHERE id = $1 RETURNING id
 ),
@@ -922,6 +1419,12 @@ UPDATE campaigns SET
     updated_at=NOW()
 WHERE id=$1;
 
+-- name: update-campaign-sent
+-- Adds to the sent count of a campaign without moving its checkpoint (last_subscriber_id),
+-- for messages that aren't sent in the campaign's subscriber order: A/B test variant
+-- samples and retries of deferred messages.
+UPDATE campaigns SET sent=sent+$2, updated_at=NOW() WHERE id=$1;
+
 -- name: update-campaign-status
 UPDATE campaigns SET
     status=(
@@ -933,6 +1436,77 @@ UPDATE campaigns SET
     updated_at=NOW()
 WHERE id = $1;
 
+-- name: add-campaign-approval
+INSERT INTO campaign_approvals (campaign_id, user_id, action, note) VALUES($1, NULLIF($2, 0), $3, $4);
+
+-- name: invalidate-campaign-approval
+-- Reverts a campaign that's pending approval or was approved (and is scheduled or paused) to a draft
+-- and records the invalidation in its approval history.
+WITH camp AS (
+    UPDATE campaigns SET status='draft', updated_at=NOW()
+    WHERE id = $1 AND status = ANY('{pending_approval, approved, scheduled, paused}'::campaign_status[])
+    RETURNING id
+)
+INSERT INTO campaign_approvals (campaign_id, user_id, action, note)
+    SELECT id, NULLIF($2, 0), 'invalidated', $3 FROM camp;
+
+-- name: get-campaign-approvals
+SELECT a.*, u.username, u.name, u.email FROM campaign_approvals a
+    LEFT JOIN users u ON (u.id = a.user_id)
+    WHERE a.campaign_id = $1 ORDER BY a.id DESC;
+
+-- name: get-campaign-approvers
+-- Retrieves the e-mails of enabled users who can approve campaigns, except the given user.
+SELECT u.email FROM users u
+    JOIN roles r ON (r.id = u.user_role_id)
+    WHERE u.id != $1 AND u.type = 'user' AND u.status = 'enabled'
+    AND (u.user_role_id = 1 OR 'campaigns:approve' = ANY(r.permissions))
+    ORDER BY u.id;
+
+-- name: add-revision
+-- Records a revision of a campaign ($1) or a template ($2). If it's the first revision
+-- of either, the state before the change ($6, last updated at $7) is recorded first
+-- so that the original content isn't lost.
+WITH base AS (
+    INSERT INTO revisions (campaign_id, template_id, fields, data, created_at)
+    SELECT NULLIF($1, 0), NULLIF($2, 0), '{}', $6, COALESCE($7, NOW())
+    WHERE NOT EXISTS (
+        SELECT 1 FROM revisions WHERE campaign_id = NULLIF($1, 0) OR template_id = NULLIF($2, 0)
+    )
+)
+INSERT INTO revisions (campaign_id, template_id, user_id, fields, data)
+    VALUES(NULLIF($1, 0), NULLIF($2, 0), NULLIF($3, 0), $4, $5);
+
+-- name: get-revisions
+-- Retrieves the revisions of a campaign ($1) or a template ($2) without their data, latest first.
+SELECT COUNT(*) OVER () AS total, r.id, r.campaign_id, r.template_id, r.user_id, r.fields, r.created_at,
+    u.username, u.name
+    FROM revisions r
+    LEFT JOIN users u ON (u.id = r.user_id)
+    WHERE r.campaign_id = NULLIF($1, 0) OR r.template_id = NULLIF($2, 0)
+    ORDER BY r.created_at DESC, r.id DESC
+    OFFSET $3 LIMIT (CASE WHEN $4 < 1 THEN NULL ELSE $4 END);
+
+-- name: get-revision
+SELECT r.*, u.username, u.name FROM revisions r
+    LEFT JOIN users u ON (u.id = r.user_id)
+    WHERE r.id = $1 AND (r.campaign_id = NULLIF($2, 0) OR r.template_id = NULLIF($3, 0));
+
+-- name: get-recurring-campaigns
+-- Retrieves the IDs of active (scheduled) recurring campaigns whose start time, if any, is up.
+SELECT id FROM campaigns
+    WHERE status = 'scheduled' AND recur_cron != '' AND (send_at IS NULL OR send_at <= NOW())
+    ORDER BY id;
+
+-- name: update-campaign-recurrence
+-- Records a run of a recurring campaign, and the publish date of the latest feed item sent
+-- and the GUIDs of the items in the feed, if any.
+UPDATE campaigns SET
+    recur_last_run_at=$2,
+    recur_last_item_at=COALESCE($3, recur_last_item_at),
+    recur_last_items=COALESCE($4::TEXT[], recur_last_items)
+WHERE id = $1;
+
 -- name: update-campaign-archive
 UPDATE campaigns SET
     archive=$2,
@@ -997,6 +1571,205 @@ up AS (
 SELECT id FROM tpl;
 
 
+-- sequences
+-- name: get-sequences
+WITH counts AS (
+    SELECT sequence_id, JSON_OBJECT_AGG(status, num) AS counts FROM (
+        SELECT sequence_id, status, COUNT(*) AS num FROM sequence_subscribers
+        WHERE ($1 = 0 OR sequence_id = $1) GROUP BY sequence_id, status
+    ) c GROUP BY sequence_id
+)
+SELECT sequences.*, lists.name AS list_name, COALESCE(counts.counts, '{}') AS subscriber_counts
+    FROM sequences
+    LEFT JOIN lists ON (lists.id = sequences.list_id)
+    LEFT JOIN counts ON (counts.sequence_id = sequences.id)
+    WHERE ($1 = 0 OR sequences.id = $1)
+    ORDER BY sequences.created_at;
+
+-- name: create-sequence
+INSERT INTO sequences (name, list_id, status, exit_list_ids, from_email, messenger)
+    VALUES($1, $2, $3, $4, $5, $6) RETURNING id;
+
+-- name: update-sequence
+UPDATE sequences SET name=$2, list_id=$3, exit_list_ids=$4, from_email=$5, messenger=$6, updated_at=NOW()
+    WHERE id=$1;
+
+-- name: update-sequence-status
+UPDATE sequences SET status=$2::sequence_status, updated_at=NOW() WHERE id=$1;
+
+-- name: delete-sequence
+DELETE FROM sequences WHERE id=$1;
+
+-- name: get-sequence-steps
+-- Returns the steps of a sequence ($2 = 0 for all) along with the number of active
+-- subscribers who are waiting to be sent each step.
+SELECT st.*, templates.name AS template_name,
+    (
+        SELECT COUNT(*) FROM sequence_subscribers ss
+        WHERE ss.sequence_id = st.sequence_id AND ss.status = 'active' AND st.position = (
+            SELECT MIN(position) FROM sequence_steps WHERE sequence_id = st.sequence_id AND position > ss.position
+        )
+    ) AS waiting
+    FROM sequence_steps st
+    LEFT JOIN templates ON (templates.id = st.template_id)
+    WHERE st.sequence_id = $1 AND ($2 = 0 OR st.id = $2)
+    ORDER BY st.position;
+
+-- name: create-sequence-step
+INSERT INTO sequence_steps (sequence_id, position, template_id, delay_mins, content_type)
+    VALUES($1, (SELECT COALESCE(MAX(position), 0) + 1 FROM sequence_steps WHERE sequence_id = $1), $2, $3, $4)
+    RETURNING id;
+
+-- name: update-sequence-step
+UPDATE sequence_steps SET template_id=$3, delay_mins=$4, content_type=$5, updated_at=NOW() WHERE id=$1 AND sequence_id=$2;
+
+-- name: delete-sequence-step
+DELETE FROM sequence_steps WHERE id=$1 AND sequence_id=$2;
+
+-- name: add-sequence-subscribers
+-- Starts the active sequences of lists for subscribers who have joined them after the
+-- sequences were created. Either takes subscriber IDs ($1), or all subscribers who joined
+-- the lists $2 at or after $3 (eg: an import). On double opt-in lists, only confirmed
+-- subscriptions start sequences. Subscribers never re-enter a sequence.
+INSERT INTO sequence_subscribers (sequence_id, subscriber_id)
+    SELECT seq.id, sl.subscriber_id FROM sequences seq
+    JOIN lists l ON (l.id = seq.list_id)
+    JOIN subscriber_lists sl ON (sl.list_id = seq.list_id AND sl.created_at >= seq.created_at)
+    JOIN subscribers s ON (s.id = sl.subscriber_id AND s.status != 'blocklisted')
+    WHERE seq.status = 'active'
+    AND (sl.status = 'confirmed' OR (sl.status = 'unconfirmed' AND l.optin != 'double'))
+    AND (
+        CASE WHEN CARDINALITY($1::INT[]) > 0 THEN sl.subscriber_id = ANY($1::INT[])
+        ELSE sl.list_id = ANY($2::INT[]) AND sl.created_at >= $3
+        END
+    )
+ON CONFLICT DO NOTHING;
+
+-- name: exit-sequence-subscribers
+-- Exits subscribers from sequences on unsubscribing from the sequence's list,
+-- being blocklisted, or joining any of the sequence's exit lists.
+UPDATE sequence_subscribers ss SET status='exited', updated_at=NOW()
+    FROM sequences seq, subscribers s
+    WHERE ss.status = 'active' AND seq.id = ss.sequence_id AND s.id = ss.subscriber_id
+    AND (
+        s.status = 'blocklisted'
+        OR NOT EXISTS (
+            SELECT 1 FROM subscriber_lists sl
+            WHERE sl.subscriber_id = ss.subscriber_id AND sl.list_id = seq.list_id AND sl.status != 'unsubscribed'
+        )
+        OR EXISTS (
+            SELECT 1 FROM subscriber_lists sl
+            WHERE sl.subscriber_id = ss.subscriber_id AND sl.list_id = ANY(seq.exit_list_ids) AND sl.status != 'unsubscribed'
+        )
+    );
+
+-- name: next-sequence-messages
+-- Returns a batch of subscribers of active sequences whose next step's delay is over, or
+-- whose failed step is due to be retried, along with the step. The batch is claimed until
+-- $2 so that it isn't picked up again while it's being sent. Progress is advanced with
+-- advance-sequence-subscriber only once a step has been sent.
+WITH due AS (
+    SELECT ss.sequence_id, ss.subscriber_id, ss.attempts, st.id AS step_id, st.template_id, st.content_type
+    FROM sequence_subscribers ss
+    JOIN sequences seq ON (seq.id = ss.sequence_id AND seq.status = 'active')
+    JOIN LATERAL (
+        SELECT id, position, template_id, content_type, delay_mins FROM sequence_steps
+        WHERE sequence_id = ss.sequence_id AND position > ss.position
+        ORDER BY position LIMIT 1
+    ) st ON TRUE
+    WHERE ss.status = 'active'
+    AND COALESCE(ss.retry_at, COALESCE(ss.last_sent_at, ss.created_at) + MAKE_INTERVAL(mins => st.delay_mins)) <= NOW()
+    ORDER BY ss.sequence_id, ss.subscriber_id
+    LIMIT $1
+    FOR UPDATE OF ss SKIP LOCKED
+),
+claim AS (
+    UPDATE sequence_subscribers ss SET retry_at = $2, updated_at = NOW()
+    FROM due WHERE ss.sequence_id = due.sequence_id AND ss.subscriber_id = due.subscriber_id
+)
+SELECT subscribers.*, due.sequence_id, due.step_id, due.template_id, due.content_type, due.attempts,
+    seq.from_email, seq.messenger
+    FROM due
+    JOIN subscribers ON (subscribers.id = due.subscriber_id)
+    JOIN sequences seq ON (seq.id = due.sequence_id)
+    ORDER BY due.sequence_id, due.subscriber_id;
+
+-- name: advance-sequence-subscriber
+-- Advances the progress of a subscriber ($2) in a sequence ($1) to a step ($3) that has been
+-- sent to them and counts the step as sent. Subscribers who have been sent the last step are
+-- marked as finished.
+WITH st AS (
+    SELECT id, sequence_id, position FROM sequence_steps WHERE id = $3 AND sequence_id = $1
+),
+progress AS (
+    UPDATE sequence_subscribers ss SET position = st.position, last_sent_at = NOW(), updated_at = NOW(),
+        attempts = 0, retry_at = NULL,
+        status = (CASE WHEN EXISTS (
+            SELECT 1 FROM sequence_steps WHERE sequence_id = st.sequence_id AND position > st.position
+        ) THEN 'active' ELSE 'finished' END)::sequence_subscriber_status
+    FROM st WHERE ss.sequence_id = st.sequence_id AND ss.subscriber_id = $2
+)
+UPDATE sequence_steps SET sent = sent + 1 FROM st WHERE sequence_steps.id = st.id;
+
+-- name: fail-sequence-subscriber
+-- Records a failed attempt to send the next step of a sequence ($1) to a subscriber ($2)
+-- to be retried at $3, or if the attempts have reached the max ($4), marks them as failed.
+UPDATE sequence_subscribers SET attempts = attempts + 1, retry_at = $3, updated_at = NOW(),
+    status = (CASE WHEN attempts + 1 >= $4 THEN 'failed' ELSE status END)::sequence_subscriber_status
+    WHERE sequence_id = $1 AND subscriber_id = $2;
+
+
+-- segments
+-- name: get-segments
+SELECT * FROM segments WHERE ($1 = 0 OR id = $1) ORDER BY created_at;
+
+-- name: create-segment
+INSERT INTO segments (name, description, rules) VALUES($1, $2, $3) RETURNING id;
+
+-- name: update-segment
+UPDATE segments SET name=$2, description=$3, rules=$4, updated_at=NOW() WHERE id=$1;
+
+-- name: delete-segment
+-- Segments targeted by campaigns that are yet to finish aren't deleted. The segment
+-- is removed from the rest of the campaigns that target it.
+WITH camps AS (
+    SELECT id, status FROM campaigns WHERE $1 = ANY(segment_ids)
+),
+del AS (
+    DELETE FROM segments WHERE id = $1
+        AND NOT EXISTS (SELECT 1 FROM camps WHERE status NOT IN ('finished', 'cancelled'))
+    RETURNING id
+),
+u AS (
+    UPDATE campaigns SET segment_ids = ARRAY_REMOVE(segment_ids, $1)
+        WHERE id = ANY(SELECT id FROM camps) AND EXISTS (SELECT 1 FROM del)
+)
+SELECT id FROM del;
+
+-- name: refresh-segment
+-- raw: true
+-- Materializes the subscribers who match the compiled rules (%query%) of a segment
+-- into segment_subscribers and updates the segment's subscriber count.
+WITH subs AS (
+    SELECT subscribers.id FROM subscribers WHERE %query%
+),
+del AS (
+    DELETE FROM segment_subscribers ss WHERE ss.segment_id = $1
+        AND NOT EXISTS (SELECT 1 FROM subs WHERE subs.id = ss.subscriber_id)
+),
+ins AS (
+    INSERT INTO segment_subscribers (segment_id, subscriber_id)
+        SELECT $1, id FROM subs
+    ON CONFLICT DO NOTHING
+)
+UPDATE segments SET subscriber_count = (SELECT COUNT(*) FROM subs), refreshed_at = NOW() WHERE id = $1;
+
+-- name: count-segment-subscribers
+-- raw: true
+-- Counts the subscribers who match the compiled rules (%query%) of a segment.
+SELECT COUNT(*) FROM subscribers WHERE %query%;
+
+
 -- media
 -- name: insert-media
 INSERT INTO media (uuid, filename, thumb, content_type, provider, meta, created_at) VALUES($1, $2, $3, $4, $5, $6, NOW()) RETURNING id;
@@ -1047,6 +1820,39 @@ UPDATE settings AS s SET value = c.value
     -- For each key in the incoming JSON map, update the row with the key and its value.
     FROM(SELECT * FROM JSONB_EACH($1)) AS c(key, value) WHERE s.key = c.key;
 
+-- name: is-valid-timezone
+-- Checks if a time zone name is one of Postgres' (pg_timezone_names), which the
+-- per-subscriber delivery schedules are computed with.
+SELECT EXISTS(SELECT 1 FROM pg_timezone_names WHERE name = $1);
+
+-- name: get-smtp-warmups
+-- Retrieves the warm-up state of the given SMTP servers, starting the warm-up of those
+-- that don't have one yet.
+WITH ins AS (
+    INSERT INTO smtp_warmup (uuid) (SELECT UNNEST($1::TEXT[]))
+    ON CONFLICT (uuid) DO NOTHING
+    RETURNING *
+)
+SELECT * FROM ins
+UNION ALL
+SELECT * FROM smtp_warmup WHERE uuid = ANY($1::TEXT[]);
+
+-- name: update-smtp-warmup
+UPDATE smtp_warmup SET day=$2, sent=$3, updated_at=NOW() WHERE uuid = $1;
+
+-- name: get-send-limit-count
+-- Retrieves the number of messages sent in the given cap window of a send limit.
+SELECT COALESCE((SELECT sent FROM send_limits WHERE key = $1 AND window_start = $2), 0);
+
+-- name: add-send-limit-count
+-- Adds to the number of messages sent in the cap window of a send limit, starting
+-- the count afresh if the window is a new one.
+INSERT INTO send_limits (key, window_start, sent) VALUES($1, $2, $3)
+    ON CONFLICT (key) DO UPDATE SET
+        sent = (CASE WHEN send_limits.window_start = $2 THEN send_limits.sent + $3 ELSE $3 END),
+        window_start = $2,
+        updated_at = NOW();
+
 -- name: record-bounce
 -- Insert a bounce and count the bounces for the subscriber and either unsubscribe them,
 WITH sub AS (
@@ -1068,6 +1874,11 @@ block2 AS (
     UPDATE subscriber_lists SET status='unsubscribed'
     WHERE $9 = 'unsubscribe' AND (SELECT num FROM num) >= $8 AND subscriber_id = (SELECT id FROM sub) AND (SELECT status FROM sub) != 'blocklisted'
 ),
+dlv AS (
+    -- Mark the campaign message as bounced in the delivery log.
+    UPDATE deliveries SET status='bounced', updated_at=NOW()
+    WHERE campaign_id = (SELECT id FROM camp) AND subscriber_id = (SELECT id FROM sub)
+),
 bounce AS (
     -- Record the bounce if the subscriber is not already blocklisted;
     INSERT INTO bounces (subscriber_id, campaign_id, type, source, meta, created_at)
@@ -1112,6 +1923,79 @@ WITH sub AS (
 )
 DELETE FROM bounces WHERE subscriber_id = (SELECT id FROM sub);
 
+-- name: defer-delivery
+-- Records a campaign message that failed to send. A message that fails again in
+-- a later run of the campaign starts over with its attempts. $3 is the A/B test variant
+-- the message was rendered from (0 for none), which the retry is rendered from.
+INSERT INTO deferred_deliveries (campaign_id, subscriber_id, variant_id, messenger, error, next_retry_at)
+    VALUES($1, $2, NULLIF($3, 0), $4, $5, $6)
+    ON CONFLICT (campaign_id, subscriber_id) DO UPDATE
+    SET variant_id=NULLIF($3, 0), messenger=$4, error=$5, attempts=0, status='pending', next_retry_at=$6, updated_at=NOW();
+
+-- name: get-due-deferred-deliveries
+-- Pending deliveries that are due for a retry, skipping paused and cancelled campaigns,
+-- blocklisted subscribers, and subscribers who've since unsubscribed from all of the
+-- campaign's lists, who'd not be sent the message by the campaign anymore.
+SELECT d.* FROM deferred_deliveries d
+    LEFT JOIN campaigns c ON (c.id = d.campaign_id)
+    LEFT JOIN subscribers s ON (s.id = d.subscriber_id)
+    WHERE d.status = 'pending' AND d.next_retry_at <= NOW()
+    AND c.status NOT IN ('paused', 'cancelled') AND s.status != 'blocklisted'
+    AND EXISTS (
+        SELECT 1 FROM subscriber_lists sl
+        JOIN campaign_lists cl ON (cl.list_id = sl.list_id)
+        WHERE cl.campaign_id = d.campaign_id AND sl.subscriber_id = d.subscriber_id
+        AND sl.status != 'unsubscribed'
+    )
+    ORDER BY d.next_retry_at LIMIT $1;
+
+-- name: update-deferred-delivery
+UPDATE deferred_deliveries SET status=$2, error=$3, next_retry_at=$4, attempts=attempts+1, updated_at=NOW()
+    WHERE id = $1;
+
+-- name: retry-deferred-deliveries
+UPDATE deferred_deliveries SET status='pending', attempts=0, next_retry_at=NOW(), updated_at=NOW()
+    WHERE CARDINALITY($1::INT[]) = 0 OR id = ANY($1);
+
+-- name: delete-deferred-deliveries
+DELETE FROM deferred_deliveries WHERE CARDINALITY($1::INT[]) = 0 OR id = ANY($1);
+
+-- name: log-delivery
+INSERT INTO deliveries (campaign_id, subscriber_id, messenger, server, response, status)
+    VALUES($1, $2, $3, $4, $5, $6)
+    ON CONFLICT (campaign_id, subscriber_id) DO UPDATE
+    SET messenger=$3, server=$4, response=$5, status=$6, updated_at=NOW();
+
+-- name: query-campaign-deliveries
+SELECT COUNT(*) OVER () AS total,
+    d.*,
+    subscribers.uuid AS subscriber_uuid,
+    subscribers.email AS email
+FROM deliveries d
+LEFT JOIN subscribers ON (subscribers.id = d.subscriber_id)
+WHERE d.campaign_id = $1
+    AND ($2 = 0 OR d.subscriber_id = $2)
+    AND ($3 = '' OR d.status = $3::delivery_status)
+    AND ($4 = '' OR subscribers.email ILIKE $4)
+ORDER BY %order% OFFSET $5 LIMIT $6;
+
+-- name: delete-deliveries
+DELETE FROM deliveries WHERE updated_at < $1;
+
+-- name: query-deferred-deliveries
+SELECT COUNT(*) OVER () AS total,
+    d.*,
+    subscribers.uuid AS subscriber_uuid,
+    subscribers.email AS email,
+    JSON_BUILD_OBJECT('id', d.campaign_id, 'name', campaigns.name) AS campaign
+FROM deferred_deliveries d
+LEFT JOIN subscribers ON (subscribers.id = d.subscriber_id)
+LEFT JOIN campaigns ON (campaigns.id = d.campaign_id)
+WHERE ($1 = 0 OR d.campaign_id = $1)
+    AND ($2 = 0 OR d.subscriber_id = $2)
+    AND ($3 = '' OR d.status = $3::deferred_status)
+ORDER BY %order% OFFSET $4 LIMIT $5;
+
 
 -- name: get-db-info
 SELECT JSON_BUILD_OBJECT('version', (SELECT VERSION()),
@@ -1160,6 +2044,21 @@ UPDATE users SET
     updated_at=NOW()
     WHERE id=$1 AND (SELECT canEdit FROM u) = TRUE;
 
+-- name: update-user-roles
+-- Sets the user role ($2) and the list role ($3, 0 = unchanged, -1 = none) of a user, for instance,
+-- from SSO group mappings. The only enabled super admin can't be moved to another role.
+UPDATE users SET
+    user_role_id=$2,
+    list_role_id=(
+        CASE
+            WHEN $3 < 0 THEN NULL
+            WHEN $3 > 0 THEN (SELECT id FROM roles WHERE id = $3 AND type = 'list')
+            ELSE list_role_id END
+    ),
+    updated_at=NOW()
+    WHERE id=$1 AND type='user' AND EXISTS (SELECT 1 FROM roles WHERE id = $2 AND type = 'user')
+    AND ($2 = 1 OR (SELECT COUNT(*) FROM users WHERE id != $1 AND status = 'enabled' AND type = 'user' AND user_role_id = 1) > 0);
+
 -- name: delete-users
 WITH u AS (
     SELECT COUNT(*) AS num FROM users WHERE NOT(id = ANY($1)) AND user_role_id=1 AND type='user' AND status='enabled'
@@ -1267,6 +2166,129 @@ UPDATE users SET name=$2, email=(CASE WHEN password_login THEN $3 ELSE email END
 -- name: update-user-login
 UPDATE users SET loggedin_at=NOW(), avatar=(CASE WHEN $2 != '' THEN $2 ELSE avatar END) WHERE id=$1;
 
+-- name: set-user-totp-secret
+-- Sets a new TOTP secret for a user to enrol with. 2FA is only enabled once a code
+-- generated with the secret is verified.
+UPDATE users SET totp_secret=$2, totp_enabled=FALSE, totp_recovery_codes='{}', updated_at=NOW()
+    WHERE id=$1 AND type='user';
+
+-- name: enable-user-totp
+-- Enables 2FA for a user and stores the hashes of the given recovery codes ($2) and the
+-- time step of the code that was verified on enrolment ($3).
+UPDATE users SET totp_enabled=TRUE, totp_recovery_codes=$2, totp_last_step=$3,
+    totp_failures=0, totp_failed_at=NULL, updated_at=NOW()
+    WHERE id=$1 AND totp_secret IS NOT NULL;
+
+-- name: reset-user-totp
+UPDATE users SET totp_secret=NULL, totp_enabled=FALSE, totp_recovery_codes='{}', totp_last_step=0,
+    totp_failures=0, totp_failed_at=NULL, updated_at=NOW() WHERE id=$1;
+
+-- name: use-user-totp-step
+-- Records the time step of an accepted TOTP code and clears the failed attempts. No rows
+-- are affected if a code of the step, or a later one, has already been used.
+UPDATE users SET totp_last_step=$2, totp_failures=0, totp_failed_at=NULL
+    WHERE id=$1 AND totp_enabled AND totp_last_step < $2;
+
+-- name: add-user-totp-failure
+-- Counts a failed TOTP code of a user. Failures before $2 are forgotten. Returns the count.
+UPDATE users SET
+    totp_failures=(CASE WHEN totp_failed_at > $2 THEN totp_failures + 1 ELSE 1 END),
+    totp_failed_at=NOW()
+    WHERE id=$1 RETURNING totp_failures;
+
+-- name: get-user-api-tokens
+-- Returns the scoped API tokens of a user ($1), or of all users if $1 is 0.
+SELECT * FROM api_tokens WHERE ($1 = 0 OR user_id = $1) ORDER BY created_at;
+
+-- name: create-api-token
+INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, permissions, list_ids, expires_at)
+    SELECT id, $2, $3, $4, $5, $6, $7 FROM users WHERE id = $1 AND type = 'api'
+    RETURNING *;
+
+-- name: delete-api-token
+DELETE FROM api_tokens WHERE id = $1 AND user_id = $2;
+
+-- name: update-api-token-usage
+UPDATE api_tokens SET last_used_at = NOW(), last_used_ip = $2 WHERE id = $1;
+
+-- name: create-password-reset
+-- Logs a password reset request and the hash of its token if one was issued. Old requests
+-- that are no longer needed for rate-limiting are deleted.
+WITH old AS (
+    DELETE FROM password_resets WHERE created_at < NOW() - INTERVAL '7 days'
+)
+INSERT INTO password_resets (user_id, email, token_hash, ip, expires_at)
+    VALUES(NULLIF($1, 0), $2, NULLIF($3, ''), $4, $5);
+
+-- name: get-password-reset-counts
+-- Counts the password reset requests made from an IP ($1) and the tokens issued to a user ($2)
+-- since the given time ($3).
+SELECT COUNT(*) FILTER (WHERE ip = $1) AS ip_count,
+    COUNT(*) FILTER (WHERE user_id = $2 AND token_hash IS NOT NULL) AS user_count
+    FROM password_resets WHERE created_at > $3;
+
+-- name: get-password-reset
+-- Returns the user of a valid (unused and unexpired) password reset token.
+SELECT user_id FROM password_resets WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW();
+
+-- name: reset-user-password
+-- Sets a user's password with a valid password reset token, uses up all the user's outstanding
+-- tokens, and logs the user out of all sessions. Returns the user ID.
+WITH r AS (
+    UPDATE password_resets SET used_at = NOW()
+    WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+    RETURNING user_id
+),
+u AS (
+    UPDATE users SET password = CRYPT($2, GEN_SALT('bf')), updated_at = NOW()
+    WHERE id = (SELECT user_id FROM r) AND type = 'user' AND status = 'enabled' AND password_login = TRUE
+    RETURNING id
+),
+others AS (
+    UPDATE password_resets SET used_at = NOW()
+    WHERE user_id = (SELECT id FROM u) AND used_at IS NULL AND token_hash != $1
+),
+sess AS (
+    DELETE FROM sessions WHERE data->>'user_id' = (SELECT id::TEXT FROM u)
+)
+SELECT id FROM u;
+
+-- name: get-login-failures
+SELECT type, key, attempts, locked_until FROM login_failures;
+
+-- name: upsert-login-failures
+INSERT INTO login_failures (type, key, attempts, locked_until) VALUES($1, $2, $3, $4)
+    ON CONFLICT (type, key) DO UPDATE SET attempts=$3, locked_until=$4, updated_at=NOW();
+
+-- name: delete-login-failures
+DELETE FROM login_failures WHERE type = $1 AND key = $2;
+
+-- name: get-user-sessions
+-- Returns the active login sessions of a user ($1) created within the session TTL ($2 seconds).
+-- Session IDs are secrets and only their hashes are returned.
+SELECT ENCODE(SHA256(id::BYTEA), 'hex') AS id,
+    COALESCE(data->>'ip', '') AS ip,
+    COALESCE(data->>'user_agent', '') AS user_agent,
+    created_at,
+    TO_TIMESTAMP((data->>'last_seen')::BIGINT) AS last_seen_at
+    FROM sessions
+    WHERE data->>'user_id' = $1::TEXT AND COALESCE((data->>'totp_pending')::BOOLEAN, FALSE) = FALSE
+    AND created_at >= NOW() - INTERVAL '1 second' * $2
+    ORDER BY COALESCE(TO_TIMESTAMP((data->>'last_seen')::BIGINT), created_at) DESC;
+
+-- name: delete-user-sessions
+-- Deletes the login session of a user ($1) with the hashed ID $2, or all the user's sessions
+-- if $2 is empty, except for the session with the hashed ID $3.
+DELETE FROM sessions WHERE data->>'user_id' = $1::TEXT
+    AND ($2 = '' OR ENCODE(SHA256(id::BYTEA), 'hex') = $2)
+    AND ($3 = '' OR ENCODE(SHA256(id::BYTEA), 'hex') != $3);
+
+-- name: use-user-totp-recovery-code
+-- Removes a recovery code (hash) of a user if it matches and clears the failed attempts.
+-- No rows are affected if it doesn't match.
+UPDATE users SET totp_recovery_codes=ARRAY_REMOVE(totp_recovery_codes, $2), totp_failures=0, totp_failed_at=NULL
+    WHERE id=$1 AND totp_enabled AND $2 = ANY(totp_recovery_codes);
+
 -- name: get-user-roles
 WITH mainroles AS (
     SELECT ur.* FROM roles ur WHERE type = 'user' AND ur.parent_id IS NULL AND
@@ -2,14 +2,24 @@ DROP TYPE IF EXISTS list_type CASCADE; CREATE TYPE list_type AS ENUM ('public',
 DROP TYPE IF EXISTS list_optin CASCADE; CREATE TYPE list_optin AS ENUM ('single', 'double');
 DROP TYPE IF EXISTS subscriber_status CASCADE; CREATE TYPE subscriber_status AS ENUM ('enabled', 'disabled', 'blocklisted');
 DROP TYPE IF EXISTS subscription_status CASCADE; CREATE TYPE subscription_status AS ENUM ('unconfirmed', 'confirmed', 'unsubscribed');
-DROP TYPE IF EXISTS campaign_status CASCADE; CREATE TYPE campaign_status AS ENUM ('draft', 'running', 'scheduled', 'paused', 'cancelled', 'finished');
+DROP TYPE IF EXISTS campaign_status CASCADE; CREATE TYPE campaign_status AS ENUM ('draft', 'pending_approval', 'approved', 'running', 'scheduled', 'paused', 'cancelled', 'finished');
 DROP TYPE IF EXISTS campaign_type CASCADE; CREATE TYPE campaign_type AS ENUM ('regular', 'optin');
+DROP TYPE IF EXISTS campaign_ab_status CASCADE; CREATE TYPE campaign_ab_status AS ENUM ('testing', 'waiting', 'done');
+DROP TYPE IF EXISTS campaign_ab_metric CASCADE; CREATE TYPE campaign_ab_metric AS ENUM ('views', 'clicks');
+DROP TYPE IF EXISTS sequence_status CASCADE; CREATE TYPE sequence_status AS ENUM ('active', 'paused');
+DROP TYPE IF EXISTS sequence_subscriber_status CASCADE; CREATE TYPE sequence_subscriber_status AS ENUM ('active', 'finished', 'exited', 'failed');
+DROP TYPE IF EXISTS campaign_send_mode CASCADE; CREATE TYPE campaign_send_mode AS ENUM ('default', 'optimal', 'local');
+DROP TYPE IF EXISTS throttle_window CASCADE; CREATE TYPE throttle_window AS ENUM ('hour', 'day');
 DROP TYPE IF EXISTS content_type CASCADE; CREATE TYPE content_type AS ENUM ('richtext', 'html', 'plain', 'markdown', 'visual');
 DROP TYPE IF EXISTS bounce_type CASCADE; CREATE TYPE bounce_type AS ENUM ('soft', 'hard', 'complaint');
+DROP TYPE IF EXISTS deferred_status CASCADE; CREATE TYPE deferred_status AS ENUM ('pending', 'failed');
+DROP TYPE IF EXISTS delivery_status CASCADE; CREATE TYPE delivery_status AS ENUM ('sent', 'failed', 'deferred', 'bounced');
+DROP TYPE IF EXISTS approval_action CASCADE; CREATE TYPE approval_action AS ENUM ('requested', 'approved', 'rejected', 'invalidated');
 DROP TYPE IF EXISTS template_type CASCADE; CREATE TYPE template_type AS ENUM ('campaign', 'campaign_visual', 'tx');
 DROP TYPE IF EXISTS user_type CASCADE; CREATE TYPE user_type AS ENUM ('user', 'api');
 DROP TYPE IF EXISTS user_status CASCADE; CREATE TYPE user_status AS ENUM ('enabled', 'disabled');
 DROP TYPE IF EXISTS role_type CASCADE; CREATE TYPE role_type AS ENUM ('user', 'list');
+DROP TYPE IF EXISTS subscriber_event_type CASCADE; CREATE TYPE subscriber_event_type AS ENUM ('updated', 'blocklisted', 'subscribed', 'unsubscribed', 'subscription_removed', 'optin_confirmed', 'preferences_updated');
 
 CREATE EXTENSION IF NOT EXISTS pgcrypto;
 
@@ -23,6 +33,10 @@ CREATE TABLE subscribers (
     attribs         JSONB NOT NULL DEFAULT '{}',
     status          subscriber_status NOT NULL DEFAULT 'enabled',
 
+    -- Periodically computed score of the subscriber's views, clicks, and bounces
+    -- whose weights decay over time.
+    engagement_score DOUBLE PRECISION NOT NULL DEFAULT 0,
+
     created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
@@ -31,6 +45,7 @@ DROP INDEX IF EXISTS idx_subs_status; CREATE INDEX idx_subs_status ON subscriber
 DROP INDEX IF EXISTS idx_subs_id_status; CREATE INDEX idx_subs_id_status ON subscribers(id, status);
 DROP INDEX IF EXISTS idx_subs_created_at; CREATE INDEX idx_subs_created_at ON subscribers(created_at);
 DROP INDEX IF EXISTS idx_subs_updated_at; CREATE INDEX idx_subs_updated_at ON subscribers(updated_at);
+DROP INDEX IF EXISTS idx_subs_engagement_score; CREATE INDEX idx_subs_engagement_score ON subscribers(engagement_score);
 
 -- lists
 DROP TABLE IF EXISTS lists CASCADE;
@@ -123,6 +138,40 @@ CREATE TABLE campaigns (
     archive_template_id INTEGER REFERENCES templates(id) ON DELETE SET NULL,
     archive_meta        JSONB NOT NULL DEFAULT '{}',
 
+    -- default = send to all subscribers at once. optimal = send to each subscriber
+    -- at their most active hour as per their campaign_schedule. local = send at the
+    -- wall-clock time of send_at in each subscriber's time zone (attribs.timezone).
+    send_mode        campaign_send_mode NOT NULL DEFAULT 'default',
+
+    -- Send throttling. Max messages per second (throttle_rate) and max messages per
+    -- throttle_window (throttle_cap), after which sending resumes in the next window. 0 = unlimited.
+    throttle_rate      INTEGER NOT NULL DEFAULT 0,
+    throttle_cap       INTEGER NOT NULL DEFAULT 0,
+    throttle_window    throttle_window NOT NULL DEFAULT 'day',
+
+    -- Recurring campaigns. A campaign with a recur_cron schedule is a template that's
+    -- cloned into a new campaign (parent_id) on every run, optionally filled with the
+    -- new items (feed_items) of the RSS/Atom feed at recur_feed_url.
+    recur_cron         TEXT NOT NULL DEFAULT '',
+    recur_feed_url     TEXT NOT NULL DEFAULT '',
+    recur_last_run_at  TIMESTAMP WITH TIME ZONE NULL,
+    recur_last_item_at TIMESTAMP WITH TIME ZONE NULL,
+    recur_last_items   TEXT[] NOT NULL DEFAULT '{}',
+    parent_id          INTEGER NULL REFERENCES campaigns(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    feed_items         JSONB NOT NULL DEFAULT '[]',
+
+    -- Saved segments that narrow down the audience of the campaign's lists. If there
+    -- are any, only the subscribers who are members of any of them are sent to.
+    segment_ids        INTEGER[] NOT NULL DEFAULT '{}',
+
+    -- A/B testing. If a campaign has campaign_variants, they are sent to samples
+    -- of the audience first, and after ab_wait (duration string, eg: 4h), the winning
+    -- variant by ab_metric is sent to the rest of the audience.
+    ab_status        campaign_ab_status NULL,
+    ab_metric        campaign_ab_metric NOT NULL DEFAULT 'views',
+    ab_wait          TEXT NOT NULL DEFAULT '4h',
+    ab_decide_at     TIMESTAMP WITH TIME ZONE NULL,
+
     started_at       TIMESTAMP WITH TIME ZONE,
     created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
@@ -160,6 +209,133 @@ DROP INDEX IF EXISTS idx_views_camp_id; CREATE INDEX idx_views_camp_id ON campai
 DROP INDEX IF EXISTS idx_views_subscriber_id; CREATE INDEX idx_views_subscriber_id ON campaign_views(subscriber_id);
 DROP INDEX IF EXISTS idx_views_date; CREATE INDEX idx_views_date ON campaign_views((TIMEZONE('UTC', created_at)::DATE));
 
+-- campaign_variants
+DROP TABLE IF EXISTS campaign_variants CASCADE;
+CREATE TABLE campaign_variants (
+    id               SERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    name             TEXT NOT NULL,
+    subject          TEXT NOT NULL,
+    body             TEXT NOT NULL,
+    altbody          TEXT NULL,
+
+    -- Percentage of the campaign's audience that's sampled for this variant.
+    percent          INT NOT NULL DEFAULT 10 CHECK (percent > 0 AND percent < 100),
+    last_subscriber_id INT NOT NULL DEFAULT 0,
+    winner           BOOLEAN NOT NULL DEFAULT false,
+
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_camp_variants_camp_id; CREATE INDEX idx_camp_variants_camp_id ON campaign_variants(campaign_id);
+
+-- Subscribers sampled for each variant of a campaign.
+DROP TABLE IF EXISTS campaign_variant_subscribers CASCADE;
+CREATE TABLE campaign_variant_subscribers (
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    variant_id       INTEGER NOT NULL REFERENCES campaign_variants(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    PRIMARY KEY (campaign_id, subscriber_id)
+);
+DROP INDEX IF EXISTS idx_camp_variant_subs; CREATE INDEX idx_camp_variant_subs ON campaign_variant_subscribers(variant_id, subscriber_id);
+
+-- Per-subscriber delivery times of campaigns that aren't sent to everyone at once (send_mode != default).
+DROP TABLE IF EXISTS campaign_schedule CASCADE;
+CREATE TABLE campaign_schedule (
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+    -- The subscriber's time zone for send_mode=local.
+    timezone         TEXT NULL,
+    send_at          TIMESTAMP WITH TIME ZONE NOT NULL,
+    sent             BOOLEAN NOT NULL DEFAULT false,
+
+    PRIMARY KEY (campaign_id, subscriber_id)
+);
+DROP INDEX IF EXISTS idx_camp_schedule_send_at; CREATE INDEX idx_camp_schedule_send_at ON campaign_schedule(campaign_id, send_at) WHERE sent = false;
+
+-- sequences
+-- A sequence is an ordered set of (tx template) messages that are sent with delays to
+-- subscribers who join its list. Subscribers exit the sequence on unsubscribing from the
+-- list, on being blocklisted, or on joining any of its exit_list_ids.
+DROP TABLE IF EXISTS sequences CASCADE;
+CREATE TABLE sequences (
+    id               SERIAL PRIMARY KEY,
+    name             TEXT NOT NULL,
+    list_id          INTEGER NULL REFERENCES lists(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    status           sequence_status NOT NULL DEFAULT 'active',
+    exit_list_ids    INTEGER[] NOT NULL DEFAULT '{}',
+    from_email       TEXT NOT NULL,
+    messenger        TEXT NOT NULL,
+
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_sequences_list_id; CREATE INDEX idx_sequences_list_id ON sequences(list_id);
+
+DROP TABLE IF EXISTS sequence_steps CASCADE;
+CREATE TABLE sequence_steps (
+    id               SERIAL PRIMARY KEY,
+    sequence_id      INTEGER NOT NULL REFERENCES sequences(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    position         INTEGER NOT NULL,
+    template_id      INTEGER NOT NULL REFERENCES templates(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    content_type     content_type NOT NULL DEFAULT 'html',
+
+    -- Minutes to wait after the previous step (or joining the sequence) before sending.
+    delay_mins       INTEGER NOT NULL DEFAULT 0 CHECK (delay_mins >= 0),
+    sent             INTEGER NOT NULL DEFAULT 0,
+
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (sequence_id, position)
+);
+
+-- Progress of every subscriber in a sequence. position is that of the last step sent (0 = none).
+DROP TABLE IF EXISTS sequence_subscribers CASCADE;
+CREATE TABLE sequence_subscribers (
+    sequence_id      INTEGER NOT NULL REFERENCES sequences(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    status           sequence_subscriber_status NOT NULL DEFAULT 'active',
+    position         INTEGER NOT NULL DEFAULT 0,
+    last_sent_at     TIMESTAMP WITH TIME ZONE NULL,
+
+    -- Failed attempts to send the next step, and when it's (re)tried next. While a step
+    -- is being sent, retry_at is set ahead so that it isn't picked up again.
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    retry_at         TIMESTAMP WITH TIME ZONE NULL,
+
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (sequence_id, subscriber_id)
+);
+DROP INDEX IF EXISTS idx_seq_subs_status; CREATE INDEX idx_seq_subs_status ON sequence_subscribers(sequence_id, status);
+DROP INDEX IF EXISTS idx_seq_subs_subscriber_id; CREATE INDEX idx_seq_subs_subscriber_id ON sequence_subscribers(subscriber_id);
+
+-- segments
+-- A segment is a saved filter of subscribers defined by a tree of rules that's compiled
+-- to SQL. Its members are periodically materialized into segment_subscribers.
+DROP TABLE IF EXISTS segments CASCADE;
+CREATE TABLE segments (
+    id               SERIAL PRIMARY KEY,
+    name             TEXT NOT NULL,
+    description      TEXT NOT NULL DEFAULT '',
+    rules            JSONB NOT NULL DEFAULT '{}',
+    subscriber_count INTEGER NOT NULL DEFAULT 0,
+    refreshed_at     TIMESTAMP WITH TIME ZONE NULL,
+
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+DROP TABLE IF EXISTS segment_subscribers CASCADE;
+CREATE TABLE segment_subscribers (
+    segment_id       INTEGER NOT NULL REFERENCES segments(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    PRIMARY KEY (segment_id, subscriber_id)
+);
+DROP INDEX IF EXISTS idx_seg_subs_subscriber_id; CREATE INDEX idx_seg_subs_subscriber_id ON segment_subscribers(subscriber_id);
+
 -- media
 DROP TABLE IF EXISTS media CASCADE;
 CREATE TABLE media (
@@ -243,6 +419,20 @@ INSERT INTO settings (key, value) VALUES
     ('app.check_updates', 'true'),
     ('app.notify_emails', '[]'),
     ('app.lang', '"en"'),
+    ('app.default_timezone', '"UTC"'),
+    ('app.messenger_limits', '[]'),
+    ('app.retry_max_attempts', '5'),
+    ('app.retry_backoff', '"5m"'),
+    ('app.delivery_log', 'false'),
+    ('app.delivery_log_retention', '30'),
+    ('app.campaign_approval', 'false'),
+    ('app.segment_refresh_interval', '"1h"'),
+    ('app.engagement_half_life', '30'),
+    ('app.sunset_enabled', 'false'),
+    ('app.sunset_campaigns', '0'),
+    ('app.sunset_days', '0'),
+    ('app.sunset_action', '"unsubscribe"'),
+    ('app.sunset_list_id', '0'),
     ('privacy.individual_tracking', 'false'),
     ('privacy.unsubscribe_header', 'true'),
     ('privacy.allow_blocklist', 'true'),
@@ -256,7 +446,14 @@ INSERT INTO settings (key, value) VALUES
     ('security.enable_captcha', 'false'),
     ('security.captcha_key', '""'),
     ('security.captcha_secret', '""'),
-    ('security.oidc', '{"enabled": false, "provider_url": "", "provider_name": "", "client_id": "", "client_secret": ""}'),
+    ('security.audit_log_retention', '90'),
+    ('security.totp_required', '"off"'),
+    ('security.totp_required_roles', '[]'),
+    ('security.login_max_attempts', '5'),
+    ('security.login_max_ip_attempts', '20'),
+    ('security.login_lockout_duration', '"15m"'),
+    ('security.oidc', '{"enabled": false, "provider_url": "", "provider_name": "", "client_id": "", "client_secret": "", "auto_create_users": false, "default_user_role_id": 0, "role_mappings": []}'),
+    ('security.saml', '{"enabled": false, "provider_name": "", "idp_metadata_url": "", "idp_metadata": "", "sp_certificate": "", "sp_private_key": "", "attr_email": "email", "attr_name": "name", "attr_groups": "groups", "auto_create_users": false, "default_user_role_id": 0, "role_mappings": []}'),
     ('upload.provider', '"filesystem"'),
     ('upload.max_file_size', '5000'),
     ('upload.extensions', '["jpg","jpeg","png","gif","svg","*"]'),
@@ -291,6 +488,28 @@ INSERT INTO settings (key, value) VALUES
     ('appearance.public.custom_css', '""'),
     ('appearance.public.custom_js', '""');
 
+-- warm-up state of SMTP servers (settings.smtp[].uuid) that have a warm-up schedule.
+-- The ceiling of a day is as per the number of days since started_on, and sent is
+-- the number of messages sent on the day.
+DROP TABLE IF EXISTS smtp_warmup CASCADE;
+CREATE TABLE smtp_warmup (
+    uuid            TEXT NOT NULL PRIMARY KEY,
+    started_on      DATE NOT NULL DEFAULT CURRENT_DATE,
+    day             DATE NOT NULL DEFAULT CURRENT_DATE,
+    sent            INTEGER NOT NULL DEFAULT 0,
+    updated_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- message counts of the current cap windows of campaign (campaign:<id>) and messenger
+-- (messenger:<name>) send limits so that the caps hold across restarts.
+DROP TABLE IF EXISTS send_limits CASCADE;
+CREATE TABLE send_limits (
+    key             TEXT NOT NULL PRIMARY KEY,
+    window_start    TIMESTAMP WITH TIME ZONE NOT NULL,
+    sent            INTEGER NOT NULL DEFAULT 0,
+    updated_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
 -- bounces
 DROP TABLE IF EXISTS bounces CASCADE;
 CREATE TABLE bounces (
@@ -307,6 +526,45 @@ DROP INDEX IF EXISTS idx_bounces_camp_id; CREATE INDEX idx_bounces_camp_id ON bo
 DROP INDEX IF EXISTS idx_bounces_source; CREATE INDEX idx_bounces_source ON bounces(source);
 DROP INDEX IF EXISTS idx_bounces_date; CREATE INDEX idx_bounces_date ON bounces((TIMEZONE('UTC', created_at)::DATE));
 
+-- deferred deliveries
+-- Campaign messages that failed to send, which are retried with a backoff until
+-- they're sent (and deleted) or have run out of attempts (failed).
+DROP TABLE IF EXISTS deferred_deliveries CASCADE;
+CREATE TABLE deferred_deliveries (
+    id               BIGSERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    variant_id       INTEGER NULL REFERENCES campaign_variants(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    messenger        TEXT NOT NULL,
+    error            TEXT NOT NULL DEFAULT '',
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    status           deferred_status NOT NULL DEFAULT 'pending',
+    next_retry_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (campaign_id, subscriber_id)
+);
+DROP INDEX IF EXISTS idx_deferred_status; CREATE INDEX idx_deferred_status ON deferred_deliveries(status, next_retry_at);
+DROP INDEX IF EXISTS idx_deferred_sub_id; CREATE INDEX idx_deferred_sub_id ON deferred_deliveries(subscriber_id);
+
+-- deliveries
+-- Optional per-recipient delivery log of campaign messages.
+DROP TABLE IF EXISTS deliveries CASCADE;
+CREATE TABLE deliveries (
+    id               BIGSERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    messenger        TEXT NOT NULL,
+    server           TEXT NOT NULL DEFAULT '',
+    response         TEXT NOT NULL DEFAULT '',
+    status           delivery_status NOT NULL,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (campaign_id, subscriber_id)
+);
+DROP INDEX IF EXISTS idx_deliveries_sub_id; CREATE INDEX idx_deliveries_sub_id ON deliveries(subscriber_id);
+DROP INDEX IF EXISTS idx_deliveries_updated_at; CREATE INDEX idx_deliveries_updated_at ON deliveries(updated_at);
+
 -- roles
 DROP TABLE IF EXISTS roles CASCADE;
 CREATE TABLE roles (
@@ -336,11 +594,43 @@ CREATE TABLE users (
     user_role_id     INTEGER NOT NULL REFERENCES roles(id) ON DELETE RESTRICT,
     list_role_id     INTEGER NULL REFERENCES roles(id) ON DELETE CASCADE,
     status           user_status NOT NULL DEFAULT 'disabled',
+
+    -- TOTP two-factor authentication. The secret is set on enrolment and
+    -- the recovery codes are stored as SHA256 hashes. The time step of the last
+    -- accepted code is kept so that a code can't be used twice, and failed codes
+    -- are counted to limit guessing.
+    totp_secret          TEXT NULL,
+    totp_enabled         BOOLEAN NOT NULL DEFAULT false,
+    totp_recovery_codes  TEXT[] NOT NULL DEFAULT '{}',
+    totp_last_step       BIGINT NOT NULL DEFAULT 0,
+    totp_failures        INTEGER NOT NULL DEFAULT 0,
+    totp_failed_at       TIMESTAMP WITH TIME ZONE NULL,
+
     loggedin_at      TIMESTAMP WITH TIME ZONE NULL,
     created_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at       TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- api tokens
+-- Named tokens of API users, each with a subset of the user's permissions and an optional list scope.
+-- Tokens are stored as SHA-256 hashes. The prefix helps identify a token without revealing it.
+DROP TABLE IF EXISTS api_tokens CASCADE;
+CREATE TABLE api_tokens (
+    id               SERIAL PRIMARY KEY,
+    user_id          INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    name             TEXT NOT NULL,
+    token_hash       TEXT NOT NULL UNIQUE,
+    token_prefix     TEXT NOT NULL,
+    permissions      TEXT[] NOT NULL DEFAULT '{}',
+    list_ids         INTEGER[] NOT NULL DEFAULT '{}',
+    expires_at       TIMESTAMP WITH TIME ZONE NULL,
+    last_used_at     TIMESTAMP WITH TIME ZONE NULL,
+    last_used_ip     TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_api_tokens_user_id; CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
+
 -- user sessions
 DROP TABLE IF EXISTS sessions CASCADE;
 CREATE TABLE sessions (
@@ -350,6 +640,108 @@ CREATE TABLE sessions (
 );
 DROP INDEX IF EXISTS idx_sessions; CREATE INDEX idx_sessions ON sessions (id, created_at);
 
+-- password resets
+-- Log of password reset requests. Tokens are stored as SHA-256 hashes and are single-use.
+-- Requests for unknown e-mails are logged without a user and a token for rate-limiting.
+DROP TABLE IF EXISTS password_resets CASCADE;
+CREATE TABLE password_resets (
+    id               BIGSERIAL PRIMARY KEY,
+    user_id          INTEGER NULL REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    email            TEXT NOT NULL,
+    token_hash       TEXT NULL UNIQUE,
+    ip               TEXT NOT NULL DEFAULT '',
+    expires_at       TIMESTAMP WITH TIME ZONE NULL,
+    used_at          TIMESTAMP WITH TIME ZONE NULL,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_password_resets_created_at; CREATE INDEX idx_password_resets_created_at ON password_resets(created_at);
+
+-- failed login attempts and lockouts of usernames and IPs (type), persisted so that they
+-- hold across restarts. attempts is a JSON array of the timestamps of the recent failures.
+DROP TABLE IF EXISTS login_failures CASCADE;
+CREATE TABLE login_failures (
+    type             TEXT NOT NULL,
+    key              TEXT NOT NULL,
+    attempts         JSONB NOT NULL DEFAULT '[]',
+    locked_until     TIMESTAMP WITH TIME ZONE NULL,
+    updated_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (type, key)
+);
+
+-- campaign approvals
+DROP TABLE IF EXISTS campaign_approvals CASCADE;
+CREATE TABLE campaign_approvals (
+    id               BIGSERIAL PRIMARY KEY,
+    campaign_id      INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    user_id          INTEGER NULL REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    action           approval_action NOT NULL,
+    note             TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_camp_approvals_camp_id; CREATE INDEX idx_camp_approvals_camp_id ON campaign_approvals(campaign_id);
+
+-- content revisions of campaigns and templates
+DROP TABLE IF EXISTS revisions CASCADE;
+CREATE TABLE revisions (
+    id               BIGSERIAL PRIMARY KEY,
+    campaign_id      INTEGER NULL REFERENCES campaigns(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    template_id      INTEGER NULL REFERENCES templates(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    user_id          INTEGER NULL REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+    -- Fields that were changed in the revision and the full state of the fields after the change.
+    fields           TEXT[] NOT NULL DEFAULT '{}',
+    data             JSONB NOT NULL DEFAULT '{}',
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CHECK ((campaign_id IS NULL) != (template_id IS NULL))
+);
+DROP INDEX IF EXISTS idx_revisions_camp_id; CREATE INDEX idx_revisions_camp_id ON revisions(campaign_id) WHERE campaign_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_revisions_tpl_id; CREATE INDEX idx_revisions_tpl_id ON revisions(template_id) WHERE template_id IS NOT NULL;
+
+-- subscriber events
+-- History of changes to subscribers and their subscriptions that aren't recorded
+-- elsewhere, eg: unsubscriptions, blocklisting, and admin edits, and who made them.
+DROP TABLE IF EXISTS subscriber_events CASCADE;
+CREATE TABLE subscriber_events (
+    id               BIGSERIAL PRIMARY KEY,
+    subscriber_id    INTEGER NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    type             subscriber_event_type NOT NULL,
+
+    -- admin (user_id is the user who made the change) or subscriber (on the public pages).
+    source           TEXT NOT NULL DEFAULT '',
+    user_id          INTEGER NULL REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    campaign_id      INTEGER NULL REFERENCES campaigns(id) ON DELETE SET NULL ON UPDATE CASCADE,
+    meta             JSONB NOT NULL DEFAULT '{}',
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_sub_events_sub_id; CREATE INDEX idx_sub_events_sub_id ON subscriber_events(subscriber_id, created_at);
+
+-- audit log
+-- Record of the changes made by users via the API.
+DROP TABLE IF EXISTS audit_log CASCADE;
+CREATE TABLE audit_log (
+    id               BIGSERIAL PRIMARY KEY,
+    user_id          INTEGER NULL REFERENCES users(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+    -- The username is kept as users may be deleted.
+    username         TEXT NOT NULL DEFAULT '',
+    ip               TEXT NOT NULL DEFAULT '',
+    method           TEXT NOT NULL,
+    path             TEXT NOT NULL,
+    action           TEXT NOT NULL,
+    entity_type      TEXT NOT NULL DEFAULT '',
+    entity_id        TEXT NOT NULL DEFAULT '',
+    status           INTEGER NOT NULL DEFAULT 0,
+
+    -- Summaries of the state of the entity before and after the change.
+    before           JSONB NULL,
+    after            JSONB NULL,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+DROP INDEX IF EXISTS idx_audit_log_created_at; CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+DROP INDEX IF EXISTS idx_audit_log_entity; CREATE INDEX idx_audit_log_entity ON audit_log(entity_type, entity_id);
+DROP INDEX IF EXISTS idx_audit_log_user_id; CREATE INDEX idx_audit_log_user_id ON audit_log(user_id);
+
 -- materialized views
 
 -- dashboard stats